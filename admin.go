@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// AddProvider registers a new provider with fresh stats. It becomes
+// selectable for the next lookup.
+func (b *Broker) AddProvider(p Provider) {
+	ps := b.newProviderStats(p)
+
+	b.providerMutex.Lock()
+	defer b.providerMutex.Unlock()
+
+	// Copy on write so rankings taken before the change stay intact
+	providers := make([]*ProviderStats, 0, len(b.providers)+1)
+	providers = append(providers, b.providers...)
+	b.providers = append(providers, ps)
+}
+
+// RemoveProvider takes the named provider out of service. Lookups already
+// using it finish normally; new lookups no longer consider it. Call
+// DrainProvider first to wait for those lookups.
+func (b *Broker) RemoveProvider(name string) error {
+	b.providerMutex.Lock()
+	defer b.providerMutex.Unlock()
+
+	for i, ps := range b.providers {
+		if ps.provider.Name() != name {
+			continue
+		}
+
+		providers := make([]*ProviderStats, 0, len(b.providers)-1)
+		providers = append(providers, b.providers[:i]...)
+		b.providers = append(providers, b.providers[i+1:]...)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+}
+
+// findProvider returns the stats for the named provider, or nil if no such
+// provider is registered
+func (b *Broker) findProvider(name string) *ProviderStats {
+	b.providerMutex.RLock()
+	defer b.providerMutex.RUnlock()
+
+	for _, ps := range b.providers {
+		if ps.provider.Name() == name {
+			return ps
+		}
+	}
+	return nil
+}
+
+// SetProviderEnabled benches or reinstates the named provider. A disabled
+// provider keeps its stats but is skipped during selection.
+func (b *Broker) SetProviderEnabled(name string, enabled bool) error {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	ps.mutex.Lock()
+	ps.enabled = enabled
+	ps.mutex.Unlock()
+	return nil
+}
+
+// Snapshot returns a copy of the named provider's current metrics, including
+// the number of requests the broker has sent it this minute
+func (b *Broker) Snapshot(name string) (ProviderSnapshot, error) {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return ProviderSnapshot{}, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return ps.fullSnapshot(), nil
+}
+
+// ResetStats clears the error history, response times and request counters
+// of every provider. Rate limiter state is kept so upstream limits are still
+// honored.
+func (b *Broker) ResetStats() {
+	b.providerMutex.RLock()
+	providers := b.providers
+	b.providerMutex.RUnlock()
+
+	for _, ps := range providers {
+		ps.reset()
+	}
+}
+
+// ResetProviderStats clears the stats of the named provider, e.g. after an
+// upstream outage has been fixed
+func (b *Broker) ResetProviderStats(name string) error {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	ps.reset()
+	return nil
+}
+
+// reset clears the provider's quality metrics and closes its circuit.
+// In-flight requests record into the fresh stats when they finish.
+func (ps *ProviderStats) reset() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.errorsInLast5Min = make([]time.Time, 0)
+	ps.requestsInWindow = make([]time.Time, 0)
+	ps.errorEWMA = ewma{}
+	ps.latencyEWMA = ewma{}
+	ps.requestsThisMinute = 0
+	ps.requestsMinuteReset = time.Now()
+	ps.totalRequests = 0
+	ps.completedRequests = 0
+	ps.breaker.consecutiveFailures = 0
+	ps.setBreakerState(BreakerClosed)
+	ps.quarantine.until = time.Time{}
+
+	ps.responseTimesMutex.Lock()
+	ps.responseTimes.reset()
+	ps.responseTimesMutex.Unlock()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// outageBroker has a fast provider whose first three lookups failed and a
+// slower one that never failed
+func outageBroker(t *testing.T, opts ...BrokerOption) *Broker {
+	t.Helper()
+	fast := NewMockProvider("fast", 0, MockLatency(time.Millisecond), MockFailCalls(1, 3, nil))
+	slow := NewMockProvider("slow", 0, MockLatency(10*time.Millisecond))
+	b := NewBroker([]Provider{fast, slow}, append(opts, WithStrategy(&ScoreStrategy{}))...)
+	t.Cleanup(func() { b.Close() })
+
+	for i := range 3 {
+		if _, err := b.GetLocationFrom(context.Background(), "fast", testIP(i)); err == nil {
+			t.Fatal("scripted failure succeeded")
+		}
+		if _, err := b.GetLocationFrom(context.Background(), "slow", testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ps := b.selectBestProvider(testIP(3)); ps.provider.Name() != "slow" {
+		t.Fatalf("%s selected during the outage, want slow", ps.provider.Name())
+	}
+	return b
+}
+
+func TestResetProviderStats(t *testing.T) {
+	// Without samples the reset provider is scored on the prior latency,
+	// which here is faster than slow's
+	b := outageBroker(t, WithColdStart(5, 0, time.Millisecond))
+	if err := b.ResetProviderStats("fast"); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := b.Snapshot("fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.ErrorsInWindow != 0 || snap.ErrorRate != 0 || snap.TotalRequests != 0 || snap.BreakerState != BreakerClosed {
+		t.Errorf("after a reset: %d errors, rate %v, %d requests, breaker %v",
+			snap.ErrorsInWindow, snap.ErrorRate, snap.TotalRequests, snap.BreakerState)
+	}
+	if ps := b.selectBestProvider(testIP(3)); ps.provider.Name() != "fast" {
+		t.Errorf("%s selected after the reset, want fast", ps.provider.Name())
+	}
+	// The other provider keeps its history
+	if snap, _ := b.Snapshot("slow"); snap.TotalRequests != 3 {
+		t.Errorf("slow has %d requests after resetting fast, want 3", snap.TotalRequests)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	b := outageBroker(t)
+	b.ResetStats()
+	for _, snap := range b.Stats() {
+		if snap.TotalRequests != 0 || snap.ErrorsInWindow != 0 || snap.AvgResponseTime != 0 {
+			t.Errorf("%s after a reset: %d requests, %d errors, mean %v", snap.Name, snap.TotalRequests, snap.ErrorsInWindow, snap.AvgResponseTime)
+		}
+	}
+}
+
+func TestResetStatsKeepsUpstreamLimit(t *testing.T) {
+	limited := &ErrRateLimited{Provider: "mock", Err: fmt.Errorf("%w: monthly quota used up", ErrProviderRateLimited), RetryAfter: time.Hour}
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 1, limited))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+	b.GetLocation(context.Background(), testIP(0))
+
+	b.ResetStats()
+	if err := b.ResetProviderStats("mock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetLocation(context.Background(), testIP(1)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Errorf("got %v after a reset, want the upstream limit still honored", err)
+	}
+	if n := p.Calls(); n != 1 {
+		t.Errorf("provider called %d times, want only before the limit", n)
+	}
+}
+
+func TestResetProviderStatsUnknown(t *testing.T) {
+	b := NewBroker([]Provider{NewMockProvider("mock", 0)})
+	defer b.Close()
+	if err := b.ResetProviderStats("nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("got %v, want ErrUnknownProvider", err)
+	}
+}
+
+func TestResetStatsInFlight(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("mock", 0, MockGate(gate))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	result := make(chan error)
+	go func() {
+		_, err := b.GetLocation(context.Background(), testIP(0))
+		result <- err
+	}()
+	for p.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.ResetStats()
+	close(gate)
+
+	// The lookup finishes normally and records into the fresh stats
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.InFlight != 0 || snap.CompletedRequests != 1 {
+		t.Errorf("%d in flight, %d completed; want 0, 1", snap.InFlight, snap.CompletedRequests)
+	}
+}
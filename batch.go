@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchProvider is implemented by providers with an endpoint that resolves
+// many IPs in one request. GetLocations returns slices indexed like ips; a
+// failure of the whole request sets the same error for every IP. The broker
+// uses it for GetLocations when the best provider supports it. Providers
+// wrapped in middleware are always called per IP, so the middleware sees
+// every lookup.
+type BatchProvider interface {
+	Provider
+	GetLocations(ctx context.Context, ips []string) ([]*Location, []error)
+	// MaxBatchSize returns how many IPs one request may carry; zero or less
+	// means any number
+	MaxBatchSize() int
+}
+
+// BatchQuotaReporter can be implemented by a BatchProvider whose service
+// limits batch requests separately from single lookups. While it reports
+// none remaining the broker sends no batches and looks the IPs up one at a
+// time instead.
+type BatchQuotaReporter interface {
+	BatchQuota() (remaining int, resetAt time.Time, ok bool)
+}
+
+// GetLocations resolves many IPs. When the best provider is a BatchProvider
+// the IPs not answered from the cache are sent to it in chunks of its batch
+// size. Every other IP, including those the batch failed for, is looked up
+// on its own, running up to the configured batch concurrency lookups at
+// once. Each of these goes through the normal selection path, so rate limits
+// are respected and load spreads across providers as capacity is used up.
+// Duplicate IPs are looked up once. The returned slices are indexed like ips;
+// a failed lookup leaves its location nil and sets its error without
+// affecting the rest of the batch.
+func (b *Broker) GetLocations(ctx context.Context, ips []string, opts ...CallOption) ([]*Location, []error) {
+	locations := make([]*Location, len(ips))
+	errs := make([]error, len(ips))
+
+	// Group positions by IP so duplicates share a lookup
+	positions := make(map[string][]int)
+	unique := make([]string, 0, len(ips))
+	for i, ip := range ips {
+		if _, ok := positions[ip]; !ok {
+			unique = append(unique, ip)
+		}
+		positions[ip] = append(positions[ip], i)
+	}
+
+	store := func(ip string, location *Location, err error) {
+		for n, i := range positions[ip] {
+			errs[i] = err
+			if location != nil {
+				// Every position gets its own copy
+				if n > 0 {
+					location = copyLocation(location)
+				}
+				locations[i] = location
+			}
+		}
+	}
+
+	var co callOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+	if ps, batcher := b.batchProvider(unique, co); batcher != nil {
+		unique = b.lookupBatch(ctx, ps, batcher, unique, co, store)
+		// The cache was already consulted for what's left
+		opts = append(opts[:len(opts):len(opts)], NoCache())
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < min(b.batchConcurrency, len(unique)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range work {
+				location, err := b.GetLocation(ctx, ip, opts...)
+				store(ip, location, err)
+			}
+		}()
+	}
+
+	for _, ip := range unique {
+		work <- ip
+	}
+	close(work)
+	wg.Wait()
+
+	return locations, errs
+}
+
+// batchProvider returns the best provider for ips if it implements
+// BatchProvider and has batch requests left. Calls routed in a special way
+// never use one.
+func (b *Broker) batchProvider(ips []string, co callOptions) (*ProviderStats, BatchProvider) {
+	if len(ips) < 2 || co.provider != "" || co.race || b.consensus.voters > 1 {
+		return nil, nil
+	}
+	ps := b.selectBestProvider(ips[0])
+	if ps == nil {
+		return nil, nil
+	}
+	batcher, ok := ps.provider.(BatchProvider)
+	if !ok {
+		return nil, nil
+	}
+	if reporter, ok := batcher.(BatchQuotaReporter); ok {
+		if remaining, _, ok := reporter.BatchQuota(); ok && remaining == 0 {
+			return nil, nil
+		}
+	}
+	return ps, batcher
+}
+
+// lookupBatch answers what it can of ips from the cache and sends the rest
+// to the batch provider, passing each result to store. It returns the IPs
+// still to be looked up one at a time: those the batch failed for, other
+// than addresses the provider can't locate, and any left once the provider
+// runs out of capacity.
+func (b *Broker) lookupBatch(ctx context.Context, ps *ProviderStats, batcher BatchProvider, ips []string, co callOptions, store func(ip string, location *Location, err error)) []string {
+	if !b.acquire() {
+		for _, ip := range ips {
+			store(ip, nil, ErrBrokerClosed)
+		}
+		return nil
+	}
+	defer b.release()
+
+	// Batches carry canonical addresses; results go back under each of the
+	// caller's spellings
+	var misses []string
+	spellings := make(map[string][]string)
+	for _, ip := range ips {
+		addr, err := parseIP(ip)
+		if err != nil {
+			store(ip, nil, err)
+			continue
+		}
+		if location, ok, err := b.reserved(addr); ok {
+			if location != nil {
+				location = b.resultIP(location, ip)
+			}
+			store(ip, location, err)
+			continue
+		}
+		if location, ok, err := b.fromCache(ctx, addr, co); ok {
+			if location != nil {
+				location = b.resultIP(location, ip)
+			}
+			store(ip, location, err)
+			continue
+		}
+		canonical := addr.String()
+		if _, ok := spellings[canonical]; !ok {
+			misses = append(misses, canonical)
+		}
+		spellings[canonical] = append(spellings[canonical], ip)
+	}
+
+	var remaining []string
+	size := batcher.MaxBatchSize()
+	if size <= 0 {
+		size = len(misses)
+	}
+	for start := 0; start < len(misses); start += size {
+		chunk := misses[start:min(start+size, len(misses))]
+		locations, errs := b.attemptBatch(ctx, ps, batcher, chunk)
+		failed := 0
+		for i, canonical := range chunk {
+			err := errs[i]
+			if err != nil && !errors.Is(err, ErrProviderInvalidIP) {
+				failed++
+				remaining = append(remaining, spellings[canonical]...)
+				continue
+			}
+			addr, _ := parseIP(canonical)
+			b.remember(ctx, addr, co, locations[i], err)
+			for n, ip := range spellings[canonical] {
+				location := locations[i]
+				if location != nil {
+					if n > 0 {
+						location = copyLocation(location)
+					}
+					location.IP = canonical
+					location = b.resultIP(location, ip)
+				}
+				store(ip, location, err)
+			}
+		}
+		if failed == len(chunk) {
+			// Don't keep sending batches to a provider that is failing or
+			// out of capacity
+			for _, canonical := range misses[start+len(chunk):] {
+				remaining = append(remaining, spellings[canonical]...)
+			}
+			break
+		}
+	}
+	return remaining
+}
+
+// attemptBatch sends one batch request to ps and records its metrics like
+// attempt does for a single lookup. The request counts once against the
+// provider's rate limit, or once per IP with WithBatchCountPerIP; every IP
+// counts against the daily and monthly quotas either way. The provider's
+// health is judged on the request as a whole: it failed only if every IP
+// failed for a reason other than being unlocatable. The returned slices are
+// indexed like ips and every error names the provider.
+func (b *Broker) attemptBatch(ctx context.Context, ps *ProviderStats, batcher BatchProvider, ips []string) ([]*Location, []error) {
+	name := ps.provider.Name()
+	locations := make([]*Location, len(ips))
+	errs := make([]error, len(ips))
+	fail := func(err error) ([]*Location, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return locations, errs
+	}
+
+	if err := ps.acquireSlot(ctx); err != nil {
+		return fail(err)
+	}
+	defer ps.releaseSlot()
+
+	startTime := time.Now()
+	requests := 1
+	if b.batchCountPerIP {
+		requests = len(ips)
+	}
+	if err := ps.admit(requests, len(ips), false); err != nil {
+		return fail(err)
+	}
+	defer ps.finishCall()
+	b.tierUsage.add(ps.costTier, requests, time.Now())
+	for _, ip := range ips {
+		b.observe(func(o Observer) { o.OnProviderSelected(Attempt{IP: ip, Provider: name}) })
+	}
+
+	callCtx := ctx
+	if ps.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, ps.timeout)
+		defer cancel()
+	}
+
+	results, resultErrs := batcher.GetLocations(callCtx, ips)
+	if len(results) != len(ips) || len(resultErrs) != len(ips) {
+		// Nothing can be matched up with its address
+		err := fmt.Errorf("%w: %d results and %d errors for %d addresses", ErrBadProviderData, len(results), len(resultErrs), len(ips))
+		results, resultErrs = make([]*Location, len(ips)), make([]error, len(ips))
+		for i := range resultErrs {
+			resultErrs[i] = err
+		}
+	}
+
+	responseTime := time.Since(startTime)
+	var requestErr error
+	failed, answered := 0, 0
+	for i, ip := range ips {
+		err := resultErrs[i]
+		if err == nil {
+			err = b.validate(ip, results[i])
+		}
+		if err != nil {
+			errs[i] = &UpstreamError{Provider: name, Err: err}
+			if errors.Is(err, ErrProviderInvalidIP) {
+				answered++
+			} else {
+				failed++
+				requestErr = errs[i]
+			}
+			continue
+		}
+		answered++
+		results[i].Provider = name
+		results[i].Latency = responseTime
+		results[i].RetrievedAt = startTime.Add(responseTime)
+		results[i].Confidence = b.confidence.live(ps)
+		locations[i] = results[i]
+	}
+
+	if requestErr != nil && ctx.Err() != nil {
+		// The caller gave up; that says nothing about the provider
+		ps.mutex.Lock()
+		ps.breakerAbandoned()
+		ps.mutex.Unlock()
+	} else {
+		ps.recordResponseTime(responseTime)
+		if failed < len(ips) {
+			requestErr = nil
+		}
+		ps.recordCallOutcome(requestErr, false)
+		if requestErr == nil {
+			b.useMonthlyQuota(ps, answered)
+		}
+	}
+
+	for i, ip := range ips {
+		attempt := Attempt{IP: ip, Provider: name, Latency: responseTime, Err: errs[i]}
+		if attempt.Err != nil {
+			b.observe(func(o Observer) { o.OnError(attempt) })
+		} else {
+			b.observe(func(o Observer) { o.OnSuccess(attempt) })
+		}
+	}
+	return locations, errs
+}
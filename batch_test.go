@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// mockBatcher is a BatchProvider answering batches of up to size IPs from
+// canned results. Single lookups go to the embedded MockProvider, so its
+// Calls count only those.
+type mockBatcher struct {
+	*MockProvider
+	size int
+
+	mutex   sync.Mutex
+	batches [][]string
+	failAll error            // fails whole requests when set
+	failIP  map[string]error // fails single IPs within a batch
+}
+
+func newMockBatcher(name string, size int) *mockBatcher {
+	return &mockBatcher{MockProvider: NewMockProvider(name, 0), size: size, failIP: make(map[string]error)}
+}
+
+func (p *mockBatcher) GetLocations(ctx context.Context, ips []string) ([]*Location, []error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.batches = append(p.batches, slices.Clone(ips))
+
+	locations := make([]*Location, len(ips))
+	errs := make([]error, len(ips))
+	for i, ip := range ips {
+		switch {
+		case p.failAll != nil:
+			errs[i] = p.failAll
+		case p.failIP[ip] != nil:
+			errs[i] = p.failIP[ip]
+		default:
+			locations[i] = &Location{IP: ip, Country: "ZZ", City: "batch"}
+		}
+	}
+	return locations, errs
+}
+
+func (p *mockBatcher) MaxBatchSize() int {
+	return p.size
+}
+
+// sent returns the batches the provider has received
+func (p *mockBatcher) sent() [][]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return slices.Clone(p.batches)
+}
+
+func TestGetLocationsBatchQuota(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  BrokerOption
+	}{
+		{"daily", WithDailyQuota("batch", 10)},
+		{"monthly", WithMonthlyQuota("batch", 10, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newMockBatcher("batch", 100)
+			b := NewBroker([]Provider{p}, tt.opt)
+			defer b.Close()
+
+			ips := make([]string, 8)
+			for i := range ips {
+				ips[i] = testIP(i)
+			}
+			if _, errs := b.GetLocations(context.Background(), ips); slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+				t.Fatalf("first batch: %v", errs)
+			}
+
+			// Another eight don't fit in what is left, so the batch isn't
+			// sent and single lookups use up the rest
+			for i := range ips {
+				ips[i] = testIP(100 + i)
+			}
+			_, errs := b.GetLocations(context.Background(), ips)
+			failed := 0
+			for _, err := range errs {
+				if err != nil {
+					if !errors.Is(err, ErrNoProviderAvailable) {
+						t.Errorf("got %v, want ErrNoProviderAvailable", err)
+					}
+					failed++
+				}
+			}
+			if failed != 6 {
+				t.Errorf("%d of 8 lookups failed, want the 6 past the quota", failed)
+			}
+			if n := len(p.sent()); n != 1 {
+				t.Errorf("%d batches sent, want only the first", n)
+			}
+			if n := p.Calls(); n != 2 {
+				t.Errorf("%d single lookups, want the 2 left in the quota", n)
+			}
+		})
+	}
+}
+
+func TestGetLocationsChunks(t *testing.T) {
+	p := newMockBatcher("batch", 3)
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	ips := make([]string, 8)
+	for i := range ips {
+		ips[i] = testIP(i)
+	}
+	locations, errs := b.GetLocations(context.Background(), ips)
+
+	// In order, matched to the input
+	for i, ip := range ips {
+		if errs[i] != nil {
+			t.Fatalf("%s: %v", ip, errs[i])
+		}
+		if locations[i].IP != ip || locations[i].City != "batch" {
+			t.Errorf("position %d: got %+v, want the batch result for %s", i, locations[i], ip)
+		}
+	}
+	sent := p.sent()
+	var sizes []int
+	for _, batch := range sent {
+		sizes = append(sizes, len(batch))
+	}
+	if !slices.Equal(sizes, []int{3, 3, 2}) {
+		t.Errorf("batches of %v, want chunks of at most 3", sizes)
+	}
+	if got := slices.Concat(sent...); !slices.Equal(got, ips) {
+		t.Errorf("sent %v, want %v", got, ips)
+	}
+	if n := p.Calls(); n != 0 {
+		t.Errorf("%d single lookups, want everything batched", n)
+	}
+}
+
+func TestGetLocationsPerIPErrors(t *testing.T) {
+	p := newMockBatcher("batch", 10)
+	p.failIP[testIP(1)] = ErrProviderInvalidIP
+	p.failIP[testIP(3)] = ErrProviderUnavailable
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	ips := []string{testIP(0), testIP(1), testIP(2), testIP(3), testIP(1)}
+	locations, errs := b.GetLocations(context.Background(), ips)
+
+	for _, i := range []int{0, 2} {
+		if errs[i] != nil || locations[i] == nil || locations[i].IP != ips[i] {
+			t.Errorf("position %d: got %+v, %v, want a location", i, locations[i], errs[i])
+		}
+	}
+	// An unlocatable address is an answer, shared by its duplicate
+	for _, i := range []int{1, 4} {
+		if !errors.Is(errs[i], ErrProviderInvalidIP) || locations[i] != nil {
+			t.Errorf("position %d: got %+v, %v, want ErrProviderInvalidIP", i, locations[i], errs[i])
+		}
+	}
+	// Any other failure is retried on its own, here successfully
+	if errs[3] != nil || locations[3] == nil || locations[3].IP != ips[3] {
+		t.Errorf("position 3: got %+v, %v, want the single lookup's location", locations[3], errs[3])
+	}
+	if n := p.CallsFor(testIP(3)); n != 1 {
+		t.Errorf("%d single lookups of the failed IP, want 1", n)
+	}
+	if n := p.Calls(); n != 1 {
+		t.Errorf("%d single lookups, want only the failed IP", n)
+	}
+}
+
+func TestGetLocationsBatchFailure(t *testing.T) {
+	p := newMockBatcher("batch", 2)
+	p.failAll = fmt.Errorf("%w: batch endpoint down", ErrProviderUnavailable)
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	ips := []string{testIP(0), testIP(1), testIP(2), testIP(3), testIP(4)}
+	locations, errs := b.GetLocations(context.Background(), ips)
+	for i, ip := range ips {
+		if errs[i] != nil || locations[i] == nil || locations[i].IP != ip {
+			t.Errorf("%s: got %+v, %v, want the single lookup's location", ip, locations[i], errs[i])
+		}
+		if n := p.CallsFor(ip); n != 1 {
+			t.Errorf("%s looked up %d times on its own, want 1", ip, n)
+		}
+	}
+	// A failing provider isn't sent the remaining chunks
+	if n := len(p.sent()); n != 1 {
+		t.Errorf("%d batches sent, want to stop after the first failed", n)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// BreakerState is the state of a provider's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all requests until the cooldown has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe request through to test recovery
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig controls when a provider's circuit opens. A zero
+// threshold disables that trigger; a zero config disables the breaker.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures opens the circuit after this many failures in a row
+	ConsecutiveFailures int
+	// MaxErrorsInWindow opens the circuit once the provider has this many
+	// errors inside the stats window. Only used in raw stats window mode.
+	MaxErrorsInWindow int
+	// Cooldown is how long the circuit stays open before a probe is allowed
+	Cooldown time.Duration
+}
+
+// enabled reports whether any trigger is configured
+func (c CircuitBreakerConfig) enabled() bool {
+	return c.ConsecutiveFailures > 0 || c.MaxErrorsInWindow > 0
+}
+
+// circuitBreaker holds the breaker state for one provider. It is guarded by
+// the owning ProviderStats' mutex.
+type circuitBreaker struct {
+	config              CircuitBreakerConfig
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	probeInFlight       bool
+}
+
+// currentState returns the breaker state, moving an open circuit to
+// half-open once its cooldown has elapsed. The caller must hold ps.mutex.
+func (ps *ProviderStats) currentState() BreakerState {
+	cb := &ps.breaker
+	if cb.state == BreakerOpen && time.Since(cb.openedAt) >= cb.config.Cooldown {
+		cb.state = BreakerHalfOpen
+		cb.probeInFlight = false
+	}
+	return cb.state
+}
+
+// breakerAllows reports whether selection may consider the provider.
+// The caller must hold ps.mutex.
+func (ps *ProviderStats) breakerAllows() bool {
+	switch ps.currentState() {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return !ps.breaker.probeInFlight
+	default:
+		return true
+	}
+}
+
+// admitRequest claims permission to send a request through the breaker,
+// reserving the probe slot when half-open. The caller must hold ps.mutex.
+func (ps *ProviderStats) admitRequest() bool {
+	if !ps.breakerAllows() {
+		return false
+	}
+	if ps.breaker.state == BreakerHalfOpen {
+		ps.breaker.probeInFlight = true
+	}
+	return true
+}
+
+// breakerSuccess closes the circuit after a successful request.
+// The caller must hold ps.mutex.
+func (ps *ProviderStats) breakerSuccess() {
+	cb := &ps.breaker
+	cb.consecutiveFailures = 0
+	if cb.state != BreakerClosed {
+		ps.setBreakerState(BreakerClosed)
+	}
+}
+
+// breakerFailure records a failed request and opens the circuit if a
+// threshold has been reached. The caller must hold ps.mutex.
+func (ps *ProviderStats) breakerFailure() {
+	cb := &ps.breaker
+	cb.consecutiveFailures++
+	if !cb.config.enabled() {
+		return
+	}
+
+	tripped := cb.state == BreakerHalfOpen ||
+		(cb.config.ConsecutiveFailures > 0 && cb.consecutiveFailures >= cb.config.ConsecutiveFailures) ||
+		(cb.config.MaxErrorsInWindow > 0 && ps.errorsInWindow() >= cb.config.MaxErrorsInWindow)
+	if tripped {
+		cb.openedAt = time.Now()
+		ps.setBreakerState(BreakerOpen)
+	}
+}
+
+// breakerAbandoned releases the probe slot when a half-open probe ended
+// without telling us anything, e.g. because it was cancelled.
+// The caller must hold ps.mutex.
+func (ps *ProviderStats) breakerAbandoned() {
+	ps.breaker.probeInFlight = false
+}
+
+// setBreakerState changes the breaker state and logs the transition.
+// The caller must hold ps.mutex.
+func (ps *ProviderStats) setBreakerState(state BreakerState) {
+	if ps.breaker.state == state {
+		return
+	}
+	log.Printf("circuit breaker for %s: %s -> %s", ps.provider.Name(), ps.breaker.state, state)
+	ps.breaker.state = state
+	ps.breaker.probeInFlight = false
+}
+
+// CircuitState returns the current circuit breaker state of the named provider
+func (b *Broker) CircuitState(name string) (BreakerState, error) {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return BreakerClosed, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return ps.currentState(), nil
+}
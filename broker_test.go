@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testIP returns a distinct public address for lookup n
+func testIP(n int) string {
+	return fmt.Sprintf("8.8.%d.%d", n/250, n%250+1)
+}
+
+func TestBrokerFailover(t *testing.T) {
+	primary := NewChaosProvider(NewMockProvider("primary", 0), 1, ChaosConfig{ErrorRate: 1})
+	backup := NewMockProvider("backup", 0)
+	b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1))
+	defer b.Close()
+	ctx := context.Background()
+
+	for i := range 5 {
+		loc, err := b.GetLocation(ctx, testIP(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Provider != "backup" {
+			t.Errorf("lookup %d served by %s while primary was failing", i, loc.Provider)
+		}
+	}
+	if n := primary.Injected(); n != 5 {
+		t.Errorf("primary failed %d lookups, want 5", n)
+	}
+
+	// Flipping primary back to healthy takes the traffic back
+	primary.SetConfig(ChaosConfig{})
+	backup.Reset()
+	for i := range 5 {
+		loc, err := b.GetLocation(ctx, testIP(100+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Provider != "primary" {
+			t.Errorf("lookup %d served by %s after primary recovered", i, loc.Provider)
+		}
+	}
+	if n := backup.Calls(); n != 0 {
+		t.Errorf("backup called %d times after primary recovered", n)
+	}
+
+	// With every provider failing the lookup fails with the last error
+	primary.SetConfig(ChaosConfig{ErrorRate: 1})
+	down := NewChaosProvider(NewMockProvider("down", 0), 2, ChaosConfig{BlackoutEvery: time.Hour, BlackoutFor: time.Hour})
+	b2 := NewBroker([]Provider{primary, down})
+	defer b2.Close()
+	_, err := b2.GetLocation(ctx, testIP(200))
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("got %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestBrokerFailoverStopsAtInvalidIP(t *testing.T) {
+	first := NewMockProvider("first", 0, MockFailCalls(1, 1, ErrProviderInvalidIP))
+	second := NewMockProvider("second", 0)
+	b := NewBroker([]Provider{first, second}, WithProviderTier("second", 1))
+	defer b.Close()
+
+	if _, err := b.GetLocation(context.Background(), testIP(0)); !errors.Is(err, ErrProviderInvalidIP) {
+		t.Errorf("got %v, want ErrProviderInvalidIP", err)
+	}
+	if n := second.Calls(); n != 0 {
+		t.Errorf("second provider asked %d times about an address the first couldn't locate", n)
+	}
+}
+
+func TestBrokerRateLimit(t *testing.T) {
+	a := NewMockProvider("a", 2)
+	c := NewChaosProvider(NewMockProvider("c", 2), 1, ChaosConfig{})
+	b := NewBroker([]Provider{a, c}, WithProviderTier("c", 1))
+	defer b.Close()
+	ctx := context.Background()
+
+	want := []string{"a", "a", "c", "c"}
+	for i, name := range want {
+		loc, err := b.GetLocation(ctx, testIP(i))
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		if loc.Provider != name {
+			t.Errorf("lookup %d served by %s, want %s", i, loc.Provider, name)
+		}
+	}
+
+	if _, err := b.GetLocation(ctx, testIP(4)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Errorf("got %v, want ErrAllProvidersRateLimited", err)
+	}
+	if _, err := b.GetLocationFrom(ctx, "a", testIP(5)); !errors.Is(err, ErrProviderRateLimited) {
+		t.Errorf("GetLocationFrom: got %v, want ErrProviderRateLimited", err)
+	}
+	if n := a.Calls(); n != 2 {
+		t.Errorf("a called %d times with a limit of 2 a minute", n)
+	}
+}
+
+func TestBrokerBlockOnRateLimit(t *testing.T) {
+	p := NewMockProvider("p", 1)
+	b := NewBroker([]Provider{p}, WithBlockOnRateLimit(true))
+	defer b.Close()
+
+	if _, err := b.GetLocation(context.Background(), testIP(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The window resets in a minute, so the wait ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := b.GetLocation(ctx, testIP(1))
+	if !errors.Is(err, ErrAllProvidersRateLimited) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want ErrAllProvidersRateLimited and DeadlineExceeded", err)
+	}
+}
+
+func TestBrokerCircuitBreaker(t *testing.T) {
+	mock := NewMockProvider("primary", 0)
+	primary := NewChaosProvider(mock, 1, ChaosConfig{ErrorRate: 1})
+	backup := NewMockProvider("backup", 0)
+	cooldown := 100 * time.Millisecond
+	b := NewBroker([]Provider{primary, backup},
+		WithProviderTier("backup", 1),
+		WithCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 3, Cooldown: cooldown}))
+	defer b.Close()
+	ctx := context.Background()
+
+	state := func() BreakerState {
+		t.Helper()
+		s, err := b.CircuitState("primary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for i := range 10 {
+		loc, err := b.GetLocation(ctx, testIP(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Provider != "backup" {
+			t.Errorf("lookup %d served by %s", i, loc.Provider)
+		}
+	}
+	if s := state(); s != BreakerOpen {
+		t.Fatalf("breaker %s after repeated failures, want open", s)
+	}
+	// The open circuit kept the failing provider out of the later lookups
+	if n := primary.Injected(); n != 3 {
+		t.Errorf("primary tried %d times, want 3", n)
+	}
+
+	// A probe after the cooldown that fails again reopens the circuit
+	time.Sleep(cooldown + 20*time.Millisecond)
+	if s := state(); s != BreakerHalfOpen {
+		t.Fatalf("breaker %s after the cooldown, want half-open", s)
+	}
+	if _, err := b.GetLocation(ctx, testIP(10)); err != nil {
+		t.Fatal(err)
+	}
+	if s := state(); s != BreakerOpen {
+		t.Fatalf("breaker %s after a failed probe, want open", s)
+	}
+
+	// Once the provider recovers, the next probe closes it
+	primary.SetConfig(ChaosConfig{})
+	time.Sleep(cooldown + 20*time.Millisecond)
+	loc, err := b.GetLocation(ctx, testIP(11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "primary" {
+		t.Errorf("probe served by %s, want primary", loc.Provider)
+	}
+	if s := state(); s != BreakerClosed {
+		t.Errorf("breaker %s after a successful probe, want closed", s)
+	}
+	if n := mock.Calls(); n != 1 {
+		t.Errorf("wrapped provider reached %d times, want 1", n)
+	}
+
+	if _, err := b.CircuitState("missing"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("got %v, want ErrUnknownProvider", err)
+	}
+}
+
+// TestBrokerUnderChaos runs lookups against providers failing in different
+// ways and checks that failover hides every failure from the caller and
+// that scoring steers traffic to the healthy provider
+func TestBrokerUnderChaos(t *testing.T) {
+	bursty := NewChaosProvider(NewMockProvider("bursty", 0, MockLatency(time.Millisecond)), 1, ChaosConfig{BurstRate: 0.1, BurstLength: 5})
+	flaky := NewChaosProvider(NewMockProvider("flaky", 0, MockLatency(time.Millisecond)), 2, ChaosConfig{ErrorRate: 0.5})
+	healthyMock := NewMockProvider("healthy", 0)
+	healthy := NewChaosProvider(healthyMock, 3, ChaosConfig{Latency: UniformLatency(time.Millisecond, 2*time.Millisecond)})
+	b := NewBroker([]Provider{bursty, flaky, healthy},
+		WithCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 3, Cooldown: time.Minute}))
+	defer b.Close()
+	ctx := context.Background()
+
+	const lookups = 100
+	for i := range lookups {
+		if _, err := b.GetLocation(ctx, testIP(i)); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if n := healthyMock.Calls(); n < lookups/2 {
+		t.Errorf("healthy provider served %d of %d lookups", n, lookups)
+	}
+}
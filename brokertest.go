@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// MockProvider is a scriptable Provider for tests and local development. It
+// answers from canned locations with configurable latency, fails on a
+// schedule, counts its calls, and can hold calls until released to test
+// concurrency. It is safe for concurrent use.
+type MockProvider struct {
+	name                 string
+	maxRequestsPerMinute int
+
+	mutex       sync.Mutex
+	latency     func(call int) time.Duration
+	responses   map[string]Location
+	failures    []mockFailure
+	failRate    float64
+	failRateErr error
+	rng         *rand.Rand
+	gate        <-chan struct{}
+	calls       int
+	callsByIP   map[string]int
+}
+
+// mockFailure fails calls numbered from to to, inclusive
+type mockFailure struct {
+	from, to int
+	err      error
+}
+
+// MockOption configures a MockProvider
+type MockOption func(*MockProvider)
+
+// NewMockProvider creates a mock provider. Without options every call
+// succeeds at once with a location in country "ZZ" (unknown).
+func NewMockProvider(name string, maxRequestsPerMinute int, opts ...MockOption) *MockProvider {
+	p := &MockProvider{
+		name:                 name,
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		responses:            make(map[string]Location),
+		callsByIP:            make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// MockLatency makes every call take d
+func MockLatency(d time.Duration) MockOption {
+	return func(p *MockProvider) {
+		p.latency = func(int) time.Duration { return d }
+	}
+}
+
+// MockLatencyFunc makes call number call (counting from 1) take the
+// returned duration
+func MockLatencyFunc(fn func(call int) time.Duration) MockOption {
+	return func(p *MockProvider) {
+		p.latency = fn
+	}
+}
+
+// MockResponse answers lookups of ip with loc. IP and Provider are filled in
+// by the mock and the broker.
+func MockResponse(ip string, loc Location) MockOption {
+	return func(p *MockProvider) {
+		p.responses[ip] = loc
+	}
+}
+
+// MockCities are canned locations with fixed coordinates for use with
+// MockResponse, e.g. MockResponse("8.8.8.8", MockCities["Mountain View"])
+var MockCities = map[string]Location{
+	"Mountain View": {Country: "US", City: "Mountain View", Timezone: "America/Los_Angeles", Latitude: 37.3861, Longitude: -122.0839, HasCoordinates: true},
+	"London":        {Country: "GB", City: "London", Timezone: "Europe/London", Latitude: 51.5074, Longitude: -0.1278, HasCoordinates: true},
+	"Berlin":        {Country: "DE", City: "Berlin", Timezone: "Europe/Berlin", Latitude: 52.5200, Longitude: 13.4050, HasCoordinates: true},
+	"Tokyo":         {Country: "JP", City: "Tokyo", Timezone: "Asia/Tokyo", Latitude: 35.6762, Longitude: 139.6503, HasCoordinates: true},
+	"Sydney":        {Country: "AU", City: "Sydney", Timezone: "Australia/Sydney", Latitude: -33.8688, Longitude: 151.2093, HasCoordinates: true},
+	"São Paulo":     {Country: "BR", City: "São Paulo", Timezone: "America/Sao_Paulo", Latitude: -23.5505, Longitude: -46.6333, HasCoordinates: true},
+}
+
+// MockFailCalls fails calls from to to (counting from 1, inclusive) with err,
+// or with an error matching ErrProviderUnavailable if err is nil
+func MockFailCalls(from, to int, err error) MockOption {
+	return func(p *MockProvider) {
+		p.failures = append(p.failures, mockFailure{from: from, to: to, err: err})
+	}
+}
+
+// MockFailRate fails the given fraction of calls with err, or with an error
+// matching ErrProviderUnavailable if err is nil. Which calls fail is decided
+// by a generator seeded with seed, so a run is repeatable as long as calls
+// arrive in the same order.
+func MockFailRate(rate float64, seed int64, err error) MockOption {
+	return func(p *MockProvider) {
+		p.failRate = rate
+		p.failRateErr = err
+		p.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// MockGate holds every call until a value is received from gate or gate is
+// closed, so a test can release calls one at a time or all at once
+func MockGate(gate <-chan struct{}) MockOption {
+	return func(p *MockProvider) {
+		p.gate = gate
+	}
+}
+
+func (p *MockProvider) Name() string {
+	return p.name
+}
+
+func (p *MockProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	p.mutex.Lock()
+	p.calls++
+	call := p.calls
+	p.callsByIP[ip]++
+	var latency time.Duration
+	if p.latency != nil {
+		latency = p.latency(call)
+	}
+	err := p.failureFor(call)
+	location, ok := p.responses[ip]
+	gate := p.gate
+	p.mutex.Unlock()
+
+	if gate != nil {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		location = Location{Country: "ZZ"}
+	}
+	location.IP = ip
+	return &location, nil
+}
+
+// failureFor returns the scripted error for call, if any. The caller must
+// hold p.mutex.
+func (p *MockProvider) failureFor(call int) error {
+	// Draw for every call so the random failures don't depend on the schedule
+	random := p.rng != nil && p.rng.Float64() < p.failRate
+
+	for _, f := range p.failures {
+		if call >= f.from && call <= f.to {
+			return p.mockError(f.err, call)
+		}
+	}
+	if random {
+		return p.mockError(p.failRateErr, call)
+	}
+	return nil
+}
+
+// mockError returns err, or a default error for call if err is nil
+func (p *MockProvider) mockError(err error, call int) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s: scripted failure of call %d", ErrProviderUnavailable, p.name, call)
+}
+
+func (p *MockProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
+
+// Calls returns the number of lookups the mock has received
+func (p *MockProvider) Calls() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.calls
+}
+
+// CallsFor returns the number of lookups of ip the mock has received
+func (p *MockProvider) CallsFor(ip string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.callsByIP[ip]
+}
+
+// Reset zeroes the call counters, so the failure schedule starts over
+func (p *MockProvider) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.calls = 0
+	clear(p.callsByIP)
+}
+
+// LatencyDistribution draws a delay from rng
+type LatencyDistribution func(rng *rand.Rand) time.Duration
+
+// UniformLatency draws delays evenly between lo and hi
+func UniformLatency(lo, hi time.Duration) LatencyDistribution {
+	return func(rng *rand.Rand) time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(rng.Int63n(int64(hi-lo)+1))
+	}
+}
+
+// NormalLatency draws delays from a normal distribution, never below zero
+func NormalLatency(mean, stddev time.Duration) LatencyDistribution {
+	return func(rng *rand.Rand) time.Duration {
+		return max(time.Duration(rng.NormFloat64()*float64(stddev))+mean, 0)
+	}
+}
+
+// ExponentialLatency draws delays from an exponential distribution, which
+// gives a long tail of slow calls
+func ExponentialLatency(mean time.Duration) LatencyDistribution {
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(rng.ExpFloat64() * float64(mean))
+	}
+}
+
+// ChaosConfig describes the trouble a ChaosProvider causes. The zero value
+// passes every call straight through.
+type ChaosConfig struct {
+	// Latency adds a delay drawn from it to every call
+	Latency LatencyDistribution
+	// ErrorRate fails this fraction of calls independently of each other
+	ErrorRate float64
+	// BurstRate is the chance that a call starts a burst of BurstLength
+	// consecutive failures
+	BurstRate   float64
+	BurstLength int
+	// BlackoutEvery and BlackoutFor fail every call for BlackoutFor at the
+	// start of each BlackoutEvery period, counted from when the provider was
+	// created
+	BlackoutEvery time.Duration
+	BlackoutFor   time.Duration
+	// Err is the injected error, or an error matching ErrProviderUnavailable
+	// if nil
+	Err error
+}
+
+// ChaosProvider wraps a real or mock provider and injects latency and
+// failures around it, to exercise failover, circuit breaking and scoring.
+// Its configuration can be changed while it is in use, and the random
+// choices come from a seeded generator, so a run is repeatable as long as
+// calls arrive in the same order. It is safe for concurrent use.
+type ChaosProvider struct {
+	Provider
+
+	mutex     sync.Mutex
+	config    ChaosConfig
+	rng       *rand.Rand
+	started   time.Time
+	burstLeft int
+	injected  int
+}
+
+// NewChaosProvider wraps p with the chaos described by config
+func NewChaosProvider(p Provider, seed int64, config ChaosConfig) *ChaosProvider {
+	return &ChaosProvider{
+		Provider: p,
+		config:   config,
+		rng:      rand.New(rand.NewSource(seed)),
+		started:  time.Now(),
+	}
+}
+
+// SetConfig replaces the chaos configuration, e.g. to flip a provider from
+// healthy to failing mid-run. A burst in progress is cut short.
+func (p *ChaosProvider) SetConfig(config ChaosConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.config = config
+	p.burstLeft = 0
+}
+
+// Config returns the current chaos configuration
+func (p *ChaosProvider) Config() ChaosConfig {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.config
+}
+
+// Injected returns the number of failures the provider has injected
+func (p *ChaosProvider) Injected() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.injected
+}
+
+// Unwrap returns the wrapped provider
+func (p *ChaosProvider) Unwrap() Provider {
+	return p.Provider
+}
+
+func (p *ChaosProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	latency, fail, cause := p.draw(time.Now())
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if fail {
+		return nil, p.chaosError(cause)
+	}
+	return p.Provider.GetLocation(ctx, ip)
+}
+
+// draw decides the fate of a call made at now. Every call draws for a burst
+// and an error whatever the configuration, so turning failures on or off
+// mid-run doesn't shift the sequence for later calls.
+func (p *ChaosProvider) draw(now time.Time) (latency time.Duration, fail bool, cause string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	burstRoll, errorRoll := p.rng.Float64(), p.rng.Float64()
+	if p.config.Latency != nil {
+		latency = p.config.Latency(p.rng)
+	}
+
+	switch {
+	case p.config.BlackoutEvery > 0 && now.Sub(p.started)%p.config.BlackoutEvery < p.config.BlackoutFor:
+		fail, cause = true, "blackout"
+	case p.burstLeft > 0:
+		p.burstLeft--
+		fail, cause = true, "error burst"
+	case burstRoll < p.config.BurstRate && p.config.BurstLength > 0:
+		p.burstLeft = p.config.BurstLength - 1
+		fail, cause = true, "error burst"
+	case errorRoll < p.config.ErrorRate:
+		fail, cause = true, "random error"
+	}
+	if fail {
+		p.injected++
+	}
+	return latency, fail, cause
+}
+
+// chaosError returns the configured error, or a default one naming cause
+func (p *ChaosProvider) chaosError(cause string) error {
+	if err := p.Config().Err; err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s: injected %s", ErrProviderUnavailable, p.Name(), cause)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChaosProviderRepeatable(t *testing.T) {
+	config := ChaosConfig{ErrorRate: 0.2, BurstRate: 0.05, BurstLength: 4}
+	run := func(seed int64) []bool {
+		p := NewChaosProvider(NewMockProvider("mock", 0), seed, config)
+		failed := make([]bool, 200)
+		for i := range failed {
+			_, err := p.GetLocation(context.Background(), testIP(i))
+			failed[i] = err != nil
+		}
+		return failed
+	}
+
+	first, second := run(7), run(7)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("call %d differs between runs with the same seed", i)
+		}
+	}
+}
+
+func TestChaosProviderBursts(t *testing.T) {
+	p := NewChaosProvider(NewMockProvider("mock", 0), 1, ChaosConfig{BurstRate: 0.05, BurstLength: 5})
+	run := 0
+	for i := range 500 {
+		_, err := p.GetLocation(context.Background(), testIP(i))
+		switch {
+		case err != nil:
+			if !errors.Is(err, ErrProviderUnavailable) {
+				t.Fatalf("got %v, want ErrProviderUnavailable", err)
+			}
+			run++
+		case run > 0 && run%5 != 0:
+			t.Fatalf("burst of %d failures, want a multiple of 5", run)
+		default:
+			run = 0
+		}
+	}
+	if p.Injected() == 0 {
+		t.Error("no bursts in 500 calls")
+	}
+}
+
+func TestChaosProviderBlackout(t *testing.T) {
+	mock := NewMockProvider("mock", 0)
+	errDown := errors.New("down")
+	p := NewChaosProvider(mock, 1, ChaosConfig{BlackoutEvery: time.Hour, BlackoutFor: time.Minute, Err: errDown})
+	for i := range 10 {
+		if _, err := p.GetLocation(context.Background(), testIP(i)); err != errDown {
+			t.Fatalf("got %v during a blackout, want the configured error", err)
+		}
+	}
+	if n := mock.Calls(); n != 0 {
+		t.Errorf("wrapped provider called %d times during a blackout", n)
+	}
+
+	// Outside the blackout calls pass through
+	p.SetConfig(ChaosConfig{BlackoutEvery: time.Hour, BlackoutFor: time.Nanosecond})
+	if _, err := p.GetLocation(context.Background(), testIP(10)); err != nil {
+		t.Errorf("got %v after the blackout", err)
+	}
+	if p.Unwrap() != Provider(mock) {
+		t.Error("Unwrap doesn't return the wrapped provider")
+	}
+}
+
+func TestChaosProviderLatency(t *testing.T) {
+	p := NewChaosProvider(NewMockProvider("mock", 0), 1, ChaosConfig{Latency: UniformLatency(time.Hour, time.Hour)})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetLocation(ctx, testIP(0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the caller's deadline to cut the delay short", err)
+	}
+
+	for name, dist := range map[string]LatencyDistribution{
+		"uniform":     UniformLatency(time.Millisecond, 2*time.Millisecond),
+		"normal":      NormalLatency(time.Millisecond, 5*time.Millisecond),
+		"exponential": ExponentialLatency(time.Millisecond),
+	} {
+		p := NewChaosProvider(NewMockProvider("mock", 0), 1, ChaosConfig{Latency: dist})
+		for range 100 {
+			if d := p.Config().Latency(p.rng); d < 0 {
+				t.Errorf("%s: negative delay %v", name, d)
+			}
+		}
+	}
+}
+
+func TestMockResponse(t *testing.T) {
+	p := NewMockProvider("mock", 60, MockResponse("8.8.8.8", MockCities["Mountain View"]))
+	ctx := context.Background()
+
+	loc, err := p.GetLocation(ctx, "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MockCities["Mountain View"]
+	want.IP = "8.8.8.8"
+	if *loc != want {
+		t.Errorf("got %+v, want %+v", *loc, want)
+	}
+	if loc, err := p.GetLocation(ctx, "1.1.1.1"); err != nil || loc.Country != "ZZ" || loc.IP != "1.1.1.1" {
+		t.Errorf("got %+v, %v without a canned response, want country ZZ", loc, err)
+	}
+	p.GetLocation(ctx, "8.8.8.8")
+
+	if n := p.Calls(); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+	if n := p.CallsFor("8.8.8.8"); n != 2 {
+		t.Errorf("%d calls for 8.8.8.8, want 2", n)
+	}
+	if rpm := p.GetMaxRequestsPerMinute(); rpm != 60 {
+		t.Errorf("rate limit %d, want 60", rpm)
+	}
+	p.Reset()
+	if p.Calls() != 0 || p.CallsFor("8.8.8.8") != 0 {
+		t.Error("counters not zeroed by Reset")
+	}
+}
+
+func TestMockFailCalls(t *testing.T) {
+	errQuota := errors.New("quota")
+	p := NewMockProvider("mock", 0, MockFailCalls(3, 5, nil), MockFailCalls(8, 8, errQuota))
+	run := func() {
+		t.Helper()
+		for call := 1; call <= 10; call++ {
+			_, err := p.GetLocation(context.Background(), testIP(call))
+			switch {
+			case call >= 3 && call <= 5:
+				if !errors.Is(err, ErrProviderUnavailable) {
+					t.Errorf("call %d: got %v, want ErrProviderUnavailable", call, err)
+				}
+			case call == 8:
+				if err != errQuota {
+					t.Errorf("call %d: got %v, want the scripted error", call, err)
+				}
+			case err != nil:
+				t.Errorf("call %d: %v", call, err)
+			}
+		}
+	}
+	run()
+	// The schedule starts over after Reset
+	p.Reset()
+	run()
+}
+
+func TestMockFailRate(t *testing.T) {
+	run := func(seed int64) []bool {
+		p := NewMockProvider("mock", 0, MockFailRate(0.2, seed, nil))
+		failed := make([]bool, 1000)
+		for i := range failed {
+			_, err := p.GetLocation(context.Background(), testIP(i))
+			if err != nil && !errors.Is(err, ErrProviderUnavailable) {
+				t.Fatalf("got %v, want ErrProviderUnavailable", err)
+			}
+			failed[i] = err != nil
+		}
+		return failed
+	}
+
+	first, second := run(42), run(42)
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("call %d differs between runs with the same seed", i)
+		}
+		if first[i] {
+			failures++
+		}
+	}
+	if failures < 150 || failures > 250 {
+		t.Errorf("%d of 1000 calls failed, want about 200", failures)
+	}
+}
+
+func TestMockLatency(t *testing.T) {
+	var calls []int
+	p := NewMockProvider("mock", 0, MockLatencyFunc(func(call int) time.Duration {
+		calls = append(calls, call)
+		if call == 2 {
+			return time.Hour
+		}
+		return 0
+	}))
+
+	if _, err := p.GetLocation(context.Background(), testIP(0)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetLocation(ctx, testIP(1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the caller's deadline to cut the delay short", err)
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 2 {
+		t.Errorf("latency asked for calls %v, want [1 2]", calls)
+	}
+}
+
+func TestMockGate(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("mock", 0, MockGate(gate))
+	done := make(chan error)
+	for i := range 3 {
+		go func() {
+			_, err := p.GetLocation(context.Background(), testIP(i))
+			done <- err
+		}()
+	}
+
+	// Held until released, one at a time
+	select {
+	case <-done:
+		t.Fatal("call finished before the gate opened")
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("one release let two calls through")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Or all at once
+	close(gate)
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held := NewMockProvider("mock", 0, MockGate(make(chan struct{})))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := held.GetLocation(ctx, testIP(0)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want a held call to give up with its context", err)
+	}
+}
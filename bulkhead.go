@@ -0,0 +1,35 @@
+package main
+
+import "context"
+
+// acquireSlot takes one of the provider's concurrency slots. Unless the
+// broker is configured to wait, it fails immediately with ErrProviderBusy
+// when no slot is free so the lookup can spill over to another provider.
+func (ps *ProviderStats) acquireSlot(ctx context.Context) error {
+	if ps.slots == nil {
+		return nil
+	}
+
+	if !ps.waitForSlot {
+		select {
+		case ps.slots <- struct{}{}:
+			return nil
+		default:
+			return ErrProviderBusy
+		}
+	}
+
+	select {
+	case ps.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseSlot returns a slot taken by acquireSlot
+func (ps *ProviderStats) releaseSlot() {
+	if ps.slots != nil {
+		<-ps.slots
+	}
+}
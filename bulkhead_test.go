@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe records the most calls its provider had in flight at once
+type concurrencyProbe struct {
+	Provider
+	current, peak atomic.Int32
+}
+
+func (p *concurrencyProbe) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	n := p.current.Add(1)
+	defer p.current.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	return p.Provider.GetLocation(ctx, ip)
+}
+
+// lookupConcurrently runs n lookups of distinct addresses at once and
+// returns their errors
+func lookupConcurrently(b *Broker, n int) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = b.GetLocation(context.Background(), testIP(i))
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestMaxInFlightSpillsOver(t *testing.T) {
+	slow := &concurrencyProbe{Provider: NewMockProvider("slow", 0, MockLatency(20*time.Millisecond))}
+	spare := NewMockProvider("spare", 0)
+	b := NewBroker([]Provider{slow, spare}, WithMaxInFlight("slow", 2), WithProviderTier("spare", 1))
+	defer b.Close()
+
+	for i, err := range lookupConcurrently(b, 20) {
+		if err != nil {
+			t.Errorf("lookup %d: %v", i, err)
+		}
+	}
+	if peak := slow.peak.Load(); peak > 2 {
+		t.Errorf("%d calls in flight at once with a cap of 2", peak)
+	}
+	if spare.Calls() == 0 {
+		t.Error("nothing spilled over to the spare provider")
+	}
+}
+
+func TestMaxInFlightWaits(t *testing.T) {
+	mock := NewMockProvider("slow", 0, MockLatency(10*time.Millisecond))
+	slow := &concurrencyProbe{Provider: mock}
+	b := NewBroker([]Provider{slow}, WithMaxInFlight("slow", 3), WithBulkheadWait(true))
+	defer b.Close()
+
+	for i, err := range lookupConcurrently(b, 20) {
+		if err != nil {
+			t.Errorf("lookup %d: %v", i, err)
+		}
+	}
+	if peak := slow.peak.Load(); peak != 3 {
+		t.Errorf("at most %d calls in flight at once, want the cap of 3", peak)
+	}
+	if n := mock.Calls(); n != 20 {
+		t.Errorf("provider served %d of 20 lookups", n)
+	}
+}
+
+func TestMaxInFlightBusy(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("slow", 0, MockGate(gate))
+	b := NewBroker([]Provider{p}, WithMaxInFlight("slow", 1))
+	defer b.Close()
+
+	go b.GetLocation(context.Background(), testIP(0))
+	for p.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// With the only slot taken and nowhere to spill over, the lookup fails
+	if _, err := b.GetLocation(context.Background(), testIP(1)); !errors.Is(err, ErrNoProviderAvailable) {
+		t.Errorf("got %v, want ErrNoProviderAvailable", err)
+	}
+
+	// A waiting lookup gives up with its context
+	bw := NewBroker([]Provider{p}, WithMaxInFlight("slow", 1), WithBulkheadWait(true))
+	defer bw.Close()
+	// Release the held lookups before the brokers wait for them to finish
+	defer close(gate)
+	go bw.GetLocation(context.Background(), testIP(2))
+	for p.Calls() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := bw.GetLocation(ctx, testIP(3)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+}
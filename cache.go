@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Cache stores lookup results between calls. The broker consults it before
+// selecting a provider and fills it after a successful lookup.
+//
+// Implementations must be safe for concurrent use by multiple goroutines and
+// should return promptly once ctx is done. Get must return a location the
+// caller is free to modify, and Set must not retain loc after returning.
+// A returned error is treated as a miss: the broker falls back to a live
+// lookup and reports the error to any CacheObserver.
+type Cache interface {
+	// Get returns the location cached for ip, if any
+	Get(ctx context.Context, ip string) (*Location, bool, error)
+	// Set caches loc for ip for ttl. A ttl of zero or less never expires.
+	Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error
+	// Delete removes any location cached for ip
+	Delete(ctx context.Context, ip string) error
+}
+
+// CacheFlusher can be implemented by a Cache that can remove every entry at
+// once. Flush returns the number of entries removed.
+type CacheFlusher interface {
+	Flush(ctx context.Context) (int, error)
+}
+
+// CacheObserver can be implemented by an Observer to be told about cache
+// activity. Like the other callbacks these run on the request path and must
+// be fast.
+type CacheObserver interface {
+	// OnCacheLookup is called for every lookup that consults the cache
+	OnCacheLookup(ip string, result CacheResult)
+	// OnCacheError is called when the cache fails; op is "get", "set",
+	// "delete" or "flush"
+	OnCacheError(op, ip string, err error)
+}
+
+// cacheKey returns the key ip is cached under: the address itself, or its
+// containing prefix when prefix caching is enabled
+func (b *Broker) cacheKey(addr netip.Addr) string {
+	bits := b.prefixBitsV6
+	if addr.Is4() {
+		bits = b.prefixBitsV4
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// cacheGet reads key from the cache for a lookup of ip, treating errors as a
+// miss. The entry is returned marked FromCache, and a stale one also marked
+// Stale while a background refresh is started. The result always carries
+// ip, even when it was cached for another address in the same prefix, and
+// its confidence is lowered accordingly.
+func (b *Broker) cacheGet(ctx context.Context, key, ip string) (*Location, bool) {
+	location, ok, err := b.cache.Get(ctx, key)
+	if err != nil {
+		b.cacheFailed("get", key, err)
+		return nil, false
+	}
+	if !ok || location == nil {
+		return nil, false
+	}
+	// With prefix caching the entry may have been looked up for a neighbor
+	prefixHit := key != ip && location.IP != ip
+	location.IP = ip
+	location.FromCache = true
+	if location.RetrievedAt.IsZero() {
+		// Written before results carried the time of their lookup
+		location.RetrievedAt = location.CachedAt
+	}
+
+	fresh, stale := b.freshness(location, time.Now())
+	switch {
+	case fresh:
+	case stale:
+		location.Stale = true
+		b.refreshStale(key, ip)
+	default:
+		return nil, false
+	}
+	location.Confidence = b.confidence.cached(location, prefixHit)
+	location.ttl = 0
+	return location, true
+}
+
+// cacheSet stores a successful lookup, ignoring errors beyond reporting them.
+// Entries are kept for the stale grace period beyond their TTL.
+func (b *Broker) cacheSet(ctx context.Context, ip string, location *Location) {
+	ttl := b.entryTTL(location)
+	if ttl <= 0 && b.cacheTTLFunc != nil {
+		return
+	}
+	if ttl > 0 {
+		ttl += b.staleGrace
+	}
+
+	entry := *location
+	entry.CachedAt = time.Now()
+	entry.Stale = false
+	entry.FromCache = false
+	if entry.RetrievedAt.IsZero() {
+		// Seeds weren't looked up; their data is as old as the entry
+		entry.RetrievedAt = entry.CachedAt
+	}
+	if err := b.cache.Set(ctx, ip, &entry, ttl); err != nil {
+		b.cacheFailed("set", ip, err)
+		return
+	}
+	b.cacheCounters.sets.Add(1)
+}
+
+// cacheFailed reports a cache error to observers that want to know
+func (b *Broker) cacheFailed(op, ip string, err error) {
+	b.observe(func(o Observer) {
+		if co, ok := o.(CacheObserver); ok {
+			co.OnCacheError(op, ip, err)
+		}
+	})
+}
+
+// VerifyCache checks that c behaves as the broker expects of a Cache and
+// returns the first violation found. It writes and deletes a few entries
+// under documentation addresses, so run it against an empty or disposable
+// store. It is meant to be called from the tests of a Cache implementation.
+func VerifyCache(ctx context.Context, c Cache) error {
+	const ip = "192.0.2.1"
+	want := &Location{IP: ip, Country: "Testland", City: "Testville", Latitude: 12.5, Longitude: -45.25, HasCoordinates: true, Provider: "test", RetrievedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	if err := c.Delete(ctx, ip); err != nil {
+		return fmt.Errorf("delete of missing entry: %w", err)
+	}
+	if _, ok, err := c.Get(ctx, ip); err != nil || ok {
+		return fmt.Errorf("get of missing entry: got hit=%v, err=%v; want a miss", ok, err)
+	}
+
+	if err := c.Set(ctx, ip, want, time.Minute); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	got, ok, err := c.Get(ctx, ip)
+	if err != nil || !ok || got == nil {
+		return fmt.Errorf("get after set: got hit=%v, err=%v; want a hit", ok, err)
+	}
+	if *got != *want {
+		return fmt.Errorf("get after set: got %+v, want %+v", *got, *want)
+	}
+
+	// The caller owns what Get returns
+	got.Country = "Elsewhere"
+	if again, _, _ := c.Get(ctx, ip); again == nil || again.Country != want.Country {
+		return errors.New("modifying a returned location changed the cached entry")
+	}
+
+	if err := c.Delete(ctx, ip); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if _, ok, err := c.Get(ctx, ip); err != nil || ok {
+		return fmt.Errorf("get after delete: got hit=%v, err=%v; want a miss", ok, err)
+	}
+
+	// Entries must stop being served once their ttl has passed
+	const shortIP = "192.0.2.2"
+	if err := c.Set(ctx, shortIP, want, 50*time.Millisecond); err != nil {
+		return fmt.Errorf("set with short ttl: %w", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, ok, err := c.Get(ctx, shortIP); err != nil || ok {
+		return fmt.Errorf("get after ttl: got hit=%v, err=%v; want a miss", ok, err)
+	}
+
+	// Concurrent use must not fail
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("192.0.2.%d", 10+i%4)
+			if err := c.Set(ctx, key, want, time.Minute); err != nil {
+				errs <- err
+				return
+			}
+			if _, _, err := c.Get(ctx, key); err != nil {
+				errs <- err
+				return
+			}
+			if err := c.Delete(ctx, key); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return fmt.Errorf("concurrent use: %w", err)
+	}
+	return nil
+}
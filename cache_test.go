@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MemoryCacheConfig
+	}{
+		{"unbounded", MemoryCacheConfig{}},
+		{"lru", MemoryCacheConfig{MaxEntries: 100}},
+		{"lfu", MemoryCacheConfig{MaxEntries: 100, Policy: EvictLFU}},
+		{"byte budget", MemoryCacheConfig{MaxBytes: 1 << 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyCache(context.Background(), NewMemoryCache(tt.config)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// immortalCache ignores ttls, which VerifyCache should catch
+type immortalCache struct {
+	*MemoryCache
+}
+
+func (c immortalCache) Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error {
+	return c.MemoryCache.Set(ctx, ip, loc, 0)
+}
+
+func TestVerifyCacheViolation(t *testing.T) {
+	if err := VerifyCache(context.Background(), immortalCache{NewLRUCache(0)}); err == nil {
+		t.Error("a cache serving expired entries passed")
+	}
+}
+
+var errStoreDown = errors.New("store down")
+
+// failingCache fails every operation
+type failingCache struct{}
+
+func (failingCache) Get(ctx context.Context, ip string) (*Location, bool, error) {
+	return nil, false, errStoreDown
+}
+
+func (failingCache) Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error {
+	return errStoreDown
+}
+
+func (failingCache) Delete(ctx context.Context, ip string) error {
+	return errStoreDown
+}
+
+// cacheErrorObserver counts cache failures by operation
+type cacheErrorObserver struct {
+	*CountingObserver
+	mutex  sync.Mutex
+	errors map[string]int
+}
+
+func (o *cacheErrorObserver) OnCacheLookup(ip string, result CacheResult) {}
+
+func (o *cacheErrorObserver) OnCacheError(op, ip string, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if errors.Is(err, errStoreDown) {
+		o.errors[op]++
+	}
+}
+
+func TestFailingCacheDegrades(t *testing.T) {
+	observer := &cacheErrorObserver{CountingObserver: NewCountingObserver(), errors: map[string]int{}}
+	p := NewMockProvider("mock", 0)
+	b := NewBroker([]Provider{p}, WithCacheStore(failingCache{}, time.Hour), WithObserver(observer))
+	defer b.Close()
+
+	// Every lookup goes to the provider instead of failing
+	for range 3 {
+		if _, err := b.GetLocation(context.Background(), testIP(0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := p.Calls(); n != 3 {
+		t.Errorf("%d provider calls, want 3", n)
+	}
+
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+	if observer.errors["get"] != 3 || observer.errors["set"] != 3 {
+		t.Errorf("cache errors reported %v, want 3 gets and 3 sets", observer.errors)
+	}
+}
+
+func TestPrefixCaching(t *testing.T) {
+	tests := []struct {
+		name      string
+		v4, v6    int
+		first     string
+		second    string
+		wantCalls int
+	}{
+		{"same /24", 24, 48, "8.8.8.1", "8.8.8.200", 1},
+		{"different /24", 24, 48, "8.8.8.1", "8.8.9.1", 2},
+		{"same /48", 24, 48, "2001:4860:1::1", "2001:4860:1:ffff::2", 1},
+		{"different /48", 24, 48, "2001:4860:1::1", "2001:4860:2::1", 2},
+		{"exact addresses by default", 0, 0, "8.8.8.1", "8.8.8.200", 2},
+		{"IPv4 prefix only", 24, 0, "2001:4860:1::1", "2001:4860:1::2", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewMockProvider("mock", 0)
+			b := NewBroker([]Provider{p}, WithCache(100, time.Hour), WithPrefixCaching(tt.v4, tt.v6))
+			defer b.Close()
+
+			first, err := b.GetLocation(context.Background(), tt.first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := b.GetLocation(context.Background(), tt.second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := p.Calls(); n != tt.wantCalls {
+				t.Errorf("%d provider calls, want %d", n, tt.wantCalls)
+			}
+			if second.IP != tt.second {
+				t.Errorf("second lookup reported IP %s, want %s", second.IP, tt.second)
+			}
+			if tt.wantCalls == 1 && (!second.FromCache || second.Confidence >= first.Confidence) {
+				t.Errorf("shared entry: got from cache %v with confidence %d, want a cache hit less confident than %d",
+					second.FromCache, second.Confidence, first.Confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "sync/atomic"
+
+// CacheResult describes how a lookup was answered by the cache
+type CacheResult int
+
+const (
+	// CacheMiss means the lookup had to go to a provider
+	CacheMiss CacheResult = iota
+	// CacheHit means a fresh cached result was served
+	CacheHit
+	// CacheStaleHit means an expired result was served while it is refreshed
+	CacheStaleHit
+	// CacheNegativeHit means a remembered failure was served
+	CacheNegativeHit
+)
+
+func (r CacheResult) String() string {
+	switch r {
+	case CacheHit:
+		return "hit"
+	case CacheStaleHit:
+		return "stale"
+	case CacheNegativeHit:
+		return "negative"
+	default:
+		return "miss"
+	}
+}
+
+// CacheStats counts how the cache has been used since the broker started
+type CacheStats struct {
+	Hits         uint64
+	Misses       uint64
+	StaleHits    uint64
+	NegativeHits uint64
+	Sets         uint64
+	// Evictions is only tracked for caches that report it, such as MemoryCache
+	Evictions uint64
+	// HitRatio is the fraction of lookups served from the cache, counting
+	// stale and negative hits
+	HitRatio float64
+}
+
+// cacheCounters holds the running cache counters
+type cacheCounters struct {
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	staleHits    atomic.Uint64
+	negativeHits atomic.Uint64
+	sets         atomic.Uint64
+}
+
+// evictionCounter is implemented by caches that count their evictions
+type evictionCounter interface {
+	Evictions() uint64
+}
+
+// countCacheResult records how a lookup was answered and tells observers
+func (b *Broker) countCacheResult(ip string, result CacheResult) {
+	switch result {
+	case CacheHit:
+		b.cacheCounters.hits.Add(1)
+	case CacheStaleHit:
+		b.cacheCounters.staleHits.Add(1)
+	case CacheNegativeHit:
+		b.cacheCounters.negativeHits.Add(1)
+	default:
+		b.cacheCounters.misses.Add(1)
+	}
+	b.observe(func(o Observer) {
+		if co, ok := o.(CacheObserver); ok {
+			co.OnCacheLookup(ip, result)
+		}
+	})
+}
+
+// CacheStats returns the cache counters
+func (b *Broker) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:         b.cacheCounters.hits.Load(),
+		Misses:       b.cacheCounters.misses.Load(),
+		StaleHits:    b.cacheCounters.staleHits.Load(),
+		NegativeHits: b.cacheCounters.negativeHits.Load(),
+		Sets:         b.cacheCounters.sets.Load(),
+	}
+	if ec, ok := b.cache.(evictionCounter); ok {
+		stats.Evictions = ec.Evictions()
+	}
+
+	served := stats.Hits + stats.StaleHits + stats.NegativeHits
+	if total := served + stats.Misses; total > 0 {
+		stats.HitRatio = float64(served) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// CacheTTLFunc decides how long a result may be cached. It is consulted
+// whenever a result is written and again when it is read back to judge its
+// freshness, so it should depend only on loc. Zero or less means the result
+// isn't cached at all.
+type CacheTTLFunc func(loc *Location) time.Duration
+
+// CompletenessTTL returns a CacheTTLFunc that caches partial or disputed
+// results for partial, and results with both a country and a city for full
+// scaled by their Confidence, but never for less than partial. Results with
+// no Confidence recorded get full.
+func CompletenessTTL(full, partial time.Duration) CacheTTLFunc {
+	return func(loc *Location) time.Duration {
+		if loc.Country == "" || loc.City == "" || loc.Disputed {
+			return partial
+		}
+		if loc.Confidence <= 0 {
+			return full
+		}
+		return max(full*time.Duration(min(loc.Confidence, 100))/100, partial)
+	}
+}
+
+// entryTTL returns how long loc may be cached. Warmed entries keep the TTL
+// they were loaded with. Without a CacheTTLFunc every other entry uses the
+// cache's TTL, where zero means entries never expire.
+func (b *Broker) entryTTL(loc *Location) time.Duration {
+	if loc.ttl > 0 {
+		return loc.ttl
+	}
+	if b.cacheTTLFunc != nil {
+		return b.cacheTTLFunc(loc)
+	}
+	return b.cacheTTL
+}
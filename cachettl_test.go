@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCompletenessTTL(t *testing.T) {
+	ttl := CompletenessTTL(24*time.Hour, time.Hour)
+	tests := []struct {
+		name string
+		loc  Location
+		want time.Duration
+	}{
+		{"complete", Location{Country: "Germany", City: "Berlin", Confidence: 100}, 24 * time.Hour},
+		{"complete, half confident", Location{Country: "Germany", City: "Berlin", Confidence: 50}, 12 * time.Hour},
+		{"complete, barely confident", Location{Country: "Germany", City: "Berlin", Confidence: 1}, time.Hour},
+		{"complete, no confidence recorded", Location{Country: "Germany", City: "Berlin"}, 24 * time.Hour},
+		{"complete, confidence out of range", Location{Country: "Germany", City: "Berlin", Confidence: 250}, 24 * time.Hour},
+		{"no city", Location{Country: "Germany", Confidence: 100}, time.Hour},
+		{"no country", Location{City: "Berlin", Confidence: 100}, time.Hour},
+		{"disputed", Location{Country: "Germany", City: "Berlin", Confidence: 100, Disputed: true}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ttl(&tt.loc); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheTTLFuncZeroSkipsCache(t *testing.T) {
+	p := NewMockProvider("mock", 100,
+		MockResponse("8.8.8.8", Location{Country: "United States", CountryCode: "US"}),
+		MockResponse("1.1.1.1", MockCities["Sydney"]),
+	)
+	b := NewBroker([]Provider{p},
+		WithCache(100, time.Hour),
+		WithCacheTTLFunc(func(loc *Location) time.Duration {
+			if loc.City == "" {
+				return 0
+			}
+			return time.Hour
+		}),
+	)
+	defer b.Close()
+
+	ctx := context.Background()
+	for range 2 {
+		loc, err := b.GetLocation(ctx, "8.8.8.8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.FromCache {
+			t.Error("result without a city was served from the cache")
+		}
+	}
+	if got := p.Calls(); got != 2 {
+		t.Errorf("provider called %d times, want 2", got)
+	}
+
+	if _, err := b.GetLocation(ctx, "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := b.GetLocation(ctx, "1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loc.FromCache {
+		t.Error("complete result wasn't served from the cache")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallerCancellationNotRecorded(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockLatency(time.Second))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	// Half the callers give up by cancelling, half by running out of time
+	for i := range 100 {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		want := context.Canceled
+		if i%2 == 0 {
+			ctx, cancel = context.WithCancel(context.Background())
+			time.AfterFunc(2*time.Millisecond, cancel)
+		} else {
+			ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+			want = context.DeadlineExceeded
+		}
+		_, err := b.GetLocation(ctx, testIP(i))
+		cancel()
+		if !errors.Is(err, want) {
+			t.Fatalf("lookup %d: got %v, want %v", i, err, want)
+		}
+	}
+
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.ErrorsInWindow != 0 || snap.ErrorRate != 0 {
+		t.Errorf("%d errors, rate %v after 100 cancelled lookups; want none", snap.ErrorsInWindow, snap.ErrorRate)
+	}
+	if snap.AvgResponseTime != 0 || snap.MaxResponseTime != 0 {
+		t.Errorf("cancelled lookups recorded response times, mean %v, max %v", snap.AvgResponseTime, snap.MaxResponseTime)
+	}
+	if snap.BreakerState != BreakerClosed {
+		t.Errorf("breaker %v after cancelled lookups, want closed", snap.BreakerState)
+	}
+	if n := p.Calls(); n != 100 {
+		t.Errorf("provider received %d of 100 calls", n)
+	}
+}
+
+func TestProviderTimeoutRecorded(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockLatency(time.Second))
+	b := NewBroker([]Provider{p}, WithProviderTimeout("mock", 5*time.Millisecond))
+	defer b.Close()
+
+	// The provider's own timeout is the provider's failure, not the caller's
+	if _, err := b.GetLocation(context.Background(), testIP(0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.ErrorsInWindow != 1 {
+		t.Errorf("%d errors after the provider timed out, want 1", snap.ErrorsInWindow)
+	}
+}
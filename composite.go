@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CompositeProvider presents two providers to the broker as one, trying the
+// primary first and the secondary when the primary fails or returns nothing
+// useful, e.g. a local database backed by an online service for ranges it
+// doesn't know yet
+type CompositeProvider struct {
+	name      string
+	primary   Provider
+	secondary Provider
+}
+
+// NewCompositeProvider creates a provider named name that falls back from
+// primary to secondary
+func NewCompositeProvider(name string, primary, secondary Provider) *CompositeProvider {
+	return &CompositeProvider{name: name, primary: primary, secondary: secondary}
+}
+
+func (p *CompositeProvider) Name() string {
+	return p.name
+}
+
+// GetLocation asks the primary, then the secondary if the primary failed or
+// returned a location without a country. When both fail the secondary's
+// error is the one that classifies the failure.
+func (p *CompositeProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	location, err := p.primary.GetLocation(ctx, ip)
+	if err == nil && location != nil && location.Country != "" {
+		return location, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	primaryErr := err
+	if primaryErr == nil {
+		primaryErr = errors.New("empty result")
+	}
+
+	location, err = p.secondary.GetLocation(ctx, ip)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s failed (%v), then %s failed: %w",
+			p.name, p.primary.Name(), primaryErr, p.secondary.Name(), err)
+	}
+	return location, nil
+}
+
+// GetMaxRequestsPerMinute returns the lower of the two providers' limits,
+// since any call may reach either. A provider without a limit doesn't
+// constrain the other.
+func (p *CompositeProvider) GetMaxRequestsPerMinute() int {
+	a, b := p.primary.GetMaxRequestsPerMinute(), p.secondary.GetMaxRequestsPerMinute()
+	switch {
+	case a <= 0:
+		return max(b, 0)
+	case b <= 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
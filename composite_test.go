@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCompositeProvider(t *testing.T) {
+	errPrimary, errSecondary := errors.New("primary down"), ErrProviderRateLimited
+	tests := []struct {
+		name          string
+		primary       []MockOption
+		secondary     []MockOption
+		wantProvider  string // which leg's answer comes back, empty for an error
+		wantSecondary int
+	}{
+		{"primary answers", []MockOption{MockResponse("8.8.8.8", Location{Country: "US"})}, nil, "primary", 0},
+		{"primary fails", []MockOption{MockFailCalls(1, 1, errPrimary)}, []MockOption{MockResponse("8.8.8.8", Location{Country: "GB"})}, "secondary", 1},
+		// A range the local database doesn't know yet
+		{"primary empty", []MockOption{MockResponse("8.8.8.8", Location{City: "Nowhere"})}, []MockOption{MockResponse("8.8.8.8", Location{Country: "GB"})}, "secondary", 1},
+		{"both fail", []MockOption{MockFailCalls(1, 1, errPrimary)}, []MockOption{MockFailCalls(1, 1, errSecondary)}, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := NewMockProvider("local", 0, tt.primary...)
+			secondary := NewMockProvider("online", 0, tt.secondary...)
+			p := NewCompositeProvider("composite", primary, secondary)
+
+			loc, err := p.GetLocation(context.Background(), "8.8.8.8")
+			switch tt.wantProvider {
+			case "primary":
+				if err != nil || loc.Country != "US" {
+					t.Errorf("got %+v, %v, want the primary's answer", loc, err)
+				}
+			case "secondary":
+				if err != nil || loc.Country != "GB" {
+					t.Errorf("got %+v, %v, want the secondary's answer", loc, err)
+				}
+			default:
+				// The secondary's error classifies the failure
+				if !errors.Is(err, errSecondary) || errors.Is(err, errPrimary) {
+					t.Errorf("got %v, want the secondary's error", err)
+				}
+			}
+			if n := primary.Calls(); n != 1 {
+				t.Errorf("primary called %d times, want 1", n)
+			}
+			if n := secondary.Calls(); n != tt.wantSecondary {
+				t.Errorf("secondary called %d times, want %d", n, tt.wantSecondary)
+			}
+		})
+	}
+}
+
+func TestCompositeProviderCanceled(t *testing.T) {
+	primary := NewMockProvider("local", 0, MockGate(make(chan struct{})))
+	secondary := NewMockProvider("online", 0)
+	p := NewCompositeProvider("composite", primary, secondary)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if n := secondary.Calls(); n != 0 {
+		t.Errorf("secondary called %d times after the caller gave up", n)
+	}
+}
+
+func TestCompositeProviderRateLimit(t *testing.T) {
+	tests := []struct {
+		primary, secondary, want int
+	}{
+		{60, 45, 45},
+		{45, 60, 45},
+		{0, 45, 45},
+		{60, 0, 60},
+		{0, 0, 0},
+		{-1, 30, 30},
+	}
+	for _, tt := range tests {
+		p := NewCompositeProvider("composite", NewMockProvider("local", tt.primary), NewMockProvider("online", tt.secondary))
+		if got := p.GetMaxRequestsPerMinute(); got != tt.want {
+			t.Errorf("limits %d and %d: got %d, want %d", tt.primary, tt.secondary, got, tt.want)
+		}
+	}
+}
+
+func TestCompositeProviderThroughBroker(t *testing.T) {
+	primary := NewMockProvider("local", 0, MockFailCalls(1, 1, nil))
+	secondary := NewMockProvider("online", 2)
+	p := NewCompositeProvider("composite", primary, secondary)
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), testIP(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "composite" {
+		t.Errorf("served by %q, want the composite's name", loc.Provider)
+	}
+	// The broker enforces the lower of the two limits
+	b.GetLocation(context.Background(), testIP(1))
+	if _, err := b.GetLocation(context.Background(), testIP(2)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Errorf("third lookup: got %v, want ErrAllProvidersRateLimited", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+// ConfidenceRules decide the Confidence of a result, from 0 to 100, by how
+// it was produced
+type ConfidenceRules struct {
+	// Live is the confidence of an answer fresh from an online provider and
+	// Static that of one from a local database, such as a FileProvider, a
+	// MaxMind file or a cache seed
+	Live   int
+	Static int
+	// PrefixHit caps the confidence of a cached answer given for another
+	// address in the same prefix, and Stale that of a cached answer past its
+	// TTL, served while it is refreshed
+	PrefixHit int
+	Stale     int
+	// FlakyPenalty is taken off answers from a provider whose recent error
+	// rate is above FlakyErrorRate
+	FlakyErrorRate float64
+	FlakyPenalty   int
+	// In consensus mode, AgreementBonus is added for every provider beyond
+	// the first that agreed with the answer, and DisputedPenalty taken off
+	// when others disagreed
+	AgreementBonus  int
+	DisputedPenalty int
+}
+
+// DefaultConfidenceRules are used unless WithConfidenceRules says otherwise
+var DefaultConfidenceRules = ConfidenceRules{
+	Live:            90,
+	Static:          30,
+	PrefixHit:       60,
+	Stale:           30,
+	FlakyErrorRate:  0.2,
+	FlakyPenalty:    20,
+	AgreementBonus:  5,
+	DisputedPenalty: 20,
+}
+
+// StaticProvider can be implemented by a provider answering from a local
+// database rather than a live service, so its answers get
+// ConfidenceRules.Static
+type StaticProvider interface {
+	Static() bool
+}
+
+// live returns the confidence of an answer ps just gave
+func (r ConfidenceRules) live(ps *ProviderStats) int {
+	confidence := r.Live
+	if static, ok := asProvider[StaticProvider](ps.provider); ok && static.Static() {
+		confidence = r.Static
+	}
+	if r.FlakyErrorRate > 0 && ps.recentErrorRate() > r.FlakyErrorRate {
+		confidence -= r.FlakyPenalty
+	}
+	return clampConfidence(confidence)
+}
+
+// cached returns the confidence of a cached answer. Entries cached before
+// confidence was recorded are taken as live answers.
+func (r ConfidenceRules) cached(loc *Location, prefixHit bool) int {
+	confidence := loc.Confidence
+	if confidence == 0 {
+		confidence = r.Live
+	}
+	if prefixHit {
+		confidence = min(confidence, r.PrefixHit)
+	}
+	if loc.Stale {
+		confidence = min(confidence, r.Stale)
+	}
+	return clampConfidence(confidence)
+}
+
+// consensus returns the confidence of an answer agreed on by agreed
+// providers, starting from that of the answer picked
+func (r ConfidenceRules) consensus(confidence, agreed int, disputed bool) int {
+	confidence += r.AgreementBonus * (agreed - 1)
+	if disputed {
+		confidence -= r.DisputedPenalty
+	}
+	return clampConfidence(confidence)
+}
+
+func clampConfidence(confidence int) int {
+	return min(max(confidence, 0), 100)
+}
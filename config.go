@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Config is the broker's configuration file, written as JSON
+type Config struct {
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as "5s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads the config file at path. Unknown fields are rejected, so
+// a misspelt setting isn't silently ignored.
+func LoadConfig(path string) (Config, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks every provider entry, returning one error per problem.
+// Each error names the entry by position and type, and the field at fault.
+// Settings only a provider itself can check, such as a required path, are
+// reported when it is built.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(i int, cfg ProviderConfig, field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("provider %d (%s): %s: %s", i, cfg.Type, field, fmt.Sprintf(format, args...)))
+	}
+
+	known := make(map[string]bool)
+	for _, name := range ProviderTypes() {
+		known[name] = true
+	}
+	for i, cfg := range c.Providers {
+		switch {
+		case cfg.Type == "":
+			fail(i, cfg, "type", "is required")
+		case !known[cfg.Type]:
+			fail(i, cfg, "type", "unknown type %q (known: %v)", cfg.Type, ProviderTypes())
+		}
+		if cfg.MaxRequestsPerMinute < 0 {
+			fail(i, cfg, "max_requests_per_minute", "must not be negative")
+		}
+		if cfg.Timeout < 0 {
+			fail(i, cfg, "timeout", "must not be negative")
+		}
+		if cfg.RetryAttempts < 0 {
+			fail(i, cfg, "retry_attempts", "must not be negative")
+		}
+		if cfg.RetryBackoff < 0 {
+			fail(i, cfg, "retry_backoff", "must not be negative")
+		}
+		if cfg.BaseURL != "" {
+			if _, err := ValidateBaseURL(cfg.BaseURL); err != nil {
+				fail(i, cfg, "base_url", "%v", err)
+			}
+		}
+		if cfg.Token != "" && cfg.KeyEnv != "" {
+			fail(i, cfg, "key_env", "set token or key_env, not both")
+		}
+		if len(cfg.Tokens) > 0 && (cfg.Token != "" || cfg.KeyEnv != "") {
+			fail(i, cfg, "tokens", "set tokens, token or key_env, only one of them")
+		}
+		if slices.Contains(cfg.Tokens, "") {
+			fail(i, cfg, "tokens", "must not be empty")
+		}
+		if cfg.KeyEnv != "" && cfg.enabled() && os.Getenv(cfg.KeyEnv) == "" {
+			fail(i, cfg, "key_env", "environment variable %s is not set", cfg.KeyEnv)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadProvidersFromConfig validates cfg and builds its enabled providers
+func LoadProvidersFromConfig(cfg Config) ([]Provider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	providers, err := BuildProviders(cfg.Providers)
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no providers are enabled")
+	}
+	return providers, nil
+}
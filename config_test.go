@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		wantErr string // empty for a valid entry
+	}{
+		{"minimal", ProviderConfig{Type: "ipinfo"}, ""},
+		{"full", ProviderConfig{Type: "ipinfo", Token: "t", MaxRequestsPerMinute: 5, Timeout: Duration(time.Second),
+			RetryAttempts: 3, RetryBackoff: Duration(time.Millisecond), BaseURL: "https://example.com"}, ""},
+		{"missing type", ProviderConfig{}, "provider 0 (): type: is required"},
+		{"unknown type", ProviderConfig{Type: "nosuch"}, `provider 0 (nosuch): type: unknown type "nosuch"`},
+		{"negative rate limit", ProviderConfig{Type: "ipinfo", MaxRequestsPerMinute: -1}, "max_requests_per_minute: must not be negative"},
+		{"negative timeout", ProviderConfig{Type: "ipinfo", Timeout: Duration(-time.Second)}, "timeout: must not be negative"},
+		{"negative retries", ProviderConfig{Type: "ipinfo", RetryAttempts: -1}, "retry_attempts: must not be negative"},
+		{"negative backoff", ProviderConfig{Type: "ipinfo", RetryBackoff: Duration(-time.Second)}, "retry_backoff: must not be negative"},
+		{"bad base url", ProviderConfig{Type: "ipinfo", BaseURL: "ftp://example.com"}, "base_url:"},
+		{"token and key_env", ProviderConfig{Type: "ipinfo", Token: "t", KeyEnv: "CONFIG_TEST_KEY"}, "key_env: set token or key_env, not both"},
+		{"tokens and token", ProviderConfig{Type: "ipinfo", Token: "t", Tokens: []string{"a"}}, "tokens: set tokens, token or key_env"},
+		{"empty token in tokens", ProviderConfig{Type: "ipinfo", Tokens: []string{"a", ""}}, "tokens: must not be empty"},
+		{"unset key_env", ProviderConfig{Type: "ipinfo", KeyEnv: "CONFIG_TEST_UNSET"}, "key_env: environment variable CONFIG_TEST_UNSET is not set"},
+		{"unset key_env, disabled", ProviderConfig{Type: "ipinfo", KeyEnv: "CONFIG_TEST_UNSET", Enabled: &disabled}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_TEST_KEY", "key")
+			err := Config{Providers: []ProviderConfig{tt.cfg}}.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("got %v, want a valid entry", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateReportsEveryProblem(t *testing.T) {
+	err := Config{Providers: []ProviderConfig{
+		{Type: "ipinfo"},
+		{Type: "nosuch", MaxRequestsPerMinute: -1},
+		{Type: "ip-api", Timeout: Duration(-time.Second)},
+	}}.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed")
+	}
+	for _, want := range []string{"provider 1 (nosuch): type:", "provider 1 (nosuch): max_requests_per_minute:", "provider 2 (ip-api): timeout:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "provider 0") {
+		t.Errorf("error %q blames the valid entry", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    ProviderConfig
+		wantErr string
+	}{
+		{"durations", `{"providers": [{"type": "ipinfo", "timeout": "2s", "retry_backoff": "100ms"}]}`,
+			ProviderConfig{Type: "ipinfo", Timeout: Duration(2 * time.Second), RetryBackoff: Duration(100 * time.Millisecond)}, ""},
+		{"headers", `{"providers": [{"type": "ipinfo", "headers": {"X-Team": "geo"}, "user_agent": "ua"}]}`,
+			ProviderConfig{Type: "ipinfo", Headers: map[string]string{"X-Team": "geo"}, UserAgent: "ua"}, ""},
+		{"unknown field", `{"providers": [{"type": "ipinfo", "tokn": "t"}]}`, ProviderConfig{}, `unknown field "tokn"`},
+		{"numeric duration", `{"providers": [{"type": "ipinfo", "timeout": 5}]}`, ProviderConfig{}, "duration must be a string"},
+		{"bad duration", `{"providers": [{"type": "ipinfo", "timeout": "soon"}]}`, ProviderConfig{}, "invalid duration"},
+		{"not json", `providers: []`, ProviderConfig{}, "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+					t.Errorf("got %v, want an error naming the file and containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Providers) != 1 {
+				t.Fatalf("got %d providers, want 1", len(cfg.Providers))
+			}
+			got := cfg.Providers[0]
+			if got.Type != tt.want.Type || got.Timeout != tt.want.Timeout || got.RetryBackoff != tt.want.RetryBackoff ||
+				got.UserAgent != tt.want.UserAgent || len(got.Headers) != len(tt.want.Headers) || got.Headers["X-Team"] != tt.want.Headers["X-Team"] {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("got %v for a missing file, want a not-exist error", err)
+	}
+}
+
+func TestLoadProvidersFromConfig(t *testing.T) {
+	disabled := false
+	if _, err := LoadProvidersFromConfig(Config{Providers: []ProviderConfig{{Type: "ipinfo", Enabled: &disabled}}}); err == nil ||
+		!strings.Contains(err.Error(), "no providers are enabled") {
+		t.Errorf("got %v, want an error for a config with no enabled provider", err)
+	}
+	if _, err := LoadProvidersFromConfig(Config{Providers: []ProviderConfig{{Type: "nosuch"}}}); err == nil ||
+		!strings.Contains(err.Error(), "type:") {
+		t.Errorf("got %v, want the validation error", err)
+	}
+	providers, err := LoadProvidersFromConfig(Config{Providers: []ProviderConfig{{Type: "ipinfo"}, {Type: "ip-api", MaxRequestsPerMinute: 20}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 2 || providers[1].GetMaxRequestsPerMinute() != 20 {
+		t.Errorf("got %d providers, want 2 with the second limited to 20 per minute", len(providers))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// vote is a single provider's answer in consensus mode
+type vote struct {
+	ps       *ProviderStats
+	rank     int
+	location *Location
+	err      error
+}
+
+// lookupConsensus queries the top candidates concurrently and reconciles
+// their answers by majority vote on the country
+func (b *Broker) lookupConsensus(ctx context.Context, ip string, candidates []*ProviderStats) (*Location, error) {
+	voters := candidates
+	if len(voters) > b.consensus.voters {
+		voters = voters[:b.consensus.voters]
+	}
+
+	votes := make([]vote, len(voters))
+	var wg sync.WaitGroup
+	for i, ps := range voters {
+		wg.Add(1)
+		go func(i int, ps *ProviderStats) {
+			defer wg.Done()
+			location, err := b.callProvider(ctx, ps, ip)
+			votes[i] = vote{ps: ps, rank: i, location: location, err: err}
+		}(i, ps)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Group successful answers by country
+	groups := make(map[string][]vote)
+	var order []string
+	errs := make([]error, 0, len(votes))
+	for _, v := range votes {
+		if v.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.ps.provider.Name(), v.err))
+			continue
+		}
+		key := v.location.CountryCode
+		if key == "" {
+			key = strings.ToLower(v.location.Country)
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], v)
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("all %d providers failed: %w", len(votes), errors.Join(errs...))
+	}
+
+	// Pick the largest group, breaking ties with the configured rule
+	var winner string
+	for _, key := range order {
+		if winner == "" || len(groups[key]) > len(groups[winner]) ||
+			(len(groups[key]) == len(groups[winner]) && b.preferGroup(groups[key], groups[winner])) {
+			winner = key
+		}
+	}
+
+	// Count disagreements against the providers that voted for a losing answer
+	for key, group := range groups {
+		if key == winner {
+			continue
+		}
+		for _, v := range group {
+			v.ps.mutex.Lock()
+			v.ps.disagreements++
+			v.ps.mutex.Unlock()
+		}
+	}
+
+	best := b.bestVote(groups[winner])
+	result := *best.location
+	result.Disputed = len(groups) > 1
+	result.Confidence = b.confidence.consensus(result.Confidence, len(groups[winner]), result.Disputed)
+	for _, v := range groups[winner] {
+		if v != best {
+			fillDetails(&result, v.location)
+		}
+	}
+	return &result, nil
+}
+
+// fillDetails copies details from other into a result that lacks them, so
+// one provider leaving out a detail doesn't lose it when another supplied
+// it. The network fields describe the address and are always taken; the
+// region, postal code and time zone only when both name the same city.
+func fillDetails(result, other *Location) {
+	if result.ASN == "" {
+		result.ASN = other.ASN
+	}
+	if result.ISP == "" {
+		result.ISP = other.ISP
+	}
+	if result.Org == "" {
+		result.Org = other.Org
+	}
+	if !strings.EqualFold(result.City, other.City) {
+		return
+	}
+	if result.Region == "" {
+		result.Region = other.Region
+	}
+	if result.PostalCode == "" {
+		result.PostalCode = other.PostalCode
+	}
+	if result.Timezone == "" {
+		result.Timezone = other.Timezone
+	}
+}
+
+// preferGroup reports whether group a should win a tie against group other
+func (b *Broker) preferGroup(a, other []vote) bool {
+	return b.preferVote(b.bestVote(a), b.bestVote(other))
+}
+
+// bestVote returns the most trustworthy vote in a group
+func (b *Broker) bestVote(group []vote) vote {
+	best := group[0]
+	for _, v := range group[1:] {
+		if b.preferVote(v, best) {
+			best = v
+		}
+	}
+	return best
+}
+
+// preferVote reports whether vote a is more trustworthy than vote other
+// according to the configured tie-breaking rule
+func (b *Broker) preferVote(a, other vote) bool {
+	if b.consensus.tieBreak == TieBreakLowestErrorRate {
+		errA, errB := a.ps.recentErrorRate(), other.ps.recentErrorRate()
+		if errA != errB {
+			return errA < errB
+		}
+	}
+	return a.rank < other.rank
+}
+
+// recentErrorRate returns the fraction of the provider's recent requests
+// that failed
+func (ps *ProviderStats) recentErrorRate() float64 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.errorRate()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// voter returns a provider answering ip with the given city
+func voter(name, ip, city string, opts ...MockOption) *MockProvider {
+	return NewMockProvider(name, 0, append([]MockOption{MockResponse(ip, MockCities[city])}, opts...)...)
+}
+
+func TestConsensusMajority(t *testing.T) {
+	ip := testIP(1)
+	tests := []struct {
+		name              string
+		cities            []string
+		wantCountry       string
+		wantDisputed      bool
+		wantDisagreements []int
+	}{
+		{"agreement", []string{"Berlin", "Berlin", "Berlin"}, "DE", false, []int{0, 0, 0}},
+		{"outvoted", []string{"Berlin", "London", "Berlin"}, "DE", true, []int{0, 1, 0}},
+		{"outvoted first", []string{"Tokyo", "Sydney", "Sydney"}, "AU", true, []int{1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var providers []Provider
+			var mocks []*MockProvider
+			for i, city := range tt.cities {
+				p := voter(string(rune('a'+i)), ip, city)
+				providers = append(providers, p)
+				mocks = append(mocks, p)
+			}
+			b := NewBroker(providers, WithConsensus(3, TieBreakLowestErrorRate))
+			defer b.Close()
+
+			loc, err := b.GetLocation(context.Background(), ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.CountryCode != tt.wantCountry || loc.Disputed != tt.wantDisputed {
+				t.Errorf("got %s (disputed %v), want %s (disputed %v)", loc.CountryCode, loc.Disputed, tt.wantCountry, tt.wantDisputed)
+			}
+			for i, p := range mocks {
+				if n := p.Calls(); n != 1 {
+					t.Errorf("%s called %d times, want 1", p.Name(), n)
+				}
+				snap, err := b.Snapshot(p.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if snap.Disagreements != tt.wantDisagreements[i] {
+					t.Errorf("%s has %d disagreements, want %d", p.Name(), snap.Disagreements, tt.wantDisagreements[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsensusTieBreak(t *testing.T) {
+	ip := testIP(1)
+	tests := []struct {
+		tieBreak TieBreak
+		want     string
+	}{
+		// flaky is ranked first but has failed before
+		{TieBreakLowestErrorRate, "GB"},
+		{TieBreakBestRanked, "DE"},
+	}
+	for _, tt := range tests {
+		flaky := voter("flaky", ip, "Berlin", MockFailCalls(1, 1, ErrProviderUnavailable))
+		steady := voter("steady", ip, "London")
+		b := NewBroker([]Provider{flaky, steady}, WithProviderTier("steady", 1), WithConsensus(2, tt.tieBreak))
+		defer b.Close()
+
+		// The first lookup fails on flaky and is answered by steady alone
+		if _, err := b.GetLocation(context.Background(), testIP(2)); err != nil {
+			t.Fatal(err)
+		}
+		loc, err := b.GetLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.CountryCode != tt.want || !loc.Disputed {
+			t.Errorf("tie break %d: got %s (disputed %v), want disputed %s", tt.tieBreak, loc.CountryCode, loc.Disputed, tt.want)
+		}
+	}
+}
+
+func TestConsensusTooFewAnswers(t *testing.T) {
+	ip := testIP(1)
+
+	// A single successful voter decides the answer alone
+	b := NewBroker([]Provider{
+		voter("down", ip, "Berlin", MockFailCalls(1, 1, ErrProviderUnavailable)),
+		voter("up", ip, "Tokyo"),
+		voter("denied", ip, "Berlin", MockFailCalls(1, 1, ErrProviderAuth)),
+	}, WithConsensus(3, TieBreakLowestErrorRate))
+	defer b.Close()
+	loc, err := b.GetLocation(context.Background(), ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.CountryCode != "JP" || loc.Disputed {
+		t.Errorf("got %s (disputed %v), want the only answer JP undisputed", loc.CountryCode, loc.Disputed)
+	}
+
+	// With no successful voter every failure is reported
+	b2 := NewBroker([]Provider{
+		voter("down", ip, "Berlin", MockFailCalls(1, 1, ErrProviderUnavailable)),
+		voter("denied", ip, "Berlin", MockFailCalls(1, 1, ErrProviderAuth)),
+	}, WithConsensus(3, TieBreakLowestErrorRate))
+	defer b2.Close()
+	_, err = b2.GetLocation(context.Background(), ip)
+	if !errors.Is(err, ErrProviderUnavailable) || !errors.Is(err, ErrProviderAuth) {
+		t.Errorf("got %v, want both voters' errors", err)
+	}
+	if err != nil && (!strings.Contains(err.Error(), "down:") || !strings.Contains(err.Error(), "denied:")) {
+		t.Errorf("error %q doesn't name each voter", err)
+	}
+}
+
+func TestConsensusVoters(t *testing.T) {
+	ip := testIP(1)
+	first := voter("first", ip, "Berlin")
+	second := voter("second", ip, "Berlin")
+	spare := voter("spare", ip, "Berlin")
+	b := NewBroker([]Provider{first, second, spare}, WithProviderTier("spare", 1), WithConsensus(2, TieBreakLowestErrorRate))
+	defer b.Close()
+
+	// Only the configured number of voters is asked
+	if _, err := b.GetLocation(context.Background(), ip); err != nil {
+		t.Fatal(err)
+	}
+	if spare.Calls() != 0 {
+		t.Errorf("spare called %d times beyond the 2 voters", spare.Calls())
+	}
+
+	if first.Calls() != 1 || second.Calls() != 1 {
+		t.Errorf("voters called %d and %d times, want 1 each", first.Calls(), second.Calls())
+	}
+
+	// A provider out of capacity doesn't vote
+	limited := NewMockProvider("limited", 1)
+	steady := NewMockProvider("steady", 0)
+	b2 := NewBroker([]Provider{limited, steady}, WithConsensus(2, TieBreakLowestErrorRate))
+	defer b2.Close()
+	for i := range 3 {
+		if _, err := b2.GetLocation(context.Background(), testIP(10+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if limited.Calls() != 1 || steady.Calls() != 3 {
+		t.Errorf("limited called %d times and steady %d, want 1 and 3", limited.Calls(), steady.Calls())
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// setCoordinates sets l's coordinates if the provider reported both
+func (l *Location) setCoordinates(lat, lon *float64) {
+	if lat != nil && lon != nil {
+		l.Latitude, l.Longitude, l.HasCoordinates = *lat, *lon, true
+	}
+}
+
+// parseCoordinate parses a coordinate a provider reports as a string. It
+// returns nil if s is empty or not a number.
+func parseCoordinate(s string) *float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// parseLatLon parses a "lat,lon" pair such as ipinfo.io reports
+func parseLatLon(s string) (lat, lon *float64) {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return nil, nil
+	}
+	return parseCoordinate(latStr), parseCoordinate(lonStr)
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseLatLon(t *testing.T) {
+	tests := []struct {
+		s        string
+		ok       bool
+		lat, lon float64
+	}{
+		{"37.4056,-122.0775", true, 37.4056, -122.0775},
+		{" -33.8688 , 151.2093 ", true, -33.8688, 151.2093},
+		{"0,0", true, 0, 0},
+		{"37.4056", false, 0, 0},
+		{"north,west", false, 0, 0},
+		{"", false, 0, 0},
+	}
+	for _, tt := range tests {
+		var loc Location
+		loc.setCoordinates(parseLatLon(tt.s))
+		if loc.HasCoordinates != tt.ok || loc.Latitude != tt.lat || loc.Longitude != tt.lon {
+			t.Errorf("parseLatLon(%q): got %v,%v (%v), want %v,%v (%v)", tt.s, loc.Latitude, loc.Longitude, loc.HasCoordinates, tt.lat, tt.lon, tt.ok)
+		}
+	}
+}
+
+func TestSetCoordinates(t *testing.T) {
+	lat, lon := 51.5074, -0.1278
+	var loc Location
+	// Half a position is no position
+	loc.setCoordinates(&lat, nil)
+	if loc.HasCoordinates {
+		t.Error("coordinates set from a latitude alone")
+	}
+	loc.setCoordinates(&lat, &lon)
+	if !loc.HasCoordinates || loc.Latitude != lat || loc.Longitude != lon {
+		t.Errorf("got %v,%v (%v), want %v,%v", loc.Latitude, loc.Longitude, loc.HasCoordinates, lat, lon)
+	}
+}
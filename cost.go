@@ -0,0 +1,36 @@
+package main
+
+import "time"
+
+// costTracker accumulates what a provider has cost us today. It is guarded
+// by the owning ProviderStats' mutex.
+type costTracker struct {
+	perRequest float64
+	weight     float64
+	day        time.Time
+	spent      float64
+}
+
+// charge adds the cost of one request, starting a new tally when the UTC
+// day has changed
+func (c *costTracker) charge(now time.Time) {
+	if day := utcDay(now); !day.Equal(c.day) {
+		c.day = day
+		c.spent = 0
+	}
+	c.spent += c.perRequest
+}
+
+// spentOn returns the spend for the UTC day containing now
+func (c *costTracker) spentOn(now time.Time) float64 {
+	if !utcDay(now).Equal(c.day) {
+		return 0
+	}
+	return c.spent
+}
+
+// adjust discounts a quality score by the provider's cost so that cheaper
+// providers win when quality is comparable. A weight of zero ignores cost.
+func (c *costTracker) adjust(score float64) float64 {
+	return score / (1.0 + c.weight*c.perRequest)
+}
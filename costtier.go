@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// CostTier ranks providers by what a lookup costs. Unlike priority tiers,
+// which are fixed, a cheaper cost tier is only preferred while its providers
+// clear the broker's QualityBar.
+type CostTier int
+
+const (
+	// CostTierFree is the default tier, for providers used on a free plan
+	CostTierFree CostTier = iota
+	// CostTierPaid is for providers whose lookups are billed
+	CostTierPaid
+)
+
+// QualityBar is the health a provider must show to be preferred over
+// providers in a more expensive cost tier. Zero fields aren't checked.
+type QualityBar struct {
+	// MaxErrorRate is the highest acceptable fraction of failed requests
+	MaxErrorRate float64
+	// MaxLatency is the highest acceptable response time: the moving
+	// average, or the mean in raw window mode
+	MaxLatency time.Duration
+	// MinSamples is the number of completed requests needed before the bar
+	// is applied; providers with fewer pass
+	MinSamples int
+}
+
+// meets reports whether a provider with the metrics in snap clears the bar
+func (q QualityBar) meets(snap ProviderSnapshot) bool {
+	if snap.CompletedRequests < max(q.MinSamples, 1) {
+		return true
+	}
+	if q.MaxErrorRate > 0 && snap.ErrorRate > q.MaxErrorRate {
+		return false
+	}
+	latency := snap.LatencyEWMA
+	if snap.RawWindow {
+		latency = snap.AvgResponseTime
+	}
+	return q.MaxLatency <= 0 || latency <= q.MaxLatency
+}
+
+// costRank orders providers within a priority tier: providers clearing the
+// quality bar come first, cheapest tier first, followed by those that don't
+type costRank struct {
+	belowBar bool
+	tier     CostTier
+}
+
+func (r costRank) less(other costRank) bool {
+	if r.belowBar != other.belowBar {
+		return !r.belowBar
+	}
+	return r.tier < other.tier
+}
+
+// costRank returns where ps ranks by cost. Without cost tiers every provider
+// ranks the same.
+func (b *Broker) costRank(ps *ProviderStats) costRank {
+	if len(b.costTiers) == 0 {
+		return costRank{}
+	}
+	return costRank{belowBar: !b.qualityBar.meets(ps.snapshot()), tier: ps.costTier}
+}
+
+// tierUsage counts the requests sent to each cost tier per UTC day
+type tierUsage struct {
+	mutex  sync.Mutex
+	day    time.Time
+	counts map[CostTier]int
+}
+
+// add records n requests sent to tier at now
+func (u *tierUsage) add(tier CostTier, n int, now time.Time) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if day := utcDay(now); !day.Equal(u.day) || u.counts == nil {
+		u.day = day
+		u.counts = make(map[CostTier]int)
+	}
+	u.counts[tier] += n
+}
+
+// on returns a copy of the counts for the UTC day containing now
+func (u *tierUsage) on(now time.Time) map[CostTier]int {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	counts := make(map[CostTier]int, len(u.counts))
+	if utcDay(now).Equal(u.day) {
+		for tier, n := range u.counts {
+			counts[tier] = n
+		}
+	}
+	return counts
+}
+
+// CostTierRequests returns how many requests went to providers in each cost
+// tier during the current UTC day
+func (b *Broker) CostTierRequests() map[CostTier]int {
+	return b.tierUsage.on(time.Now())
+}
@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+
+// NormalizeCountryCode returns the ISO 3166-1 alpha-2 code, in upper case,
+// for a country given by its code, alpha-3 code or English name, e.g. "us",
+// "USA" and "United States" all give "US". Other two letter codes, such as
+// user-assigned ones, are upper-cased as they are. ok is false for anything
+// else.
+func NormalizeCountryCode(country string) (code string, ok bool) {
+	key := strings.ToLower(strings.Join(strings.Fields(country), " "))
+	if code, ok := countryNames[key]; ok {
+		return code, true
+	}
+	if len(key) == 2 && isASCIILower(key[0]) && isASCIILower(key[1]) {
+		return strings.ToUpper(key), true
+	}
+	return "", false
+}
+
+// CountryName returns the English short name of the country with the
+// alpha-2 code, or "" if the code isn't known
+func CountryName(code string) string {
+	return countries[code].name
+}
+
+// ContinentOf returns the code and name of the continent the country with
+// the alpha-2 code lies in, or "" for both if the code isn't known
+func ContinentOf(code string) (continentCode, continent string) {
+	continentCode = countries[code].continent
+	return continentCode, continents[continentCode]
+}
+
+func isASCIILower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
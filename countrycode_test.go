@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCountryCode(t *testing.T) {
+	tests := []struct {
+		country string
+		want    string // empty when not identified
+	}{
+		{"US", "US"},
+		{"us", "US"},
+		{" gb ", "GB"},
+		{"USA", "US"},
+		{"deu", "DE"},
+		{"United States", "US"},
+		{"United States of America", "US"},
+		{"united  kingdom", "GB"},
+		{"UK", "GB"},
+		{"Germany", "DE"},
+		{"France", "FR"},
+		{"Japan", "JP"},
+		{"China", "CN"},
+		{"India", "IN"},
+		{"Brazil", "BR"},
+		{"Canada", "CA"},
+		{"Australia", "AU"},
+		{"Netherlands", "NL"},
+		{"Russia", "RU"},
+		{"Russian Federation", "RU"},
+		{"South Korea", "KR"},
+		{"Korea, Republic of", "KR"},
+		{"Iran, Islamic Republic of", "IR"},
+		{"Viet Nam", "VN"},
+		{"Czech Republic", "CZ"},
+		{"Turkey", "TR"},
+		{"Türkiye", "TR"},
+		{"Côte d'Ivoire", "CI"},
+		{"Cote d'Ivoire", "CI"},
+		{"Ivory Coast", "CI"},
+		{"Kosovo", "XK"},
+		// User-assigned codes pass through
+		{"zz", "ZZ"},
+		{"Atlantis", ""},
+		{"U", ""},
+		{"XYZ", ""},
+		{"1A", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeCountryCode(tt.country)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("NormalizeCountryCode(%q) = %q, %v, want %q", tt.country, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCountryTables(t *testing.T) {
+	for code, c := range countries {
+		if len(code) != 2 || strings.ToUpper(code) != code {
+			t.Errorf("code %q isn't two upper-case letters", code)
+		}
+		if _, ok := continents[c.continent]; !ok {
+			t.Errorf("%s: unknown continent %q", code, c.continent)
+		}
+		// Every country is found by its code and its own name
+		for _, key := range []string{code, c.name} {
+			if got, _ := NormalizeCountryCode(key); got != code {
+				t.Errorf("NormalizeCountryCode(%q) = %q, want %q", key, got, code)
+			}
+		}
+	}
+	for name, code := range countryNames {
+		if _, ok := countries[code]; !ok {
+			t.Errorf("%q maps to unknown code %q", name, code)
+		}
+		if name != strings.ToLower(name) {
+			t.Errorf("name %q isn't lower case", name)
+		}
+	}
+}
+
+func TestCountryNameAndContinent(t *testing.T) {
+	tests := []struct {
+		code, name, continentCode, continent string
+	}{
+		{"US", "United States", "NA", "North America"},
+		{"BR", "Brazil", "SA", "South America"},
+		{"DE", "Germany", "EU", "Europe"},
+		{"JP", "Japan", "AS", "Asia"},
+		{"AU", "Australia", "OC", "Oceania"},
+		{"ZA", "South Africa", "AF", "Africa"},
+		{"AQ", "Antarctica", "AN", "Antarctica"},
+		{"ZZ", "", "", ""},
+		{"us", "", "", ""},
+	}
+	for _, tt := range tests {
+		if name := CountryName(tt.code); name != tt.name {
+			t.Errorf("CountryName(%q) = %q, want %q", tt.code, name, tt.name)
+		}
+		if code, name := ContinentOf(tt.code); code != tt.continentCode || name != tt.continent {
+			t.Errorf("ContinentOf(%q) = %q, %q, want %q, %q", tt.code, code, name, tt.continentCode, tt.continent)
+		}
+	}
+}
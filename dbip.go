@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// dbipFreeKey is the path segment db-ip.com uses in place of a key for its
+// free tier
+const dbipFreeKey = "free"
+
+// DBIPProvider implements the Provider interface for db-ip.com
+type DBIPProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewDBIPProvider creates a db-ip.com provider. An API key is optional and
+// read from DBIP_API_KEY unless given with WithToken; without one the free
+// tier is used.
+func NewDBIPProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*DBIPProvider, error) {
+	config, err := newHTTPConfig(opts, "DBIP_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return &DBIPProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://api.db-ip.com"),
+		config:               config,
+	}, nil
+}
+
+func (p *DBIPProvider) Name() string {
+	return "db-ip.com"
+}
+
+// dbipResponse is the body of a db-ip.com lookup. Errors are reported with a
+// 200 status and {"error": ...}.
+type dbipResponse struct {
+	IP          string `json:"ipAddress"`
+	CountryCode string `json:"countryCode"` // ISO 3166-1 alpha-2
+	CountryName string `json:"countryName"`
+	StateProv   string `json:"stateProv"`
+	City        string `json:"city"`
+	// Latitude and Longitude are only included on paid plans
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	TimeZone  string   `json:"timeZone"`
+	// The network fields are only included on paid plans too
+	ASNumber     json.Number `json:"asNumber"`
+	ISP          string      `json:"isp"`
+	Organization string      `json:"organization"`
+	Error        string      `json:"error"`
+}
+
+func (p *DBIPProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	// The key is part of the path; redact hides it in any error
+	key := p.config.token
+	if key == "" {
+		key = dbipFreeKey
+	}
+	endpoint := fmt.Sprintf("%s/v2/%s/%s", p.baseURL, url.PathEscape(key), url.PathEscape(ip))
+
+	var result dbipResponse
+	if _, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, p.config.redact(dbipError(p.Name(), result.Error))
+	}
+
+	location := &Location{
+		IP:          result.IP,
+		Country:     result.CountryName,
+		CountryCode: result.CountryCode,
+		City:        result.City,
+		Region:      result.StateProv,
+		Timezone:    result.TimeZone,
+		ASN:         result.ASNumber.String(),
+		ISP:         result.ISP,
+		Org:         result.Organization,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	return location, nil
+}
+
+// dbipError classifies the message of a db-ip.com error envelope
+func dbipError(name, message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "key"):
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, name, message)
+	case strings.Contains(lower, "limit") || strings.Contains(lower, "exceeded") || strings.Contains(lower, "too many"):
+		return rateLimited(name, message, nil)
+	case strings.Contains(lower, "invalid address") || strings.Contains(lower, "reserved") || strings.Contains(lower, "private"):
+		return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, name, message)
+	default:
+		return fmt.Errorf("%s: %s", name, message)
+	}
+}
+
+func (p *DBIPProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDBIPProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		body     string
+		wantPath string
+		want     Location
+	}{
+		{
+			"free tier", "",
+			`{"ipAddress": "8.8.8.8", "continentCode": "NA", "continentName": "North America",
+				"countryCode": "US", "countryName": "United States", "stateProv": "California", "city": "Mountain View"}`,
+			"/v2/free/8.8.8.8",
+			Location{IP: "8.8.8.8", Country: "United States", CountryCode: "US", Region: "California", City: "Mountain View"},
+		},
+		{
+			"paid plan", "dbip-key",
+			`{"ipAddress": "8.8.8.8", "countryCode": "US", "countryName": "United States", "stateProv": "California",
+				"city": "Mountain View", "latitude": 37.4056, "longitude": -122.0775, "timeZone": "America/Los_Angeles",
+				"asNumber": 15169, "isp": "Google LLC", "organization": "Google LLC"}`,
+			"/v2/dbip-key/8.8.8.8",
+			Location{IP: "8.8.8.8", Country: "United States", CountryCode: "US", Region: "California", City: "Mountain View",
+				Timezone: "America/Los_Angeles", ASN: "15169", ISP: "Google LLC", Org: "Google LLC",
+				Latitude: 37.4056, Longitude: -122.0775, HasCoordinates: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DBIP_API_KEY", "")
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewDBIPProvider(100, WithBaseURL(s.URL), WithToken(tt.token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			if path := s.request().URL.Path; path != tt.wantPath {
+				t.Errorf("requested %s, want %s", path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestDBIPProviderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error // nil for any error
+	}{
+		{"invalid key", `{"error": "invalid API key"}`, ErrProviderAuth},
+		{"daily limit", `{"error": "maximum daily query limit exceeded"}`, ErrProviderRateLimited},
+		{"reserved address", `{"error": "reserved address"}`, ErrProviderInvalidIP},
+		{"invalid address", `{"error": "invalid address"}`, ErrProviderInvalidIP},
+		{"other", `{"error": "internal error"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewDBIPProvider(100, WithBaseURL(s.URL), WithToken("dbip-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err == nil {
+				t.Fatalf("got %+v for an error in a 200 response", loc)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBIPProviderMalformed(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, `{"ipAddress": "8.8.8.8", "countryCode": `)
+	p, err := NewDBIPProvider(100, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetLocation(context.Background(), "8.8.8.8"); err == nil || !strings.Contains(err.Error(), "decoding response") {
+		t.Errorf("got %v, want a decoding error", err)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// diskRecord is a single line of a DiskCache file. A record with Deleted set
+// removes any earlier entry for the IP.
+type diskRecord struct {
+	IP       string    `json:"ip"`
+	Location *Location `json:"loc,omitempty"`
+	Expires  int64     `json:"exp,omitempty"` // unix nanoseconds, 0 = never
+	Deleted  bool      `json:"del,omitempty"`
+}
+
+// diskEntry locates a live record in the file
+type diskEntry struct {
+	offset  int64
+	length  int
+	expires time.Time
+}
+
+// DiskCache is a Cache that persists entries to a file so they survive
+// restarts. The file is an append-only log of JSON records; only an index of
+// where each entry lives is kept in memory and locations are read from disk
+// on Get. The log is compacted when it is opened and whenever superseded
+// records outnumber live ones.
+type DiskCache struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+	index map[string]diskEntry
+	// dead counts records in the file that no longer hold a live entry
+	dead int
+}
+
+// minCompactRecords is the number of dead records below which a DiskCache
+// is never compacted
+const minCompactRecords = 1000
+
+// OpenDiskCache opens the cache file at path, creating it if needed. A file
+// that can't be read or is corrupt is logged and replaced with an empty one
+// rather than failing.
+func OpenDiskCache(path string) (*DiskCache, error) {
+	c := &DiskCache{path: path}
+	err := c.load()
+	if err == nil {
+		c.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	}
+	if err != nil {
+		log.Printf("disk cache %s unreadable, starting empty: %v", path, err)
+		c.index = make(map[string]diskEntry)
+	}
+
+	// Compacting rewrites the file from the index, which also replaces a
+	// corrupt file with a clean one
+	if err := c.compact(); err != nil {
+		return nil, fmt.Errorf("disk cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// load builds the index from the existing file, if any
+func (c *DiskCache) load() error {
+	c.index = make(map[string]diskEntry)
+
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	now := time.Now()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Ignore a final record cut short by a crash mid-write
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec diskRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		switch {
+		case rec.Deleted:
+			delete(c.index, rec.IP)
+		case rec.Expires != 0 && now.UnixNano() >= rec.Expires:
+			delete(c.index, rec.IP)
+		default:
+			c.index[rec.IP] = diskEntry{
+				offset:  offset,
+				length:  len(line),
+				expires: expiryTime(rec.Expires),
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Get reads the location stored for ip from disk, if it hasn't expired
+func (c *DiskCache) Get(ctx context.Context, ip string) (*Location, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.index[ip]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		delete(c.index, ip)
+		c.dead++
+		return nil, false, nil
+	}
+
+	buf := make([]byte, entry.length)
+	if _, err := c.file.ReadAt(buf, entry.offset); err != nil {
+		return nil, false, fmt.Errorf("disk cache: reading %s: %w", ip, err)
+	}
+	var rec diskRecord
+	if err := json.Unmarshal(buf, &rec); err != nil || rec.Location == nil {
+		// Drop the damaged entry so it isn't read again
+		delete(c.index, ip)
+		c.dead++
+		return nil, false, fmt.Errorf("disk cache: decoding %s: %v", ip, err)
+	}
+	return rec.Location, true, nil
+}
+
+// Set appends loc for ip to the file
+func (c *DiskCache) Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error {
+	rec := diskRecord{IP: ip, Location: loc}
+	if ttl > 0 {
+		rec.Expires = time.Now().Add(ttl).UnixNano()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, err := c.append(rec)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.index[ip]; ok {
+		c.dead++
+	}
+	c.index[ip] = entry
+	return c.maybeCompact()
+}
+
+// Delete appends a record removing ip
+func (c *DiskCache) Delete(ctx context.Context, ip string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.index[ip]; !ok {
+		return nil
+	}
+	if _, err := c.append(diskRecord{IP: ip, Deleted: true}); err != nil {
+		return err
+	}
+	delete(c.index, ip)
+	// Both the old entry and the tombstone are now dead
+	c.dead += 2
+	return c.maybeCompact()
+}
+
+// Flush removes every entry and truncates the file
+func (c *DiskCache) Flush(ctx context.Context) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.file.Truncate(0); err != nil {
+		return 0, fmt.Errorf("disk cache: %w", err)
+	}
+	removed := len(c.index)
+	clear(c.index)
+	c.size = 0
+	c.dead = 0
+	return removed, nil
+}
+
+// Len returns the number of entries in the cache, including any that have
+// expired but haven't been dropped yet
+func (c *DiskCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.index)
+}
+
+// Close closes the cache file
+func (c *DiskCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.file.Close()
+}
+
+// append writes rec at the end of the file. The caller must hold c.mutex.
+func (c *DiskCache) append(rec diskRecord) (diskEntry, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return diskEntry{}, fmt.Errorf("disk cache: encoding %s: %w", rec.IP, err)
+	}
+	line = append(line, '\n')
+	if _, err := c.file.WriteAt(line, c.size); err != nil {
+		return diskEntry{}, fmt.Errorf("disk cache: writing %s: %w", rec.IP, err)
+	}
+
+	entry := diskEntry{offset: c.size, length: len(line), expires: expiryTime(rec.Expires)}
+	c.size += int64(len(line))
+	return entry, nil
+}
+
+// maybeCompact compacts the file once dead records outnumber live ones.
+// The caller must hold c.mutex.
+func (c *DiskCache) maybeCompact() error {
+	if c.dead < minCompactRecords || c.dead < len(c.index) {
+		return nil
+	}
+	return c.compact()
+}
+
+// compact rewrites the file with only the live, unexpired entries and
+// switches to it. The caller must hold c.mutex, or be opening the cache.
+func (c *DiskCache) compact() error {
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	writer := bufio.NewWriter(tmp)
+	index := make(map[string]diskEntry, len(c.index))
+	var size int64
+	now := time.Now()
+	for ip, entry := range c.index {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			continue
+		}
+		line := make([]byte, entry.length)
+		if _, err := c.file.ReadAt(line, entry.offset); err != nil {
+			continue
+		}
+		if _, err := writer.Write(line); err != nil {
+			tmp.Close()
+			return err
+		}
+		index[ip] = diskEntry{offset: size, length: entry.length, expires: entry.expires}
+		size += int64(entry.length)
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(c.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file = file
+	c.size = size
+	c.index = index
+	c.dead = 0
+	return nil
+}
+
+// expiryTime converts a record's expiry to a time, zero meaning never
+func expiryTime(unixNano int64) time.Time {
+	if unixNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, unixNano)
+}
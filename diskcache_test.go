@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyFixture copies a file from testdata into a temporary directory, as
+// opening a DiskCache rewrites its file
+func copyFixture(t testing.TB, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestDiskCacheVerify(t *testing.T) {
+	c, err := OpenDiskCache(filepath.Join(t.TempDir(), "cache.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := VerifyCache(context.Background(), c); err != nil {
+		t.Error(err)
+	}
+}
+
+// testdata/diskcache.log holds a superseded entry, an expired one, a
+// deleted one, one written before Location had JSON tags and a final record
+// cut short by a crash
+func TestDiskCacheFixture(t *testing.T) {
+	path := copyFixture(t, "diskcache.log")
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if n := c.Len(); n != 3 {
+		t.Errorf("Len %d, want 3", n)
+	}
+	// Opening compacted the file down to the live entries
+	if n := countLines(t, path); n != 3 {
+		t.Errorf("%d records after opening, want 3", n)
+	}
+
+	loc, ok, err := c.Get(ctx, "8.8.8.8")
+	if err != nil || !ok {
+		t.Fatalf("8.8.8.8: ok %v, err %v", ok, err)
+	}
+	if loc.Region != "California" {
+		t.Errorf("8.8.8.8 served from the superseded record: %+v", loc)
+	}
+
+	loc, ok, err = c.Get(ctx, "1.1.1.1")
+	if err != nil || !ok {
+		t.Fatalf("1.1.1.1: ok %v, err %v", ok, err)
+	}
+	if !loc.HasCoordinates || loc.Latitude != -33.8688 || loc.Confidence != 90 {
+		t.Errorf("1.1.1.1 decoded as %+v", loc)
+	}
+
+	loc, ok, err = c.Get(ctx, "5.5.5.5")
+	if err != nil || !ok {
+		t.Fatalf("5.5.5.5: ok %v, err %v", ok, err)
+	}
+	wantCached := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if loc.City != "Berlin" || loc.Latency != 120*time.Millisecond || !loc.CachedAt.Equal(wantCached) {
+		t.Errorf("legacy record decoded as %+v", loc)
+	}
+
+	for _, ip := range []string{"9.9.9.9", "4.4.4.4", "2.2.2.2"} {
+		if _, ok, err := c.Get(ctx, ip); ok || err != nil {
+			t.Errorf("%s: ok %v, err %v; want a miss", ip, ok, err)
+		}
+	}
+}
+
+func TestDiskCacheCorruptFile(t *testing.T) {
+	path := copyFixture(t, "diskcache-corrupt.log")
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatalf("opening a corrupt file failed: %v", err)
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len %d, want an empty cache", n)
+	}
+	if n := countLines(t, path); n != 0 {
+		t.Errorf("%d records left in the replaced file", n)
+	}
+
+	ctx := context.Background()
+	if err := c.Set(ctx, "8.8.8.8", &Location{IP: "8.8.8.8", Country: "United States"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok, err := c.Get(ctx, "8.8.8.8"); !ok || err != nil {
+		t.Errorf("entry written after recovery: ok %v, err %v", ok, err)
+	}
+}
+
+func TestDiskCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	ctx := context.Background()
+
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MockCities["London"]
+	want.IP = "81.2.69.142"
+	if err := c.Set(ctx, want.IP, &want, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "1.1.1.1", &Location{IP: "1.1.1.1", Country: "Australia"}, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "8.8.8.8", &Location{IP: "8.8.8.8", Country: "United States"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	c, err = OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	got, ok, err := c.Get(ctx, want.IP)
+	if err != nil || !ok {
+		t.Fatalf("entry lost across reopening: ok %v, err %v", ok, err)
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8"} {
+		if _, ok, err := c.Get(ctx, ip); ok || err != nil {
+			t.Errorf("%s: ok %v, err %v; want a miss", ip, ok, err)
+		}
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Errorf("%d records after reopening, want 1", n)
+	}
+}
+
+func TestDiskCacheCompactsWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	for i := range 3 * minCompactRecords {
+		loc := &Location{IP: "8.8.8.8", Country: "United States", City: fmt.Sprint(i)}
+		if err := c.Set(ctx, "8.8.8.8", loc, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countLines(t, path); n > minCompactRecords+1 {
+		t.Errorf("%d records for one live entry; the log wasn't compacted", n)
+	}
+	got, ok, err := c.Get(ctx, "8.8.8.8")
+	if err != nil || !ok || got.City != fmt.Sprint(3*minCompactRecords-1) {
+		t.Errorf("after compaction got %+v, ok %v, err %v", got, ok, err)
+	}
+}
+
+// BenchmarkColdStart looks up the same addresses before and after a
+// restart and reports how many of the second run's lookups reached a
+// provider, with only an in-memory cache and with a DiskCache
+func BenchmarkColdStart(b *testing.B) {
+	ips := make([]string, 200)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("8.8.%d.%d", i/250, i%250+1)
+	}
+	ctx := context.Background()
+
+	run := func(b *testing.B, cache func() (Cache, func())) {
+		var calls int
+		for range b.N {
+			p := NewMockProvider("mock", 0)
+			for range 2 {
+				store, closeStore := cache()
+				broker := NewBroker([]Provider{p}, WithCacheStore(store, time.Hour))
+				p.Reset()
+				for _, ip := range ips {
+					if _, err := broker.GetLocation(ctx, ip); err != nil {
+						b.Fatal(err)
+					}
+				}
+				broker.Close()
+				closeStore()
+			}
+			calls += p.Calls()
+		}
+		b.ReportMetric(float64(calls)/float64(b.N), "provider-calls/op")
+	}
+
+	b.Run("memory", func(b *testing.B) {
+		run(b, func() (Cache, func()) {
+			return NewLRUCache(len(ips)), func() {}
+		})
+	})
+	b.Run("disk", func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "cache.log")
+		run(b, func() (Cache, func()) {
+			c, err := OpenDiskCache(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return c, func() { c.Close() }
+		})
+	})
+}
+
+func TestDiskCacheTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	ctx := context.Background()
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"} {
+		if err := c.Set(ctx, ip, &Location{IP: ip, Country: "ZZ"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastStart := bytes.LastIndexByte(full[:len(full)-1], '\n') + 1
+
+	// A crash can cut the last record off anywhere; the records before it
+	// survive and the torn one is dropped
+	for cut := lastStart; cut < len(full); cut++ {
+		if err := os.WriteFile(path, full[:cut], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := OpenDiskCache(path)
+		if err != nil {
+			t.Fatalf("cut at %d: %v", cut, err)
+		}
+		for ip, want := range map[string]bool{"1.1.1.1": true, "8.8.8.8": true, "9.9.9.9": false} {
+			if _, ok, err := c.Get(ctx, ip); ok != want || err != nil {
+				t.Errorf("cut at %d: %s ok %v, err %v; want ok %v", cut, ip, ok, err, want)
+			}
+		}
+		c.Close()
+		if n := countLines(t, path); n != 2 {
+			t.Errorf("cut at %d: %d records after reopening, want the 2 intact ones", cut, n)
+		}
+	}
+}
+
+func TestDiskCacheSurvivesCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	ctx := context.Background()
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Set(ctx, "8.8.8.8", &Location{IP: "8.8.8.8", Country: "ZZ"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "1.1.1.1", &Location{IP: "1.1.1.1", Country: "ZZ"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every write went straight to the file, so a process that dies
+	// without closing the cache loses nothing
+	reopened, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, ok, err := reopened.Get(ctx, "8.8.8.8"); !ok || err != nil {
+		t.Errorf("8.8.8.8 after a crash: ok %v, err %v", ok, err)
+	}
+	if _, ok, err := reopened.Get(ctx, "1.1.1.1"); ok || err != nil {
+		t.Errorf("deleted 1.1.1.1 after a crash: ok %v, err %v; want a miss", ok, err)
+	}
+}
+
+func TestDiskCacheCompactsDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	ctx := context.Background()
+	c, err := OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "8.8.8.8", &Location{IP: "8.8.8.8", Country: "ZZ"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Each set and delete leaves two dead records behind
+	for i := range minCompactRecords {
+		ip := fmt.Sprintf("10.0.%d.%d", i/250, i%250+1)
+		if err := c.Set(ctx, ip, &Location{IP: ip, Country: "ZZ"}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Delete(ctx, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countLines(t, path); n >= 2*minCompactRecords {
+		t.Errorf("%d records for one live entry; tombstones weren't compacted", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The compacted log reads back the same
+	c, err = OpenDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len %d after reopening the compacted log, want 1", n)
+	}
+	if _, ok, err := c.Get(ctx, "8.8.8.8"); !ok || err != nil {
+		t.Errorf("8.8.8.8 after compaction: ok %v, err %v", ok, err)
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Errorf("%d records after reopening, want 1", n)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// DrainProvider stops selecting the named provider for new lookups and
+// waits for the calls already sent to it to finish, so it can then be
+// removed or have its credentials rotated without cutting any off. It
+// returns ctx.Err() if ctx is done first; the provider stays draining
+// either way until ResumeProvider is called.
+func (b *Broker) DrainProvider(ctx context.Context, name string) error {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	ps.mutex.Lock()
+	ps.draining = true
+	if ps.inFlight == 0 {
+		ps.mutex.Unlock()
+		return nil
+	}
+	if ps.drained == nil {
+		ps.drained = make(chan struct{})
+	}
+	drained := ps.drained
+	ps.mutex.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResumeProvider lets a provider drained with DrainProvider serve lookups
+// again
+func (b *Broker) ResumeProvider(name string) error {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	ps.mutex.Lock()
+	ps.draining = false
+	ps.mutex.Unlock()
+	return nil
+}
+
+// finishCall marks a call counted by admit as finished, waking
+// DrainProvider when it was the last one
+func (ps *ProviderStats) finishCall() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.inFlight--
+	if ps.inFlight == 0 && ps.drained != nil {
+		close(ps.drained)
+		ps.drained = nil
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainProvider(t *testing.T) {
+	gate := make(chan struct{})
+	old := NewMockProvider("old", 0, MockGate(gate))
+	replacement := NewMockProvider("new", 0)
+	b := NewBroker([]Provider{old, replacement}, WithProviderTier("new", 1))
+	defer b.Close()
+	ctx := context.Background()
+
+	// A lookup is in flight on old when the drain starts
+	inFlight := make(chan error, 1)
+	go func() {
+		loc, err := b.GetLocation(ctx, testIP(1))
+		if err == nil && loc.Provider != "old" {
+			t.Errorf("in-flight lookup served by %s, want old", loc.Provider)
+		}
+		inFlight <- err
+	}()
+	for deadline := time.Now().Add(2 * time.Second); old.Calls() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("lookup never reached old")
+		}
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- b.DrainProvider(ctx, "old") }()
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned %v with a call still in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// New lookups go elsewhere while old is draining
+	loc, err := b.GetLocation(ctx, testIP(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "new" {
+		t.Errorf("lookup during the drain served by %s, want new", loc.Provider)
+	}
+	if _, err := b.GetLocationFrom(ctx, "old", testIP(3)); err == nil {
+		t.Error("lookup forced through a draining provider succeeded")
+	}
+	if n := old.Calls(); n != 1 {
+		t.Errorf("old called %d times while draining, want only the in-flight call", n)
+	}
+	if snap, _ := b.Snapshot("old"); !snap.Draining || snap.InFlight != 1 {
+		t.Errorf("got draining %v with %d in flight, want draining with 1", snap.Draining, snap.InFlight)
+	}
+
+	// The in-flight call finishes normally and the drain completes
+	close(gate)
+	if err := <-inFlight; err != nil {
+		t.Errorf("in-flight lookup failed: %v", err)
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Errorf("drain: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain didn't finish after the in-flight call")
+	}
+
+	// Resuming puts old back in rotation
+	if err := b.ResumeProvider("old"); err != nil {
+		t.Fatal(err)
+	}
+	loc, err = b.GetLocation(ctx, testIP(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "old" {
+		t.Errorf("lookup after resuming served by %s, want old", loc.Provider)
+	}
+}
+
+func TestDrainProviderTimeout(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("mock", 0, MockGate(gate))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+	defer close(gate)
+	go b.GetLocation(context.Background(), testIP(1))
+	for deadline := time.Now().Add(2 * time.Second); p.Calls() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("lookup never reached the provider")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.DrainProvider(ctx, "mock"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's deadline", err)
+	}
+	if err := b.DrainProvider(context.Background(), "missing"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("got %v, want ErrUnknownProvider", err)
+	}
+	if err := b.ResumeProvider("missing"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("got %v, want ErrUnknownProvider", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrBrokerClosed is returned by GetLocation after the broker has been closed
+var ErrBrokerClosed = errors.New("broker is closed")
+
+// ErrUnknownProvider is returned when a provider name doesn't match any
+// provider registered with the broker
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// ErrCircuitOpen is returned for a provider whose circuit breaker is not
+// currently letting requests through
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrProviderRateLimited is returned when a provider has no capacity left
+// for the current rate limit window
+var ErrProviderRateLimited = errors.New("provider rate limit exceeded")
+
+// ErrAllProvidersRateLimited is returned when every provider is out of
+// capacity and the caller's context ended before any capacity freed up
+var ErrAllProvidersRateLimited = errors.New("all providers are rate limited")
+
+// ErrQuotaExhausted is returned, inside an *ErrRateLimited, when a
+// provider's service reports that the plan's monthly quota is used up. The
+// broker marks the provider's monthly quota used up, if one is configured,
+// and otherwise backs off for the error's RetryAfter.
+var ErrQuotaExhausted = errors.New("provider quota exhausted")
+
+// ErrProviderBusy is returned when a provider already has as many requests
+// in flight as its concurrency limit allows
+var ErrProviderBusy = errors.New("provider concurrency limit reached")
+
+// ErrProviderDraining is returned for a provider that DrainProvider is
+// taking out of service
+var ErrProviderDraining = errors.New("provider is draining")
+
+// ErrInvalidIP is returned when the looked up address is not a valid IP
+var ErrInvalidIP = errors.New("invalid IP address")
+
+// ErrReservedIP is returned for an address in a reserved range, such as a
+// private network or loopback, which the broker doesn't send to providers
+// unless configured to with WithReservedIPs
+var ErrReservedIP = errors.New("reserved IP address")
+
+// ErrNoProviderAvailable is returned when no provider can be selected, for
+// example because they are all disabled or their circuits are open
+var ErrNoProviderAvailable = errors.New("no suitable provider available")
+
+// ErrCachedFailure wraps a failure served from the negative cache rather
+// than from a fresh lookup
+var ErrCachedFailure = errors.New("cached lookup failure")
+
+// ErrCacheDisabled is returned by cache operations on a broker configured
+// without a cache
+var ErrCacheDisabled = errors.New("cache is not enabled")
+
+// ErrFlushUnsupported is returned by FlushCache when the configured cache
+// can't remove all of its entries
+var ErrFlushUnsupported = errors.New("cache does not support flushing")
+
+// ErrSnapshotUnsupported is returned by ExportSnapshot when the configured
+// cache can't list its entries
+var ErrSnapshotUnsupported = errors.New("cache does not support snapshots")
+
+// ErrMissingCredentials is returned when a provider that needs an API key is
+// created without one
+var ErrMissingCredentials = errors.New("provider credentials missing")
+
+// ErrProviderAuth is returned when a provider rejects our credentials. The
+// broker quarantines a provider that returns it rather than retrying.
+var ErrProviderAuth = errors.New("provider rejected credentials")
+
+// ErrProviderInvalidIP is returned when a provider can't geolocate the
+// address at all, for example because it is private or reserved. The broker
+// returns it without trying other providers, which would say the same.
+var ErrProviderInvalidIP = errors.New("provider cannot locate this address")
+
+// ErrProviderNoData is returned by a provider backed by a local database
+// that has no entry for the address. Unlike ErrProviderInvalidIP the broker
+// fails over, since an online provider may know it.
+var ErrProviderNoData = errors.New("provider has no data for this address")
+
+// ErrBadProviderData is returned when a provider answers with a result that
+// fails validation, such as one without a country or for another address.
+// The broker counts it as a failure of the provider and fails over.
+var ErrBadProviderData = errors.New("provider returned bad data")
+
+// ErrProviderUnavailable is returned when a provider's service can't be
+// reached or answers with a server error
+var ErrProviderUnavailable = errors.New("provider service unavailable")
+
+// ErrUpstreamFailure matches any UpstreamError via errors.Is
+var ErrUpstreamFailure = errors.New("upstream provider failure")
+
+// UpstreamError wraps an error returned by a provider's lookup
+type UpstreamError struct {
+	Provider string
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrUpstreamFailure) true for upstream errors
+func (e *UpstreamError) Is(target error) bool {
+	return target == ErrUpstreamFailure
+}
+
+// StatusError is returned by HTTP-backed providers for a non-200 response
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Is makes a 429 match ErrProviderRateLimited, a 401 or 403 match
+// ErrProviderAuth and a 5xx match ErrProviderUnavailable
+func (e *StatusError) Is(target error) bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return target == ErrProviderRateLimited
+	case e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return target == ErrProviderAuth
+	case e.StatusCode >= 500:
+		return target == ErrProviderUnavailable
+	}
+	return false
+}
+
+// ErrRateLimited is returned by a provider whose upstream service refused a
+// request for exceeding its rate limit. The broker stops selecting the
+// provider until RetryAfter has passed, or until the end of the current
+// minute when the service didn't say. It matches ErrProviderRateLimited.
+type ErrRateLimited struct {
+	Provider   string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ErrRateLimited) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v (retry after %s)", e.Err, e.RetryAfter)
+	}
+	return e.Err.Error()
+}
+
+func (e *ErrRateLimited) Unwrap() error {
+	return e.Err
+}
+
+// errLostRace is the cancellation cause for requests the broker abandons
+// because another provider answered first
+var errLostRace = errors.New("another provider answered first")
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// ewma is a time-decayed moving average. Every sample has weight 1 when
+// added and its weight halves every halfLife, so bursts of samples at the
+// same instant all count while old samples fade out smoothly.
+type ewma struct {
+	sum    float64
+	weight float64
+	last   time.Time
+}
+
+// add records a sample observed at now
+func (e *ewma) add(x float64, now time.Time, halfLife time.Duration) {
+	e.decay(now, halfLife)
+	e.sum += x
+	e.weight++
+}
+
+// decay ages the accumulated samples up to now
+func (e *ewma) decay(now time.Time, halfLife time.Duration) {
+	if !e.last.IsZero() && now.After(e.last) && halfLife > 0 {
+		factor := math.Exp2(-float64(now.Sub(e.last)) / float64(halfLife))
+		e.sum *= factor
+		e.weight *= factor
+	}
+	if now.After(e.last) {
+		e.last = now
+	}
+}
+
+// value returns the current average, or 0 if there are no samples
+func (e *ewma) value() float64 {
+	if e.weight == 0 {
+		return 0
+	}
+	return e.sum / e.weight
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxLoadErrors caps how many bad rows a load reports
+const maxLoadErrors = 20
+
+// FileProvider implements the Provider interface with a local CSV file of
+// IP ranges, for environments without internet access. Each row is
+// start_ip,end_ip,country,city with inclusive bounds, optionally followed by
+// latitude,longitude; IPv4 and IPv6 ranges can be mixed. The country is an
+// ISO 3166-1 code or English name. A header row and lines starting with #
+// are skipped.
+type FileProvider struct {
+	path        string
+	ranges      atomic.Pointer[[]ipRange]
+	reloadMutex sync.Mutex
+}
+
+// ipRange is one row of the range file
+type ipRange struct {
+	start, end netip.Addr
+	country    string // ISO 3166-1 alpha-2 code
+	city       string
+	lat, lon   *float64
+	line       int
+}
+
+// NewFileProvider creates a provider reading the CSV range file at path. It
+// fails if any row is malformed or overlaps another.
+func NewFileProvider(path string) (*FileProvider, error) {
+	p := &FileProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+// Reload reads the range file again. On error the current ranges stay in
+// use; lookups already running finish against the ranges they started with.
+func (p *FileProvider) Reload() error {
+	p.reloadMutex.Lock()
+	defer p.reloadMutex.Unlock()
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ranges, err := loadRanges(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	p.ranges.Store(&ranges)
+	return nil
+}
+
+// loadRanges parses and sorts a range file, reporting every malformed or
+// overlapping row by line number
+func loadRanges(r io.Reader) ([]ipRange, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var ranges []ipRange
+	var errs []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			errs = append(errs, err)
+			if len(errs) >= maxLoadErrors {
+				break
+			}
+			continue
+		}
+		if len(ranges) == 0 && len(errs) == 0 && strings.EqualFold(record[0], "start_ip") {
+			continue
+		}
+
+		rng, err := parseRange(record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			if len(errs) >= maxLoadErrors {
+				break
+			}
+			continue
+		}
+		rng.line = line
+		ranges = append(ranges, rng)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+	// Compare each range with the earlier one reaching furthest, so a range
+	// nested in a wide one is caught even after other nested ranges
+	for i, furthest := 1, 0; i < len(ranges) && len(errs) < maxLoadErrors; i++ {
+		cur := ranges[i]
+		if cur.start.Compare(ranges[furthest].end) <= 0 {
+			errs = append(errs, fmt.Errorf("line %d: range overlaps line %d", cur.line, ranges[furthest].line))
+		}
+		if ranges[furthest].end.Less(cur.end) {
+			furthest = i
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return ranges, nil
+}
+
+// parseRange parses the fields of one row
+func parseRange(record []string) (ipRange, error) {
+	if len(record) != 4 && len(record) != 6 {
+		return ipRange{}, fmt.Errorf("want 4 fields (start_ip,end_ip,country,city) or 6 with latitude,longitude, got %d", len(record))
+	}
+	start, err := parseIP(record[0])
+	if err != nil {
+		return ipRange{}, err
+	}
+	end, err := parseIP(record[1])
+	if err != nil {
+		return ipRange{}, err
+	}
+	if start.Is4() != end.Is4() {
+		return ipRange{}, errors.New("start and end are different address families")
+	}
+	if end.Less(start) {
+		return ipRange{}, errors.New("end is before start")
+	}
+	if record[2] == "" {
+		return ipRange{}, errors.New("country is empty")
+	}
+	country, ok := NormalizeCountryCode(record[2])
+	if !ok {
+		return ipRange{}, fmt.Errorf("unknown country %q", record[2])
+	}
+	rng := ipRange{start: start, end: end, country: country, city: record[3]}
+	if len(record) == 6 {
+		rng.lat, rng.lon = parseCoordinate(record[4]), parseCoordinate(record[5])
+		if rng.lat == nil || rng.lon == nil {
+			return ipRange{}, fmt.Errorf("invalid coordinates %q,%q", record[4], record[5])
+		}
+		if err := checkCoordinates(*rng.lat, *rng.lon); err != nil {
+			return ipRange{}, err
+		}
+	}
+	return rng, nil
+}
+
+func (p *FileProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	addr, err := parseIP(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := *p.ranges.Load()
+	// The last range starting at or before addr is the only one that can
+	// contain it, since ranges don't overlap
+	i := sort.Search(len(ranges), func(i int) bool {
+		return addr.Less(ranges[i].start)
+	}) - 1
+	if i < 0 || ranges[i].end.Less(addr) {
+		return nil, fmt.Errorf("%w: %s not in %s", ErrProviderNoData, ip, p.path)
+	}
+
+	location := &Location{
+		IP:          addr.String(),
+		Country:     CountryName(ranges[i].country),
+		CountryCode: ranges[i].country,
+		City:        ranges[i].city,
+	}
+	location.setCoordinates(ranges[i].lat, ranges[i].lon)
+	return location, nil
+}
+
+// Static reports that answers come from a local file. It implements
+// StaticProvider.
+func (p *FileProvider) Static() bool {
+	return true
+}
+
+// GetMaxRequestsPerMinute returns 0: local lookups are unlimited
+func (p *FileProvider) GetMaxRequestsPerMinute() int {
+	return 0
+}
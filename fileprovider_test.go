@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRanges writes a range file and returns its path
+func writeRanges(t *testing.T, rows ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ranges.csv")
+	if err := os.WriteFile(path, []byte(strings.Join(rows, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileProvider(t *testing.T) {
+	p, err := NewFileProvider(writeRanges(t,
+		"start_ip,end_ip,country,city,latitude,longitude",
+		"# Google",
+		"8.8.8.0,8.8.8.255,US,Mountain View,37.4056,-122.0775",
+		"1.1.1.0, 1.1.1.255, Australia, Sydney",
+		"2001:4860::,2001:4860:ffff:ffff:ffff:ffff:ffff:ffff,us,Mountain View",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lat, lon := 37.4056, -122.0775
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"8.8.8.0", Location{IP: "8.8.8.0", Country: "United States", CountryCode: "US", City: "Mountain View", Latitude: lat, Longitude: lon, HasCoordinates: true}},
+		{"8.8.8.255", Location{IP: "8.8.8.255", Country: "United States", CountryCode: "US", City: "Mountain View", Latitude: lat, Longitude: lon, HasCoordinates: true}},
+		{"1.1.1.1", Location{IP: "1.1.1.1", Country: "Australia", CountryCode: "AU", City: "Sydney"}},
+		{"2001:4860::8888", Location{IP: "2001:4860::8888", Country: "United States", CountryCode: "US", City: "Mountain View"}},
+	}
+	for _, tt := range tests {
+		got, err := p.GetLocation(context.Background(), tt.ip)
+		if err != nil {
+			t.Errorf("%s: %v", tt.ip, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.ip, *got, tt.want)
+		}
+	}
+
+	for _, ip := range []string{"8.8.9.0", "1.1.0.255", "2001:4861::1"} {
+		if _, err := p.GetLocation(context.Background(), ip); !errors.Is(err, ErrProviderNoData) {
+			t.Errorf("%s: got %v, want ErrProviderNoData", ip, err)
+		}
+	}
+	if _, err := p.GetLocation(context.Background(), "not an ip"); err == nil {
+		t.Error("looked up an invalid address")
+	}
+}
+
+func TestFileProviderMalformedRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     string
+		wantErr string
+	}{
+		{"too few columns", "8.8.8.0,8.8.8.255,US", "line 2: want 4 fields"},
+		{"five columns", "8.8.8.0,8.8.8.255,US,Mountain View,37.4", "line 2: want 4 fields"},
+		{"too many columns", "8.8.8.0,8.8.8.255,US,Mountain View,37.4,-122.1,extra", "line 2: want 4 fields"},
+		{"bad start", "8.8.8.x,8.8.8.255,US,Mountain View", "line 2:"},
+		{"mixed families", "8.8.8.0,2001:4860::1,US,Mountain View", "line 2: start and end are different address families"},
+		{"end before start", "8.8.8.255,8.8.8.0,US,Mountain View", "line 2: end is before start"},
+		{"empty country", "8.8.8.0,8.8.8.255,,Mountain View", "line 2: country is empty"},
+		{"unknown country name", "8.8.8.0,8.8.8.255,Atlantis,Mountain View", `line 2: unknown country "Atlantis"`},
+		{"malformed country code", "8.8.8.0,8.8.8.255,U1,Mountain View", `line 2: unknown country "U1"`},
+		{"non-numeric coordinates", "8.8.8.0,8.8.8.255,US,Mountain View,north,west", `line 2: invalid coordinates "north","west"`},
+		{"latitude out of range", "8.8.8.0,8.8.8.255,US,Mountain View,91,0", "line 2: coordinates 91,0 out of range"},
+		{"longitude out of range", "8.8.8.0,8.8.8.255,US,Mountain View,0,-181", "line 2: coordinates 0,-181 out of range"},
+		{"overlap", "1.1.1.128,1.1.2.0,AU,Sydney", "line 2: range overlaps line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileProvider(writeRanges(t, "1.1.1.0,1.1.1.255,AU,Sydney", tt.row))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileProviderReportsEveryBadRow(t *testing.T) {
+	_, err := NewFileProvider(writeRanges(t,
+		"8.8.8.0,8.8.8.255,US",
+		"1.1.1.0,1.1.1.255,AU,Sydney",
+		"1.1.1.0,1.1.1.255,Atlantis,Sydney",
+		"9.9.9.0,9.9.9.255,CH,Zurich,47.4,999",
+	))
+	if err == nil {
+		t.Fatal("malformed file loaded")
+	}
+	for _, want := range []string{"line 1:", "line 3:", "line 4:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't report %s", err, want)
+		}
+	}
+}
+
+func TestFileProviderReload(t *testing.T) {
+	path := writeRanges(t, "8.8.8.0,8.8.8.255,US,Mountain View")
+	p, err := NewFileProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bad file leaves the current ranges in use
+	if err := os.WriteFile(path, []byte("8.8.8.0,8.8.8.255,Atlantis,Mountain View\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("got %v, want an error naming the file", err)
+	}
+	if loc, err := p.GetLocation(context.Background(), "8.8.8.8"); err != nil || loc.CountryCode != "US" {
+		t.Errorf("after a failed reload: got %v, %v, want the old range", loc, err)
+	}
+
+	if err := os.WriteFile(path, []byte("8.8.8.0,8.8.8.255,DE,Berlin\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if loc, err := p.GetLocation(context.Background(), "8.8.8.8"); err != nil || loc.CountryCode != "DE" {
+		t.Errorf("after a reload: got %v, %v, want the new range", loc, err)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GenericJSONConfig declares an HTTP provider that answers with JSON, so a
+// service can be added without writing a provider for it. Paths are dotted,
+// as in "location.country.code"; a numeric segment indexes an array.
+type GenericJSONConfig struct {
+	// Name identifies the provider in the broker
+	Name string `json:"name"`
+	// URL is the lookup URL. "{ip}" is replaced with the address and "{key}"
+	// with the API key, e.g. "https://example.com/geo/{ip}?key={key}".
+	URL string `json:"url"`
+	// KeyEnv names the environment variable holding the API key, which
+	// WithToken overrides. Keeping the key out of the config file keeps it
+	// out of version control.
+	KeyEnv string `json:"key_env,omitempty"`
+	// Headers are sent with every request; "{key}" is replaced in values
+	Headers map[string]string `json:"headers,omitempty"`
+	// MaxRequestsPerMinute is the provider's rate limit; zero is unlimited
+	MaxRequestsPerMinute int `json:"max_requests_per_minute"`
+
+	// IPPath, CountryPath and CityPath locate the result fields. Only
+	// CountryPath is required; without IPPath the looked up IP is used.
+	IPPath      string `json:"ip_path,omitempty"`
+	CountryPath string `json:"country_path"`
+	CityPath    string `json:"city_path,omitempty"`
+	// RegionPath and PostalCodePath locate the state or province and the
+	// postal code
+	RegionPath     string `json:"region_path,omitempty"`
+	PostalCodePath string `json:"postal_code_path,omitempty"`
+	// TimezonePath locates the IANA time zone name
+	TimezonePath string `json:"timezone_path,omitempty"`
+	// ASNPath, ISPPath and OrgPath locate the network fields. The ASN may be
+	// a number or a string with or without the "AS" prefix.
+	ASNPath string `json:"asn_path,omitempty"`
+	ISPPath string `json:"isp_path,omitempty"`
+	OrgPath string `json:"org_path,omitempty"`
+	// LatitudePath and LongitudePath locate the coordinates, given as
+	// numbers or numeric strings
+	LatitudePath  string `json:"latitude_path,omitempty"`
+	LongitudePath string `json:"longitude_path,omitempty"`
+
+	// ErrorPath locates an in-band error flag. The response is an error when
+	// the value there equals ErrorValue or, if ErrorValue is empty, when it
+	// is present and not false, null or "". MessagePath locates the message.
+	ErrorPath   string `json:"error_path,omitempty"`
+	ErrorValue  string `json:"error_value,omitempty"`
+	MessagePath string `json:"message_path,omitempty"`
+}
+
+// GenericJSONProvider implements the Provider interface for a service
+// described by a GenericJSONConfig
+type GenericJSONProvider struct {
+	spec   GenericJSONConfig
+	config httpConfig
+}
+
+// NewGenericJSONProvider creates a provider from spec. An API key is required
+// if the URL or a header uses "{key}". WithBaseURL replaces the scheme and
+// host of spec.URL.
+func NewGenericJSONProvider(spec GenericJSONConfig, opts ...ProviderOption) (*GenericJSONProvider, error) {
+	if spec.Name == "" {
+		return nil, errors.New("generic JSON provider: name is required")
+	}
+	if !strings.Contains(spec.URL, "{ip}") {
+		return nil, fmt.Errorf("%s: url must contain {ip}", spec.Name)
+	}
+	if _, err := url.Parse(strings.NewReplacer("{ip}", "ip", "{key}", "key").Replace(spec.URL)); err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	if spec.CountryPath == "" {
+		return nil, fmt.Errorf("%s: country_path is required", spec.Name)
+	}
+	if (spec.LatitudePath == "") != (spec.LongitudePath == "") {
+		return nil, fmt.Errorf("%s: latitude_path and longitude_path go together", spec.Name)
+	}
+
+	config, err := newHTTPConfig(opts, spec.KeyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	if spec.usesKey() && config.token == "" {
+		return nil, fmt.Errorf("%w: %s uses {key}; pass WithToken or set key_env", ErrMissingCredentials, spec.Name)
+	}
+	if config.baseURL != "" {
+		spec.URL = config.baseURL + urlPathAndQuery(spec.URL)
+	}
+	return &GenericJSONProvider{spec: spec, config: config}, nil
+}
+
+// urlPathAndQuery returns rawURL without its scheme and host
+func urlPathAndQuery(rawURL string) string {
+	_, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return rawURL
+	}
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		return rest[i:]
+	}
+	return ""
+}
+
+// usesKey reports whether the API key appears in the URL or a header
+func (spec *GenericJSONConfig) usesKey() bool {
+	if strings.Contains(spec.URL, "{key}") {
+		return true
+	}
+	for _, value := range spec.Headers {
+		if strings.Contains(value, "{key}") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *GenericJSONProvider) Name() string {
+	return p.spec.Name
+}
+
+func (p *GenericJSONProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	endpoint := strings.NewReplacer(
+		"{ip}", url.PathEscape(ip),
+		"{key}", url.QueryEscape(p.config.token),
+	).Replace(p.spec.URL)
+
+	var header http.Header
+	if len(p.spec.Headers) > 0 {
+		header = make(http.Header, len(p.spec.Headers))
+		for name, value := range p.spec.Headers {
+			header.Set(name, strings.ReplaceAll(value, "{key}", p.config.token))
+		}
+	}
+
+	var raw json.RawMessage
+	if _, err := p.config.getJSON(ctx, p.Name(), endpoint, header, &raw); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: decoding response: %w", p.Name(), err)
+	}
+
+	if p.spec.ErrorPath != "" {
+		if flag, ok := jsonPath(body, p.spec.ErrorPath); ok && p.isError(flag) {
+			message, _ := jsonPath(body, p.spec.MessagePath)
+			return nil, p.config.redact(fmt.Errorf("%s: lookup failed: %s", p.Name(), jsonString(message)))
+		}
+	}
+
+	country, _ := jsonPath(body, p.spec.CountryPath)
+	location := &Location{IP: ip, Country: jsonString(country)}
+	if p.spec.IPPath != "" {
+		if value, ok := jsonPath(body, p.spec.IPPath); ok {
+			location.IP = jsonString(value)
+		}
+	}
+	if p.spec.CityPath != "" {
+		city, _ := jsonPath(body, p.spec.CityPath)
+		location.City = jsonString(city)
+	}
+	if p.spec.RegionPath != "" {
+		region, _ := jsonPath(body, p.spec.RegionPath)
+		location.Region = jsonString(region)
+	}
+	if p.spec.PostalCodePath != "" {
+		postalCode, _ := jsonPath(body, p.spec.PostalCodePath)
+		location.PostalCode = jsonString(postalCode)
+	}
+	if p.spec.TimezonePath != "" {
+		timezone, _ := jsonPath(body, p.spec.TimezonePath)
+		location.Timezone = jsonString(timezone)
+	}
+	for _, field := range []struct {
+		path string
+		dst  *string
+	}{
+		{p.spec.ASNPath, &location.ASN},
+		{p.spec.ISPPath, &location.ISP},
+		{p.spec.OrgPath, &location.Org},
+	} {
+		if field.path != "" {
+			value, _ := jsonPath(body, field.path)
+			*field.dst = jsonString(value)
+		}
+	}
+	if p.spec.LatitudePath != "" && p.spec.LongitudePath != "" {
+		lat, _ := jsonPath(body, p.spec.LatitudePath)
+		lon, _ := jsonPath(body, p.spec.LongitudePath)
+		location.setCoordinates(parseCoordinate(jsonString(lat)), parseCoordinate(jsonString(lon)))
+	}
+	return location, nil
+}
+
+// isError reports whether the value found at the error path signals an error
+func (p *GenericJSONProvider) isError(value any) bool {
+	if p.spec.ErrorValue != "" {
+		return jsonString(value) == p.spec.ErrorValue
+	}
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+func (p *GenericJSONProvider) GetMaxRequestsPerMinute() int {
+	return p.spec.MaxRequestsPerMinute
+}
+
+// jsonPath follows a dotted path through a decoded JSON value. Numeric
+// segments index arrays. An empty path finds nothing.
+func jsonPath(v any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonString formats a decoded JSON scalar as a string. Objects, arrays and
+// null become "".
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// genericJSONServer serves the responses in testdata/genericjson the way
+// two differently shaped services would: flat-api takes the key in the
+// query and reports errors with a status field, nested-api takes it as a
+// bearer token and reports errors in an error object. 192.0.2.1 gets the
+// in-band error from both.
+func genericJSONServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	serve := func(w http.ResponseWriter, name string) {
+		data, err := os.ReadFile(filepath.Join("testdata", "genericjson", name))
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "flat-key" {
+			http.Error(w, `{"status":"fail","message":"invalid key"}`, http.StatusUnauthorized)
+			return
+		}
+		if strings.TrimPrefix(r.URL.Path, "/json/") == "192.0.2.1" {
+			serve(w, "flat-error.json")
+			return
+		}
+		serve(w, "flat.json")
+	})
+	mux.HandleFunc("/v2/lookup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer nested-key" {
+			http.Error(w, `{"error":{"code":101,"info":"missing key"}}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("address") == "192.0.2.1" {
+			serve(w, "nested-error.json")
+			return
+		}
+		serve(w, "nested.json")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// loadGenericJSONProviders builds the providers declared in
+// testdata/genericjson/config.json against server
+func loadGenericJSONProviders(t *testing.T, server *httptest.Server) map[string]Provider {
+	t.Helper()
+	t.Setenv("FLAT_API_KEY", "flat-key")
+	t.Setenv("NESTED_API_KEY", "nested-key")
+
+	cfg, err := LoadConfig(filepath.Join("testdata", "genericjson", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cfg.Providers {
+		cfg.Providers[i].BaseURL = server.URL
+	}
+	providers, err := LoadProvidersFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Provider)
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return byName
+}
+
+func TestGenericJSONProvider(t *testing.T) {
+	providers := loadGenericJSONProviders(t, genericJSONServer(t))
+	ctx := context.Background()
+
+	tests := []struct {
+		provider string
+		rpm      int
+		want     Location
+	}{
+		{"flat-api", 45, Location{
+			IP:             "81.2.69.142",
+			Country:        "GB",
+			City:           "London",
+			Region:         "England",
+			PostalCode:     "EC1A",
+			Timezone:       "Europe/London",
+			ASN:            "AS20712 Andrews & Arnold Ltd",
+			ISP:            "Andrews & Arnold Ltd",
+			Org:            "Andrews & Arnold",
+			Latitude:       51.5142,
+			Longitude:      -0.0931,
+			HasCoordinates: true,
+		}},
+		{"nested-api", 120, Location{
+			IP:             "81.2.69.142",
+			Country:        "United Kingdom",
+			City:           "London",
+			Region:         "England",
+			PostalCode:     "EC1A",
+			Timezone:       "Europe/London",
+			ASN:            "20712",
+			ISP:            "Andrews & Arnold Ltd",
+			Org:            "Andrews & Arnold",
+			Latitude:       51.5142,
+			Longitude:      -0.0931,
+			HasCoordinates: true,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			p, ok := providers[tt.provider]
+			if !ok {
+				t.Fatalf("%s not built from the config", tt.provider)
+			}
+			if got := p.GetMaxRequestsPerMinute(); got != tt.rpm {
+				t.Errorf("rate limit %d, want %d", got, tt.rpm)
+			}
+
+			loc, err := p.GetLocation(ctx, "81.2.69.142")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *loc != tt.want {
+				t.Errorf("got %+v, want %+v", *loc, tt.want)
+			}
+
+			// In-band errors fail the lookup with the service's message
+			_, err = p.GetLocation(ctx, "192.0.2.1")
+			if err == nil {
+				t.Fatal("in-band error not reported")
+			}
+			if !strings.Contains(err.Error(), tt.provider) || strings.Contains(err.Error(), "-key") {
+				t.Errorf("error %q should name the provider and not the key", err)
+			}
+		})
+	}
+
+	_, err := providers["flat-api"].GetLocation(ctx, "192.0.2.1")
+	if !strings.Contains(err.Error(), "invalid query") {
+		t.Errorf("flat-api error %q lacks the service's message", err)
+	}
+	_, err = providers["nested-api"].GetLocation(ctx, "192.0.2.1")
+	if !strings.Contains(err.Error(), "monthly usage limit") {
+		t.Errorf("nested-api error %q lacks the service's message", err)
+	}
+}
+
+func TestGenericJSONProviderThroughBroker(t *testing.T) {
+	providers := loadGenericJSONProviders(t, genericJSONServer(t))
+	b := NewBroker([]Provider{providers["flat-api"]})
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), "81.2.69.142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The broker names the country by the code the service gave and
+	// separates the ASN from its name
+	if loc.Country != "United Kingdom" || loc.CountryCode != "GB" || loc.ASN != "AS20712" || loc.Provider != "flat-api" {
+		t.Errorf("got %+v", loc)
+	}
+}
+
+func TestGenericJSONProviderBadKey(t *testing.T) {
+	server := genericJSONServer(t)
+	p, err := NewGenericJSONProvider(GenericJSONConfig{
+		Name:        "flat-api",
+		URL:         "https://flat.example.com/json/{ip}?key={key}",
+		CountryPath: "countryCode",
+	}, WithBaseURL(server.URL), WithToken("wrong-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.GetLocation(context.Background(), "81.2.69.142")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401 StatusError", err)
+	}
+	if strings.Contains(err.Error(), "wrong-key") {
+		t.Errorf("error %q contains the key", err)
+	}
+}
+
+func TestNewGenericJSONProviderInvalid(t *testing.T) {
+	valid := GenericJSONConfig{Name: "test", URL: "https://example.com/{ip}", CountryPath: "country"}
+	tests := []struct {
+		name   string
+		modify func(*GenericJSONConfig)
+		opts   []ProviderOption
+		want   error
+	}{
+		{"no name", func(c *GenericJSONConfig) { c.Name = "" }, nil, nil},
+		{"no {ip}", func(c *GenericJSONConfig) { c.URL = "https://example.com/lookup" }, nil, nil},
+		{"bad url", func(c *GenericJSONConfig) { c.URL = "https://exa mple.com/{ip}" }, nil, nil},
+		{"no country path", func(c *GenericJSONConfig) { c.CountryPath = "" }, nil, nil},
+		{"latitude without longitude", func(c *GenericJSONConfig) { c.LatitudePath = "lat" }, nil, nil},
+		{"key without token", func(c *GenericJSONConfig) { c.URL += "?key={key}" }, nil, ErrMissingCredentials},
+		{"key header without token", func(c *GenericJSONConfig) { c.Headers = map[string]string{"X-Key": "{key}"} }, nil, ErrMissingCredentials},
+		{"bad base url", func(*GenericJSONConfig) {}, []ProviderOption{WithBaseURL("://nowhere")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := valid
+			tt.modify(&spec)
+			_, err := NewGenericJSONProvider(spec, tt.opts...)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	body := map[string]any{
+		"a": map[string]any{
+			"b":    "deep",
+			"list": []any{"first", map[string]any{"c": true}},
+		},
+		"n": nil,
+	}
+	tests := []struct {
+		path   string
+		want   any
+		wantOK bool
+	}{
+		{"a.b", "deep", true},
+		{"a.list.0", "first", true},
+		{"a.list.1.c", true, true},
+		{"n", nil, true},
+		{"", nil, false},
+		{"missing", nil, false},
+		{"a.missing", nil, false},
+		{"a.list.2", nil, false},
+		{"a.list.-1", nil, false},
+		{"a.list.x", nil, false},
+		{"a.b.c", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonPath(body, tt.path)
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("jsonPath(%q) = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.28.3
+// source: geopb/geo.proto
+
+package geopb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRequest) Reset() {
+	*x = LookupRequest{}
+	mi := &file_geopb_geo_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRequest) ProtoMessage() {}
+
+func (x *LookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geopb_geo_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRequest.ProtoReflect.Descriptor instead.
+func (*LookupRequest) Descriptor() ([]byte, []int) {
+	return file_geopb_geo_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type LookupResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Country       string                 `protobuf:"bytes,2,opt,name=country,proto3" json:"country,omitempty"`
+	City          string                 `protobuf:"bytes,3,opt,name=city,proto3" json:"city,omitempty"`
+	Region        string                 `protobuf:"bytes,6,opt,name=region,proto3" json:"region,omitempty"`
+	PostalCode    string                 `protobuf:"bytes,7,opt,name=postal_code,json=postalCode,proto3" json:"postal_code,omitempty"`
+	Timezone      string                 `protobuf:"bytes,8,opt,name=timezone,proto3" json:"timezone,omitempty"`
+	Asn           string                 `protobuf:"bytes,9,opt,name=asn,proto3" json:"asn,omitempty"`
+	Isp           string                 `protobuf:"bytes,10,opt,name=isp,proto3" json:"isp,omitempty"`
+	Org           string                 `protobuf:"bytes,11,opt,name=org,proto3" json:"org,omitempty"`
+	Latitude      *float64               `protobuf:"fixed64,4,opt,name=latitude,proto3,oneof" json:"latitude,omitempty"`
+	Longitude     *float64               `protobuf:"fixed64,5,opt,name=longitude,proto3,oneof" json:"longitude,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupResponse) Reset() {
+	*x = LookupResponse{}
+	mi := &file_geopb_geo_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupResponse) ProtoMessage() {}
+
+func (x *LookupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geopb_geo_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupResponse.ProtoReflect.Descriptor instead.
+func (*LookupResponse) Descriptor() ([]byte, []int) {
+	return file_geopb_geo_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupResponse) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetTimezone() string {
+	if x != nil {
+		return x.Timezone
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetAsn() string {
+	if x != nil {
+		return x.Asn
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetIsp() string {
+	if x != nil {
+		return x.Isp
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetOrg() string {
+	if x != nil {
+		return x.Org
+	}
+	return ""
+}
+
+func (x *LookupResponse) GetLatitude() float64 {
+	if x != nil && x.Latitude != nil {
+		return *x.Latitude
+	}
+	return 0
+}
+
+func (x *LookupResponse) GetLongitude() float64 {
+	if x != nil && x.Longitude != nil {
+		return *x.Longitude
+	}
+	return 0
+}
+
+type CapacityRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CapacityRequest) Reset() {
+	*x = CapacityRequest{}
+	mi := &file_geopb_geo_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapacityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapacityRequest) ProtoMessage() {}
+
+func (x *CapacityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geopb_geo_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapacityRequest.ProtoReflect.Descriptor instead.
+func (*CapacityRequest) Descriptor() ([]byte, []int) {
+	return file_geopb_geo_proto_rawDescGZIP(), []int{2}
+}
+
+type CapacityResponse struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	MaxRequestsPerMinute int32                  `protobuf:"varint,1,opt,name=max_requests_per_minute,json=maxRequestsPerMinute,proto3" json:"max_requests_per_minute,omitempty"`
+	Remaining            int32                  `protobuf:"varint,2,opt,name=remaining,proto3" json:"remaining,omitempty"`
+	ResetUnix            int64                  `protobuf:"varint,3,opt,name=reset_unix,json=resetUnix,proto3" json:"reset_unix,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *CapacityResponse) Reset() {
+	*x = CapacityResponse{}
+	mi := &file_geopb_geo_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapacityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapacityResponse) ProtoMessage() {}
+
+func (x *CapacityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geopb_geo_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapacityResponse.ProtoReflect.Descriptor instead.
+func (*CapacityResponse) Descriptor() ([]byte, []int) {
+	return file_geopb_geo_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CapacityResponse) GetMaxRequestsPerMinute() int32 {
+	if x != nil {
+		return x.MaxRequestsPerMinute
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetRemaining() int32 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetResetUnix() int64 {
+	if x != nil {
+		return x.ResetUnix
+	}
+	return 0
+}
+
+var File_geopb_geo_proto protoreflect.FileDescriptor
+
+const file_geopb_geo_proto_rawDesc = "" +
+	"\n" +
+	"\x0fgeopb/geo.proto\x12\x06geo.v1\"\x1f\n" +
+	"\rLookupRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\"\xb8\x02\n" +
+	"\x0eLookupResponse\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x18\n" +
+	"\acountry\x18\x02 \x01(\tR\acountry\x12\x12\n" +
+	"\x04city\x18\x03 \x01(\tR\x04city\x12\x16\n" +
+	"\x06region\x18\x06 \x01(\tR\x06region\x12\x1f\n" +
+	"\vpostal_code\x18\a \x01(\tR\n" +
+	"postalCode\x12\x1a\n" +
+	"\btimezone\x18\b \x01(\tR\btimezone\x12\x10\n" +
+	"\x03asn\x18\t \x01(\tR\x03asn\x12\x10\n" +
+	"\x03isp\x18\n" +
+	" \x01(\tR\x03isp\x12\x10\n" +
+	"\x03org\x18\v \x01(\tR\x03org\x12\x1f\n" +
+	"\blatitude\x18\x04 \x01(\x01H\x00R\blatitude\x88\x01\x01\x12!\n" +
+	"\tlongitude\x18\x05 \x01(\x01H\x01R\tlongitude\x88\x01\x01B\v\n" +
+	"\t_latitudeB\f\n" +
+	"\n" +
+	"_longitude\"\x11\n" +
+	"\x0fCapacityRequest\"\x86\x01\n" +
+	"\x10CapacityResponse\x125\n" +
+	"\x17max_requests_per_minute\x18\x01 \x01(\x05R\x14maxRequestsPerMinute\x12\x1c\n" +
+	"\tremaining\x18\x02 \x01(\x05R\tremaining\x12\x1d\n" +
+	"\n" +
+	"reset_unix\x18\x03 \x01(\x03R\tresetUnix2\x85\x01\n" +
+	"\vGeolocation\x127\n" +
+	"\x06Lookup\x12\x15.geo.v1.LookupRequest\x1a\x16.geo.v1.LookupResponse\x12=\n" +
+	"\bCapacity\x12\x17.geo.v1.CapacityRequest\x1a\x18.geo.v1.CapacityResponseB+Z)github.com/Hitesh-180876/api-broker/geopbb\x06proto3"
+
+var (
+	file_geopb_geo_proto_rawDescOnce sync.Once
+	file_geopb_geo_proto_rawDescData []byte
+)
+
+func file_geopb_geo_proto_rawDescGZIP() []byte {
+	file_geopb_geo_proto_rawDescOnce.Do(func() {
+		file_geopb_geo_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_geopb_geo_proto_rawDesc), len(file_geopb_geo_proto_rawDesc)))
+	})
+	return file_geopb_geo_proto_rawDescData
+}
+
+var file_geopb_geo_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_geopb_geo_proto_goTypes = []any{
+	(*LookupRequest)(nil),    // 0: geo.v1.LookupRequest
+	(*LookupResponse)(nil),   // 1: geo.v1.LookupResponse
+	(*CapacityRequest)(nil),  // 2: geo.v1.CapacityRequest
+	(*CapacityResponse)(nil), // 3: geo.v1.CapacityResponse
+}
+var file_geopb_geo_proto_depIdxs = []int32{
+	0, // 0: geo.v1.Geolocation.Lookup:input_type -> geo.v1.LookupRequest
+	2, // 1: geo.v1.Geolocation.Capacity:input_type -> geo.v1.CapacityRequest
+	1, // 2: geo.v1.Geolocation.Lookup:output_type -> geo.v1.LookupResponse
+	3, // 3: geo.v1.Geolocation.Capacity:output_type -> geo.v1.CapacityResponse
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_geopb_geo_proto_init() }
+func file_geopb_geo_proto_init() {
+	if File_geopb_geo_proto != nil {
+		return
+	}
+	file_geopb_geo_proto_msgTypes[1].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_geopb_geo_proto_rawDesc), len(file_geopb_geo_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_geopb_geo_proto_goTypes,
+		DependencyIndexes: file_geopb_geo_proto_depIdxs,
+		MessageInfos:      file_geopb_geo_proto_msgTypes,
+	}.Build()
+	File_geopb_geo_proto = out.File
+	file_geopb_geo_proto_goTypes = nil
+	file_geopb_geo_proto_depIdxs = nil
+}
@@ -0,0 +1,159 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.28.3
+// source: geopb/geo.proto
+
+package geopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Geolocation_Lookup_FullMethodName   = "/geo.v1.Geolocation/Lookup"
+	Geolocation_Capacity_FullMethodName = "/geo.v1.Geolocation/Capacity"
+)
+
+// GeolocationClient is the client API for Geolocation service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GeolocationClient interface {
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+	Capacity(ctx context.Context, in *CapacityRequest, opts ...grpc.CallOption) (*CapacityResponse, error)
+}
+
+type geolocationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeolocationClient(cc grpc.ClientConnInterface) GeolocationClient {
+	return &geolocationClient{cc}
+}
+
+func (c *geolocationClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupResponse)
+	err := c.cc.Invoke(ctx, Geolocation_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geolocationClient) Capacity(ctx context.Context, in *CapacityRequest, opts ...grpc.CallOption) (*CapacityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CapacityResponse)
+	err := c.cc.Invoke(ctx, Geolocation_Capacity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GeolocationServer is the server API for Geolocation service.
+// All implementations must embed UnimplementedGeolocationServer
+// for forward compatibility.
+type GeolocationServer interface {
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	Capacity(context.Context, *CapacityRequest) (*CapacityResponse, error)
+	mustEmbedUnimplementedGeolocationServer()
+}
+
+// UnimplementedGeolocationServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGeolocationServer struct{}
+
+func (UnimplementedGeolocationServer) Lookup(context.Context, *LookupRequest) (*LookupResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedGeolocationServer) Capacity(context.Context, *CapacityRequest) (*CapacityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Capacity not implemented")
+}
+func (UnimplementedGeolocationServer) mustEmbedUnimplementedGeolocationServer() {}
+func (UnimplementedGeolocationServer) testEmbeddedByValue()                     {}
+
+// UnsafeGeolocationServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeolocationServer will
+// result in compilation errors.
+type UnsafeGeolocationServer interface {
+	mustEmbedUnimplementedGeolocationServer()
+}
+
+func RegisterGeolocationServer(s grpc.ServiceRegistrar, srv GeolocationServer) {
+	// If the following call panics, it indicates UnimplementedGeolocationServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Geolocation_ServiceDesc, srv)
+}
+
+func _Geolocation_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeolocationServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Geolocation_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeolocationServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Geolocation_Capacity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapacityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeolocationServer).Capacity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Geolocation_Capacity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeolocationServer).Capacity(ctx, req.(*CapacityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Geolocation_ServiceDesc is the grpc.ServiceDesc for Geolocation service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Geolocation_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "geo.v1.Geolocation",
+	HandlerType: (*GeolocationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _Geolocation_Lookup_Handler,
+		},
+		{
+			MethodName: "Capacity",
+			Handler:    _Geolocation_Capacity_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "geopb/geo.proto",
+}
@@ -0,0 +1,125 @@
+//go:build grpc
+
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative geopb/geo.proto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Hitesh-180876/api-broker/geopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCProvider implements the Provider interface for a geolocation service
+// speaking the Geolocation gRPC API in geopb/geo.proto. It is built only
+// with the grpc build tag, which needs the gRPC module and generated code.
+type GRPCProvider struct {
+	name                 string
+	maxRequestsPerMinute int
+	client               geopb.GeolocationClient
+
+	// Capacity last reported by the service
+	quotaMutex sync.Mutex
+	remaining  int
+	resetAt    time.Time
+}
+
+// NewGRPCProvider creates a provider calling the service on conn. The
+// caller owns conn and closes it after the broker.
+func NewGRPCProvider(conn *grpc.ClientConn, name string, maxRequestsPerMinute int) *GRPCProvider {
+	return &GRPCProvider{
+		name:                 name,
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		client:               geopb.NewGeolocationClient(conn),
+	}
+}
+
+func (p *GRPCProvider) Name() string {
+	return p.name
+}
+
+// GetLocation calls Lookup. gRPC sends ctx's deadline along with the call,
+// so the service stops work the broker has given up on.
+func (p *GRPCProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	resp, err := p.client.Lookup(ctx, &geopb.LookupRequest{Ip: ip})
+	if err != nil {
+		return nil, p.grpcError(ctx, err)
+	}
+	// The service sends an ISO 3166-1 alpha-2 code, not a name
+	code, _ := NormalizeCountryCode(resp.GetCountry())
+	location := &Location{
+		IP:          resp.GetIp(),
+		Country:     CountryName(code),
+		CountryCode: code,
+		City:        resp.GetCity(),
+		Region:      resp.GetRegion(),
+		PostalCode:  resp.GetPostalCode(),
+		Timezone:    resp.GetTimezone(),
+		ASN:         resp.GetAsn(),
+		ISP:         resp.GetIsp(),
+		Org:         resp.GetOrg(),
+	}
+	location.setCoordinates(resp.Latitude, resp.Longitude)
+	return location, nil
+}
+
+// grpcError maps a gRPC status onto the provider error taxonomy
+func (p *GRPCProvider) grpcError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		return rateLimited(p.name, st.Message(), nil)
+	case codes.InvalidArgument:
+		return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, p.name, st.Message())
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s: %s", ErrProviderNoData, p.name, st.Message())
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, p.name, st.Message())
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %s: %s", ErrProviderUnavailable, p.name, st.Message())
+	default:
+		return fmt.Errorf("%s: %s: %s", p.name, st.Code(), st.Message())
+	}
+}
+
+// RefreshCapacity asks the service how much of its rate limit is left. The
+// answer is reported to the broker through Quota until it resets. The
+// broker calls it every health probe round, so Quota has no figure unless
+// the broker was built with WithHealthProbes or the caller refreshes it.
+func (p *GRPCProvider) RefreshCapacity(ctx context.Context) error {
+	resp, err := p.client.Capacity(ctx, &geopb.CapacityRequest{})
+	if err != nil {
+		return p.grpcError(ctx, err)
+	}
+
+	p.quotaMutex.Lock()
+	p.remaining = int(resp.GetRemaining())
+	p.resetAt = time.Unix(resp.GetResetUnix(), 0)
+	p.quotaMutex.Unlock()
+	return nil
+}
+
+// Quota returns the capacity last fetched with RefreshCapacity. It
+// implements QuotaReporter.
+func (p *GRPCProvider) Quota() (remaining int, resetAt time.Time, ok bool) {
+	p.quotaMutex.Lock()
+	defer p.quotaMutex.Unlock()
+
+	if p.resetAt.IsZero() || !time.Now().Before(p.resetAt) {
+		return 0, time.Time{}, false
+	}
+	return p.remaining, p.resetAt, true
+}
+
+func (p *GRPCProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
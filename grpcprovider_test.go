@@ -0,0 +1,224 @@
+//go:build grpc
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hitesh-180876/api-broker/geopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// geoServer is an in-process Geolocation service answering with lookup and
+// remembering the deadline of the last call
+type geoServer struct {
+	geopb.UnimplementedGeolocationServer
+	lookup   func(ctx context.Context, ip string) (*geopb.LookupResponse, error)
+	capacity *geopb.CapacityResponse
+
+	mutex    sync.Mutex
+	deadline time.Time
+}
+
+func (s *geoServer) Lookup(ctx context.Context, req *geopb.LookupRequest) (*geopb.LookupResponse, error) {
+	s.mutex.Lock()
+	s.deadline, _ = ctx.Deadline()
+	s.mutex.Unlock()
+	return s.lookup(ctx, req.GetIp())
+}
+
+func (s *geoServer) Capacity(context.Context, *geopb.CapacityRequest) (*geopb.CapacityResponse, error) {
+	return s.capacity, nil
+}
+
+// lastDeadline returns the deadline the server saw on the last Lookup
+func (s *geoServer) lastDeadline() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.deadline
+}
+
+// dialGeoServer serves s over an in-memory connection and returns a
+// provider calling it
+func dialGeoServer(t *testing.T, s *geoServer) *GRPCProvider {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	geopb.RegisterGeolocationServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewGRPCProvider(conn, "geo-grpc", 600)
+}
+
+func TestGRPCProvider(t *testing.T) {
+	s := &geoServer{lookup: func(_ context.Context, ip string) (*geopb.LookupResponse, error) {
+		return &geopb.LookupResponse{
+			Ip: ip, Country: "US", City: "Mountain View", Region: "California", PostalCode: "94043",
+			Timezone: "America/Los_Angeles", Asn: "AS15169", Isp: "Google LLC", Org: "Google LLC",
+			Latitude: proto.Float64(37.4056), Longitude: proto.Float64(-122.0775),
+		}, nil
+	}}
+	p := dialGeoServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := p.GetLocation(ctx, "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", City: "Mountain View", Region: "California", PostalCode: "94043",
+		Timezone: "America/Los_Angeles", ASN: "AS15169", ISP: "Google LLC", Org: "Google LLC",
+		Latitude: 37.4056, Longitude: -122.0775, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	// The caller's deadline travels with the call
+	deadline, _ := ctx.Deadline()
+	if seen := s.lastDeadline(); seen.IsZero() || seen.Sub(deadline).Abs() > time.Second {
+		t.Errorf("server saw deadline %v, want about %v", seen, deadline)
+	}
+	if p.GetMaxRequestsPerMinute() != 600 {
+		t.Errorf("rate limit %d, want 600", p.GetMaxRequestsPerMinute())
+	}
+}
+
+func TestGRPCProviderNoCoordinates(t *testing.T) {
+	p := dialGeoServer(t, &geoServer{lookup: func(_ context.Context, ip string) (*geopb.LookupResponse, error) {
+		return &geopb.LookupResponse{Ip: ip, Country: "US"}, nil
+	}})
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HasCoordinates {
+		t.Errorf("got coordinates %v, %v the service didn't send", got.Latitude, got.Longitude)
+	}
+}
+
+func TestGRPCProviderCountry(t *testing.T) {
+	tests := []struct {
+		country            string
+		wantCode, wantName string
+	}{
+		{"US", "US", "United States"},
+		{"de", "DE", "Germany"},
+		{"", "", ""},
+		{"not a code", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.country, func(t *testing.T) {
+			p := dialGeoServer(t, &geoServer{lookup: func(_ context.Context, ip string) (*geopb.LookupResponse, error) {
+				return &geopb.LookupResponse{Ip: ip, Country: tt.country}, nil
+			}})
+			got, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.CountryCode != tt.wantCode || got.Country != tt.wantName {
+				t.Errorf("got %q, %q, want %q, %q", got.CountryCode, got.Country, tt.wantCode, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestGRPCProviderErrors(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want error // nil for an unclassified error
+	}{
+		{codes.ResourceExhausted, ErrProviderRateLimited},
+		{codes.InvalidArgument, ErrProviderInvalidIP},
+		{codes.NotFound, ErrProviderNoData},
+		{codes.Unauthenticated, ErrProviderAuth},
+		{codes.PermissionDenied, ErrProviderAuth},
+		{codes.Unavailable, ErrProviderUnavailable},
+		{codes.Internal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			p := dialGeoServer(t, &geoServer{lookup: func(context.Context, string) (*geopb.LookupResponse, error) {
+				return nil, status.Error(tt.code, "scripted")
+			}})
+			_, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err == nil {
+				t.Fatal("lookup succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			var limited *ErrRateLimited
+			if errors.As(err, &limited) != (tt.want == ErrProviderRateLimited) {
+				t.Errorf("got %T, want an *ErrRateLimited only for ResourceExhausted", err)
+			}
+		})
+	}
+}
+
+func TestGRPCProviderDeadline(t *testing.T) {
+	p := dialGeoServer(t, &geoServer{lookup: func(ctx context.Context, _ string) (*geopb.LookupResponse, error) {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the caller's deadline", err)
+	}
+}
+
+func TestGRPCProviderCapacity(t *testing.T) {
+	resetAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	p := dialGeoServer(t, &geoServer{capacity: &geopb.CapacityResponse{MaxRequestsPerMinute: 600, Remaining: 42, ResetUnix: resetAt.Unix()}})
+
+	if _, _, ok := p.Quota(); ok {
+		t.Error("quota reported before asking the service")
+	}
+	if err := p.RefreshCapacity(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	remaining, at, ok := p.Quota()
+	if !ok || remaining != 42 || !at.Equal(resetAt) {
+		t.Errorf("got %d until %v (%v), want 42 until %v", remaining, at, ok, resetAt)
+	}
+}
+
+func TestGRPCProviderCapacityRefreshedByProbes(t *testing.T) {
+	resetAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	p := dialGeoServer(t, &geoServer{
+		lookup: func(_ context.Context, ip string) (*geopb.LookupResponse, error) {
+			return &geopb.LookupResponse{Ip: ip, Country: "US"}, nil
+		},
+		capacity: &geopb.CapacityResponse{MaxRequestsPerMinute: 600, Remaining: 0, ResetUnix: resetAt.Unix()},
+	})
+	b := NewBroker([]Provider{p}, WithHealthProbes(time.Hour, "8.8.8.8"))
+	defer b.Close()
+
+	b.probeProviders()
+	if remaining, at, ok := p.Quota(); !ok || remaining != 0 || !at.Equal(resetAt) {
+		t.Errorf("got %d until %v (%v) after a probe round, want 0 until %v", remaining, at, ok, resetAt)
+	}
+	if _, err := b.GetLocation(context.Background(), "1.1.1.1"); err == nil {
+		t.Error("lookup went to a provider reporting no capacity")
+	}
+}
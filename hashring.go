@@ -0,0 +1,106 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultVirtualNodes is how many points each provider gets on the ring
+const defaultVirtualNodes = 100
+
+// ConsistentHashStrategy routes each IP to the same provider every time by
+// hashing it onto a ring of the selectable providers. When a provider is
+// rate limited or unhealthy it drops off the ring and its IPs move to the
+// next position; IPs owned by other providers are unaffected.
+type ConsistentHashStrategy struct {
+	// VirtualNodes is the number of ring points per provider. Zero means
+	// defaultVirtualNodes.
+	VirtualNodes int
+
+	mutex sync.Mutex
+	ring  *hashRing
+}
+
+// Select falls back to the first candidate since there is no key to hash
+func (s *ConsistentHashStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	return candidates[0]
+}
+
+func (s *ConsistentHashStrategy) SelectFor(ip string, candidates []*ProviderStats) *ProviderStats {
+	names := make([]string, len(candidates))
+	byName := make(map[string]*ProviderStats, len(candidates))
+	for i, ps := range candidates {
+		names[i] = ps.provider.Name()
+		byName[names[i]] = ps
+	}
+
+	return byName[s.ringFor(names).lookup(ip)]
+}
+
+// ringFor returns the ring for the given providers, rebuilding it only when
+// the set of providers has changed since the last call
+func (s *ConsistentHashStrategy) ringFor(names []string) *hashRing {
+	key := strings.Join(names, "\x00")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ring == nil || s.ring.key != key {
+		vnodes := s.VirtualNodes
+		if vnodes <= 0 {
+			vnodes = defaultVirtualNodes
+		}
+		s.ring = newHashRing(key, names, vnodes)
+	}
+	return s.ring
+}
+
+// hashRing is an immutable consistent-hash ring of provider names
+type hashRing struct {
+	key    string
+	points []uint64
+	owners map[uint64]string
+}
+
+func newHashRing(key string, names []string, vnodes int) *hashRing {
+	r := &hashRing{
+		key:    key,
+		points: make([]uint64, 0, len(names)*vnodes),
+		owners: make(map[uint64]string, len(names)*vnodes),
+	}
+
+	for _, name := range names {
+		for i := 0; i < vnodes; i++ {
+			h := hashKey(name + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[h]; taken {
+				continue
+			}
+			r.owners[h] = name
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+
+	return r
+}
+
+// lookup returns the provider owning the first ring point at or after the
+// key's hash, wrapping around at the end of the ring
+func (r *hashRing) lookup(key string) string {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// hashKey hashes s with 64-bit FNV-1a
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
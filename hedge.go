@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// hedgeResult is the outcome of a single hedged provider call
+type hedgeResult struct {
+	location *Location
+	err      error
+}
+
+// lookupHedged starts with the best candidate and launches the next one
+// whenever the in-flight requests are slower than the hedge delay or one of
+// them fails. The first success is returned and the others are cancelled.
+// With a percentile set the delay is taken from the provider launched last.
+func (b *Broker) lookupHedged(ctx context.Context, ip string, candidates []*ProviderStats) (*Location, error) {
+	hedgeCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errLostRace)
+
+	// Buffered so losing calls can finish after we've returned
+	results := make(chan hedgeResult, len(candidates))
+
+	next, inFlight, hedges, failed := 0, 0, 0, 0
+	// launch starts the next candidate and returns how long to give it
+	launch := func() time.Duration {
+		ps := candidates[next]
+		next++
+		inFlight++
+		go func() {
+			location, err := b.callProvider(hedgeCtx, ps, ip)
+			results <- hedgeResult{location: location, err: err}
+		}()
+		return b.hedge.delayFor(ps)
+	}
+
+	timer := time.NewTimer(launch())
+	defer timer.Stop()
+
+	var lastErr error
+	for inFlight > 0 {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				return r.location, nil
+			}
+			if errors.Is(r.err, ErrProviderInvalidIP) {
+				// Other providers won't locate it either
+				return nil, r.err
+			}
+			lastErr = r.err
+			failed++
+
+			// Fail over immediately rather than waiting for the hedge timer
+			if next < len(candidates) && ctx.Err() == nil {
+				timer.Reset(launch())
+			}
+
+		case <-timer.C:
+			if next < len(candidates) && hedges < b.hedge.maxHedges {
+				hedges++
+				timer.Reset(launch())
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("all %d providers failed, last error: %w", failed, lastErr)
+}
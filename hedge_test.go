@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingProvider counts calls like a MockProvider but never answers. It
+// closes cancelled once its call's context is done.
+type blockingProvider struct {
+	*MockProvider
+	cancelled chan struct{}
+}
+
+func newBlockingProvider(name string) *blockingProvider {
+	return &blockingProvider{MockProvider: NewMockProvider(name, 0), cancelled: make(chan struct{})}
+}
+
+func (p *blockingProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	p.MockProvider.GetLocation(ctx, ip)
+	<-ctx.Done()
+	close(p.cancelled)
+	return nil, ctx.Err()
+}
+
+// waitIdle waits for the named provider's in-flight calls to finish
+func waitIdle(t *testing.T, b *Broker, name string) ProviderSnapshot {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		snap, err := b.Snapshot(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.InFlight == 0 || time.Now().After(deadline) {
+			return snap
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgeFiresAfterDelay(t *testing.T) {
+	primary := newBlockingProvider("primary")
+	backup := NewMockProvider("backup", 0)
+	b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1), WithHedging(50*time.Millisecond, 1))
+	defer b.Close()
+
+	start := time.Now()
+	loc, err := b.GetLocation(context.Background(), testIP(1))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "backup" {
+		t.Errorf("served by %s, want the hedge to backup", loc.Provider)
+	}
+	if elapsed < 50*time.Millisecond {
+		t.Errorf("answered after %v, before the hedge delay", elapsed)
+	}
+	if primary.Calls() != 1 || backup.Calls() != 1 {
+		t.Errorf("primary called %d times and backup %d, want 1 each", primary.Calls(), backup.Calls())
+	}
+
+	// The losing call is cancelled and not held against the provider
+	select {
+	case <-primary.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("losing call not cancelled")
+	}
+	if snap := waitIdle(t, b, "primary"); snap.ErrorsInWindow != 0 {
+		t.Errorf("cancelled call counted as %d errors", snap.ErrorsInWindow)
+	}
+}
+
+func TestHedgeNotFiredBeforeDelay(t *testing.T) {
+	primary := NewMockProvider("primary", 0, MockLatency(10*time.Millisecond))
+	backup := NewMockProvider("backup", 0)
+	b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1), WithHedging(time.Second, 1))
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), testIP(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "primary" {
+		t.Errorf("served by %s, want primary", loc.Provider)
+	}
+	if n := backup.Calls(); n != 0 {
+		t.Errorf("backup called %d times for a lookup faster than the hedge delay", n)
+	}
+}
+
+func TestHedgeFirstSuccessWins(t *testing.T) {
+	tests := []struct {
+		name           string
+		primaryLatency time.Duration
+		backupLatency  time.Duration
+		want           string
+	}{
+		// Both are in flight once the hedge fires; the faster answer wins
+		{"hedge faster", 300 * time.Millisecond, 10 * time.Millisecond, "backup"},
+		{"primary faster", 40 * time.Millisecond, 300 * time.Millisecond, "primary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := NewMockProvider("primary", 0, MockLatency(tt.primaryLatency))
+			backup := NewMockProvider("backup", 0, MockLatency(tt.backupLatency))
+			b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1), WithHedging(20*time.Millisecond, 1))
+			defer b.Close()
+
+			start := time.Now()
+			loc, err := b.GetLocation(context.Background(), testIP(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.Provider != tt.want {
+				t.Errorf("served by %s, want %s", loc.Provider, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+				t.Errorf("answered after %v, waited for the slower provider", elapsed)
+			}
+			if primary.Calls() != 1 || backup.Calls() != 1 {
+				t.Errorf("primary called %d times and backup %d, want 1 each", primary.Calls(), backup.Calls())
+			}
+		})
+	}
+}
+
+func TestHedgeFailsOverImmediately(t *testing.T) {
+	primary := NewMockProvider("primary", 0, MockFailCalls(1, 1, ErrProviderUnavailable))
+	backup := NewMockProvider("backup", 0)
+	b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1), WithHedging(time.Hour, 1))
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), testIP(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "backup" {
+		t.Errorf("served by %s, want backup", loc.Provider)
+	}
+
+	// Without another candidate the failure is returned
+	b2 := NewBroker([]Provider{NewMockProvider("only", 0, MockFailCalls(1, 1, ErrProviderUnavailable))}, WithHedging(time.Hour, 1))
+	defer b2.Close()
+	if _, err := b2.GetLocation(context.Background(), testIP(1)); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("got %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestHedgePercentile(t *testing.T) {
+	primary := newBlockingProvider("primary")
+	backup := NewMockProvider("backup", 0)
+	b := NewBroker([]Provider{primary, backup}, WithProviderTier("backup", 1),
+		WithHedgingPercentile(95, time.Hour, 1))
+	defer b.Close()
+
+	// Until primary has response times the fallback delay applies
+	if d := b.hedge.delayFor(b.findProvider("primary")); d != time.Hour {
+		t.Errorf("delay %v without response times, want the fallback of 1h", d)
+	}
+	for i := range 20 {
+		b.findProvider("primary").recordResponseTime(time.Duration(i+1) * time.Millisecond)
+	}
+	if d := b.hedge.delayFor(b.findProvider("primary")); d != 19*time.Millisecond {
+		t.Errorf("delay %v, want the p95 of 19ms", d)
+	}
+
+	start := time.Now()
+	loc, err := b.GetLocation(context.Background(), testIP(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "backup" {
+		t.Errorf("served by %s, want the hedge to backup", loc.Provider)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("hedged after %v, want about the p95", elapsed)
+	}
+}
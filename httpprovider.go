@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxErrorBody caps how much of an error response is kept for the message
+	maxErrorBody = 512
+	// maxDrain caps how much of an unread body is discarded to reuse the
+	// connection; larger leftovers just close it
+	maxDrain = 64 << 10
+)
+
+// Version is the release of the broker, sent in the default User-Agent
+const Version = "0.1.0"
+
+// DefaultUserAgent is sent by HTTP-backed providers not given one with
+// WithUserAgent. Some services block Go's own default.
+var DefaultUserAgent = "api-broker/" + Version
+
+// ProviderOption configures an HTTP-backed provider
+type ProviderOption func(*httpConfig)
+
+// httpConfig holds the settings shared by HTTP-backed providers
+type httpConfig struct {
+	client    *http.Client
+	token     string
+	baseURL   string
+	userAgent string
+	headers   http.Header
+	// err is the first invalid option, which the constructor returns
+	err error
+}
+
+// newHTTPConfig applies opts over the defaults. If no token was given,
+// it is read from the environment variable tokenEnv. It returns the error
+// of the first invalid option.
+func newHTTPConfig(opts []ProviderOption, tokenEnv string) (httpConfig, error) {
+	cfg := httpConfig{client: defaultHTTPClient}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.err != nil {
+		return httpConfig{}, cfg.err
+	}
+	if cfg.token == "" && tokenEnv != "" {
+		cfg.token = os.Getenv(tokenEnv)
+	}
+	return cfg, nil
+}
+
+// WithToken sets the API token or key the provider authenticates with,
+// overriding the provider's environment variable
+func WithToken(token string) ProviderOption {
+	return func(cfg *httpConfig) {
+		cfg.token = token
+	}
+}
+
+// WithTransportConfig gives the provider its own HTTP client and connection
+// pool tuned by tc, instead of sharing the default client
+func WithTransportConfig(tc TransportConfig) ProviderOption {
+	return func(cfg *httpConfig) {
+		cfg.client = NewHTTPClient(tc)
+	}
+}
+
+// WithHTTPClient makes the provider send its requests with client, for
+// example to add a proxy, a custom transport or instrumentation
+func WithHTTPClient(client *http.Client) ProviderOption {
+	return func(cfg *httpConfig) {
+		if client != nil {
+			cfg.client = client
+		}
+	}
+}
+
+// WithHeaders adds headers to every request the provider sends, e.g. an
+// X-Api-Key a proxy expects. They override the provider's own headers of the
+// same name. Values of headers that look like credentials are redacted from
+// errors.
+func WithHeaders(headers map[string]string) ProviderOption {
+	return func(cfg *httpConfig) {
+		if cfg.headers == nil {
+			cfg.headers = make(http.Header, len(headers))
+		}
+		for name, value := range headers {
+			cfg.headers.Set(name, value)
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent the provider sends instead of
+// DefaultUserAgent
+func WithUserAgent(userAgent string) ProviderOption {
+	return func(cfg *httpConfig) {
+		cfg.userAgent = userAgent
+	}
+}
+
+// WithBaseURL sends the provider's requests to rawURL instead of its public
+// endpoint, e.g. a mock server or an egress proxy. The provider still adds
+// its own path and query. The provider's constructor fails if rawURL is not
+// an absolute http or https URL.
+func WithBaseURL(rawURL string) ProviderOption {
+	return func(cfg *httpConfig) {
+		baseURL, err := ValidateBaseURL(rawURL)
+		if err != nil {
+			cfg.err = cmp.Or(cfg.err, err)
+			return
+		}
+		cfg.baseURL = baseURL
+	}
+}
+
+// ValidateBaseURL checks that rawURL can be used with WithBaseURL and
+// returns it without a trailing slash
+func ValidateBaseURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", rawURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid base URL %q: must not have a query or fragment", rawURL)
+	}
+	return strings.TrimSuffix(rawURL, "/"), nil
+}
+
+// baseURLOr returns the base URL set with WithBaseURL, or def if none was
+func (cfg *httpConfig) baseURLOr(def string) string {
+	if cfg.baseURL != "" {
+		return cfg.baseURL
+	}
+	return def
+}
+
+// requireToken returns ErrMissingCredentials if no token is configured
+func (cfg *httpConfig) requireToken(name, tokenEnv string) error {
+	if cfg.token == "" {
+		return fmt.Errorf("%w: %s needs an API key; pass WithToken or set %s", ErrMissingCredentials, name, tokenEnv)
+	}
+	return nil
+}
+
+// redact hides the configured token and sensitive header values anywhere in
+// err's message while keeping the error chain intact for errors.Is and
+// errors.As
+func (cfg *httpConfig) redact(err error) error {
+	if err == nil {
+		return err
+	}
+	var secrets []string
+	message := err.Error()
+	for _, secret := range cfg.secrets() {
+		if strings.Contains(message, secret) {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) == 0 {
+		return err
+	}
+	return &redactedError{err: err, secrets: secrets}
+}
+
+// secrets returns the values that must never appear in errors
+func (cfg *httpConfig) secrets() []string {
+	var secrets []string
+	if cfg.token != "" {
+		secrets = append(secrets, cfg.token)
+	}
+	for name, values := range cfg.headers {
+		if sensitiveHeader(name) {
+			for _, value := range values {
+				if value != "" {
+					secrets = append(secrets, value)
+				}
+			}
+		}
+	}
+	return secrets
+}
+
+// sensitiveHeader reports whether a header of this name likely carries a
+// credential
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"auth", "key", "token", "secret", "cookie", "password"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedError masks secrets in the message of the error it wraps
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+func (e *redactedError) Error() string {
+	message := e.err.Error()
+	for _, secret := range e.secrets {
+		message = strings.ReplaceAll(message, secret, "[REDACTED]")
+	}
+	return message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// GoString keeps %#v from printing the secrets and the unredacted error
+func (e *redactedError) GoString() string {
+	return fmt.Sprintf("&redactedError{%q}", e.Error())
+}
+
+// getJSON fetches url and decodes a successful response into v. Non-200
+// responses are returned as a *StatusError. header may be nil and is
+// overridden by WithHeaders. The response headers are returned whenever a
+// response was received. Errors never contain the token.
+func (cfg *httpConfig) getJSON(ctx context.Context, name, url string, header http.Header, v any) (http.Header, error) {
+	respHeader, err := cfg.fetchJSON(ctx, name, http.MethodGet, url, header, nil, v)
+	return respHeader, cfg.redact(err)
+}
+
+// postJSON is getJSON for a POST request sending body encoded as JSON
+func (cfg *httpConfig) postJSON(ctx context.Context, name, url string, header http.Header, body, v any) (http.Header, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encoding request: %w", name, err)
+	}
+	respHeader, err := cfg.fetchJSON(ctx, name, http.MethodPost, url, header, buf, v)
+	return respHeader, cfg.redact(err)
+}
+
+// fetchJSON does the work of getJSON and postJSON. body is sent as JSON
+// unless it is nil.
+func (cfg *httpConfig) fetchJSON(ctx context.Context, name, method, url string, header http.Header, body []byte, v any) (http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	for key, values := range cfg.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.userAgent != "" {
+		req.Header.Set("User-Agent", cfg.userAgent)
+	} else {
+		req.Header.Set("User-Agent", DefaultUserAgent)
+	}
+
+	resp, err := cfg.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, redactURLError(err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrProviderUnavailable, redactURLError(err))
+	}
+	defer func() {
+		// Drain what's left so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.Header, statusError(name, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.Header, fmt.Errorf("%s: decoding response: %w", name, err)
+	}
+	return resp.Header, nil
+}
+
+// statusError builds the error for a non-200 response. A 429 is returned
+// as an *ErrRateLimited carrying the response's Retry-After.
+func statusError(name string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	status := &StatusError{
+		Provider:   name,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &ErrRateLimited{
+			Provider:   name,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Err:        status,
+		}
+	}
+	return status
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date. It returns zero if the header is missing or malformed.
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// rateLimited builds the error for a rate limit a provider reported with a
+// message, keeping any Retry-After found in err's chain
+func rateLimited(name, message string, err error) *ErrRateLimited {
+	limited := &ErrRateLimited{
+		Provider: name,
+		Err:      fmt.Errorf("%w: %s: %s", ErrProviderRateLimited, name, message),
+	}
+	var upstream *ErrRateLimited
+	if errors.As(err, &upstream) {
+		limited.RetryAfter = upstream.RetryAfter
+	}
+	return limited
+}
+
+// errorMessage returns the "message" field of a JSON error body, or the body
+// itself if it has none
+func (e *StatusError) errorMessage() string {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal([]byte(e.Body), &body) == nil && body.Message != "" {
+		return body.Message
+	}
+	return e.Body
+}
+
+// redactURLError drops the query string from the URL quoted in a transport
+// error, since some providers take their API key as a query parameter
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.RawQuery != "" {
+		u.RawQuery = "REDACTED"
+		urlErr.URL = u.String()
+	}
+	return err
+}
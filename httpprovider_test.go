@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const secretToken = "s3cr3t-t0ken"
+
+// keyedProviders are the HTTP providers that authenticate with a token, and
+// the environment variable each reads it from
+var keyedProviders = []struct {
+	env      string
+	required bool
+	build    func(opts ...ProviderOption) (Provider, error)
+}{
+	{"IPINFO_TOKEN", false, func(opts ...ProviderOption) (Provider, error) { return NewIPInfoProvider(100, opts...) }},
+	{"IPSTACK_KEY", true, func(opts ...ProviderOption) (Provider, error) { return NewIPStackProvider(100, opts...) }},
+	{"IPDATA_API_KEY", true, func(opts ...ProviderOption) (Provider, error) { return NewIPDataProvider(100, opts...) }},
+	{"IPGEOLOCATION_API_KEY", true, func(opts ...ProviderOption) (Provider, error) { return NewIPGeolocationProvider(100, opts...) }},
+	{"IPBASE_API_KEY", true, func(opts ...ProviderOption) (Provider, error) { return NewIPBaseProvider(100, opts...) }},
+	{"IP2LOCATION_API_KEY", true, func(opts ...ProviderOption) (Provider, error) { return NewIP2LocationProvider(100, opts...) }},
+	{"IPAPICO_KEY", false, func(opts ...ProviderOption) (Provider, error) { return NewIPAPICoProvider(100, opts...) }},
+	{"DBIP_API_KEY", false, func(opts ...ProviderOption) (Provider, error) { return NewDBIPProvider(100, opts...) }},
+}
+
+func TestProviderCredentials(t *testing.T) {
+	for _, kp := range keyedProviders {
+		t.Run(kp.env, func(t *testing.T) {
+			t.Setenv(kp.env, "")
+			_, err := kp.build()
+			if kp.required && !errors.Is(err, ErrMissingCredentials) {
+				t.Errorf("without a key: got %v, want ErrMissingCredentials", err)
+			}
+			if !kp.required && err != nil {
+				t.Errorf("without an optional key: %v", err)
+			}
+			if _, err := kp.build(WithToken(secretToken)); err != nil {
+				t.Errorf("with WithToken: %v", err)
+			}
+			t.Setenv(kp.env, secretToken)
+			if _, err := kp.build(); err != nil {
+				t.Errorf("with %s set: %v", kp.env, err)
+			}
+		})
+	}
+}
+
+// echoServer answers with status and a body repeating the request's URL and
+// headers, like services that echo what they were sent in their errors
+func echoServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"message": "bad request %s %v"}`, r.URL, r.Header)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestProviderErrorsHideToken(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	servers := map[string]string{
+		"unauthorized": echoServer(t, http.StatusUnauthorized).URL,
+		"bad request":  echoServer(t, http.StatusBadRequest).URL,
+		"server error": echoServer(t, http.StatusInternalServerError).URL,
+		"unreachable":  closed.URL,
+	}
+
+	for _, kp := range keyedProviders {
+		for name, url := range servers {
+			t.Run(kp.env+"/"+name, func(t *testing.T) {
+				p, err := kp.build(WithToken(secretToken), WithBaseURL(url))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Contains(p.Name(), secretToken) {
+					t.Errorf("name %q contains the token", p.Name())
+				}
+
+				_, err = p.GetLocation(context.Background(), "8.8.8.8")
+				if err == nil {
+					t.Fatal("lookup succeeded")
+				}
+				for _, s := range []string{err.Error(), fmt.Sprintf("%v", err), fmt.Sprintf("%+v", err), fmt.Sprintf("%#v", err)} {
+					if strings.Contains(s, secretToken) {
+						t.Errorf("error contains the token: %s", s)
+					}
+				}
+
+				// Nor does it reach the log through the broker
+				b := NewBroker([]Provider{p}, WithObserver(LogObserver{}))
+				defer b.Close()
+				b.GetLocation(context.Background(), "8.8.8.8")
+			})
+		}
+	}
+	if strings.Contains(logs.String(), secretToken) {
+		t.Errorf("log contains the token:\n%s", logs.String())
+	}
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	http.RoundTripper
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	var mutex sync.Mutex
+	connections := 0
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ip": "8.8.8.8", "country": "US", "loc": "37.4,-122.1"}`))
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			connections++
+			mutex.Unlock()
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	transport := &countingTransport{RoundTripper: &http.Transport{}}
+	p, err := NewIPInfoProvider(100, WithBaseURL(s.URL), WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if _, err := p.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := transport.requests.Load(); n != 5 {
+		t.Errorf("%d requests through the injected client, want 5", n)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if connections != 1 {
+		t.Errorf("%d connections for 5 sequential lookups, want 1 kept alive", connections)
+	}
+}
+
+func TestDefaultHTTPClient(t *testing.T) {
+	p, err := NewIPInfoProvider(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.config.client != defaultHTTPClient || defaultHTTPClient.Timeout <= 0 {
+		t.Errorf("provider uses %p with timeout %v, want the shared client with a timeout", p.config.client, p.config.client.Timeout)
+	}
+	// A nil client keeps the default
+	p, err = NewIPInfoProvider(100, WithHTTPClient(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.config.client != defaultHTTPClient {
+		t.Error("WithHTTPClient(nil) replaced the shared client")
+	}
+}
+
+func TestValidateBaseURL(t *testing.T) {
+	tests := []struct {
+		rawURL string
+		want   string // empty for invalid
+	}{
+		{"http://127.0.0.1:8080", "http://127.0.0.1:8080"},
+		{"https://egress.internal/ipinfo/", "https://egress.internal/ipinfo"},
+		{"ipinfo.io", ""},
+		{"/relative", ""},
+		{"ftp://ipinfo.io", ""},
+		{"https://", ""},
+		{"https://egress.internal/?via=proxy", ""},
+		{"https://egress.internal/#top", ""},
+		{"://nowhere", ""},
+	}
+	for _, tt := range tests {
+		got, err := ValidateBaseURL(tt.rawURL)
+		if tt.want == "" && err == nil {
+			t.Errorf("ValidateBaseURL(%q) = %q, want an error", tt.rawURL, got)
+		}
+		if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("ValidateBaseURL(%q) = %q, %v, want %q", tt.rawURL, got, err, tt.want)
+		}
+	}
+}
+
+func TestWithBaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(opts ...ProviderOption) (Provider, error)
+		wantPath string
+	}{
+		{"ipinfo", func(opts ...ProviderOption) (Provider, error) { return NewIPInfoProvider(100, opts...) }, "/proxy/8.8.8.8/json"},
+		{"ipapi", func(opts ...ProviderOption) (Provider, error) { return NewIPAPIProvider(100, opts...) }, "/proxy/json/8.8.8.8"},
+		{"ipstack", func(opts ...ProviderOption) (Provider, error) { return NewIPStackProvider(100, opts...) }, "/proxy/8.8.8.8"},
+		{"ipdata", func(opts ...ProviderOption) (Provider, error) { return NewIPDataProvider(100, opts...) }, "/proxy/8.8.8.8"},
+		{"ipgeolocation", func(opts ...ProviderOption) (Provider, error) { return NewIPGeolocationProvider(100, opts...) }, "/proxy/ipgeo"},
+		{"ipbase", func(opts ...ProviderOption) (Provider, error) { return NewIPBaseProvider(100, opts...) }, "/proxy/v2/info"},
+		{"ip2location", func(opts ...ProviderOption) (Provider, error) { return NewIP2LocationProvider(100, opts...) }, "/proxy/"},
+		{"ipapico", func(opts ...ProviderOption) (Provider, error) { return NewIPAPICoProvider(100, opts...) }, "/proxy/8.8.8.8/json/"},
+		{"dbip", func(opts ...ProviderOption) (Provider, error) { return NewDBIPProvider(100, opts...) }, "/proxy/v2/" + secretToken + "/8.8.8.8"},
+		{"ipwhois", func(opts ...ProviderOption) (Provider, error) { return NewIPWhoisProvider(100, opts...) }, "/proxy/json/8.8.8.8"},
+		{"generic", func(opts ...ProviderOption) (Provider, error) {
+			return NewGenericJSONProvider(GenericJSONConfig{
+				Name:        "generic",
+				URL:         "https://geo.example.com/lookup/{ip}",
+				CountryPath: "country_code",
+			}, opts...)
+		}, "/proxy/lookup/8.8.8.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, `{}`)
+			p, err := tt.build(WithBaseURL(s.URL+"/proxy/"), WithToken(secretToken), WithUserAgent("staging-probe"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Whether an empty body decodes doesn't matter here, only where
+			// the request went
+			p.GetLocation(context.Background(), "8.8.8.8")
+			r := s.request()
+			if r == nil {
+				t.Fatal("no request reached the base URL")
+			}
+			if r.URL.Path != tt.wantPath {
+				t.Errorf("requested %s, want %s", r.URL.Path, tt.wantPath)
+			}
+			if ua := r.Header.Get("User-Agent"); ua != "staging-probe" {
+				t.Errorf("User-Agent %q, want staging-probe", ua)
+			}
+
+			if _, err := tt.build(WithBaseURL("ipinfo.io"), WithToken(secretToken)); err == nil {
+				t.Error("constructed with a base URL without a scheme")
+			}
+		})
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, `{"ip": "8.8.8.8", "country": "US"}`)
+	p, err := NewIPInfoProvider(100, WithBaseURL(s.URL), WithToken(secretToken), WithHeaders(map[string]string{
+		"X-Api-Key":     "proxy-key",
+		"X-Tenant":      "geo",
+		"Authorization": "Bearer proxy-token",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetLocation(context.Background(), "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+
+	header := s.request().Header
+	for name, want := range map[string]string{
+		"X-Api-Key": "proxy-key",
+		"X-Tenant":  "geo",
+		// Overrides the provider's own bearer token
+		"Authorization": "Bearer proxy-token",
+		"User-Agent":    DefaultUserAgent,
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWithHeadersRedacted(t *testing.T) {
+	const apiKey = "pr0xy-k3y-value"
+	s := echoServer(t, http.StatusBadRequest)
+	p, err := NewIPInfoProvider(100, WithBaseURL(s.URL), WithHeaders(map[string]string{"X-Api-Key": apiKey, "X-Tenant": "geo"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetLocation(context.Background(), "8.8.8.8")
+	if err == nil {
+		t.Fatal("lookup succeeded")
+	}
+	if !strings.Contains(err.Error(), "[REDACTED]") {
+		t.Errorf("error %q doesn't show the key was redacted", err)
+	}
+	// Only credentials are hidden
+	if !strings.Contains(err.Error(), "geo") {
+		t.Errorf("error %q lost a header that isn't a credential", err)
+	}
+	for _, s := range []string{err.Error(), fmt.Sprintf("%+v", err), fmt.Sprintf("%#v", err)} {
+		if strings.Contains(s, apiKey) {
+			t.Errorf("error contains the key: %s", s)
+		}
+	}
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want the *StatusError still reachable", err)
+	}
+}
+
+func TestSensitiveHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Authorization", true},
+		{"X-Api-Key", true},
+		{"x-auth-token", true},
+		{"X-Client-Secret", true},
+		{"Cookie", true},
+		{"Proxy-Authorization", true},
+		{"X-Tenant", false},
+		{"Accept", false},
+		{"User-Agent", false},
+	}
+	for _, tt := range tests {
+		if got := sensitiveHeader(tt.name); got != tt.want {
+			t.Errorf("sensitiveHeader(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
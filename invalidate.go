@@ -0,0 +1,53 @@
+package main
+
+import "context"
+
+// InvalidateIP removes any cached result or remembered failure for ip so the
+// next lookup goes to a provider. With prefix caching this invalidates the
+// whole prefix containing ip. Invalidating an IP that isn't cached succeeds.
+func (b *Broker) InvalidateIP(ctx context.Context, ip string) error {
+	addr, err := parseIP(ip)
+	if err != nil {
+		return err
+	}
+	if b.cache == nil && b.negative == nil {
+		return ErrCacheDisabled
+	}
+
+	if b.negative != nil {
+		b.negative.delete(addr.String())
+	}
+	if b.cache != nil {
+		key := b.cacheKey(addr)
+		if err := b.cache.Delete(ctx, key); err != nil {
+			b.cacheFailed("delete", key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// FlushCache removes every cached result and remembered failure, returning
+// how many cached results were removed. It returns ErrFlushUnsupported if
+// the cache can't be flushed.
+func (b *Broker) FlushCache(ctx context.Context) (int, error) {
+	if b.cache == nil && b.negative == nil {
+		return 0, ErrCacheDisabled
+	}
+
+	if b.negative != nil {
+		b.negative.flush()
+	}
+	if b.cache == nil {
+		return 0, nil
+	}
+	flusher, ok := b.cache.(CacheFlusher)
+	if !ok {
+		return 0, ErrFlushUnsupported
+	}
+	removed, err := flusher.Flush(ctx)
+	if err != nil {
+		b.cacheFailed("flush", "", err)
+	}
+	return removed, err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// parseIP parses ip into its canonical form so that every spelling of an
+// address shares cache entries, lookups and stats: IPv4-mapped IPv6
+// addresses become plain IPv4, and the String form is lowercase with zeros
+// compressed. It returns ErrInvalidIP if ip is not an address. Addresses
+// with a zone, such as "fe80::1%eth0", are rejected too: the zone names an
+// interface on the caller's host, which no provider can locate.
+func parseIP(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("%w: %q has a zone", ErrInvalidIP, ip)
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IP2LocationProvider implements the Provider interface for IP2Location.io
+type IP2LocationProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIP2LocationProvider creates an IP2Location.io provider. It requires an
+// API key, given with WithToken or read from IP2LOCATION_API_KEY; without
+// one it returns ErrMissingCredentials.
+func NewIP2LocationProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IP2LocationProvider, error) {
+	config, err := newHTTPConfig(opts, "IP2LOCATION_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.requireToken("ip2location.io", "IP2LOCATION_API_KEY"); err != nil {
+		return nil, err
+	}
+	return &IP2LocationProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://api.ip2location.io"),
+		config:               config,
+	}, nil
+}
+
+func (p *IP2LocationProvider) Name() string {
+	return "ip2location.io"
+}
+
+// ip2locationResponse is the body of an IP2Location.io lookup. Private and
+// reserved addresses come back with "-" in every field.
+type ip2locationResponse struct {
+	IP          string   `json:"ip"`
+	CountryCode string   `json:"country_code"` // ISO 3166-1 alpha-2
+	CountryName string   `json:"country_name"`
+	RegionName  string   `json:"region_name"`
+	CityName    string   `json:"city_name"`
+	ZipCode     string   `json:"zip_code"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	ASN         string   `json:"asn"` // "15169"
+	AS          string   `json:"as"`  // "Google LLC"
+}
+
+func (p *IP2LocationProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	query := url.Values{"key": {p.config.token}, "ip": {ip}}
+	endpoint := fmt.Sprintf("%s/?%s", p.baseURL, query.Encode())
+
+	var result ip2locationResponse
+	_, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return nil, p.config.redact(ip2locationError(status, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.CountryCode == "-" {
+		return nil, fmt.Errorf("%w: %s: no location for %s", ErrProviderInvalidIP, p.Name(), ip)
+	}
+
+	location := &Location{
+		IP:          result.IP,
+		Country:     result.CountryName,
+		CountryCode: result.CountryCode,
+		City:        result.CityName,
+		Region:      result.RegionName,
+		PostalCode:  result.ZipCode,
+		ASN:         result.ASN,
+		Org:         result.AS,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	return location, nil
+}
+
+// ip2locationError classifies an IP2Location.io error response, which
+// carries {"error": {"error_code": ..., "error_message": ...}}. A 401 is
+// either a bad key or a used up allowance, told apart by the message. err is
+// the error status came from.
+func ip2locationError(status *StatusError, err error) error {
+	var body struct {
+		Error struct {
+			Message string `json:"error_message"`
+		} `json:"error"`
+	}
+	message := status.Body
+	if json.Unmarshal([]byte(status.Body), &body) == nil && body.Error.Message != "" {
+		message = body.Error.Message
+	}
+
+	lower := strings.ToLower(message)
+	switch status.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if strings.Contains(lower, "limit") || strings.Contains(lower, "quota") {
+			return rateLimited(status.Provider, message, nil)
+		}
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, status.Provider, message)
+	case http.StatusTooManyRequests:
+		return rateLimited(status.Provider, message, err)
+	case http.StatusBadRequest:
+		if strings.Contains(lower, "invalid ip") {
+			return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, status.Provider, message)
+		}
+	}
+	return status
+}
+
+func (p *IP2LocationProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
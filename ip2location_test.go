@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestIP2LocationProvider(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, recordedResponse(t, "ip2location", "8.8.8.8"))
+	p, err := NewIP2LocationProvider(100, WithBaseURL(s.URL), WithToken("ip2l-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States of America", CountryCode: "US", City: "Mountain View",
+		Region: "California", PostalCode: "94035", ASN: "15169", Org: "Google LLC",
+		Latitude: 37.38605, Longitude: -122.08385, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if q := s.request().URL.Query(); q.Get("key") != "ip2l-key" || q.Get("ip") != "8.8.8.8" {
+		t.Errorf("query %v, want the key and address", q)
+	}
+}
+
+func TestIP2LocationProviderErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		status  int
+		want    error
+	}{
+		{"reserved", http.StatusOK, ErrProviderInvalidIP},
+		{"invalid-ip", http.StatusBadRequest, ErrProviderInvalidIP},
+		{"invalid-key", http.StatusUnauthorized, ErrProviderAuth},
+		// IP2Location.io answers a used up allowance with a 401 too
+		{"quota-exceeded", http.StatusUnauthorized, ErrProviderRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			s := newCannedServer(t, tt.status, nil, recordedResponse(t, "ip2location", tt.fixture))
+			p, err := NewIP2LocationProvider(100, WithBaseURL(s.URL), WithToken("ip2l-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.GetLocation(context.Background(), "10.0.0.1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIP2LocationProviderThroughBroker(t *testing.T) {
+	tests := []struct {
+		fixture         string
+		wantQuarantined bool
+		wantLimited     bool
+	}{
+		{"invalid-key", true, false},
+		{"quota-exceeded", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusUnauthorized, nil, recordedResponse(t, "ip2location", tt.fixture))
+			p, err := NewIP2LocationProvider(100, WithBaseURL(s.URL), WithToken("ip2l-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := NewBroker([]Provider{p})
+			defer b.Close()
+			b.GetLocation(context.Background(), "8.8.8.8")
+
+			snap, err := b.Snapshot(p.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snap.Quarantined != tt.wantQuarantined {
+				t.Errorf("quarantined %v, want %v", snap.Quarantined, tt.wantQuarantined)
+			}
+			if limited := !snap.UpstreamLimitedUntil.IsZero(); limited != tt.wantLimited {
+				t.Errorf("backed off until %v, want backed off %v", snap.UpstreamLimitedUntil, tt.wantLimited)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // empty for ErrInvalidIP
+	}{
+		{"8.8.8.8", "8.8.8.8"},
+		{"2606:4700:4700::1111", "2606:4700:4700::1111"},
+		{"2606:4700:4700:0:0:0:0:1111", "2606:4700:4700::1111"},
+		{"::ffff:8.8.8.8", "8.8.8.8"},
+		{"::ffff:808:808", "8.8.8.8"},
+		{"fe80::1", "fe80::1"},
+		{"fe80::1%eth0", ""},
+		{"fe80::1%25eth0", ""},
+		{"[2606:4700:4700::1111]", ""},
+		{"2606:4700:4700::1111/128", ""},
+		{"8.8.8.8:53", ""},
+		{"08.8.8.8", ""},
+		{"8.8.8", ""},
+		{" 8.8.8.8", ""},
+		{"", ""},
+		{"localhost", ""},
+		{"not an ip", ""},
+	}
+	for _, tt := range tests {
+		addr, err := parseIP(tt.in)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidIP) {
+				t.Errorf("parseIP(%q) = %v, %v; want ErrInvalidIP", tt.in, addr, err)
+			}
+			continue
+		}
+		if err != nil || addr.String() != tt.want {
+			t.Errorf("parseIP(%q) = %v, %v; want %s", tt.in, addr, err, tt.want)
+		}
+	}
+}
+
+// ipapiServer answers ip-api.com lookups and batches, recording the
+// request URIs it saw
+type ipapiServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	uris  []string
+}
+
+func newIPAPIServer(t *testing.T) *ipapiServer {
+	t.Helper()
+	s := &ipapiServer{}
+	answer := func(ip string) map[string]any {
+		return map[string]any{"status": "success", "query": ip, "country": "United States", "countryCode": "US", "city": "San Francisco"}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/", func(w http.ResponseWriter, r *http.Request) {
+		s.record(r)
+		json.NewEncoder(w).Encode(answer(strings.TrimPrefix(r.URL.Path, "/json/")))
+	})
+	mux.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) {
+		s.record(r)
+		var ips []string
+		if err := json.NewDecoder(r.Body).Decode(&ips); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results := make([]map[string]any, len(ips))
+		for i, ip := range ips {
+			results[i] = answer(ip)
+		}
+		json.NewEncoder(w).Encode(results)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *ipapiServer) record(r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.uris = append(s.uris, r.RequestURI)
+}
+
+func (s *ipapiServer) requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.uris...)
+}
+
+func TestBrokerRejectsInvalidIP(t *testing.T) {
+	p := NewMockProvider("mock", 0)
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+	ctx := context.Background()
+
+	for _, ip := range []string{"fe80::1%eth0", "[::1]", "8.8.8.8:53", "", "junk"} {
+		if _, err := b.GetLocation(ctx, ip); !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("GetLocation(%q): got %v, want ErrInvalidIP", ip, err)
+		}
+	}
+	if n := p.Calls(); n != 0 {
+		t.Errorf("provider called %d times for invalid input", n)
+	}
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.TotalRequests != 0 {
+		t.Errorf("%d requests counted for invalid input", snap.TotalRequests)
+	}
+
+	// Unzoned IPv6 and IPv4-mapped addresses are looked up, the latter as
+	// plain IPv4
+	for _, tt := range []struct{ in, asked string }{
+		{"2606:4700:4700::1111", "2606:4700:4700::1111"},
+		{"::ffff:8.8.4.4", "8.8.4.4"},
+	} {
+		loc, err := b.GetLocation(ctx, tt.in)
+		if err != nil {
+			t.Fatalf("GetLocation(%q): %v", tt.in, err)
+		}
+		if loc.IP != tt.asked {
+			t.Errorf("GetLocation(%q) answered for %q, want %s", tt.in, loc.IP, tt.asked)
+		}
+		if p.CallsFor(tt.asked) != 1 {
+			t.Errorf("GetLocation(%q) didn't ask the provider about %s", tt.in, tt.asked)
+		}
+	}
+}
+
+func TestBrokerGetLocationsRejectsInvalidIP(t *testing.T) {
+	ctx := context.Background()
+	ips := []string{"fe80::1%eth0", "2606:4700:4700::1111", "junk", "8.8.8.8"}
+	check := func(t *testing.T, locations []*Location, errs []error) {
+		t.Helper()
+		for _, i := range []int{0, 2} {
+			if locations[i] != nil || !errors.Is(errs[i], ErrInvalidIP) {
+				t.Errorf("%q: got %v, %v; want ErrInvalidIP", ips[i], locations[i], errs[i])
+			}
+		}
+		for _, i := range []int{1, 3} {
+			if errs[i] != nil || locations[i] == nil || locations[i].IP != ips[i] {
+				t.Errorf("%q: got %+v, %v", ips[i], locations[i], errs[i])
+			}
+		}
+	}
+
+	// One lookup at a time
+	t.Run("single", func(t *testing.T) {
+		p := NewMockProvider("mock", 0)
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+		locations, errs := b.GetLocations(ctx, ips)
+		check(t, locations, errs)
+		if n := p.Calls(); n != 2 {
+			t.Errorf("provider called %d times, want 2", n)
+		}
+	})
+
+	// Through a batch provider
+	t.Run("batch", func(t *testing.T) {
+		server := newIPAPIServer(t)
+		p, err := NewIPAPIProvider(0, WithBaseURL(server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+		locations, errs := b.GetLocations(ctx, ips)
+		check(t, locations, errs)
+		if got := server.requests(); len(got) != 1 || !strings.HasPrefix(got[0], "/batch?") {
+			t.Errorf("requests %q, want one batch", got)
+		}
+	})
+}
+
+func TestHTTPProviderIPv6URL(t *testing.T) {
+	server := newIPAPIServer(t)
+	p, err := NewIPAPIProvider(0, WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), "2606:4700:4700:0:0:0:0:1111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Country != "United States" {
+		t.Errorf("got %+v", loc)
+	}
+	got := server.requests()
+	if len(got) != 1 {
+		t.Fatalf("requests %q, want one", got)
+	}
+	// The canonical address goes in the path as is, without brackets
+	if !strings.HasPrefix(got[0], "/json/2606:4700:4700::1111?") {
+		t.Errorf("request %q, want the address as a path segment", got[0])
+	}
+
+	// Anything that reached a provider unparsed is escaped, not spliced in
+	if _, err := p.GetLocation(context.Background(), "fe80::1%eth0/x?y"); err != nil {
+		t.Fatal(err)
+	}
+	got = server.requests()
+	if !strings.HasPrefix(got[1], "/json/fe80::1%25eth0%2Fx%3Fy?") {
+		t.Errorf("request %q, want the input escaped", got[1])
+	}
+}
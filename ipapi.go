@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// ipapiFields limits ip-api.com responses to the fields we use
+	ipapiFields = "status,message,continentCode,country,countryCode,regionName,city,zip,lat,lon,timezone,isp,org,as,query"
+	// ipapiBatchSize is the most IPs ip-api.com accepts in one batch request
+	ipapiBatchSize = 100
+)
+
+// IPAPIProvider implements the Provider interface for ip-api.com
+type IPAPIProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+
+	// Rate limit state from the most recent response's X-Rl and X-Ttl.
+	// ip-api.com limits single lookups and batch requests separately.
+	quota      headerQuota
+	batchQuota headerQuota
+}
+
+// NewIPAPIProvider creates an ip-api.com provider using the free endpoint
+func NewIPAPIProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPAPIProvider, error) {
+	config, err := newHTTPConfig(opts, "")
+	if err != nil {
+		return nil, err
+	}
+	return &IPAPIProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("http://ip-api.com"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPAPIProvider) Name() string {
+	return "ip-api.com"
+}
+
+// ipapiResponse is the body of an ip-api.com lookup. Failures are reported
+// with a 200 status, "status": "fail" and a message.
+type ipapiResponse struct {
+	Status        string   `json:"status"`
+	Message       string   `json:"message"`
+	Query         string   `json:"query"`
+	ContinentCode string   `json:"continentCode"`
+	Country       string   `json:"country"`
+	CountryCode   string   `json:"countryCode"`
+	RegionName    string   `json:"regionName"`
+	City          string   `json:"city"`
+	Zip           string   `json:"zip"`
+	Timezone      string   `json:"timezone"`
+	ISP           string   `json:"isp"`
+	Org           string   `json:"org"`
+	AS            string   `json:"as"` // "AS15169 Google LLC"
+	Lat           *float64 `json:"lat"`
+	Lon           *float64 `json:"lon"`
+}
+
+func (p *IPAPIProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	var result ipapiResponse
+	endpoint := fmt.Sprintf("%s/json/%s?fields=%s", p.baseURL, url.PathEscape(ip), ipapiFields)
+	header, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+	p.quota.record(header, "X-Rl", "X-Ttl")
+	if err != nil {
+		return nil, err
+	}
+	return p.location(result)
+}
+
+// GetLocations looks up ips with a single request to ip-api.com's batch
+// endpoint, which answers in the order asked. It implements BatchProvider.
+// ip-api.com allows fewer batch requests than single lookups per minute.
+func (p *IPAPIProvider) GetLocations(ctx context.Context, ips []string) ([]*Location, []error) {
+	locations := make([]*Location, len(ips))
+	errs := make([]error, len(ips))
+
+	var results []ipapiResponse
+	endpoint := fmt.Sprintf("%s/batch?fields=%s", p.baseURL, ipapiFields)
+	header, err := p.config.postJSON(ctx, p.Name(), endpoint, nil, ips, &results)
+	p.batchQuota.record(header, "X-Rl", "X-Ttl")
+	if err == nil && len(results) != len(ips) {
+		err = fmt.Errorf("%w: %s: %d results for %d addresses", ErrBadProviderData, p.Name(), len(results), len(ips))
+	}
+
+	for i := range ips {
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		locations[i], errs[i] = p.location(results[i])
+	}
+	return locations, errs
+}
+
+// MaxBatchSize returns the most IPs GetLocations sends in one request
+func (p *IPAPIProvider) MaxBatchSize() int {
+	return ipapiBatchSize
+}
+
+// location converts one lookup result, turning an in-band failure into an
+// error
+func (p *IPAPIProvider) location(result ipapiResponse) (*Location, error) {
+	if result.Status != "success" {
+		switch result.Message {
+		case "private range", "reserved range", "invalid query":
+			return nil, fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, p.Name(), result.Message)
+		default:
+			return nil, fmt.Errorf("%s: lookup failed: %s", p.Name(), result.Message)
+		}
+	}
+
+	location := &Location{
+		IP:            result.Query,
+		Country:       result.Country,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.ContinentCode,
+		City:          result.City,
+		Region:        result.RegionName,
+		PostalCode:    result.Zip,
+		Timezone:      result.Timezone,
+		ASN:           result.AS,
+		ISP:           result.ISP,
+		Org:           result.Org,
+	}
+	location.setCoordinates(result.Lat, result.Lon)
+	return location, nil
+}
+
+// Quota returns the number of single lookups ip-api.com reported as
+// remaining in its current window and when that window resets. ok is false
+// until a response carrying the headers has been seen or once the window has
+// reset. It implements QuotaReporter.
+func (p *IPAPIProvider) Quota() (remaining int, resetAt time.Time, ok bool) {
+	return p.quota.get()
+}
+
+// BatchQuota is like Quota for batch requests. It implements
+// BatchQuotaReporter.
+func (p *IPAPIProvider) BatchQuota() (remaining int, resetAt time.Time, ok bool) {
+	return p.batchQuota.get()
+}
+
+func (p *IPAPIProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIPAPIProvider(t *testing.T) {
+	const success = `{"status": "success", "continentCode": "NA", "country": "United States", "countryCode": "US",
+		"regionName": "Virginia", "city": "Ashburn", "zip": "20149", "lat": 39.03, "lon": -77.5,
+		"timezone": "America/New_York", "isp": "Google LLC", "org": "Google Public DNS",
+		"as": "AS15169 Google LLC", "query": "8.8.8.8"}`
+
+	s := newCannedServer(t, http.StatusOK, map[string]string{"X-Rl": "44", "X-Ttl": "60"}, success)
+	p, err := NewIPAPIProvider(45, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA", City: "Ashburn",
+		Region: "Virginia", PostalCode: "20149", Timezone: "America/New_York", ASN: "AS15169 Google LLC",
+		ISP: "Google LLC", Org: "Google Public DNS", Latitude: 39.03, Longitude: -77.5, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	r := s.request()
+	if r.URL.Path != "/json/8.8.8.8" || r.URL.Query().Get("fields") != ipapiFields {
+		t.Errorf("requested %s, want /json/8.8.8.8 limited to our fields", r.URL)
+	}
+
+	remaining, resetAt, ok := p.Quota()
+	if !ok || remaining != 44 {
+		t.Errorf("quota %d, %v; want 44 reported", remaining, ok)
+	}
+	if until := time.Until(resetAt); until < 55*time.Second || until > 60*time.Second {
+		t.Errorf("quota resets in %v, want about 60s", until)
+	}
+}
+
+func TestIPAPIProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		want   error // nil for any error
+	}{
+		{"private range", http.StatusOK, nil, `{"status": "fail", "message": "private range", "query": "10.0.0.1"}`, ErrProviderInvalidIP},
+		{"reserved range", http.StatusOK, nil, `{"status": "fail", "message": "reserved range", "query": "240.0.0.1"}`, ErrProviderInvalidIP},
+		{"other failure", http.StatusOK, nil, `{"status": "fail", "message": "SSL unavailable for this endpoint"}`, nil},
+		{"rate limited", http.StatusTooManyRequests, map[string]string{"X-Rl": "0", "X-Ttl": "30"}, ``, ErrProviderRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, tt.status, tt.header, tt.body)
+			p, err := NewIPAPIProvider(45, WithBaseURL(s.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "10.0.0.1")
+			if err == nil {
+				t.Fatalf("got %+v, want an error", loc)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPAPIProviderMalformed(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, `{"status": "success", "lat": `)
+	p, err := NewIPAPIProvider(45, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetLocation(context.Background(), "8.8.8.8"); err == nil || !strings.Contains(err.Error(), "decoding response") {
+		t.Errorf("got %v, want a decoding error", err)
+	}
+}
+
+func TestIPAPIProviderBackOff(t *testing.T) {
+	// The service says the window's requests are used up for another 30s
+	s := newCannedServer(t, http.StatusTooManyRequests, map[string]string{"X-Rl": "0", "X-Ttl": "30"}, ``)
+	p, err := NewIPAPIProvider(45, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	if _, err := b.GetLocation(context.Background(), "8.8.8.8"); !errors.Is(err, ErrProviderRateLimited) {
+		t.Fatalf("got %v, want ErrProviderRateLimited", err)
+	}
+	snap, err := b.Snapshot(p.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap.QuotaReported || snap.ReportedRemaining != 0 || snap.Selectable {
+		t.Errorf("reported %v, %d remaining, selectable %v; want the broker to back off", snap.QuotaReported, snap.ReportedRemaining, snap.Selectable)
+	}
+}
+
+func TestIPAPIProviderBatchQuota(t *testing.T) {
+	// Batches have their own window, used up by the first one
+	var batches, singles atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		answer := func(ip string) map[string]string {
+			return map[string]string{"status": "success", "country": "United States", "countryCode": "US", "query": ip}
+		}
+		if r.URL.Path == "/batch" {
+			batches.Add(1)
+			var ips []string
+			json.NewDecoder(r.Body).Decode(&ips)
+			results := make([]map[string]string, len(ips))
+			for i, ip := range ips {
+				results[i] = answer(ip)
+			}
+			w.Header().Set("X-Rl", "0")
+			w.Header().Set("X-Ttl", "30")
+			json.NewEncoder(w).Encode(results)
+			return
+		}
+		singles.Add(1)
+		w.Header().Set("X-Rl", "44")
+		w.Header().Set("X-Ttl", "60")
+		json.NewEncoder(w).Encode(answer(strings.TrimPrefix(r.URL.Path, "/json/")))
+	}))
+	defer s.Close()
+	p, err := NewIPAPIProvider(45, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	lookup := func(ips ...string) {
+		t.Helper()
+		_, errs := b.GetLocations(context.Background(), ips)
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("lookup %d: %v", i, err)
+			}
+		}
+	}
+	lookup("8.8.8.8", "8.8.4.4", "1.1.1.1")
+	if _, _, ok := p.Quota(); ok {
+		t.Error("batch headers reported as the single lookup quota")
+	}
+	if remaining, _, ok := p.BatchQuota(); !ok || remaining != 0 {
+		t.Errorf("batch quota %d, %v; want none left", remaining, ok)
+	}
+
+	// With no batches left the broker looks the IPs up one at a time, which
+	// the batch window doesn't limit
+	lookup("9.9.9.9", "1.0.0.1", "208.67.222.222")
+	if n := batches.Load(); n != 1 {
+		t.Errorf("%d batch requests, want only the first", n)
+	}
+	if n := singles.Load(); n != 3 {
+		t.Errorf("%d single lookups, want 3", n)
+	}
+	if remaining, _, ok := p.Quota(); !ok || remaining != 44 {
+		t.Errorf("quota %d, %v; want the 44 single lookups reported", remaining, ok)
+	}
+}
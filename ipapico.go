@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IPAPICoProvider implements the Provider interface for ipapi.co. Not to be
+// confused with IPAPIProvider, which uses ip-api.com.
+type IPAPICoProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPAPICoProvider creates an ipapi.co provider. A key is optional and
+// read from IPAPICO_KEY unless given with WithToken; without one ipapi.co
+// applies its free limits.
+func NewIPAPICoProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPAPICoProvider, error) {
+	config, err := newHTTPConfig(opts, "IPAPICO_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return &IPAPICoProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://ipapi.co"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPAPICoProvider) Name() string {
+	return "ipapi.co"
+}
+
+// ipapicoResponse is the body of an ipapi.co lookup. Reserved and invalid
+// addresses come back with a 200 status, "error": true and a reason.
+type ipapicoResponse struct {
+	IP            string   `json:"ip"`
+	City          string   `json:"city"`
+	Region        string   `json:"region"`
+	Postal        string   `json:"postal"`
+	Timezone      string   `json:"timezone"`
+	ASN           string   `json:"asn"` // "AS15169"
+	Org           string   `json:"org"`
+	CountryCode   string   `json:"country_code"` // ISO 3166-1 alpha-2
+	ContinentCode string   `json:"continent_code"`
+	CountryName   string   `json:"country_name"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	Error         bool     `json:"error"`
+	Reason        string   `json:"reason"`
+	Message       string   `json:"message"`
+}
+
+func (p *IPAPICoProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	endpoint := fmt.Sprintf("%s/%s/json/", p.baseURL, url.PathEscape(ip))
+	if p.config.token != "" {
+		endpoint += "?" + url.Values{"key": {p.config.token}}.Encode()
+	}
+	// ipapi.co blocks Go's default User-Agent; getJSON never sends it
+	var result ipapicoResponse
+	_, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		// Error statuses carry the same envelope as in-band errors
+		var body ipapicoResponse
+		if json.Unmarshal([]byte(status.Body), &body) != nil || body.Reason == "" {
+			return nil, err
+		}
+		return nil, p.config.redact(ipapicoError(p.Name(), status.StatusCode, body, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Error {
+		return nil, p.config.redact(ipapicoError(p.Name(), http.StatusOK, result, nil))
+	}
+
+	location := &Location{
+		IP:            result.IP,
+		Country:       result.CountryName,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.ContinentCode,
+		City:          result.City,
+		Region:        result.Region,
+		PostalCode:    result.Postal,
+		Timezone:      result.Timezone,
+		ASN:           result.ASN,
+		Org:           result.Org,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	return location, nil
+}
+
+// ipapicoError classifies an ipapi.co error envelope received with the given
+// status code. err is the error the status came from, if any.
+func ipapicoError(name string, statusCode int, result ipapicoResponse, err error) error {
+	message := result.Reason
+	if result.Message != "" {
+		message += ": " + result.Message
+	}
+	detail := name + ": " + message
+
+	reason := strings.ToLower(result.Reason)
+	switch {
+	case statusCode == http.StatusTooManyRequests || strings.Contains(reason, "ratelimited"):
+		return rateLimited(name, message, err)
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrProviderAuth, detail)
+	case strings.Contains(reason, "reserved ip") || strings.Contains(reason, "invalid ip"):
+		return fmt.Errorf("%w: %s", ErrProviderInvalidIP, detail)
+	default:
+		return errors.New(detail)
+	}
+}
+
+func (p *IPAPICoProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPAPICoProvider(t *testing.T) {
+	const success = `{"ip": "8.8.8.8", "city": "Mountain View", "region": "California", "country_code": "US",
+		"country_name": "United States", "continent_code": "NA", "postal": "94043", "latitude": 37.42301,
+		"longitude": -122.083352, "timezone": "America/Los_Angeles", "asn": "AS15169", "org": "GOOGLE"}`
+
+	s := newCannedServer(t, http.StatusOK, nil, success)
+	p, err := NewIPAPICoProvider(100, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA", City: "Mountain View",
+		Region: "California", PostalCode: "94043", Timezone: "America/Los_Angeles", ASN: "AS15169", Org: "GOOGLE",
+		Latitude: 37.42301, Longitude: -122.083352, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	// ipapi.co blocks Go's default User-Agent
+	r := s.request()
+	if ua := r.Header.Get("User-Agent"); ua == "" || strings.HasPrefix(ua, "Go-http-client") {
+		t.Errorf("sent User-Agent %q, want one of our own", ua)
+	}
+	if r.URL.Path != "/8.8.8.8/json/" {
+		t.Errorf("requested %s, want /8.8.8.8/json/", r.URL.Path)
+	}
+}
+
+func TestIPAPICoProviderRateLimited(t *testing.T) {
+	s := newCannedServer(t, http.StatusTooManyRequests, map[string]string{"Retry-After": "60"},
+		`{"error": true, "reason": "RateLimited", "message": "Visit https://ipapi.co/ratelimited/ for details"}`)
+	p, err := NewIPAPICoProvider(100, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetLocation(context.Background(), "8.8.8.8")
+	var limited *ErrRateLimited
+	if !errors.As(err, &limited) || !errors.Is(err, ErrProviderRateLimited) {
+		t.Fatalf("got %v, want an *ErrRateLimited", err)
+	}
+	if limited.RetryAfter != time.Minute {
+		t.Errorf("retry after %v, want the minute the header asked for", limited.RetryAfter)
+	}
+	if !strings.Contains(err.Error(), "RateLimited") {
+		t.Errorf("error %q doesn't carry the reason", err)
+	}
+}
+
+func TestIPAPICoProviderInBandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error // nil for any error
+	}{
+		{"reserved", `{"ip": "10.0.0.1", "error": true, "reason": "Reserved IP Address", "reserved": true, "version": "IPv4"}`, ErrProviderInvalidIP},
+		{"invalid", `{"ip": "nope", "error": true, "reason": "Invalid IP Address"}`, ErrProviderInvalidIP},
+		// Some rate limits come back with a 200 too
+		{"rate limited", `{"error": true, "reason": "RateLimited"}`, ErrProviderRateLimited},
+		{"other", `{"error": true, "reason": "Something else"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewIPAPICoProvider(100, WithBaseURL(s.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "10.0.0.1")
+			if err == nil {
+				t.Fatalf("got %+v for an error in a 200 response", loc)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IPBaseProvider implements the Provider interface for ipbase.com
+type IPBaseProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+
+	// Rate limit state from the most recent response's RateLimit-Remaining
+	// and RateLimit-Reset
+	quota headerQuota
+}
+
+// NewIPBaseProvider creates an ipbase.com provider. It requires an API key,
+// given with WithToken or read from IPBASE_API_KEY; without one it returns
+// ErrMissingCredentials.
+func NewIPBaseProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPBaseProvider, error) {
+	config, err := newHTTPConfig(opts, "IPBASE_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.requireToken("ipbase.com", "IPBASE_API_KEY"); err != nil {
+		return nil, err
+	}
+	return &IPBaseProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://api.ipbase.com"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPBaseProvider) Name() string {
+	return "ipbase.com"
+}
+
+// ipbaseResponse is the body of an ipbase.com lookup. The location is
+// nested, with the country and city each in their own object, and is null
+// for addresses outside public ranges.
+type ipbaseResponse struct {
+	Data struct {
+		IP        string `json:"ip"`
+		RangeType struct {
+			Type string `json:"type"` // PUBLIC, PRIVATE, RESERVED, ...
+		} `json:"range_type"`
+		Location *struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+			Zip       string   `json:"zip"`
+			Country   struct {
+				Alpha2 string `json:"alpha2"` // ISO 3166-1 alpha-2
+				Name   string `json:"name"`
+			} `json:"country"`
+			Region struct {
+				Name string `json:"name"`
+			} `json:"region"`
+			City struct {
+				Name string `json:"name"`
+			} `json:"city"`
+		} `json:"location"`
+		Timezone struct {
+			ID string `json:"id"`
+		} `json:"timezone"`
+		Connection struct {
+			ASN          json.Number `json:"asn"`
+			Organization string      `json:"organization"`
+			ISP          string      `json:"isp"`
+		} `json:"connection"`
+	} `json:"data"`
+}
+
+func (p *IPBaseProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	query := url.Values{"apikey": {p.config.token}, "ip": {ip}}
+	endpoint := fmt.Sprintf("%s/v2/info?%s", p.baseURL, query.Encode())
+
+	var result ipbaseResponse
+	header, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+	p.quota.record(header, "RateLimit-Remaining", "RateLimit-Reset")
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return nil, p.config.redact(p.classify(status, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.Data
+	if data.Location == nil || data.Location.Country.Alpha2 == "" {
+		if data.RangeType.Type != "" && data.RangeType.Type != "PUBLIC" {
+			return nil, fmt.Errorf("%w: %s: %s address", ErrProviderInvalidIP, p.Name(), strings.ToLower(data.RangeType.Type))
+		}
+		return nil, fmt.Errorf("%s: no location for %s", p.Name(), ip)
+	}
+	location := &Location{
+		IP:          data.IP,
+		Country:     data.Location.Country.Name,
+		CountryCode: data.Location.Country.Alpha2,
+		City:        data.Location.City.Name,
+		Region:      data.Location.Region.Name,
+		PostalCode:  data.Location.Zip,
+		Timezone:    data.Timezone.ID,
+		ASN:         data.Connection.ASN.String(),
+		ISP:         data.Connection.ISP,
+		Org:         data.Connection.Organization,
+	}
+	location.setCoordinates(data.Location.Latitude, data.Location.Longitude)
+	return location, nil
+}
+
+// classify turns an ipbase.com error response into a provider error. A 429
+// without a Retry-After waits for the reset the quota headers announced.
+// err is the error status came from.
+func (p *IPBaseProvider) classify(status *StatusError, err error) error {
+	message := status.errorMessage()
+	switch status.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, status.Provider, message)
+	case http.StatusTooManyRequests:
+		limited := rateLimited(status.Provider, message, err)
+		if _, resetAt, ok := p.quota.get(); ok && limited.RetryAfter == 0 {
+			limited.RetryAfter = time.Until(resetAt).Round(time.Second)
+		}
+		return limited
+	case http.StatusUnprocessableEntity, http.StatusBadRequest:
+		// Malformed addresses fail validation
+		if strings.Contains(strings.ToLower(message), "valid ip") {
+			return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, status.Provider, message)
+		}
+	}
+	return status
+}
+
+// Quota returns the number of requests ipbase.com reported as remaining and
+// when its window resets. It implements QuotaReporter.
+func (p *IPBaseProvider) Quota() (remaining int, resetAt time.Time, ok bool) {
+	return p.quota.get()
+}
+
+func (p *IPBaseProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const ipbaseSuccess = `{"data": {"ip": "8.8.8.8", "hostname": "dns.google", "type": "v4",
+	"range_type": {"type": "PUBLIC", "description": "Public address"},
+	"connection": {"asn": 15169, "organization": "Google LLC", "isp": "Google LLC", "range": "8.8.8.0/24"},
+	"location": {"geonames_id": 5375480, "latitude": 37.38605, "longitude": -122.08385, "zip": "94035",
+		"continent": {"code": "NA", "name": "North America"},
+		"country": {"alpha2": "US", "alpha3": "USA", "name": "United States"},
+		"region": {"alpha2": "US-CA", "name": "California"},
+		"city": {"name": "Mountain View"}},
+	"timezone": {"id": "America/Los_Angeles", "current_time": "2024-01-01T04:00:00-08:00"}}}`
+
+func TestIPBaseProvider(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, map[string]string{"RateLimit-Remaining": "41", "RateLimit-Reset": "60"}, ipbaseSuccess)
+	p, err := NewIPBaseProvider(100, WithBaseURL(s.URL), WithToken("base-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", City: "Mountain View", Region: "California",
+		PostalCode: "94035", Timezone: "America/Los_Angeles", ASN: "15169", ISP: "Google LLC", Org: "Google LLC",
+		Latitude: 37.38605, Longitude: -122.08385, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if r := s.request(); r.URL.Path != "/v2/info" || r.URL.Query().Get("apikey") != "base-key" || r.URL.Query().Get("ip") != "8.8.8.8" {
+		t.Errorf("requested %s, want /v2/info with the key and address", r.URL)
+	}
+
+	remaining, resetAt, ok := p.Quota()
+	if !ok || remaining != 41 {
+		t.Errorf("quota %d (%v), want 41 from the headers", remaining, ok)
+	}
+	if until := time.Until(resetAt); until < 55*time.Second || until > 60*time.Second {
+		t.Errorf("quota resets in %v, want about a minute", until)
+	}
+}
+
+func TestIPBaseProviderNoLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error // nil for any error
+	}{
+		{"private", `{"data": {"ip": "10.0.0.1", "range_type": {"type": "PRIVATE"}, "location": null}}`, ErrProviderInvalidIP},
+		{"unlocated", `{"data": {"ip": "8.8.8.8", "range_type": {"type": "PUBLIC"}, "location": null}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewIPBaseProvider(100, WithBaseURL(s.URL), WithToken("base-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "10.0.0.1")
+			if err == nil {
+				t.Fatalf("got %+v without a location", loc)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPBaseProviderRateLimited(t *testing.T) {
+	s := newCannedServer(t, http.StatusTooManyRequests, map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "120"},
+		`{"message": "Too Many Requests"}`)
+	p, err := NewIPBaseProvider(100, WithBaseURL(s.URL), WithToken("base-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetLocation(context.Background(), "8.8.8.8")
+	var limited *ErrRateLimited
+	if !errors.As(err, &limited) || !errors.Is(err, ErrProviderRateLimited) {
+		t.Fatalf("got %v, want an *ErrRateLimited", err)
+	}
+	// Without a Retry-After it waits for the announced reset
+	if limited.RetryAfter < 115*time.Second || limited.RetryAfter > 120*time.Second {
+		t.Errorf("retry after %v, want the two minutes until the reset", limited.RetryAfter)
+	}
+	if remaining, _, ok := p.Quota(); !ok || remaining != 0 {
+		t.Errorf("quota %d (%v), want none left", remaining, ok)
+	}
+
+	// With Retry-After that wins
+	s = newCannedServer(t, http.StatusTooManyRequests, map[string]string{"Retry-After": "5", "RateLimit-Remaining": "0", "RateLimit-Reset": "120"}, `{}`)
+	p, err = NewIPBaseProvider(100, WithBaseURL(s.URL), WithToken("base-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetLocation(context.Background(), "8.8.8.8")
+	if !errors.As(err, &limited) || limited.RetryAfter != 5*time.Second {
+		t.Errorf("got %v, want to retry after 5s", err)
+	}
+}
+
+func TestIPBaseProviderQuotaThroughBroker(t *testing.T) {
+	// The last request of the window succeeds and says so
+	s := newCannedServer(t, http.StatusOK, map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "60"}, ipbaseSuccess)
+	p, err := NewIPBaseProvider(100, WithBaseURL(s.URL), WithToken("base-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback := NewMockProvider("fallback", 0)
+	b := NewBroker([]Provider{p, fallback}, WithProviderTier("fallback", 1))
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != p.Name() {
+		t.Fatalf("first lookup served by %s, want ipbase.com", loc.Provider)
+	}
+	for i := 1; i < 5; i++ {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fallback.Calls(); n != 4 {
+		t.Errorf("fallback served %d of 5 lookups, want all after ipbase.com ran out", n)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IPDataProvider implements the Provider interface for ipdata.co
+type IPDataProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPDataProvider creates an ipdata.co provider. It requires an API key,
+// given with WithToken or read from IPDATA_API_KEY; without one it returns
+// ErrMissingCredentials.
+func NewIPDataProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPDataProvider, error) {
+	config, err := newHTTPConfig(opts, "IPDATA_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.requireToken("ipdata.co", "IPDATA_API_KEY"); err != nil {
+		return nil, err
+	}
+	return &IPDataProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://api.ipdata.co"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPDataProvider) Name() string {
+	return "ipdata.co"
+}
+
+// IPDataResponse is the full body of an ipdata.co lookup, including the
+// network and threat data that Location has no room for
+type IPDataResponse struct {
+	IP          string   `json:"ip"`
+	City        string   `json:"city"`
+	Region      string   `json:"region"`
+	RegionCode  string   `json:"region_code"`
+	CountryName string   `json:"country_name"`
+	CountryCode string   `json:"country_code"` // ISO 3166-1 alpha-2
+	Continent   string   `json:"continent_code"`
+	Postal      string   `json:"postal"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	ASN         struct {
+		ASN    string `json:"asn"`
+		Name   string `json:"name"`
+		Domain string `json:"domain"`
+		Route  string `json:"route"`
+		Type   string `json:"type"`
+	} `json:"asn"`
+	TimeZone struct {
+		Name   string `json:"name"`
+		Offset string `json:"offset"`
+	} `json:"time_zone"`
+	Threat struct {
+		IsTor           bool `json:"is_tor"`
+		IsICloudRelay   bool `json:"is_icloud_relay"`
+		IsProxy         bool `json:"is_proxy"`
+		IsDatacenter    bool `json:"is_datacenter"`
+		IsAnonymous     bool `json:"is_anonymous"`
+		IsKnownAttacker bool `json:"is_known_attacker"`
+		IsKnownAbuser   bool `json:"is_known_abuser"`
+		IsThreat        bool `json:"is_threat"`
+		IsBogon         bool `json:"is_bogon"`
+	} `json:"threat"`
+}
+
+func (p *IPDataProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	result, err := p.Lookup(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	location := &Location{
+		IP:            result.IP,
+		Country:       result.CountryName,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.Continent,
+		City:          result.City,
+		Region:        result.Region,
+		PostalCode:    result.Postal,
+		Timezone:      result.TimeZone.Name,
+		ASN:           result.ASN.ASN,
+		Org:           result.ASN.Name,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	return location, nil
+}
+
+// Lookup returns everything ipdata.co knows about ip. It bypasses the
+// broker, so its requests are not rate limited or counted.
+func (p *IPDataProvider) Lookup(ctx context.Context, ip string) (*IPDataResponse, error) {
+	query := url.Values{"api-key": {p.config.token}}
+	endpoint := fmt.Sprintf("%s/%s?%s", p.baseURL, url.PathEscape(ip), query.Encode())
+
+	var result IPDataResponse
+	_, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return nil, p.config.redact(ipdataError(status, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ipdataError classifies an ipdata.co error response. Every error carries a
+// {"message": ...} body. err is the error status came from.
+func ipdataError(status *StatusError, err error) error {
+	message := status.errorMessage()
+	switch status.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, status.Provider, message)
+	case http.StatusTooManyRequests:
+		return rateLimited(status.Provider, message, err)
+	case http.StatusBadRequest:
+		// Private, reserved and malformed addresses
+		lower := strings.ToLower(message)
+		if strings.Contains(lower, "private") || strings.Contains(lower, "reserved") || strings.Contains(lower, "does not appear to be an ip") {
+			return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, status.Provider, message)
+		}
+	}
+	return status
+}
+
+func (p *IPDataProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordedResponse returns a response body recorded from provider, kept in
+// testdata/<provider>/<name>.json
+func recordedResponse(t *testing.T, provider, name string) string {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", provider, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestIPDataProvider(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"8.8.8.8", Location{
+			IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA", City: "Mountain View",
+			Region: "California", PostalCode: "94035", Timezone: "America/Los_Angeles", ASN: "AS15169", Org: "Google LLC",
+			Latitude: 37.386, Longitude: -122.0838, HasCoordinates: true,
+		}},
+		// Nulls for what ipdata.co doesn't know
+		{"185.220.101.1", Location{
+			IP: "185.220.101.1", Country: "Germany", CountryCode: "DE", ContinentCode: "EU", Timezone: "Europe/Berlin",
+			ASN: "AS60729", Org: "Zwiebelfreunde e.V.", Latitude: 51.2993, Longitude: 9.491, HasCoordinates: true,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, recordedResponse(t, "ipdata", tt.ip))
+			p, err := NewIPDataProvider(100, WithBaseURL(s.URL), WithToken("data-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.GetLocation(context.Background(), tt.ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			if r := s.request(); r.URL.Path != "/"+tt.ip || r.URL.Query().Get("api-key") != "data-key" {
+				t.Errorf("requested %s, want /%s with the key", r.URL.Path, tt.ip)
+			}
+		})
+	}
+}
+
+func TestIPDataProviderThreat(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, recordedResponse(t, "ipdata", "185.220.101.1"))
+	p, err := NewIPDataProvider(100, WithBaseURL(s.URL), WithToken("data-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Lookup(context.Background(), "185.220.101.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	threat := result.Threat
+	if !threat.IsTor || !threat.IsThreat || !threat.IsKnownAttacker || threat.IsBogon {
+		t.Errorf("threat data %+v, want a known Tor exit", threat)
+	}
+	if result.ASN.Type != "hosting" || result.ASN.Route != "185.220.101.0/24" {
+		t.Errorf("network data %+v", result.ASN)
+	}
+}
+
+func TestIPDataProviderErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		status  int
+		want    error
+	}{
+		{"private", http.StatusBadRequest, ErrProviderInvalidIP},
+		{"unauthorized", http.StatusUnauthorized, ErrProviderAuth},
+		{"forbidden", http.StatusForbidden, ErrProviderAuth},
+		{"ratelimited", http.StatusTooManyRequests, ErrProviderRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			s := newCannedServer(t, tt.status, nil, recordedResponse(t, "ipdata", tt.fixture))
+			p, err := NewIPDataProvider(100, WithBaseURL(s.URL), WithToken("data-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.GetLocation(context.Background(), "10.0.0.1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			var limited *ErrRateLimited
+			if errors.As(err, &limited) != (tt.want == ErrProviderRateLimited) {
+				t.Errorf("got %T, want an *ErrRateLimited only for rate limits", err)
+			}
+		})
+	}
+}
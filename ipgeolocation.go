@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IPGeolocationProvider implements the Provider interface for
+// ipgeolocation.io
+type IPGeolocationProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPGeolocationProvider creates an ipgeolocation.io provider. It requires
+// an API key, given with WithToken or read from IPGEOLOCATION_API_KEY;
+// without one it returns ErrMissingCredentials.
+func NewIPGeolocationProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPGeolocationProvider, error) {
+	config, err := newHTTPConfig(opts, "IPGEOLOCATION_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.requireToken("ipgeolocation.io", "IPGEOLOCATION_API_KEY"); err != nil {
+		return nil, err
+	}
+	return &IPGeolocationProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://api.ipgeolocation.io"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPGeolocationProvider) Name() string {
+	return "ipgeolocation.io"
+}
+
+// ipgeolocationResponse is the body of an ipgeolocation.io lookup. Latitude
+// and longitude come back as strings. Errors use a 4xx status with a
+// {"message": ...} body.
+type ipgeolocationResponse struct {
+	IP            string `json:"ip"`
+	CountryCode   string `json:"country_code2"` // ISO 3166-1 alpha-2
+	CountryName   string `json:"country_name"`
+	ContinentCode string `json:"continent_code"`
+	StateProv     string `json:"state_prov"`
+	City          string `json:"city"`
+	Zipcode       string `json:"zipcode"`
+	Latitude      string `json:"latitude"`
+	Longitude     string `json:"longitude"`
+	ISP           string `json:"isp"`
+	Organization  string `json:"organization"`
+	TimeZone      struct {
+		Name string `json:"name"`
+	} `json:"time_zone"`
+}
+
+func (p *IPGeolocationProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	query := url.Values{"apiKey": {p.config.token}, "ip": {ip}}
+	endpoint := fmt.Sprintf("%s/ipgeo?%s", p.baseURL, query.Encode())
+
+	var result ipgeolocationResponse
+	_, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result)
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return nil, p.config.redact(ipgeolocationError(status, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	location := &Location{
+		IP:            result.IP,
+		Country:       result.CountryName,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.ContinentCode,
+		City:          result.City,
+		Region:        result.StateProv,
+		PostalCode:    result.Zipcode,
+		Timezone:      result.TimeZone.Name,
+		ISP:           result.ISP,
+		Org:           result.Organization,
+	}
+	location.setCoordinates(parseCoordinate(result.Latitude), parseCoordinate(result.Longitude))
+	return location, nil
+}
+
+// ipgeolocationError classifies an ipgeolocation.io error response. Free
+// plans report an exhausted quota with a 401, so the message decides
+// between a key problem and a rate limit. err is the error status came from.
+func ipgeolocationError(status *StatusError, err error) error {
+	message := status.errorMessage()
+	switch status.StatusCode {
+	case http.StatusUnauthorized:
+		if strings.Contains(strings.ToLower(message), "limit") {
+			return rateLimited(status.Provider, message, nil)
+		}
+		return fmt.Errorf("%w: %s: %s", ErrProviderAuth, status.Provider, message)
+	case http.StatusLocked:
+		// Bogon addresses such as private and reserved ranges
+		return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, status.Provider, message)
+	case http.StatusBadRequest:
+		if strings.Contains(strings.ToLower(message), "not a valid ip") {
+			return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, status.Provider, message)
+		}
+	case http.StatusTooManyRequests:
+		// Paid plans over their limit
+		return rateLimited(status.Provider, message, err)
+	}
+	return status
+}
+
+func (p *IPGeolocationProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIPGeolocationProvider(t *testing.T) {
+	const success = `{"ip": "8.8.8.8", "continent_code": "NA", "country_code2": "US", "country_name": "United States",
+		"state_prov": "California", "city": "Mountain View", "zipcode": "94043-1351",
+		"latitude": "37.42240", "longitude": "-122.08421", "isp": "Google LLC", "organization": "Google LLC",
+		"time_zone": {"name": "America/Los_Angeles", "offset": -8}}`
+
+	s := newCannedServer(t, http.StatusOK, nil, success)
+	p, err := NewIPGeolocationProvider(100, WithBaseURL(s.URL), WithToken("geo-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA", City: "Mountain View",
+		Region: "California", PostalCode: "94043-1351", Timezone: "America/Los_Angeles", ISP: "Google LLC",
+		Org: "Google LLC", Latitude: 37.4224, Longitude: -122.08421, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if q := s.request().URL.Query(); q.Get("apiKey") != "geo-key" || q.Get("ip") != "8.8.8.8" {
+		t.Errorf("query %v, want the key and address", q)
+	}
+}
+
+func TestIPGeolocationProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"invalid key", http.StatusUnauthorized, `{"message": "Provided API key is not valid. Contact technical support for assistance at support@ipgeolocation.io"}`, ErrProviderAuth},
+		{"free quota exceeded", http.StatusUnauthorized, `{"message": "You have exceeded your daily limit of 1000 requests."}`, ErrProviderRateLimited},
+		{"paid quota exceeded", http.StatusTooManyRequests, `{"message": "Your subscription has reached its request limit."}`, ErrProviderRateLimited},
+		{"bogon", http.StatusLocked, `{"message": "'10.0.0.1' is a bogon IP address."}`, ErrProviderInvalidIP},
+		{"bad address", http.StatusBadRequest, `{"message": "'nope' is not a valid IP address."}`, ErrProviderInvalidIP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, tt.status, nil, tt.body)
+			p, err := NewIPGeolocationProvider(100, WithBaseURL(s.URL), WithToken("geo-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.GetLocation(context.Background(), "10.0.0.1"); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPGeolocationProviderThroughBroker(t *testing.T) {
+	t.Run("quota exceeded", func(t *testing.T) {
+		s := newCannedServer(t, http.StatusUnauthorized, nil, `{"message": "You have exceeded your daily limit of 1000 requests."}`)
+		p, err := NewIPGeolocationProvider(100, WithBaseURL(s.URL), WithToken("geo-key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+		b.GetLocation(context.Background(), "8.8.8.8")
+
+		// Backed off rather than counted as failing
+		snap, err := b.Snapshot(p.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.UpstreamLimitedUntil.Before(time.Now()) || snap.ErrorsInWindow != 0 {
+			t.Errorf("limited until %v with %d errors; want backed off without errors", snap.UpstreamLimitedUntil, snap.ErrorsInWindow)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		s := newCannedServer(t, http.StatusUnauthorized, nil, `{"message": "Provided API key is not valid."}`)
+		p, err := NewIPGeolocationProvider(100, WithBaseURL(s.URL), WithToken("geo-key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+		if _, err := b.GetLocation(context.Background(), "8.8.8.8"); !errors.Is(err, ErrProviderAuth) {
+			t.Fatalf("got %v, want ErrProviderAuth", err)
+		}
+
+		// Retrying with the same key can't help
+		snap, err := b.Snapshot(p.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !snap.Quarantined {
+			t.Error("provider with a rejected key still selectable")
+		}
+	})
+}
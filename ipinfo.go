@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// IPInfoProvider implements the Provider interface for ipinfo.io
+type IPInfoProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPInfoProvider creates an ipinfo.io provider. A token is optional and
+// read from IPINFO_TOKEN unless given with WithToken; without one ipinfo.io
+// applies its anonymous rate limit.
+func NewIPInfoProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPInfoProvider, error) {
+	config, err := newHTTPConfig(opts, "IPINFO_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	return &IPInfoProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://ipinfo.io"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPInfoProvider) Name() string {
+	return "ipinfo.io"
+}
+
+// ipinfoResponse is the body of an ipinfo.io lookup. Errors come back as
+// {"error": {"title": ..., "message": ...}} and private or reserved
+// addresses as {"ip": ..., "bogon": true}.
+type ipinfoResponse struct {
+	IP       string `json:"ip"`
+	City     string `json:"city"`
+	Region   string `json:"region"`
+	Country  string `json:"country"` // ISO 3166-1 alpha-2
+	Postal   string `json:"postal"`
+	Timezone string `json:"timezone"`
+	Org      string `json:"org"` // "AS15169 Google LLC"
+	Loc      string `json:"loc"` // "lat,lng"
+	Bogon    bool   `json:"bogon"`
+	Error    *struct {
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *IPInfoProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	// The token goes in a header so it never shows up in a URL in an error
+	var header http.Header
+	if p.config.token != "" {
+		header = http.Header{"Authorization": {"Bearer " + p.config.token}}
+	}
+
+	var result ipinfoResponse
+	endpoint := fmt.Sprintf("%s/%s/json", p.baseURL, url.PathEscape(ip))
+	_, err := p.config.getJSON(ctx, p.Name(), endpoint, header, &result)
+
+	var status *StatusError
+	if errors.As(err, &status) && status.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %w", ErrProviderInvalidIP, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case result.Error != nil:
+		return nil, fmt.Errorf("%s: %s: %s", p.Name(), result.Error.Title, result.Error.Message)
+	case result.Bogon:
+		return nil, fmt.Errorf("%w: %s: %s is a bogon address", ErrProviderInvalidIP, p.Name(), ip)
+	}
+
+	location := &Location{
+		IP:          result.IP,
+		CountryCode: result.Country,
+		City:        result.City,
+		Region:      result.Region,
+		PostalCode:  result.Postal,
+		Timezone:    result.Timezone,
+	}
+	location.setCoordinates(parseLatLon(result.Loc))
+	location.ASN, location.Org = splitASN(result.Org)
+	return location, nil
+}
+
+func (p *IPInfoProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
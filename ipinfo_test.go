@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cannedServer answers every request with the same response and remembers
+// the last request
+type cannedServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	last  *http.Request
+}
+
+func newCannedServer(t *testing.T, status int, header map[string]string, body string) *cannedServer {
+	t.Helper()
+	s := &cannedServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.last = r
+		s.mutex.Unlock()
+		for name, value := range header {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// request returns the last request the server received
+func (s *cannedServer) request() *http.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last
+}
+
+func TestIPInfoProvider(t *testing.T) {
+	const success = `{"ip": "8.8.8.8", "hostname": "dns.google", "city": "Mountain View", "region": "California",
+		"country": "US", "loc": "37.4056,-122.0775", "org": "AS15169 Google LLC", "postal": "94043",
+		"timezone": "America/Los_Angeles"}`
+
+	s := newCannedServer(t, http.StatusOK, nil, success)
+	p, err := NewIPInfoProvider(1000, WithBaseURL(s.URL), WithToken("secret-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", CountryCode: "US", City: "Mountain View", Region: "California", PostalCode: "94043",
+		Timezone: "America/Los_Angeles", ASN: "AS15169", Org: "Google LLC",
+		Latitude: 37.4056, Longitude: -122.0775, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	r := s.request()
+	if r.URL.Path != "/8.8.8.8/json" {
+		t.Errorf("requested %s, want /8.8.8.8/json", r.URL.Path)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "Bearer secret-token" {
+		t.Errorf("Authorization %q, want the bearer token", auth)
+	}
+	if r.URL.RawQuery != "" {
+		t.Errorf("token leaked into the query %q", r.URL.RawQuery)
+	}
+}
+
+func TestIPInfoProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"bogon", http.StatusOK, `{"ip": "10.0.0.1", "bogon": true}`, ErrProviderInvalidIP},
+		{"wrong ip", http.StatusNotFound, `{"status": 404, "error": {"title": "Wrong ip", "message": "Please provide a valid IP address"}}`, ErrProviderInvalidIP},
+		{"rate limited", http.StatusTooManyRequests, `{"status": 429, "error": {"title": "Rate limit exceeded"}}`, ErrProviderRateLimited},
+		{"bad token", http.StatusForbidden, `{"status": 403, "error": {"title": "Unknown token"}}`, ErrProviderAuth},
+		{"unauthorized", http.StatusUnauthorized, `{}`, ErrProviderAuth},
+		{"server error", http.StatusBadGateway, `bad gateway`, ErrProviderUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, tt.status, nil, tt.body)
+			p, err := NewIPInfoProvider(1000, WithBaseURL(s.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.GetLocation(context.Background(), "10.0.0.1"); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// An error payload in a 200 response still fails the lookup
+	s := newCannedServer(t, http.StatusOK, nil, `{"error": {"title": "Something", "message": "went wrong"}}`)
+	p, err := NewIPInfoProvider(1000, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc, err := p.GetLocation(context.Background(), "8.8.8.8"); err == nil {
+		t.Errorf("got %+v for an error payload", loc)
+	}
+}
+
+func TestIPInfoProviderContext(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer s.Close()
+	p, err := NewIPInfoProvider(1000, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %v after its context expired", elapsed)
+	}
+}
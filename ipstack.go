@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// IPStackProvider implements the Provider interface for ipstack.com
+type IPStackProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPStackProvider creates an ipstack.com provider. ipstack.com requires
+// an access key, given with WithToken or read from IPSTACK_KEY; without one
+// it returns ErrMissingCredentials.
+func NewIPStackProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPStackProvider, error) {
+	config, err := newHTTPConfig(opts, "IPSTACK_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.requireToken("ipstack.com", "IPSTACK_KEY"); err != nil {
+		return nil, err
+	}
+	return &IPStackProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("http://api.ipstack.com"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPStackProvider) Name() string {
+	return "ipstack.com"
+}
+
+// ipstackResponse is the body of an ipstack.com lookup. Errors are reported
+// with a 200 status, "success": false and an error object.
+type ipstackResponse struct {
+	Success     *bool  `json:"success"`
+	IP          string `json:"ip"`
+	Continent   string `json:"continent_code"`
+	CountryCode string `json:"country_code"`
+	CountryName string `json:"country_name"`
+	Region      string `json:"region_name"`
+	City        string `json:"city"`
+	Zip         string `json:"zip"`
+	// TimeZone is only included on paid plans
+	TimeZone *struct {
+		ID string `json:"id"`
+	} `json:"time_zone"`
+	// Connection is only included on paid plans
+	Connection *struct {
+		ASN json.Number `json:"asn"`
+		ISP string      `json:"isp"`
+	} `json:"connection"`
+	// Latitude and Longitude are null for addresses ipstack can't place
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Error     *struct {
+		Code int    `json:"code"`
+		Type string `json:"type"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// ipstack.com error codes
+const (
+	ipstackMissingKey      = 101
+	ipstackInactiveUser    = 102
+	ipstackMonthlyLimit    = 104
+	ipstackRestricted      = 105
+	ipstackInvalidIP       = 106
+	ipstackTooManyRequests = 429
+)
+
+func (p *IPStackProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	query := url.Values{"access_key": {p.config.token}}
+	endpoint := fmt.Sprintf("%s/%s?%s", p.baseURL, url.PathEscape(ip), query.Encode())
+
+	var result ipstackResponse
+	if _, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil || (result.Success != nil && !*result.Success) {
+		return nil, p.config.redact(ipstackError(p.Name(), result))
+	}
+
+	location := &Location{
+		IP:            result.IP,
+		Country:       result.CountryName,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.Continent,
+		City:          result.City,
+		Region:        result.Region,
+		PostalCode:    result.Zip,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	if result.TimeZone != nil {
+		location.Timezone = result.TimeZone.ID
+	}
+	if result.Connection != nil {
+		location.ASN, location.ISP = result.Connection.ASN.String(), result.Connection.ISP
+	}
+	return location, nil
+}
+
+// ipstackError maps an ipstack.com error envelope to a typed error
+func ipstackError(name string, result ipstackResponse) error {
+	if result.Error == nil {
+		return fmt.Errorf("%s: lookup failed", name)
+	}
+
+	e := result.Error
+	message := fmt.Sprintf("error %d (%s): %s", e.Code, e.Type, e.Info)
+	detail := name + ": " + message
+	switch e.Code {
+	case ipstackMissingKey, ipstackInactiveUser, ipstackRestricted:
+		return fmt.Errorf("%w: %s", ErrProviderAuth, detail)
+	case ipstackMonthlyLimit:
+		// The quota resets with the plan's billing month, which the error
+		// doesn't give; assume calendar months
+		now := time.Now().UTC()
+		limited := rateLimited(name, message, nil)
+		limited.Err = fmt.Errorf("%w: %w", ErrQuotaExhausted, limited.Err)
+		limited.RetryAfter = resetDate(now.Year(), now.Month()+1, 1).Sub(now)
+		return limited
+	case ipstackTooManyRequests:
+		return rateLimited(name, message, nil)
+	case ipstackInvalidIP:
+		return fmt.Errorf("%w: %s", ErrProviderInvalidIP, detail)
+	default:
+		return errors.New(detail)
+	}
+}
+
+func (p *IPStackProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
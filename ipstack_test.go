@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIPStackProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Location
+	}{
+		{
+			"free plan",
+			`{"ip": "8.8.8.8", "type": "ipv4", "continent_code": "NA", "country_code": "US",
+				"country_name": "United States", "region_name": "California", "city": "Mountain View",
+				"zip": "94043", "latitude": 37.42, "longitude": -122.08}`,
+			Location{IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA",
+				City: "Mountain View", Region: "California", PostalCode: "94043",
+				Latitude: 37.42, Longitude: -122.08, HasCoordinates: true},
+		},
+		{
+			"paid plan",
+			`{"ip": "8.8.8.8", "continent_code": "NA", "country_code": "US", "country_name": "United States",
+				"region_name": "California", "city": "Mountain View", "zip": "94043",
+				"latitude": 37.42, "longitude": -122.08, "time_zone": {"id": "America/Los_Angeles"},
+				"connection": {"asn": 15169, "isp": "Google LLC"}}`,
+			Location{IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA",
+				City: "Mountain View", Region: "California", PostalCode: "94043", Timezone: "America/Los_Angeles",
+				ASN: "15169", ISP: "Google LLC", Latitude: 37.42, Longitude: -122.08, HasCoordinates: true},
+		},
+		{
+			"unplaced",
+			`{"ip": "8.8.8.8", "country_code": null, "latitude": null, "longitude": null}`,
+			Location{IP: "8.8.8.8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewIPStackProvider(100, WithBaseURL(s.URL), WithToken("stack-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			if r := s.request(); r.URL.Path != "/8.8.8.8" || r.URL.Query().Get("access_key") != "stack-key" {
+				t.Errorf("requested %s, want /8.8.8.8 with the access key", r.URL.Path)
+			}
+		})
+	}
+}
+
+func TestIPStackProviderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []error // empty for any error
+	}{
+		{"invalid key", `{"success": false, "error": {"code": 101, "type": "invalid_access_key", "info": "You have not supplied a valid API Access Key."}}`, []error{ErrProviderAuth}},
+		{"inactive user", `{"success": false, "error": {"code": 102, "type": "inactive_user"}}`, []error{ErrProviderAuth}},
+		{"monthly limit", `{"success": false, "error": {"code": 104, "type": "usage_limit_reached"}}`, []error{ErrProviderRateLimited, ErrQuotaExhausted}},
+		{"too many requests", `{"success": false, "error": {"code": 429, "type": "too_many_requests"}}`, []error{ErrProviderRateLimited}},
+		{"invalid address", `{"success": false, "error": {"code": 106, "type": "invalid_ip_address"}}`, []error{ErrProviderInvalidIP}},
+		{"unknown code", `{"success": false, "error": {"code": 999, "type": "surprise"}}`, nil},
+		{"no envelope", `{"success": false}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewIPStackProvider(100, WithBaseURL(s.URL), WithToken("stack-key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "8.8.8.8")
+			if err == nil {
+				t.Fatalf("got %+v, want an error", loc)
+			}
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("got %v, want %v", err, want)
+				}
+			}
+			if strings.Contains(err.Error(), "stack-key") {
+				t.Errorf("error %q contains the access key", err)
+			}
+		})
+	}
+}
+
+func TestIPStackProviderMonthlyLimitRetry(t *testing.T) {
+	s := newCannedServer(t, http.StatusOK, nil, `{"success": false, "error": {"code": 104}}`)
+	p, err := NewIPStackProvider(100, WithBaseURL(s.URL), WithToken("stack-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetLocation(context.Background(), "8.8.8.8")
+	var limited *ErrRateLimited
+	if !errors.As(err, &limited) || limited.RetryAfter <= 0 {
+		t.Errorf("got %v, want a rate limit lasting until next month", err)
+	}
+}
+
+func TestIPStackProviderMissingKey(t *testing.T) {
+	t.Setenv("IPSTACK_KEY", "")
+	if _, err := NewIPStackProvider(100); !errors.Is(err, ErrMissingCredentials) {
+		t.Errorf("got %v, want ErrMissingCredentials", err)
+	}
+
+	t.Setenv("IPSTACK_KEY", "env-key")
+	if _, err := NewIPStackProvider(100); err != nil {
+		t.Errorf("key from the environment: %v", err)
+	}
+}
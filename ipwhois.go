@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// IPWhoisProvider implements the Provider interface for ipwhois.app
+type IPWhoisProvider struct {
+	maxRequestsPerMinute int
+	baseURL              string
+	config               httpConfig
+}
+
+// NewIPWhoisProvider creates an ipwhois.app provider. It needs no key for
+// low volumes, which makes it a good fallback.
+func NewIPWhoisProvider(maxRequestsPerMinute int, opts ...ProviderOption) (*IPWhoisProvider, error) {
+	config, err := newHTTPConfig(opts, "")
+	if err != nil {
+		return nil, err
+	}
+	return &IPWhoisProvider{
+		maxRequestsPerMinute: maxRequestsPerMinute,
+		baseURL:              config.baseURLOr("https://ipwhois.app"),
+		config:               config,
+	}, nil
+}
+
+func (p *IPWhoisProvider) Name() string {
+	return "ipwhois.app"
+}
+
+// ipwhoisResponse is the body of an ipwhois.app lookup. Errors are reported
+// with a 200 status, "success": false and a message.
+type ipwhoisResponse struct {
+	IP            string   `json:"ip"`
+	Success       *bool    `json:"success"`
+	Message       string   `json:"message"`
+	Country       string   `json:"country"`
+	CountryCode   string   `json:"country_code"` // ISO 3166-1 alpha-2
+	ContinentCode string   `json:"continent_code"`
+	Region        string   `json:"region"`
+	City          string   `json:"city"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	Timezone      string   `json:"timezone"`
+	ASN           string   `json:"asn"` // "AS15169"
+	Org           string   `json:"org"`
+	ISP           string   `json:"isp"`
+}
+
+func (p *IPWhoisProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	endpoint := fmt.Sprintf("%s/json/%s", p.baseURL, url.PathEscape(ip))
+
+	var result ipwhoisResponse
+	if _, err := p.config.getJSON(ctx, p.Name(), endpoint, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Success != nil && !*result.Success {
+		return nil, ipwhoisError(p.Name(), result.Message)
+	}
+
+	location := &Location{
+		IP:            result.IP,
+		Country:       result.Country,
+		CountryCode:   result.CountryCode,
+		ContinentCode: result.ContinentCode,
+		City:          result.City,
+		Region:        result.Region,
+		Timezone:      result.Timezone,
+		ASN:           result.ASN,
+		ISP:           result.ISP,
+		Org:           result.Org,
+	}
+	location.setCoordinates(result.Latitude, result.Longitude)
+	return location, nil
+}
+
+// ipwhoisError classifies the message of an ipwhois.app failure envelope
+func ipwhoisError(name, message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "reserved range") || strings.Contains(lower, "private range") || strings.Contains(lower, "invalid ip"):
+		return fmt.Errorf("%w: %s: %s", ErrProviderInvalidIP, name, message)
+	case strings.Contains(lower, "limit"):
+		return rateLimited(name, message, nil)
+	default:
+		return fmt.Errorf("%s: lookup failed: %s", name, message)
+	}
+}
+
+func (p *IPWhoisProvider) GetMaxRequestsPerMinute() int {
+	return p.maxRequestsPerMinute
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestIPWhoisProvider(t *testing.T) {
+	const success = `{"ip": "8.8.8.8", "success": true, "type": "IPv4", "continent": "North America",
+		"continent_code": "NA", "country": "United States", "country_code": "US", "region": "California",
+		"city": "Mountain View", "latitude": 37.3860517, "longitude": -122.0838511, "asn": "AS15169",
+		"org": "Google LLC", "isp": "Google LLC", "timezone": "America/Los_Angeles"}`
+
+	s := newCannedServer(t, http.StatusOK, nil, success)
+	p, err := NewIPWhoisProvider(100, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP: "8.8.8.8", Country: "United States", CountryCode: "US", ContinentCode: "NA", City: "Mountain View",
+		Region: "California", Timezone: "America/Los_Angeles", ASN: "AS15169", ISP: "Google LLC", Org: "Google LLC",
+		Latitude: 37.3860517, Longitude: -122.0838511, HasCoordinates: true,
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+	if path := s.request().URL.Path; path != "/json/8.8.8.8" {
+		t.Errorf("requested %s, want /json/8.8.8.8", path)
+	}
+}
+
+func TestIPWhoisProviderFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error // nil for any error
+	}{
+		{"reserved range", `{"ip": "240.0.0.1", "success": false, "message": "reserved range"}`, ErrProviderInvalidIP},
+		{"private range", `{"ip": "10.0.0.1", "success": false, "message": "private range"}`, ErrProviderInvalidIP},
+		{"invalid address", `{"success": false, "message": "invalid IP address"}`, ErrProviderInvalidIP},
+		{"rate limited", `{"success": false, "message": "you've hit the monthly limit"}`, ErrProviderRateLimited},
+		{"other", `{"success": false, "message": "something went wrong"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCannedServer(t, http.StatusOK, nil, tt.body)
+			p, err := NewIPWhoisProvider(100, WithBaseURL(s.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := p.GetLocation(context.Background(), "10.0.0.1")
+			if err == nil {
+				t.Fatalf("got %+v for a failure envelope", loc)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// KeyUsage describes one API key of a KeyPoolProvider
+type KeyUsage struct {
+	// Key identifies the key without revealing it
+	Key string
+	// Requests counts the lookups sent with the key
+	Requests int
+	// LimitedUntil is when a key the service rate limited is used again; it
+	// is zero when the key is not limited
+	LimitedUntil time.Time
+	// Revoked is set once the service rejected the key
+	Revoked bool
+}
+
+// KeyUsageReporter can be implemented by a provider that spreads its
+// lookups over several API keys. The broker includes the usage in its
+// stats.
+type KeyUsageReporter interface {
+	KeyUsage() []KeyUsage
+}
+
+// KeyPoolProvider spreads lookups over several accounts of one service,
+// each with its own API key, to add up their quotas. Keys are used in turn,
+// skipping any the service rate limited until it is ready again. A key the
+// service rejects is dropped from the pool.
+type KeyPoolProvider struct {
+	keys      []*poolKey
+	onRevoke  func(provider, key string, err error)
+	mutex     sync.Mutex
+	next      int
+	rateLimit int
+}
+
+// poolKey is one key of a KeyPoolProvider and the provider using it
+type poolKey struct {
+	id           string
+	provider     Provider
+	requests     int
+	limitedUntil time.Time
+	revoked      bool
+}
+
+// KeyPoolOption configures a KeyPoolProvider
+type KeyPoolOption func(*KeyPoolProvider)
+
+// OnKeyRevoked calls fn when a key is dropped from the pool after the
+// service rejected it. key identifies it as in KeyUsage. By default the
+// event is logged.
+func OnKeyRevoked(fn func(provider, key string, err error)) KeyPoolOption {
+	return func(p *KeyPoolProvider) {
+		p.onRevoke = fn
+	}
+}
+
+// NewKeyPoolProvider creates a provider for each of tokens with build and
+// rotates lookups over them. The pool takes its name from the providers and
+// its rate limit is the sum of theirs.
+func NewKeyPoolProvider(tokens []string, build func(token string) (Provider, error), opts ...KeyPoolOption) (*KeyPoolProvider, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: key pool needs at least one key", ErrMissingCredentials)
+	}
+	p := &KeyPoolProvider{
+		onRevoke: func(provider, key string, err error) {
+			log.Printf("%s: dropping key %s: %v", provider, key, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	for i, token := range tokens {
+		provider, err := build(token)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		if len(p.keys) > 0 && provider.Name() != p.keys[0].provider.Name() {
+			return nil, fmt.Errorf("key %d: provider %q differs from %q", i+1, provider.Name(), p.keys[0].provider.Name())
+		}
+		p.keys = append(p.keys, &poolKey{id: keyID(i, token), provider: provider})
+		if limit := provider.GetMaxRequestsPerMinute(); limit > 0 && p.rateLimit >= 0 {
+			p.rateLimit += limit
+		} else {
+			p.rateLimit = -1 // one unlimited key makes the pool unlimited
+		}
+	}
+	return p, nil
+}
+
+// keyID names the key at index i by position and its last characters
+func keyID(i int, token string) string {
+	if len(token) <= 8 {
+		return fmt.Sprintf("#%d", i+1)
+	}
+	return fmt.Sprintf("#%d (...%s)", i+1, token[len(token)-4:])
+}
+
+func (p *KeyPoolProvider) Name() string {
+	return p.keys[0].provider.Name()
+}
+
+// GetLocation looks ip up with the next usable key. If the service rate
+// limits or rejects that key, the lookup moves on to the next one, so the
+// broker only sees those errors once no key is left.
+func (p *KeyPoolProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	for {
+		key, err := p.take(time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		location, err := key.provider.GetLocation(ctx, ip)
+
+		var limited *ErrRateLimited
+		switch {
+		case ctx.Err() != nil:
+			return location, err
+		case errors.As(err, &limited):
+			p.mutex.Lock()
+			key.limitedUntil = limitedUntil(limited.RetryAfter, time.Now())
+			p.mutex.Unlock()
+		case errors.Is(err, ErrProviderAuth):
+			p.revoke(key, err)
+		default:
+			return location, err
+		}
+	}
+}
+
+// revoke drops key from the rotation after the service rejected it with err
+func (p *KeyPoolProvider) revoke(key *poolKey, err error) {
+	p.mutex.Lock()
+	revoked := !key.revoked
+	key.revoked = true
+	p.mutex.Unlock()
+	if revoked {
+		p.onRevoke(p.Name(), key.id, err)
+	}
+}
+
+// take picks the next usable key in turn and counts a request against it.
+// With no usable key it returns an error the broker understands: a rate
+// limit lasting until the first key is ready again, or, once every key has
+// been revoked, an auth error.
+func (p *KeyPoolProvider) take(now time.Time) (*poolKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var soonest time.Time
+	for i := range p.keys {
+		key := p.keys[(p.next+i)%len(p.keys)]
+		if key.revoked {
+			continue
+		}
+		if now.Before(key.limitedUntil) {
+			if soonest.IsZero() || key.limitedUntil.Before(soonest) {
+				soonest = key.limitedUntil
+			}
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.keys)
+		key.requests++
+		return key, nil
+	}
+
+	if soonest.IsZero() {
+		return nil, fmt.Errorf("%w: %s: every key in the pool was rejected", ErrProviderAuth, p.Name())
+	}
+	return nil, &ErrRateLimited{
+		Provider:   p.Name(),
+		RetryAfter: soonest.Sub(now),
+		Err:        fmt.Errorf("%w: %s: every key in the pool is rate limited", ErrProviderRateLimited, p.Name()),
+	}
+}
+
+// limitedUntil returns when a key rate limited at now may be used again:
+// after retryAfter, or at the start of the next minute when the service
+// didn't say
+func limitedUntil(retryAfter time.Duration, now time.Time) time.Time {
+	if retryAfter > 0 {
+		return now.Add(retryAfter)
+	}
+	return now.Truncate(time.Minute).Add(time.Minute)
+}
+
+// GetMaxRequestsPerMinute returns the sum of the keys' rate limits, or 0 if
+// any key is unlimited
+func (p *KeyPoolProvider) GetMaxRequestsPerMinute() int {
+	return max(p.rateLimit, 0)
+}
+
+// KeyUsage returns the usage of every key in the pool. It implements
+// KeyUsageReporter.
+func (p *KeyPoolProvider) KeyUsage() []KeyUsage {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	usage := make([]KeyUsage, len(p.keys))
+	for i, key := range p.keys {
+		usage[i] = KeyUsage{Key: key.id, Requests: key.requests, Revoked: key.revoked}
+		if now.Before(key.limitedUntil) {
+			usage[i].LimitedUntil = key.limitedUntil
+		}
+	}
+	return usage
+}
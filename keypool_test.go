@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockKeys builds a key pool over mocks of one service, one per token,
+// scripted by opts[token]
+func mockKeys(t *testing.T, tokens []string, opts map[string][]MockOption, poolOpts ...KeyPoolOption) (*KeyPoolProvider, map[string]*MockProvider) {
+	t.Helper()
+	mocks := make(map[string]*MockProvider)
+	p, err := NewKeyPoolProvider(tokens, func(token string) (Provider, error) {
+		mocks[token] = NewMockProvider("ipstack", 100, opts[token]...)
+		return mocks[token], nil
+	}, poolOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, mocks
+}
+
+func TestKeyPoolRotation(t *testing.T) {
+	tokens := []string{"account-one-key", "account-two-key", "account-three-key"}
+	p, mocks := mockKeys(t, tokens, nil)
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	for i := range 30 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, token := range tokens {
+		if n := mocks[token].Calls(); n != 10 {
+			t.Errorf("%s used for %d of 30 lookups, want 10", token, n)
+		}
+	}
+	if rpm := p.GetMaxRequestsPerMinute(); rpm != 300 {
+		t.Errorf("rate limit %d, want the three keys' 300", rpm)
+	}
+
+	// The stats show each key's share without the key itself
+	snap, err := b.Snapshot("ipstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Keys) != 3 {
+		t.Fatalf("%d keys in the stats, want 3", len(snap.Keys))
+	}
+	for i, usage := range snap.Keys {
+		if usage.Requests != 10 || usage.Revoked || !usage.LimitedUntil.IsZero() {
+			t.Errorf("key %d: %+v, want 10 requests", i+1, usage)
+		}
+		if strings.Contains(usage.Key, tokens[i]) {
+			t.Errorf("key %d identified as %q, which reveals it", i+1, usage.Key)
+		}
+	}
+}
+
+func TestKeyPoolRevokesRejectedKey(t *testing.T) {
+	revoked := fmt.Errorf("%w: ipstack: invalid_access_key", ErrProviderAuth)
+	var events []string
+	p, mocks := mockKeys(t, []string{"good-key-1111", "revoked-key-2222", "good-key-3333"},
+		map[string][]MockOption{"revoked-key-2222": {MockFailCalls(1, 1000, revoked)}},
+		OnKeyRevoked(func(provider, key string, err error) {
+			events = append(events, fmt.Sprintf("%s %s %v", provider, key, errors.Is(err, ErrProviderAuth)))
+		}))
+
+	for i := range 20 {
+		if _, err := p.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if n := mocks["revoked-key-2222"].Calls(); n != 1 {
+		t.Errorf("rejected key used %d times, want once", n)
+	}
+	if a, c := mocks["good-key-1111"].Calls(), mocks["good-key-3333"].Calls(); a != 10 || c != 10 {
+		t.Errorf("remaining keys served %d and %d lookups, want 10 each", a, c)
+	}
+	if len(events) != 1 || events[0] != "ipstack #2 (...2222) true" {
+		t.Errorf("revocation events %q, want one for key #2", events)
+	}
+	if usage := p.KeyUsage(); !usage[1].Revoked || usage[0].Revoked || usage[2].Revoked {
+		t.Errorf("usage %+v, want only key #2 revoked", usage)
+	}
+}
+
+func TestKeyPoolSkipsRateLimitedKey(t *testing.T) {
+	limited := &ErrRateLimited{Provider: "ipstack", RetryAfter: time.Minute, Err: ErrProviderRateLimited}
+	p, mocks := mockKeys(t, []string{"key-a", "key-b"}, map[string][]MockOption{"key-a": {MockFailCalls(1, 1, limited)}})
+
+	for i := range 5 {
+		if _, err := p.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if a, b := mocks["key-a"].Calls(), mocks["key-b"].Calls(); a != 1 || b != 5 {
+		t.Errorf("keys used %d and %d times, want the limited key once and the other for every lookup", a, b)
+	}
+	if until := time.Until(p.KeyUsage()[0].LimitedUntil); until < 55*time.Second || until > time.Minute {
+		t.Errorf("limited key back in %v, want about a minute", until)
+	}
+}
+
+func TestKeyPoolExhausted(t *testing.T) {
+	t.Run("rate limited", func(t *testing.T) {
+		fail := func(retryAfter time.Duration) []MockOption {
+			return []MockOption{MockFailCalls(1, 1, &ErrRateLimited{Provider: "ipstack", RetryAfter: retryAfter, Err: ErrProviderRateLimited})}
+		}
+		p, _ := mockKeys(t, []string{"key-a", "key-b"}, map[string][]MockOption{"key-a": fail(time.Minute), "key-b": fail(10 * time.Second)})
+		_, err := p.GetLocation(context.Background(), testIP(0))
+		var limited *ErrRateLimited
+		if !errors.As(err, &limited) {
+			t.Fatalf("got %v, want an *ErrRateLimited", err)
+		}
+		// Until the first key is ready again
+		if limited.RetryAfter <= 5*time.Second || limited.RetryAfter > 10*time.Second {
+			t.Errorf("retry after %v, want the 10s until key-b is ready", limited.RetryAfter)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		reject := []MockOption{MockFailCalls(1, 1, ErrProviderAuth)}
+		p, _ := mockKeys(t, []string{"key-a", "key-b"}, map[string][]MockOption{"key-a": reject, "key-b": reject}, OnKeyRevoked(func(string, string, error) {}))
+		if _, err := p.GetLocation(context.Background(), testIP(0)); !errors.Is(err, ErrProviderAuth) {
+			t.Errorf("got %v, want ErrProviderAuth once every key is rejected", err)
+		}
+	})
+}
+
+func TestNewKeyPoolProviderInvalid(t *testing.T) {
+	if _, err := NewKeyPoolProvider(nil, nil); !errors.Is(err, ErrMissingCredentials) {
+		t.Errorf("no keys: got %v, want ErrMissingCredentials", err)
+	}
+
+	names := []string{"ipstack", "ipdata"}
+	_, err := NewKeyPoolProvider([]string{"key-a", "key-b"}, func(string) (Provider, error) {
+		name := names[0]
+		names = names[1:]
+		return NewMockProvider(name, 100), nil
+	})
+	if err == nil {
+		t.Error("pooled keys of two different services")
+	}
+
+	// One unlimited key makes the pool unlimited
+	limits := []int{100, 0}
+	p, err := NewKeyPoolProvider([]string{"key-a", "key-b"}, func(string) (Provider, error) {
+		limit := limits[0]
+		limits = limits[1:]
+		return NewMockProvider("ipstack", limit), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpm := p.GetMaxRequestsPerMinute(); rpm != 0 {
+		t.Errorf("rate limit %d, want unlimited", rpm)
+	}
+}
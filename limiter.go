@@ -0,0 +1,270 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter decides whether a provider may receive another request.
+// Times are passed in so limiters can be driven by simulated clocks.
+// Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Allow consumes capacity for one request at now and reports whether
+	// the request is permitted
+	Allow(now time.Time) bool
+	// Remaining returns how many more requests would be allowed at now
+	Remaining(now time.Time) int
+	// Limit returns the maximum number of requests the limiter can allow
+	// at once, used to express Remaining as a fraction
+	Limit() int
+	// NextAvailable returns the earliest time at or after now when a
+	// request will be allowed
+	NextAvailable(now time.Time) time.Time
+}
+
+// FixedWindowLimiter allows up to limit requests per calendar window,
+// resetting the count when a window ends
+type FixedWindowLimiter struct {
+	mutex       sync.Mutex
+	limit       int
+	window      time.Duration
+	count       int
+	windowStart time.Time
+}
+
+// NewFixedWindowLimiter allows limit requests per window
+func NewFixedWindowLimiter(limit int, window time.Duration) *FixedWindowLimiter {
+	return &FixedWindowLimiter{limit: limit, window: window}
+}
+
+// roll starts a new window if the current one has ended. The caller must
+// hold l.mutex.
+func (l *FixedWindowLimiter) roll(now time.Time) {
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.count = 0
+	}
+}
+
+func (l *FixedWindowLimiter) Allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.roll(now)
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+func (l *FixedWindowLimiter) Remaining(now time.Time) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.windowStart) >= l.window {
+		return l.limit
+	}
+	return max(l.limit-l.count, 0)
+}
+
+func (l *FixedWindowLimiter) Limit() int {
+	return l.limit
+}
+
+func (l *FixedWindowLimiter) NextAvailable(now time.Time) time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.windowStart) >= l.window || l.count < l.limit {
+		return now
+	}
+	return l.windowStart.Add(l.window)
+}
+
+// TokenBucketLimiter is a continuously refilling rate limiter. It holds up
+// to burst tokens, refills at a steady rate and every request takes one
+// token, which avoids the boundary bursts of a fixed window.
+type TokenBucketLimiter struct {
+	mutex    sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucketLimiter creates a full bucket allowing perMinute requests per
+// minute on average with bursts of up to burst requests. A burst of zero or
+// less defaults to perMinute.
+func NewTokenBucketLimiter(perMinute, burst int, now time.Time) *TokenBucketLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &TokenBucketLimiter{
+		rate:     float64(perMinute) / 60.0,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     now,
+	}
+}
+
+// tokensAt returns the number of tokens the bucket holds at now without
+// modifying it. The caller must hold l.mutex.
+func (l *TokenBucketLimiter) tokensAt(now time.Time) float64 {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed <= 0 {
+		return l.tokens
+	}
+	return math.Min(l.capacity, l.tokens+elapsed*l.rate)
+}
+
+func (l *TokenBucketLimiter) Allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.tokens = l.tokensAt(now)
+	if now.After(l.last) {
+		l.last = now
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (l *TokenBucketLimiter) Remaining(now time.Time) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.tokensAt(now))
+}
+
+func (l *TokenBucketLimiter) Limit() int {
+	return int(l.capacity)
+}
+
+func (l *TokenBucketLimiter) NextAvailable(now time.Time) time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tokens := l.tokensAt(now)
+	if tokens >= 1 || l.rate <= 0 {
+		return now
+	}
+	wait := (1 - tokens) / l.rate
+	return now.Add(time.Duration(wait * float64(time.Second)))
+}
+
+// SlidingWindowLimiter allows up to limit requests in any trailing window,
+// matching upstreams that enforce their limits that way
+type SlidingWindowLimiter struct {
+	mutex  sync.Mutex
+	limit  int
+	window time.Duration
+	times  []time.Time
+}
+
+// NewSlidingWindowLimiter allows limit requests in any trailing window
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		limit:  limit,
+		window: window,
+		times:  make([]time.Time, 0, max(limit, 0)),
+	}
+}
+
+// inWindow returns the index of the first request still inside the window
+// ending at now. The caller must hold l.mutex.
+func (l *SlidingWindowLimiter) inWindow(now time.Time) int {
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(l.times) && !l.times[i].After(cutoff) {
+		i++
+	}
+	return i
+}
+
+func (l *SlidingWindowLimiter) Allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.times = l.times[l.inWindow(now):]
+	if len(l.times) >= l.limit {
+		return false
+	}
+	l.times = append(l.times, now)
+	return true
+}
+
+func (l *SlidingWindowLimiter) Remaining(now time.Time) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return max(l.limit-(len(l.times)-l.inWindow(now)), 0)
+}
+
+func (l *SlidingWindowLimiter) Limit() int {
+	return l.limit
+}
+
+func (l *SlidingWindowLimiter) NextAvailable(now time.Time) time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	active := l.times[l.inWindow(now):]
+	if len(active) < l.limit || len(active) == 0 {
+		return now
+	}
+	// A slot frees up when the oldest request that keeps us at the limit
+	// leaves the window
+	return active[len(active)-l.limit].Add(l.window)
+}
+
+// UnlimitedLimiter allows every request. It is used for providers whose
+// GetMaxRequestsPerMinute is zero or negative.
+type UnlimitedLimiter struct{}
+
+func (UnlimitedLimiter) Allow(now time.Time) bool {
+	return true
+}
+
+func (UnlimitedLimiter) Remaining(now time.Time) int {
+	return math.MaxInt
+}
+
+// Limit returns 0 since there is no limit
+func (UnlimitedLimiter) Limit() int {
+	return 0
+}
+
+func (UnlimitedLimiter) NextAvailable(now time.Time) time.Time {
+	return now
+}
+
+// allowN consumes capacity for n requests at now, reporting whether all of
+// them were permitted
+func allowN(l RateLimiter, n int, now time.Time) bool {
+	for range n {
+		if !l.Allow(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// fractionLeft returns the unused share of the limiter's capacity. A limiter
+// without a limit that still allows requests counts as entirely unused.
+func fractionLeft(l RateLimiter, now time.Time) float64 {
+	if l.Limit() <= 0 {
+		if l.Remaining(now) > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(l.Remaining(now)) / float64(l.Limit())
+}
+
+// defaultLimiterFactory rate limits providers with a token bucket
+func defaultLimiterFactory(maxPerMinute, burst int) RateLimiter {
+	return NewTokenBucketLimiter(maxPerMinute, burst, time.Now())
+}
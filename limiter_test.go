@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// allowedBetween offers the limiter a request every step from start until
+// end and returns how many it allowed
+func allowedBetween(l RateLimiter, start, end time.Time, step time.Duration) int {
+	n := 0
+	for now := start; now.Before(end); now = now.Add(step) {
+		if l.Allow(now) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTokenBucketConverges(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, burst := range []int{1, 10, 60} {
+		l := NewTokenBucketLimiter(60, burst, start)
+		// Far more demand than the limit, for an hour. Apart from the
+		// initial burst the rate settles on the limit, give or take the
+		// refill lost between attempts.
+		got := allowedBetween(l, start, start.Add(time.Hour), 250*time.Millisecond)
+		if got < 60*60*99/100 || got > 60*60+burst {
+			t.Errorf("burst %d: allowed %d requests in an hour, want about %d", burst, got, 60*60)
+		}
+	}
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewTokenBucketLimiter(60, 5, now)
+
+	for range 5 {
+		if !l.Allow(now) {
+			t.Fatal("request within the burst turned away")
+		}
+	}
+	if l.Allow(now) {
+		t.Error("request beyond the burst allowed")
+	}
+	if next := l.NextAvailable(now); next != now.Add(time.Second) {
+		t.Errorf("next request at %v, want a second later", next.Sub(now))
+	}
+	if l.Remaining(now.Add(time.Hour)) != 5 || l.Limit() != 5 {
+		t.Errorf("refilled to %d of %d, want the burst of 5", l.Remaining(now.Add(time.Hour)), l.Limit())
+	}
+}
+
+// TestBoundaryBurst shows a fixed window letting through twice its limit
+// around a window boundary, which the token bucket does not
+func TestBoundaryBurst(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	boundary := start.Add(time.Minute)
+	tests := []struct {
+		name    string
+		limiter RateLimiter
+		max     int
+	}{
+		// What is left of the first window plus all of the next
+		{"fixed window", NewFixedWindowLimiter(60, time.Minute), 59 + 60},
+		// The burst plus the one token refilled in between
+		{"token bucket", NewTokenBucketLimiter(60, 5, start), 5 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.limiter.Allow(start)
+			// Idle until a second before the boundary, then flood
+			got := allowedBetween(tt.limiter, boundary.Add(-time.Second), boundary.Add(time.Second), time.Millisecond)
+			if got != tt.max {
+				t.Errorf("allowed %d requests in the two seconds around the boundary, want %d", got, tt.max)
+			}
+		})
+	}
+}
+
+func TestBrokerTokenBucket(t *testing.T) {
+	p := NewMockProvider("mock", 60)
+	b := NewBroker([]Provider{p}, WithBurst("mock", 3))
+	defer b.Close()
+
+	for i := range 3 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatalf("lookup %d within the burst: %v", i, err)
+		}
+	}
+	if _, err := b.GetLocation(context.Background(), testIP(3)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Errorf("got %v, want ErrAllProvidersRateLimited", err)
+	}
+	// A token refills every second
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := b.GetLocation(context.Background(), testIP(4)); err != nil {
+		t.Errorf("lookup after a refill: %v", err)
+	}
+}
+
+func TestUnlimitedProvider(t *testing.T) {
+	a, c := NewMockProvider("a", 2), NewMockProvider("c", 2)
+	db := NewMockProvider("db", 0)
+	b := NewBroker([]Provider{a, c, db}, WithProviderTier("db", 1))
+	defer b.Close()
+
+	// The limited providers serve until they run out, then everything goes
+	// to the unlimited one
+	for i := range 54 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if a.Calls() != 2 || c.Calls() != 2 || db.Calls() != 50 {
+		t.Errorf("a served %d, c %d, db %d; want 2, 2, 50", a.Calls(), c.Calls(), db.Calls())
+	}
+
+	snap, err := b.Snapshot("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.CapacityRemaining != 1 || !snap.Selectable {
+		t.Errorf("unlimited provider has %v capacity left, selectable %v; want 1, true", snap.CapacityRemaining, snap.Selectable)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// locationField is a line /location can print for a result
+type locationField struct {
+	name  string
+	label string
+	value func(loc *Location) string
+	// jsonKeys are the keys of the field in the JSON form of a Location,
+	// if other than name
+	jsonKeys []string
+	// always fields are printed even when empty; others are left out
+	always bool
+	// optIn fields are only printed when asked for with ?fields=, so
+	// callers who don't need them don't pay for them
+	optIn bool
+}
+
+// locationFields lists the fields /location prints, in order
+var locationFields = []locationField{
+	{name: "ip", label: "IP", value: func(loc *Location) string { return loc.IP }, always: true},
+	{name: "country", label: "Country", value: func(loc *Location) string { return loc.Country }, always: true, jsonKeys: []string{"country", "country_code"}},
+	{name: "continent", label: "Continent", value: func(loc *Location) string { return loc.Continent }, jsonKeys: []string{"continent", "continent_code"}},
+	{name: "city", label: "City", value: func(loc *Location) string { return loc.City }, always: true},
+	{name: "region", label: "Region", value: func(loc *Location) string { return loc.Region }},
+	{name: "postal_code", label: "Postal code", value: func(loc *Location) string { return loc.PostalCode }},
+	{name: "timezone", label: "Timezone", value: func(loc *Location) string { return loc.Timezone }},
+	{name: "coordinates", label: "Coordinates", value: func(loc *Location) string {
+		if !loc.HasCoordinates {
+			return ""
+		}
+		return fmt.Sprintf("%.4f,%.4f", loc.Latitude, loc.Longitude)
+	}, jsonKeys: []string{"latitude", "longitude"}},
+	{name: "asn", label: "ASN", value: func(loc *Location) string { return loc.ASN }, optIn: true},
+	{name: "isp", label: "ISP", value: func(loc *Location) string { return loc.ISP }, optIn: true},
+	{name: "org", label: "Organization", value: func(loc *Location) string { return loc.Org }, optIn: true},
+	{name: "reserved", label: "Reserved range", value: func(loc *Location) string { return loc.Reserved }},
+	{name: "confidence", label: "Confidence", value: func(loc *Location) string { return strconv.Itoa(loc.Confidence) }},
+	{name: "provider", label: "Provider", value: func(loc *Location) string { return loc.Provider }, always: true},
+	{name: "retrieved_at", label: "Retrieved at", value: func(loc *Location) string {
+		if loc.RetrievedAt.IsZero() {
+			return ""
+		}
+		return loc.RetrievedAt.UTC().Format(time.RFC3339)
+	}},
+	{name: "from_cache", label: "From cache", value: func(loc *Location) string { return strconv.FormatBool(loc.FromCache) }, always: true},
+}
+
+// selectFields returns the fields named in the comma-separated list, in
+// their usual order. An empty list selects every field that isn't opt-in.
+func selectFields(list string) ([]locationField, error) {
+	if strings.TrimSpace(list) == "" {
+		var fields []locationField
+		for _, field := range locationFields {
+			if !field.optIn {
+				fields = append(fields, field)
+			}
+		}
+		return fields, nil
+	}
+
+	wanted := make(map[string]bool)
+	for name := range strings.SplitSeq(list, ",") {
+		wanted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	var fields []locationField
+	for _, field := range locationFields {
+		if wanted[field.name] {
+			fields = append(fields, field)
+			delete(wanted, field.name)
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+	return fields, nil
+}
+
+// writeLocation prints the selected fields of loc, one per line
+func writeLocation(w io.Writer, loc *Location, fields []locationField) {
+	for _, field := range fields {
+		if value := field.value(loc); value != "" || field.always {
+			fmt.Fprintf(w, "%s: %s\n", field.label, value)
+		}
+	}
+}
+
+// writeLocationJSON writes the selected fields of loc as a JSON object in
+// the format of Location.MarshalJSON
+func writeLocationJSON(w io.Writer, loc *Location, fields []locationField) error {
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	selected := make(map[string]json.RawMessage)
+	for _, field := range fields {
+		keys := field.jsonKeys
+		if keys == nil {
+			keys = []string{field.name}
+		}
+		for _, key := range keys {
+			if value, ok := all[key]; ok {
+				selected[key] = value
+			}
+		}
+	}
+	return json.NewEncoder(w).Encode(selected)
+}
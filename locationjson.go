@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// locationJSON is the wire format of a Location, used by the caches,
+// snapshots and seed files. Fields are only ever added to it, so entries
+// written by older versions still decode. Optional fields are left out when
+// empty; the coordinates are left out unless the location has them, so 0,0
+// still means 0,0.
+type locationJSON struct {
+	IP            string   `json:"ip"`
+	Country       string   `json:"country"`
+	CountryCode   string   `json:"country_code,omitempty"`
+	ContinentCode string   `json:"continent_code,omitempty"`
+	Continent     string   `json:"continent,omitempty"`
+	City          string   `json:"city,omitempty"`
+	Region        string   `json:"region,omitempty"`
+	PostalCode    string   `json:"postal_code,omitempty"`
+	Timezone      string   `json:"timezone,omitempty"`
+	Latitude      *float64 `json:"latitude,omitempty"`
+	Longitude     *float64 `json:"longitude,omitempty"`
+	ASN           string   `json:"asn,omitempty"`
+	ISP           string   `json:"isp,omitempty"`
+	Org           string   `json:"org,omitempty"`
+
+	Provider    string    `json:"provider,omitempty"`
+	LatencyMS   float64   `json:"latency_ms,omitempty"`
+	Reserved    string    `json:"reserved,omitempty"`
+	Disputed    bool      `json:"disputed,omitempty"`
+	Confidence  int       `json:"confidence,omitempty"`
+	RetrievedAt time.Time `json:"retrieved_at,omitzero"`
+	FromCache   bool      `json:"from_cache,omitempty"`
+	CachedAt    time.Time `json:"cached_at,omitzero"`
+	Stale       bool      `json:"stale,omitempty"`
+	CacheTTLS   float64   `json:"cache_ttl_s,omitempty"`
+
+	// Latency and CachedAt as written before Location had JSON tags, when
+	// the keys were the Go field names. The other fields of that time
+	// decode through the case-insensitive match of their new keys.
+	LegacyLatency  time.Duration `json:"Latency,omitempty"`
+	LegacyCachedAt time.Time     `json:"CachedAt,omitzero"`
+}
+
+// MarshalJSON encodes the location in its stable wire format
+func (l Location) MarshalJSON() ([]byte, error) {
+	out := locationJSON{
+		IP:            l.IP,
+		Country:       l.Country,
+		CountryCode:   l.CountryCode,
+		ContinentCode: l.ContinentCode,
+		Continent:     l.Continent,
+		City:          l.City,
+		Region:        l.Region,
+		PostalCode:    l.PostalCode,
+		Timezone:      l.Timezone,
+		ASN:           l.ASN,
+		ISP:           l.ISP,
+		Org:           l.Org,
+		Provider:      l.Provider,
+		LatencyMS:     float64(l.Latency) / float64(time.Millisecond),
+		Reserved:      l.Reserved,
+		Disputed:      l.Disputed,
+		Confidence:    l.Confidence,
+		RetrievedAt:   l.RetrievedAt,
+		FromCache:     l.FromCache,
+		CachedAt:      l.CachedAt,
+		Stale:         l.Stale,
+		CacheTTLS:     l.ttl.Seconds(),
+	}
+	if l.HasCoordinates {
+		out.Latitude, out.Longitude = &l.Latitude, &l.Longitude
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a location written by MarshalJSON or by a version
+// without JSON tags
+func (l *Location) UnmarshalJSON(data []byte) error {
+	var in locationJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*l = Location{
+		IP:            in.IP,
+		Country:       in.Country,
+		CountryCode:   in.CountryCode,
+		ContinentCode: in.ContinentCode,
+		Continent:     in.Continent,
+		City:          in.City,
+		Region:        in.Region,
+		PostalCode:    in.PostalCode,
+		Timezone:      in.Timezone,
+		ASN:           in.ASN,
+		ISP:           in.ISP,
+		Org:           in.Org,
+		Provider:      in.Provider,
+		Latency:       time.Duration(in.LatencyMS * float64(time.Millisecond)),
+		Reserved:      in.Reserved,
+		Disputed:      in.Disputed,
+		Confidence:    in.Confidence,
+		RetrievedAt:   in.RetrievedAt,
+		FromCache:     in.FromCache,
+		CachedAt:      in.CachedAt,
+		Stale:         in.Stale,
+		ttl:           time.Duration(in.CacheTTLS * float64(time.Second)),
+	}
+	l.setCoordinates(in.Latitude, in.Longitude)
+	if l.Latency == 0 {
+		l.Latency = in.LegacyLatency
+	}
+	if l.CachedAt.IsZero() {
+		l.CachedAt = in.LegacyCachedAt
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fullLocation has every field set, so the golden file shows the whole
+// wire format
+func fullLocation() Location {
+	return Location{
+		IP:             "2001:4860:4860::8888",
+		Country:        "United States",
+		CountryCode:    "US",
+		ContinentCode:  "NA",
+		Continent:      "North America",
+		City:           "Mountain View",
+		Region:         "California",
+		PostalCode:     "94043",
+		Timezone:       "America/Los_Angeles",
+		ASN:            "AS15169",
+		ISP:            "Google LLC",
+		Org:            "Google Public DNS",
+		Latitude:       37.4056,
+		Longitude:      -122.0775,
+		HasCoordinates: true,
+		Provider:       "ipinfo.io",
+		Latency:        42500 * time.Microsecond,
+		Reserved:       "documentation",
+		Disputed:       true,
+		Confidence:     85,
+		RetrievedAt:    time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		FromCache:      true,
+		CachedAt:       time.Date(2024, 5, 1, 10, 0, 1, 500_000_000, time.UTC),
+		Stale:          true,
+		ttl:            90 * time.Minute,
+	}
+}
+
+func TestLocationJSONGolden(t *testing.T) {
+	// A field added to Location must be added to fullLocation, and so to
+	// the golden file, or its wire format goes unchecked
+	full := reflect.ValueOf(fullLocation())
+	for i := range full.NumField() {
+		if full.Field(i).IsZero() {
+			t.Errorf("fullLocation doesn't set %s", full.Type().Field(i).Name)
+		}
+	}
+
+	got, err := json.MarshalIndent(fullLocation(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", "location.golden.json")
+	if *updateFixtures {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("wire format changed; if that's intended run go test -run TestLocationJSONGolden -update\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLocationJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		loc  Location
+		json string
+	}{
+		{
+			name: "minimal",
+			loc:  Location{IP: "8.8.8.8", Country: "United States"},
+			json: `{"ip":"8.8.8.8","country":"United States"}`,
+		},
+		{
+			// The origin is a position, not a missing one
+			name: "coordinates at 0,0",
+			loc:  Location{IP: "8.8.8.8", Country: "", HasCoordinates: true},
+			json: `{"ip":"8.8.8.8","country":"","latitude":0,"longitude":0}`,
+		},
+		{
+			name: "latency",
+			loc:  Location{IP: "1.1.1.1", Country: "Australia", Provider: "mock", Latency: 1500 * time.Microsecond},
+			json: `{"ip":"1.1.1.1","country":"Australia","provider":"mock","latency_ms":1.5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.json {
+				t.Errorf("got %s, want %s", got, tt.json)
+			}
+
+			var back Location
+			if err := json.Unmarshal(got, &back); err != nil {
+				t.Fatal(err)
+			}
+			if back != tt.loc {
+				t.Errorf("round trip gave %+v, want %+v", back, tt.loc)
+			}
+		})
+	}
+}
+
+func TestLocationJSONRoundTrip(t *testing.T) {
+	want := fullLocation()
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Location
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Through a pointer and inside other values, as the caches store it
+	entries := map[string]*Location{"a": &want}
+	data, err = json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back map[string]*Location
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back["a"] == nil || *back["a"] != want {
+		t.Errorf("got %+v, want %+v", back["a"], want)
+	}
+}
+
+func TestLocationJSONDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Location
+	}{
+		{
+			name: "without coordinates",
+			json: `{"ip":"8.8.8.8","country":"United States","latitude":null}`,
+			want: Location{IP: "8.8.8.8", Country: "United States"},
+		},
+		{
+			name: "latitude alone",
+			json: `{"ip":"8.8.8.8","country":"United States","latitude":37.4}`,
+			want: Location{IP: "8.8.8.8", Country: "United States"},
+		},
+		{
+			name: "unknown fields",
+			json: `{"ip":"8.8.8.8","country":"United States","added_later":{"x":1}}`,
+			want: Location{IP: "8.8.8.8", Country: "United States"},
+		},
+		{
+			// Written before Location had JSON tags
+			name: "legacy",
+			json: `{"IP":"5.5.5.5","Country":"Germany","City":"Berlin","Latitude":52.52,"Longitude":13.405,"Provider":"ipinfo.io","Latency":120000000,"CachedAt":"2024-05-01T10:00:00Z"}`,
+			want: Location{
+				IP:             "5.5.5.5",
+				Country:        "Germany",
+				City:           "Berlin",
+				Latitude:       52.52,
+				Longitude:      13.405,
+				HasCoordinates: true,
+				Provider:       "ipinfo.io",
+				Latency:        120 * time.Millisecond,
+				CachedAt:       time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Location
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var loc Location
+	if err := json.Unmarshal([]byte(`{"ip":1}`), &loc); err == nil {
+		t.Error("wrong type for ip: no error")
+	}
+}
@@ -2,26 +2,102 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Location represents the geographical location data
+// Location represents the geographical location data. Its JSON form, used
+// by the caches and the /location endpoint, is fixed by MarshalJSON.
 type Location struct {
-	IP      string
+	IP string
+	// Country is the country's name, in English when the country is
+	// known; otherwise as the provider gave it
 	Country string
-	City    string
+	// CountryCode is the ISO 3166-1 alpha-2 code, always two upper-case
+	// letters, or empty when the country couldn't be identified. Compare
+	// countries from different providers by it.
+	CountryCode string
+	// ContinentCode is one of AF, AN, AS, EU, NA, OC and SA, and Continent
+	// its English name
+	ContinentCode string
+	Continent     string
+	City          string
+	// Region is the state or province and PostalCode the postal or ZIP
+	// code; either is empty when the provider doesn't know it
+	Region     string
+	PostalCode string
+	// Timezone is the IANA time zone name, such as "Europe/Berlin"
+	Timezone string
+	// ASN is the autonomous system announcing the address, such as
+	// "AS15169", ISP the network operator and Org the organization the
+	// address is assigned to; each is empty when the provider doesn't say
+	ASN string
+	ISP string
+	Org string
+
+	// Latitude and Longitude are in decimal degrees and only meaningful when
+	// HasCoordinates is set, so a missing position isn't mistaken for 0,0
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+
+	// Provider is the name of the provider that produced the data and
+	// Latency how long its lookup took
+	Provider string
+	Latency  time.Duration
+
+	// Reserved names the range of an address no provider can locate, such
+	// as "private" or "loopback", on the result of a broker configured with
+	// ReservedIPLocation. Such a result has no geographic data.
+	Reserved string
+
+	// Disputed is set in consensus mode when the queried providers did not
+	// all agree on the country
+	Disputed bool
+	// Confidence is how far the result can be trusted, from 0 to 100,
+	// following the broker's ConfidenceRules: lower for stale or
+	// prefix-wide cache hits, local databases and flaky providers, higher
+	// when providers agreed
+	Confidence int
+
+	// RetrievedAt is when the provider answered. A cached result keeps the
+	// time of the lookup that produced it, so it tells how old the data is.
+	// FromCache is set when the result was served from the cache rather
+	// than looked up for this call.
+	RetrievedAt time.Time
+	FromCache   bool
+
+	// CachedAt is when the result was stored in the cache; it is zero for
+	// live lookups. Stale is set when the cached result is past its TTL and
+	// is being refreshed in the background.
+	CachedAt time.Time
+	Stale    bool
+
+	// ttl overrides the broker's cache TTL for an entry loaded by WarmCache
+	// with WarmTTL. It is only set on entries in the cache.
+	ttl time.Duration
 }
 
-// Provider interface for IP location services
+// Provider interface for IP location services. Providers don't track their
+// own usage; the broker counts requests per provider and exposes them through
+// its stats.
 type Provider interface {
 	Name() string
 	GetLocation(ctx context.Context, ip string) (*Location, error)
-	GetRequestsThisMinute() int
+	// GetMaxRequestsPerMinute returns the provider's rate limit. Zero or a
+	// negative value means the provider has no limit.
 	GetMaxRequestsPerMinute() int
 }
 
@@ -30,182 +106,1091 @@ type ProviderStats struct {
 	provider            Provider
 	mutex               sync.RWMutex
 	errorsInLast5Min    []time.Time
-	responseTimes       []time.Duration
+	requestsInWindow    []time.Time
+	responseTimes       *durationRing
 	responseTimesMutex  sync.RWMutex
 	requestsThisMinute  int
 	requestsMinuteReset time.Time
+	disagreements       int
+	totalRequests       int
+	statsWindow         time.Duration
+	enabled             bool
+	breaker             circuitBreaker
+	probes              probeStats
+	timeout             time.Duration
+	tier                int
+	costTier            CostTier
+	scoreFunc           ScoreFunc
+	slots               chan struct{}
+	waitForSlot         bool
+	cost                costTracker
+	daily               dailyQuota
+	monthly             monthlyQuota
+	limiter             RateLimiter
+	// upstreamLimitedUntil is when a provider whose service rate limited us
+	// may be selected again
+	upstreamLimitedUntil time.Time
+
+	// Time-decayed averages used for scoring unless rawWindow is set, in
+	// which case the raw errors and response times in the window are used.
+	// Both are always kept, so Stats reports either. Guarded by mutex.
+	rawWindow   bool
+	halfLife    time.Duration
+	latencyEWMA ewma
+	errorEWMA   ewma
+
+	completedRequests int
+	priorLatency      time.Duration
+	quarantine        quarantine
+
+	// inFlight counts calls admitted but not yet finished. While draining,
+	// no new calls are admitted and drained, if set, is closed once
+	// inFlight reaches zero. Guarded by mutex.
+	inFlight int
+	draining bool
+	drained  chan struct{}
 }
 
 // Broker manages multiple providers and routes requests
 type Broker struct {
 	providers     []*ProviderStats
 	providerMutex sync.RWMutex
+	retry         retryPolicy
+	hedge         hedgePolicy
+	consensus     consensusPolicy
+	strategy      SelectionStrategy
+
+	statsWindow        time.Duration
+	cleanupInterval    time.Duration
+	maxResponseSamples int
+	breakerConfig      CircuitBreakerConfig
+	probe              probePolicy
+	providerTimeouts   map[string]time.Duration
+	providerTiers      map[string]int
+	costTiers          map[string]CostTier
+	qualityBar         QualityBar
+	tierUsage          tierUsage
+	scoreFunc          ScoreFunc
+	blockOnRateLimit   bool
+	maxInFlight        map[string]int
+	bulkheadWait       bool
+	providerCosts      map[string]float64
+	costWeight         float64
+	dailyQuotas        map[string]int
+	monthlyQuotas      map[string]monthlyQuota
+	quotaState         *quotaStateFile
+	bursts             map[string]int
+	limiters           map[string]RateLimiter
+	limiterFactory     func(maxPerMinute, burst int) RateLimiter
+	batchConcurrency   int
+	batchCountPerIP    bool
+	rawStatsWindow     bool
+	ewmaHalfLife       time.Duration
+	coldStart          coldStartPolicy
+	quarantineConfig   QuarantineConfig
+	observers          []Observer
+	cache              Cache
+	cacheTTL           time.Duration
+	cacheTTLFunc       CacheTTLFunc
+	prefixBitsV4       int
+	prefixBitsV6       int
+	echoInputIP        bool
+	reservedIPs        ReservedIPPolicy
+	negative           *negativeCache
+	staleGrace         time.Duration
+	refresher          staleRefresher
+	cacheCounters      cacheCounters
+	validationRules    []ValidationRule
+	confidence         ConfidenceRules
+
+	// Lifecycle state used by Close and Shutdown
+	done       chan struct{}
+	flights    flightGroup
+	closeMutex sync.RWMutex
+	closed     bool
+	inFlight   sync.WaitGroup
 }
 
 // NewBroker creates a new broker with the given providers
-func NewBroker(providers []Provider) *Broker {
+func NewBroker(providers []Provider, opts ...BrokerOption) *Broker {
 	broker := &Broker{
 		providers: make([]*ProviderStats, len(providers)),
+		retry:     retryPolicy{maxAttempts: 1},
+
+		statsWindow:        5 * time.Minute,
+		maxResponseSamples: 100,
+		scoreFunc:          DefaultScore,
+		costWeight:         1,
+		limiterFactory:     defaultLimiterFactory,
+		batchConcurrency:   8,
+		validationRules:    DefaultValidationRules(),
+		confidence:         DefaultConfidenceRules,
+		coldStart: coldStartPolicy{
+			minSamples:   5,
+			epsilon:      0.05,
+			priorLatency: 250 * time.Millisecond,
+		},
+
+		done: make(chan struct{}),
+	}
+
+	broker.flights.inFlight = &broker.inFlight
+	for _, opt := range opts {
+		opt(broker)
+	}
+
+	if broker.strategy == nil {
+		broker.strategy = &ScoreStrategy{
+			MinSamples: broker.coldStart.minSamples,
+			Epsilon:    broker.coldStart.epsilon,
+		}
 	}
 
 	for i, p := range providers {
-		broker.providers[i] = &ProviderStats{
-			provider:            p,
-			errorsInLast5Min:    make([]time.Time, 0),
-			responseTimes:       make([]time.Duration, 0),
-			requestsThisMinute:  0,
-			requestsMinuteReset: time.Now(),
+		broker.providers[i] = broker.newProviderStats(p)
+	}
+	if broker.quotaState != nil {
+		if err := broker.quotaState.load(broker, time.Now()); err != nil {
+			log.Printf("loading quota state from %s: %v", broker.quotaState.path, err)
 		}
 	}
 
-	// Start a goroutine to clean up old stats
-	go broker.cleanupStatsRoutine()
+	// Stats are pruned whenever a provider is used. An optional sweep keeps
+	// the memory of idle providers in check too.
+	if broker.cleanupInterval > 0 {
+		go broker.cleanupStatsRoutine()
+	}
+
+	// Start health probes if configured
+	if broker.probe.interval > 0 {
+		go broker.healthProbeRoutine()
+	}
 
 	return broker
 }
 
-// cleanupStatsRoutine periodically cleans up old stats
+// newProviderStats creates empty stats for a provider using the broker's
+// settings
+func (b *Broker) newProviderStats(p Provider) *ProviderStats {
+	var slots chan struct{}
+	if limit := b.maxInFlight[p.Name()]; limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
+	return &ProviderStats{
+		provider:            p,
+		errorsInLast5Min:    make([]time.Time, 0),
+		requestsInWindow:    make([]time.Time, 0),
+		responseTimes:       newDurationRing(b.maxResponseSamples),
+		requestsThisMinute:  0,
+		requestsMinuteReset: time.Now(),
+		statsWindow:         b.statsWindow,
+		enabled:             true,
+		breaker:             circuitBreaker{config: b.breakerConfig},
+		timeout:             b.providerTimeouts[p.Name()],
+		tier:                b.providerTiers[p.Name()],
+		costTier:            b.costTiers[p.Name()],
+		scoreFunc:           b.scoreFunc,
+		slots:               slots,
+		waitForSlot:         b.bulkheadWait,
+		cost:                costTracker{perRequest: b.providerCosts[p.Name()], weight: b.costWeight},
+		daily:               dailyQuota{limit: b.dailyQuotas[p.Name()]},
+		monthly:             b.monthlyQuotas[p.Name()],
+		limiter:             b.newLimiter(p),
+		rawWindow:           b.rawStatsWindow,
+		halfLife:            b.halfLife(),
+		priorLatency:        b.coldStart.priorLatency,
+		quarantine:          quarantine{config: b.quarantineConfig},
+	}
+}
+
+// halfLife returns the EWMA half-life. It defaults to half the stats window,
+// which gives samples a similar average age to the raw window.
+func (b *Broker) halfLife() time.Duration {
+	if b.ewmaHalfLife > 0 {
+		return b.ewmaHalfLife
+	}
+	return b.statsWindow / 2
+}
+
+// newLimiter returns the rate limiter configured for p, building one from
+// the limiter factory when no limiter was supplied for it by name. Providers
+// without a rate limit are never limited.
+func (b *Broker) newLimiter(p Provider) RateLimiter {
+	if l, ok := b.limiters[p.Name()]; ok {
+		return l
+	}
+	if p.GetMaxRequestsPerMinute() <= 0 {
+		return UnlimitedLimiter{}
+	}
+	return b.limiterFactory(p.GetMaxRequestsPerMinute(), b.bursts[p.Name()])
+}
+
+// cleanupStatsRoutine periodically cleans up old stats until the broker is
+// closed
 func (b *Broker) cleanupStatsRoutine() {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(b.cleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		b.cleanupStats()
+	for {
+		select {
+		case <-ticker.C:
+			b.cleanupStats()
+		case <-b.done:
+			return
+		}
 	}
 }
 
-// cleanupStats removes old error and response time entries
+// cleanupStats prunes the stats of every provider
 func (b *Broker) cleanupStats() {
-	fiveMinAgo := time.Now().Add(-5 * time.Minute)
-
 	b.providerMutex.RLock()
 	defer b.providerMutex.RUnlock()
 
 	for _, ps := range b.providers {
 		ps.mutex.Lock()
+		ps.prune(time.Now())
+		ps.mutex.Unlock()
+	}
+}
+
+// prune removes errors and requests older than the stats window and rolls
+// the request counter. Response times live in a fixed-size ring and need no
+// pruning. The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) prune(now time.Time) {
+	windowStart := now.Add(-ps.statsWindow)
+	ps.errorsInLast5Min = trimBefore(ps.errorsInLast5Min, windowStart)
+	ps.requestsInWindow = trimBefore(ps.requestsInWindow, windowStart)
+	ps.rollMinute()
+}
+
+// GetLocation returns the location for an IP using the best available provider.
+// If the chosen provider fails, the next-ranked provider is tried until one
+// succeeds or every candidate has failed. When a retry policy is configured the
+// whole lookup is retried with backoff. Results are served from the cache when
+// one is configured, and remembered failures wrap ErrCachedFailure. The IP is
+// canonicalized first, so every spelling of an address shares one lookup;
+// input that isn't an address is rejected with ErrInvalidIP before any
+// provider is chosen or charged, and so are private, loopback and other
+// reserved addresses unless WithReservedIPs says otherwise. After the broker
+// is closed it returns ErrBrokerClosed.
+func (b *Broker) GetLocation(ctx context.Context, ip string, opts ...CallOption) (*Location, error) {
+	addr, err := parseIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	canonical := addr.String()
 
-		// Clean up errors older than 5 minutes
-		newErrors := make([]time.Time, 0)
-		for _, t := range ps.errorsInLast5Min {
-			if t.After(fiveMinAgo) {
-				newErrors = append(newErrors, t)
+	if !b.acquire() {
+		return nil, ErrBrokerClosed
+	}
+	defer b.release()
+
+	var co callOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+
+	if location, ok, err := b.reserved(addr); ok {
+		if err != nil {
+			return nil, err
+		}
+		return b.resultIP(location, ip), nil
+	}
+	if location, ok, err := b.fromCache(ctx, addr, co); ok {
+		if err != nil {
+			return nil, err
+		}
+		return b.resultIP(location, ip), nil
+	}
+
+	// Concurrent callers asking for the same thing share one upstream lookup
+	location, err := b.flights.do(ctx, co.flightKey(canonical), func(ctx context.Context) (*Location, error) {
+		location, err := b.lookupWithRetry(ctx, canonical, co)
+		b.remember(ctx, addr, co, location, err)
+		return location, err
+	})
+	if err != nil {
+		if ctx.Err() != nil && b.blockOnRateLimit && b.allRateLimited() && !errors.Is(err, ErrAllProvidersRateLimited) {
+			// The caller gave up while the shared lookup waited for capacity
+			err = fmt.Errorf("%w: %w", ErrAllProvidersRateLimited, err)
+		}
+		return nil, err
+	}
+	location.IP = canonical
+	return b.resultIP(location, ip), nil
+}
+
+// fromCache serves a lookup of addr from the cache or the negative cache
+// when co allows it, counting the outcome. ok is false on a miss; otherwise
+// either the location or the remembered failure is returned. Lookups forced
+// through a specific provider always go upstream. Failures are remembered per
+// address, even with prefix caching.
+func (b *Broker) fromCache(ctx context.Context, addr netip.Addr, co callOptions) (location *Location, ok bool, err error) {
+	canonical := addr.String()
+	useCache := b.cache != nil && co.provider == ""
+	useNegative := b.negative != nil && co.provider == ""
+	if co.refresh && useNegative {
+		b.negative.delete(canonical)
+	}
+	if co.noCache {
+		return nil, false, nil
+	}
+
+	if useCache {
+		if location, ok := b.cacheGet(ctx, b.cacheKey(addr), canonical); ok {
+			result := CacheHit
+			if location.Stale {
+				result = CacheStaleHit
 			}
+			b.countCacheResult(canonical, result)
+			return location, true, nil
+		}
+	}
+	if useNegative {
+		if err, ok := b.negative.get(canonical, time.Now()); ok {
+			b.countCacheResult(canonical, CacheNegativeHit)
+			return nil, true, fmt.Errorf("%w: %w", ErrCachedFailure, err)
 		}
-		ps.errorsInLast5Min = newErrors
+	}
+	if useCache || useNegative {
+		b.countCacheResult(canonical, CacheMiss)
+	}
+	return nil, false, nil
+}
 
-		// Clean up response times older than 5 minutes
-		ps.responseTimesMutex.Lock()
-		if len(ps.responseTimes) > 100 {
-			// Keep only the most recent 100 response times
-			ps.responseTimes = ps.responseTimes[len(ps.responseTimes)-100:]
+// remember stores the outcome of an upstream lookup of addr in the cache or,
+// unless it is transient, the negative cache
+func (b *Broker) remember(ctx context.Context, addr netip.Addr, co callOptions, location *Location, err error) {
+	if co.provider != "" {
+		return
+	}
+	if err == nil && b.cache != nil {
+		b.cacheSet(ctx, b.cacheKey(addr), location)
+	}
+	if err != nil && b.negative != nil && !isTransient(err) {
+		b.negative.set(addr.String(), err, time.Now())
+	}
+}
+
+// resultIP sets the IP reported on a result to the caller's original string
+// when the broker is configured to echo it
+func (b *Broker) resultIP(location *Location, original string) *Location {
+	if b.echoInputIP {
+		location.IP = original
+	}
+	return location
+}
+
+// lookupWithRetry runs lookup attempts according to the retry policy
+func (b *Broker) lookupWithRetry(ctx context.Context, ip string, co callOptions) (*Location, error) {
+	var lastErr error
+	for attempt := 1; attempt <= b.retry.maxAttempts; attempt++ {
+		if attempt > 1 && !sleepBackoff(ctx, b.retry.backoff(attempt-1)) {
+			break
 		}
-		ps.responseTimesMutex.Unlock()
 
-		// Reset requests counter if a minute has passed
-		if time.Since(ps.requestsMinuteReset) > time.Minute {
-			ps.requestsThisMinute = 0
-			ps.requestsMinuteReset = time.Now()
+		location, err := b.lookup(ctx, ip, co)
+		if err == nil {
+			return location, nil
 		}
+		lastErr = err
 
-		ps.mutex.Unlock()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, ErrProviderInvalidIP) {
+			break
+		}
 	}
+
+	return nil, lastErr
 }
 
-// GetLocation returns the location for an IP using the best available provider
-func (b *Broker) GetLocation(ctx context.Context, ip string) (*Location, error) {
-	bestProvider := b.selectBestProvider()
-	if bestProvider == nil {
-		return nil, errors.New("no suitable provider available")
+// lookup runs a single attempt using the routing mode selected for the call
+func (b *Broker) lookup(ctx context.Context, ip string, co callOptions) (*Location, error) {
+	if co.provider != "" {
+		return b.lookupFrom(ctx, co.provider, ip)
+	}
+
+	candidates := b.rankProviders(ip)
+	if len(candidates) == 0 && b.blockOnRateLimit {
+		var err error
+		if candidates, err = b.waitForCapacity(ctx, ip); err != nil {
+			return nil, err
+		}
+	}
+	if len(candidates) == 0 {
+		err := ErrNoProviderAvailable
+		if b.allRateLimited() {
+			err = ErrAllProvidersRateLimited
+		}
+		b.observe(func(o Observer) { o.OnNoProvider(ip, err) })
+		return nil, err
+	}
+
+	switch {
+	case co.race:
+		return b.lookupRace(ctx, ip, candidates)
+	case b.consensus.voters > 1:
+		return b.lookupConsensus(ctx, ip, candidates)
+	case b.hedge.maxHedges > 0:
+		return b.lookupHedged(ctx, ip, candidates)
+	default:
+		return b.lookupWithFailover(ctx, ip, candidates)
 	}
+}
+
+// GetLocationFrom looks up ip using only the named provider. It returns
+// ErrUnknownProvider if no such provider is registered and
+// ErrProviderRateLimited if it has no capacity left.
+func (b *Broker) GetLocationFrom(ctx context.Context, name, ip string) (*Location, error) {
+	return b.GetLocation(ctx, ip, WithProvider(name))
+}
+
+// lookupFrom sends the lookup to the named provider without failover
+func (b *Broker) lookupFrom(ctx context.Context, name, ip string) (*Location, error) {
+	ps := b.findProvider(name)
+	if ps == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	ps.mutex.RLock()
+	hasCapacity := ps.hasCapacity() && ps.quotaAvailable(time.Now())
+	ps.mutex.RUnlock()
+	if !hasCapacity {
+		return nil, fmt.Errorf("%w: %s", ErrProviderRateLimited, name)
+	}
+
+	return b.callProvider(ctx, ps, ip)
+}
+
+// lookupWithFailover tries the ranked providers in order until one succeeds
+func (b *Broker) lookupWithFailover(ctx context.Context, ip string, candidates []*ProviderStats) (*Location, error) {
+	var lastErr error
+	tried := 0
+	for _, ps := range candidates {
+		// Stop walking the chain as soon as the caller gives up
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		tried++
+		location, err := b.callProvider(ctx, ps, ip)
+		if err == nil {
+			return location, nil
+		}
+		if errors.Is(err, ErrProviderInvalidIP) {
+			// Other providers won't locate it either
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("all %d providers failed, last error: %w", tried, lastErr)
+}
+
+// callProvider performs a single lookup against ps and records its metrics
+func (b *Broker) callProvider(ctx context.Context, ps *ProviderStats, ip string) (*Location, error) {
+	return b.doCall(ctx, ps, ip, false)
+}
+
+// doCall performs the lookup for callProvider and health probes, reporting
+// the attempt to any observers
+func (b *Broker) doCall(ctx context.Context, ps *ProviderStats, ip string, probe bool) (*Location, error) {
+	attempt := Attempt{IP: ip, Provider: ps.provider.Name(), Probe: probe}
+	b.observe(func(o Observer) { o.OnProviderSelected(attempt) })
+
+	startTime := time.Now()
+	location, err := b.attempt(ctx, ps, ip, probe)
+	attempt.Latency = time.Since(startTime)
+	if err != nil {
+		attempt.Err = err
+		b.observe(func(o Observer) { o.OnError(attempt) })
+		return nil, err
+	}
+	b.observe(func(o Observer) { o.OnSuccess(attempt) })
+	return location, nil
+}
+
+// attempt calls the provider and records its metrics. Probes bypass the
+// circuit breaker and are additionally tallied as probe traffic.
+func (b *Broker) attempt(ctx context.Context, ps *ProviderStats, ip string, probe bool) (*Location, error) {
+	// Respect the provider's concurrency limit, if any
+	if err := ps.acquireSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer ps.releaseSlot()
 
 	// Track request start time
 	startTime := time.Now()
 
-	// Update request count
-	bestProvider.mutex.Lock()
-	bestProvider.requestsThisMinute++
-	bestProvider.mutex.Unlock()
+	// Update request count, unless the circuit breaker turns the request away
+	if err := ps.admit(1, 1, probe); err != nil {
+		return nil, err
+	}
+	defer ps.finishCall()
+	b.tierUsage.add(ps.costTier, 1, time.Now())
+
+	// Bound the call by the provider's own timeout, if any. The caller's
+	// context still applies when it is shorter.
+	callCtx := ctx
+	if ps.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, ps.timeout)
+		defer cancel()
+	}
 
 	// Make the request to the provider
-	location, err := bestProvider.provider.GetLocation(ctx, ip)
+	location, err := ps.provider.GetLocation(callCtx, ip)
+	if err == nil {
+		// Junk from a provider counts against it like any other failure
+		err = b.validate(ip, location)
+	}
+	if err != nil {
+		err = &UpstreamError{Provider: ps.provider.Name(), Err: err}
+	}
 
-	// Record response time
 	responseTime := time.Since(startTime)
-	bestProvider.responseTimesMutex.Lock()
-	bestProvider.responseTimes = append(bestProvider.responseTimes, responseTime)
-	bestProvider.responseTimesMutex.Unlock()
 
-	// Record error if any
+	// A call cancelled through the caller's context says nothing about the
+	// provider's health, and its duration measures the cancellation rather
+	// than the provider, so neither is recorded. Calls the broker cancelled
+	// itself (a losing hedged or raced request) still ran for real and keep
+	// their response time. Running out of the provider's own timeout is a
+	// genuine failure and is recorded below.
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(context.Cause(ctx), errLostRace) {
+			ps.recordResponseTime(responseTime)
+		}
+		ps.mutex.Lock()
+		ps.breakerAbandoned()
+		ps.mutex.Unlock()
+		return nil, err
+	}
+
+	// Record response time
+	ps.recordResponseTime(responseTime)
+
+	ps.recordCallOutcome(err, probe)
+	if err == nil || errors.Is(err, ErrProviderInvalidIP) {
+		b.useMonthlyQuota(ps, 1)
+	} else if errors.Is(err, ErrQuotaExhausted) {
+		b.quotaState.changed(b, false)
+	}
 	if err != nil {
-		bestProvider.mutex.Lock()
-		bestProvider.errorsInLast5Min = append(bestProvider.errorsInLast5Min, time.Now())
-		bestProvider.mutex.Unlock()
 		return nil, err
 	}
 
+	// Tag the result with where it came from
+	location.Provider = ps.provider.Name()
+	location.Latency = responseTime
+	location.RetrievedAt = startTime.Add(responseTime)
+	location.Confidence = b.confidence.live(ps)
+
 	return location, nil
 }
 
+// admit counts n requests, sent in one call for the given number of
+// lookups, against the provider's limits, unless draining, the circuit
+// breaker, the rate limit or the daily or monthly quota turns them away.
+// Quotas count lookups, so a batch can't overshoot them. The caller must
+// call finishCall once an admitted call is done.
+func (ps *ProviderStats) admit(n, lookups int, probe bool) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.draining {
+		// Selected before DrainProvider was called
+		return fmt.Errorf("%w: %s", ErrProviderDraining, ps.provider.Name())
+	}
+	if !probe && !ps.admitRequest() {
+		return ErrCircuitOpen
+	}
+	now := time.Now()
+	if !ps.upstreamAllows(now) || (n > 1 && ps.limiter.Remaining(now) < n) || !allowN(ps.limiter, n, now) {
+		// Capacity was used up by concurrent requests since selection
+		ps.breakerAbandoned()
+		return fmt.Errorf("%w: %s", ErrProviderRateLimited, ps.provider.Name())
+	}
+	if !ps.quotaFits(lookups, now) {
+		ps.breakerAbandoned()
+		return fmt.Errorf("%w: %w: %s has no daily or monthly quota left for %d lookups", ErrProviderRateLimited, ErrQuotaExhausted, ps.provider.Name(), lookups)
+	}
+	ps.prune(now)
+	ps.inFlight++
+	for range n {
+		ps.requestsThisMinute++
+		ps.totalRequests++
+		ps.cost.charge(now)
+	}
+	for range lookups {
+		ps.daily.use(now)
+	}
+	return nil
+}
+
+// recordCallOutcome updates the provider's health after a call it answered
+// with err
+func (ps *ProviderStats) recordCallOutcome(err error, probe bool) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	var limited *ErrRateLimited
+	switch {
+	case errors.As(err, &limited):
+		// A provider telling us to slow down is not failing, so rather than
+		// counting an error, stop selecting it until it is ready again
+		if !errors.Is(err, ErrQuotaExhausted) || !ps.exhaustMonthlyQuota(time.Now()) {
+			ps.backOffUpstream(limited.RetryAfter, time.Now())
+		}
+		ps.breakerAbandoned()
+
+	case errors.Is(err, ErrProviderInvalidIP):
+		// A provider that can't locate the address answered correctly; the
+		// address is the problem, so this counts as a success
+		ps.recordOutcome(true)
+		ps.breakerSuccess()
+		if probe {
+			ps.probes.record(nil)
+		}
+
+	case err != nil:
+		ps.recordOutcome(false)
+		ps.breakerFailure()
+		if errors.Is(err, ErrProviderAuth) {
+			// Retrying with the same credentials can't help
+			ps.quarantineAuth()
+		}
+		if probe {
+			ps.probes.record(err)
+		}
+
+	default:
+		ps.recordOutcome(true)
+		ps.breakerSuccess()
+		if probe {
+			ps.probes.record(nil)
+			ps.readmit("health probe succeeded")
+		}
+	}
+}
+
+// recordResponseTime adds a response time sample to both the moving
+// average and the ring the percentiles are taken from
+func (ps *ProviderStats) recordResponseTime(rt time.Duration) {
+	ps.mutex.Lock()
+	ps.latencyEWMA.add(float64(rt), time.Now(), ps.halfLife)
+	ps.mutex.Unlock()
+
+	ps.responseTimesMutex.Lock()
+	ps.responseTimes.add(rt)
+	ps.responseTimesMutex.Unlock()
+}
+
+// recordOutcome records whether a request succeeded. The caller must hold
+// ps.mutex for writing.
+func (ps *ProviderStats) recordOutcome(success bool) {
+	now := time.Now()
+	ps.completedRequests++
+	ps.prune(now)
+	ps.requestsInWindow = append(ps.requestsInWindow, now)
+	if success {
+		ps.errorEWMA.add(0, now, ps.halfLife)
+		return
+	}
+	ps.errorEWMA.add(1, now, ps.halfLife)
+	ps.errorsInLast5Min = append(ps.errorsInLast5Min, now)
+	ps.checkErrorRate()
+}
+
 // selectBestProvider chooses the most reliable provider based on metrics
-func (b *Broker) selectBestProvider() *ProviderStats {
+func (b *Broker) selectBestProvider(ip string) *ProviderStats {
+	candidates := b.rankProviders(ip)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// rankProviders returns the providers that are not rate limited, grouped by
+// priority tier with the preferred tier first. Each priority tier is split
+// by cost tier, cheapest first, with providers below the quality bar moved
+// after all the others. Within the preferred group the provider chosen by
+// the selection strategy comes first; every other provider is ordered from
+// best to worst score for failover.
+func (b *Broker) rankProviders(ip string) []*ProviderStats {
 	b.providerMutex.RLock()
 	defer b.providerMutex.RUnlock()
 
-	var bestProvider *ProviderStats
-	var bestScore float64 = -1
-
+	type group struct {
+		tier int
+		cost costRank
+	}
+	tiers := make(map[group][]*ProviderStats)
+	var tierOrder []group
 	for _, ps := range b.providers {
-		ps.mutex.RLock()
-
-		// Skip if provider is at or over rate limit
-		if ps.requestsThisMinute >= ps.provider.GetMaxRequestsPerMinute() {
-			ps.mutex.RUnlock()
+		if !ps.isSelectable() {
 			continue
 		}
+		if b.quarantineConfig.MinScore > 0 && ps.checkScore(ps.score()) {
+			continue
+		}
+		g := group{tier: ps.tier, cost: b.costRank(ps)}
+		if _, ok := tiers[g]; !ok {
+			tierOrder = append(tierOrder, g)
+		}
+		tiers[g] = append(tiers[g], ps)
+	}
+	if len(tierOrder) == 0 {
+		return nil
+	}
+	sort.Slice(tierOrder, func(i, j int) bool {
+		if tierOrder[i].tier != tierOrder[j].tier {
+			return tierOrder[i].tier < tierOrder[j].tier
+		}
+		return tierOrder[i].cost.less(tierOrder[j].cost)
+	})
 
-		// Calculate error rate (lower is better)
-		errorRate := float64(len(ps.errorsInLast5Min)) / 300.0 // errors per second in last 5 min
-
-		// Calculate average response time
-		ps.responseTimesMutex.RLock()
-		var avgResponseTime float64
-		if len(ps.responseTimes) > 0 {
-			var total time.Duration
-			for _, rt := range ps.responseTimes {
-				total += rt
+	candidates := make([]*ProviderStats, 0, len(b.providers))
+	for i, tier := range tierOrder {
+		var chosen *ProviderStats
+		if i == 0 {
+			chosen = selectFor(b.strategy, ip, tiers[tier])
+			if chosen != nil {
+				candidates = append(candidates, chosen)
 			}
-			avgResponseTime = float64(total) / float64(len(ps.responseTimes))
 		}
-		ps.responseTimesMutex.RUnlock()
+		candidates = append(candidates, orderByScore(tiers[tier], chosen)...)
+	}
+	return candidates
+}
+
+// orderByScore returns providers except skip sorted from best to worst score
+func orderByScore(providers []*ProviderStats, skip *ProviderStats) []*ProviderStats {
+	type scored struct {
+		ps    *ProviderStats
+		score float64
+	}
+	rest := make([]scored, 0, len(providers))
+	for _, ps := range providers {
+		if ps != skip {
+			rest = append(rest, scored{ps: ps, score: ps.score()})
+		}
+	}
+
+	// Highest score first; ties keep registration order
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].score > rest[j].score
+	})
+
+	ordered := make([]*ProviderStats, len(rest))
+	for i, r := range rest {
+		ordered[i] = r.ps
+	}
+	return ordered
+}
+
+// isSelectable reports whether the provider can take another request
+func (ps *ProviderStats) isSelectable() bool {
+	// Takes the write lock because checking the breaker may move it from
+	// open to half-open
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	return ps.selectableLocked()
+}
+
+// selectableLocked implements isSelectable. The caller must hold ps.mutex
+// for writing.
+func (ps *ProviderStats) selectableLocked() bool {
+	// Skip if provider has been disabled or is being drained
+	if !ps.enabled || ps.draining {
+		return false
+	}
+
+	// Skip if the circuit breaker is open
+	if !ps.breakerAllows() {
+		return false
+	}
+
+	// Skip if the provider is quarantined for poor health
+	if ps.quarantinedAt(time.Now()) {
+		return false
+	}
+
+	// Skip if every concurrency slot is taken and we'd rather spill over
+	if !ps.waitForSlot && ps.slots != nil && len(ps.slots) == cap(ps.slots) {
+		return false
+	}
+
+	// Skip if provider has used up its daily or monthly quota
+	if !ps.quotaAvailable(time.Now()) {
+		return false
+	}
+
+	// Skip if provider is at or over rate limit
+	return ps.hasCapacity()
+}
+
+// hasCapacity reports whether the provider's rate limiter would allow
+// another request and its service hasn't told us to back off or reported
+// that no requests remain
+func (ps *ProviderStats) hasCapacity() bool {
+	now := time.Now()
+	return ps.upstreamAllows(now) && ps.limiter.Remaining(now) > 0
+}
+
+// rollMinute resets the informational requests-this-minute counter once its
+// minute window has ended. Rate limiting itself is done by the RateLimiter.
+// The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) rollMinute() {
+	if time.Since(ps.requestsMinuteReset) > time.Minute {
+		ps.requestsThisMinute = 0
+		ps.requestsMinuteReset = time.Now()
+	}
+}
+
+// errorsInWindow counts the recorded errors that fall inside the stats
+// window. Entries older than the window may linger until the provider is
+// next pruned, so they are filtered here as well. The caller must hold
+// ps.mutex.
+func (ps *ProviderStats) errorsInWindow() int {
+	return countAfter(ps.errorsInLast5Min, time.Now().Add(-ps.statsWindow))
+}
+
+// errorRate returns the fraction of recent requests that failed: errors over
+// completed requests in raw window mode, otherwise the moving average.
+// The caller must hold ps.mutex.
+func (ps *ProviderStats) errorRate() float64 {
+	if !ps.rawWindow {
+		return ps.errorEWMA.value()
+	}
+	requests := countAfter(ps.requestsInWindow, time.Now().Add(-ps.statsWindow))
+	if requests == 0 {
+		return 0
+	}
+	return float64(ps.errorsInWindow()) / float64(requests)
+}
+
+// countAfter counts the times after start
+func countAfter(times []time.Time, start time.Time) int {
+	count := 0
+	for _, t := range times {
+		if t.After(start) {
+			count++
+		}
+	}
+	return count
+}
 
-		// Calculate capacity left (higher is better)
-		capacityLeft := 1.0 - (float64(ps.requestsThisMinute) / float64(ps.provider.GetMaxRequestsPerMinute()))
+// requestsThisMinuteAt returns the request count for the minute window
+// containing now, which is zero if the window has ended but hasn't been
+// rolled yet. The caller must hold ps.mutex.
+func (ps *ProviderStats) requestsThisMinuteAt(now time.Time) int {
+	if now.Sub(ps.requestsMinuteReset) > time.Minute {
+		return 0
+	}
+	return ps.requestsThisMinute
+}
 
-		// Calculate score (higher is better)
-		// We prioritize providers with lower error rates and faster response times
-		// while also considering available capacity
-		score := (1.0 - errorRate) * (1000.0 / (avgResponseTime + 1.0)) * capacityLeft
+// trimBefore drops the leading times that are not after start. Times are
+// recorded in order, so everything after the first kept entry is kept too.
+func trimBefore(times []time.Time, start time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	return times[i:]
+}
 
-		ps.mutex.RUnlock()
+// score rates the provider's recent quality of service (higher is better).
+// A provider without any completed requests is scored with the prior
+// latency, so it neither looks infinitely fast nor hopelessly slow.
+func (ps *ProviderStats) score() float64 {
+	snap := ps.snapshot()
+	if snap.CompletedRequests == 0 {
+		snap.AvgResponseTime = ps.priorLatency
+		snap.P50ResponseTime = ps.priorLatency
+		snap.P95ResponseTime = ps.priorLatency
+		snap.P99ResponseTime = ps.priorLatency
+		snap.LatencyEWMA = ps.priorLatency
+	}
+	return ps.cost.adjust(ps.scoreFunc(snap))
+}
 
-		if bestScore < 0 || score > bestScore {
-			bestScore = score
-			bestProvider = ps
+// completedCount returns the number of requests that completed with a
+// success or an error
+func (ps *ProviderStats) completedCount() int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.completedRequests
+}
+
+// errorStatus maps broker errors to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidIP):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrReservedIP), errors.Is(err, ErrProviderInvalidIP):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrAllProvidersRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrNoProviderAvailable), errors.Is(err, ErrBrokerClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrUpstreamFailure):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrCacheDisabled), errors.Is(err, ErrFlushUnsupported),
+		errors.Is(err, ErrSnapshotUnsupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ipstackKeys returns the comma-separated ipstack.com keys of several
+// accounts in IPSTACK_KEYS, or nil to use the single IPSTACK_KEY
+func ipstackKeys() []string {
+	var keys []string
+	for key := range strings.SplitSeq(os.Getenv("IPSTACK_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
 		}
 	}
+	return keys
+}
 
-	return bestProvider
+// newIPStack builds the ipstack.com provider, rotating over keys if there
+// are any
+func newIPStack(keys []string) (Provider, error) {
+	if len(keys) == 0 {
+		return NewIPStackProvider(150)
+	}
+	return NewKeyPoolProvider(keys, func(key string) (Provider, error) {
+		return NewIPStackProvider(150, WithToken(key))
+	})
+}
+
+// adminOnly rejects requests that don't carry the admin token as a bearer
+// token. With no token configured the admin endpoints are disabled.
+func adminOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// defaultProviders returns the providers used without a config file: the
+// keyless services plus those whose API keys are set in the environment
+func defaultProviders(useDBIP bool, maxmindDB string) []Provider {
+	// The keyless services can't fail without options
+	ipinfo, _ := NewIPInfoProvider(100)  // 100 requests per minute
+	ipapi, _ := NewIPAPIProvider(120)    // 120 requests per minute
+	ipwhois, _ := NewIPWhoisProvider(10) // keyless fallback
+	providers := []Provider{ipinfo, ipapi, ipwhois}
+	if ipstack, err := newIPStack(ipstackKeys()); err == nil {
+		providers = append(providers, ipstack)
+	} else {
+		log.Printf("Skipping ipstack.com: %v", err)
+	}
+	if ipgeolocation, err := NewIPGeolocationProvider(30); err == nil {
+		providers = append(providers, ipgeolocation)
+	} else {
+		log.Printf("Skipping ipgeolocation.io: %v", err)
+	}
+	if ipdata, err := NewIPDataProvider(60); err == nil {
+		providers = append(providers, ipdata)
+	} else {
+		log.Printf("Skipping ipdata.co: %v", err)
+	}
+	if ip2location, err := NewIP2LocationProvider(30); err == nil {
+		providers = append(providers, ip2location)
+	} else {
+		log.Printf("Skipping ip2location.io: %v", err)
+	}
+	if ipbase, err := NewIPBaseProvider(10); err == nil {
+		providers = append(providers, ipbase)
+	} else {
+		log.Printf("Skipping ipbase.com: %v", err)
+	}
+	if useDBIP || os.Getenv("DBIP_API_KEY") != "" {
+		if dbip, err := NewDBIPProvider(1); err == nil { // the free tier allows 1,000 a day
+			providers = append(providers, dbip)
+		} else {
+			log.Printf("Skipping db-ip.com: %v", err)
+		}
+	}
+	if maxmindDB != "" {
+		maxmind, err := NewMaxMindProvider(maxmindDB)
+		if err != nil {
+			log.Fatalf("Opening MaxMind database: %v", err)
+		}
+		providers = append(providers, maxmind)
+	}
+	return providers
 }
 
 func main() {
-	// Example usage
-	providers := []Provider{
-		NewIPInfoProvider(100),  // 100 requests per minute
-		NewIPAPIProvider(120),   // 120 requests per minute
-		NewIPStackProvider(150), // 150 requests per minute
+	configFile := flag.String("config", "", "JSON file declaring the providers to use instead of the defaults")
+	seedFile := flag.String("cache-seed", "", "file of known locations to preload into the cache")
+	seedTTL := flag.Duration("cache-seed-ttl", 0, "how long preloaded entries stay fresh; 0 for the cache's TTL")
+	cacheFile := flag.String("cache-file", "", "file to persist the cache in across restarts")
+	useDBIP := flag.Bool("dbip", false, "without -config, also look up with db-ip.com, on the free tier unless DBIP_API_KEY is set")
+	maxmindDB := flag.String("maxmind-db", "", "without -config, a MaxMind GeoLite2 or GeoIP2 .mmdb database to look up locally")
+	ipstackMonthly := flag.Int("ipstack-monthly-quota", 100, "requests each ipstack.com key may answer per month, resetting on the 1st; 0 for no cap")
+	quotaFile := flag.String("quota-file", "", "file to keep monthly quota usage in across restarts")
+	flag.Parse()
+
+	var providers []Provider
+	if *configFile != "" {
+		config, err := LoadConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Loading config: %v", err)
+		}
+		if providers, err = LoadProvidersFromConfig(config); err != nil {
+			log.Fatalf("Invalid config %s:\n%v", *configFile, err)
+		}
+	} else {
+		providers = defaultProviders(*useDBIP, *maxmindDB)
+	}
+
+	cache := WithCache(10000, time.Hour)
+	if *cacheFile != "" {
+		disk, err := OpenDiskCache(*cacheFile)
+		if err != nil {
+			log.Fatalf("Opening cache file: %v", err)
+		}
+		defer disk.Close()
+		cache = WithCacheStore(disk, time.Hour)
+	}
+
+	brokerOpts := []BrokerOption{
+		cache,
+		WithMonthlyQuota("ipstack.com", *ipstackMonthly*max(len(ipstackKeys()), 1), 1),
+		// ipstack credits are paid for; spend them only when the free
+		// providers can't keep up
+		WithCostTier("ipstack.com", CostTierPaid),
+		WithQualityBar(QualityBar{MaxErrorRate: 0.2, MaxLatency: 2 * time.Second, MinSamples: 10}),
+	}
+	if *quotaFile != "" {
+		brokerOpts = append(brokerOpts, WithQuotaStateFile(*quotaFile))
 	}
+	broker := NewBroker(providers, brokerOpts...)
 
-	broker := NewBroker(providers)
+	if *seedFile != "" {
+		loaded, skipped, err := broker.WarmCacheFile(context.Background(), *seedFile, WarmTTL(*seedTTL))
+		if err != nil {
+			log.Fatalf("Loading cache seed: %v", err)
+		}
+		log.Printf("Preloaded %d cache entries, skipped %d malformed lines", loaded, skipped)
+	}
 
 	// Set up HTTP server
 	http.HandleFunc("/location", func(w http.ResponseWriter, r *http.Request) {
@@ -215,16 +1200,92 @@ func main() {
 			return
 		}
 
-		location, err := broker.GetLocation(r.Context(), ip)
+		fields, err := selectFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var opts []CallOption
+		if r.URL.Query().Get("refresh") == "1" {
+			opts = append(opts, RefreshCache())
+		}
+
+		location, err := broker.GetLocation(r.Context(), ip, opts...)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error getting location: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error getting location: %v", err), errorStatus(err))
 			return
 		}
 
-		fmt.Fprintf(w, "IP: %s\nCountry: %s\nCity: %s\n",
-			location.IP, location.Country, location.City)
+		// Age tells clients how old the data is, whether it was looked up
+		// now or served from the cache
+		if !location.RetrievedAt.IsZero() {
+			age := max(time.Since(location.RetrievedAt), 0)
+			w.Header().Set("Age", strconv.Itoa(int(age/time.Second)))
+		}
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			writeLocationJSON(w, location, fields)
+			return
+		}
+		writeLocation(w, location, fields)
+	})
+
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Providers []ProviderSnapshot
+			Cache     CacheStats
+			// Requests sent to each cost tier today
+			CostTiers map[CostTier]int
+		}{broker.Stats(), broker.CacheStats(), broker.CostTierRequests()})
 	})
 
+	// Admin endpoints for purging the cache, enabled by setting ADMIN_TOKEN
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	http.HandleFunc("/cache/", adminOnly(adminToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := strings.TrimPrefix(r.URL.Path, "/cache/")
+		if err := broker.InvalidateIP(r.Context(), ip); err != nil {
+			http.Error(w, fmt.Sprintf("Error invalidating cache: %v", err), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	http.HandleFunc("/cache/snapshot", adminOnly(adminToken, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			if _, err := broker.ExportSnapshot(r.Context(), w); err != nil {
+				http.Error(w, fmt.Sprintf("Error exporting cache: %v", err), errorStatus(err))
+			}
+		case http.MethodPost:
+			imported, skipped, err := broker.ImportSnapshot(r.Context(), r.Body)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error importing cache: %v", err), errorStatus(err))
+				return
+			}
+			fmt.Fprintf(w, "Imported: %d\nSkipped: %d\n", imported, skipped)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/cache", adminOnly(adminToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		removed, err := broker.FlushCache(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error flushing cache: %v", err), errorStatus(err))
+			return
+		}
+		fmt.Fprintf(w, "Removed: %d\n", removed)
+	}))
+
 	log.Println("Starting server on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
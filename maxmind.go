@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxMindCheckInterval is how often lookups check whether the database file
+// has changed on disk
+const maxMindCheckInterval = 10 * time.Second
+
+// MaxMindProvider implements the Provider interface with a local MaxMind
+// GeoLite2 or GeoIP2 database. Lookups never leave the process, so it has no
+// rate limit.
+type MaxMindProvider struct {
+	path string
+	db   atomic.Pointer[maxMindDB]
+
+	// reloadMutex serialises reloads; lookups never take it
+	reloadMutex sync.Mutex
+	checkedAt   atomic.Int64
+}
+
+// maxMindDB is one loaded copy of the database file
+type maxMindDB struct {
+	reader  *mmdbReader
+	modTime time.Time
+	size    int64
+}
+
+// NewMaxMindProvider creates a provider reading the .mmdb database at path,
+// such as GeoLite2-City.mmdb. The file is reloaded when it changes on disk.
+func NewMaxMindProvider(path string) (*MaxMindProvider, error) {
+	p := &MaxMindProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *MaxMindProvider) Name() string {
+	return "maxmind"
+}
+
+// Reload reads the database file again. Lookups already running finish
+// against the database they started with. On error the current database
+// stays in use.
+func (p *MaxMindProvider) Reload() error {
+	p.reloadMutex.Lock()
+	defer p.reloadMutex.Unlock()
+	return p.reloadLocked()
+}
+
+// reloadLocked loads the database file. The caller must hold p.reloadMutex.
+func (p *MaxMindProvider) reloadLocked() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("maxmind: %w", err)
+	}
+	buf, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("maxmind: %w", err)
+	}
+	reader, err := newMMDBReader(buf)
+	if err != nil {
+		return fmt.Errorf("maxmind: %s: %w", p.path, err)
+	}
+
+	p.db.Store(&maxMindDB{reader: reader, modTime: info.ModTime(), size: info.Size()})
+	p.checkedAt.Store(time.Now().UnixNano())
+	return nil
+}
+
+// reloadIfChanged reloads the database when the file on disk has a different
+// modification time or size from the loaded one. It checks at most once per
+// maxMindCheckInterval and never blocks a lookup on another reload.
+func (p *MaxMindProvider) reloadIfChanged(now time.Time) {
+	checked := p.checkedAt.Load()
+	if now.UnixNano()-checked < int64(maxMindCheckInterval) {
+		return
+	}
+	if !p.checkedAt.CompareAndSwap(checked, now.UnixNano()) || !p.reloadMutex.TryLock() {
+		return
+	}
+	defer p.reloadMutex.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return
+	}
+	current := p.db.Load()
+	if info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+		return
+	}
+	if err := p.reloadLocked(); err != nil {
+		// A file caught mid-write fails to parse; the next check retries
+		log.Printf("maxmind: keeping the current database: %v", err)
+	}
+}
+
+func (p *MaxMindProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	addr, err := parseIP(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	p.reloadIfChanged(time.Now())
+	record, err := p.db.Load().reader.lookup(addr)
+	if errors.Is(err, errMMDBNotFound) {
+		return nil, fmt.Errorf("%w: %s not in MaxMind database", ErrProviderNoData, ip)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("maxmind: %w", err)
+	}
+
+	location := &Location{IP: addr.String()}
+	location.CountryCode, _ = mmdbPath(record, "country", "iso_code").(string)
+	location.Country, _ = mmdbPath(record, "country", "names", "en").(string)
+	location.ContinentCode, _ = mmdbPath(record, "continent", "code").(string)
+	location.City, _ = mmdbPath(record, "city", "names", "en").(string)
+	if subdivisions, _ := mmdbPath(record, "subdivisions").([]any); len(subdivisions) > 0 {
+		// The first subdivision is the largest, e.g. the state
+		location.Region, _ = mmdbPath(subdivisions[0], "names", "en").(string)
+	}
+	location.PostalCode, _ = mmdbPath(record, "postal", "code").(string)
+	location.Timezone, _ = mmdbPath(record, "location", "time_zone").(string)
+	// GeoLite2-ASN databases carry the network at the top level, GeoIP2
+	// Enterprise ones under traits
+	network := record
+	if traits, ok := mmdbPath(record, "traits").(map[string]any); ok {
+		network = traits
+	}
+	if asn, ok := mmdbPath(network, "autonomous_system_number").(uint64); ok {
+		location.ASN = strconv.FormatUint(asn, 10)
+	}
+	location.ISP, _ = mmdbPath(network, "isp").(string)
+	location.Org, _ = mmdbPath(network, "autonomous_system_organization").(string)
+	if org, ok := mmdbPath(network, "organization").(string); ok {
+		location.Org = org
+	}
+	lat, latOK := mmdbPath(record, "location", "latitude").(float64)
+	lon, lonOK := mmdbPath(record, "location", "longitude").(float64)
+	if latOK && lonOK {
+		location.setCoordinates(&lat, &lon)
+	}
+	return location, nil
+}
+
+// Static reports that answers come from a local database. It implements
+// StaticProvider.
+func (p *MaxMindProvider) Static() bool {
+	return true
+}
+
+// GetMaxRequestsPerMinute returns 0: local lookups are unlimited
+func (p *MaxMindProvider) GetMaxRequestsPerMinute() int {
+	return 0
+}
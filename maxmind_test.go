@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxMindProvider(t *testing.T) {
+	p, err := NewMaxMindProvider(filepath.Join("testdata", "GeoLite2-City-Test.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	loc, err := p.GetLocation(ctx, "81.2.69.142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{
+		IP:             "81.2.69.142",
+		Country:        "United Kingdom",
+		CountryCode:    "GB",
+		ContinentCode:  "EU",
+		City:           "London",
+		Region:         "England",
+		PostalCode:     "EC1A",
+		Timezone:       "Europe/London",
+		Latitude:       51.5142,
+		Longitude:      -0.0931,
+		HasCoordinates: true,
+	}
+	if *loc != want {
+		t.Errorf("got %+v, want %+v", *loc, want)
+	}
+
+	loc, err = p.GetLocation(ctx, "2001:218:ffff::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.CountryCode != "JP" || loc.City != "" || loc.Timezone != "Asia/Tokyo" {
+		t.Errorf("country-level IPv6 record decoded as %+v", loc)
+	}
+
+	if _, err := p.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, ErrProviderNoData) {
+		t.Errorf("address not in the database: got %v, want ErrProviderNoData", err)
+	}
+	if _, err := p.GetLocation(ctx, "not an ip"); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("got %v, want ErrInvalidIP", err)
+	}
+	if n := p.GetMaxRequestsPerMinute(); n != 0 {
+		t.Errorf("rate limit %d, want none", n)
+	}
+}
+
+func TestMaxMindProviderNetworkDatabases(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		db, ip        string
+		asn, isp, org string
+	}{
+		{"GeoLite2-ASN-Test.mmdb", "1.128.0.1", "1221", "", "Telstra Pty Ltd"},
+		{"GeoIP2-ISP-Test.mmdb", "1.128.0.1", "1221", "Telstra Internet", "Telstra Internet"},
+		{"GeoIP2-ISP-Test.mmdb", "2c0f:ff80::1", "237", "Merit Network", ""},
+	}
+	for _, tt := range tests {
+		p, err := NewMaxMindProvider(filepath.Join("testdata", tt.db))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := p.GetLocation(ctx, tt.ip)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.db, tt.ip, err)
+		}
+		if loc.ASN != tt.asn || loc.ISP != tt.isp || loc.Org != tt.org {
+			t.Errorf("%s %s: got ASN %q, ISP %q, Org %q", tt.db, tt.ip, loc.ASN, loc.ISP, loc.Org)
+		}
+	}
+}
+
+func TestMaxMindProviderBadFile(t *testing.T) {
+	if _, err := NewMaxMindProvider(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("missing file: no error")
+	}
+	if _, err := NewMaxMindProvider(filepath.Join("testdata", "diskcache.log")); err == nil {
+		t.Error("file that isn't a database: no error")
+	}
+}
+
+func TestMaxMindProviderReload(t *testing.T) {
+	path := copyFixture(t, "GeoLite2-City-Test.mmdb")
+	p, err := NewMaxMindProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	replace := func(name string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A broken file is rejected and the loaded database kept
+	if err := os.WriteFile(path, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reload(); err == nil {
+		t.Error("reloading a broken file: no error")
+	}
+	if _, err := p.GetLocation(ctx, "81.2.69.142"); err != nil {
+		t.Errorf("lookup after a failed reload: %v", err)
+	}
+
+	replace("GeoLite2-ASN-Test.mmdb")
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := p.GetLocation(ctx, "1.128.0.1")
+	if err != nil || loc.ASN != "1221" {
+		t.Errorf("after Reload got %+v, %v; want the new database's answer", loc, err)
+	}
+
+	// A changed file is picked up by lookups once the check interval has
+	// passed
+	replace("GeoLite2-City-Test.mmdb")
+	p.checkedAt.Store(time.Now().Add(-2 * maxMindCheckInterval).UnixNano())
+	loc, err = p.GetLocation(ctx, "81.2.69.142")
+	if err != nil || loc.City != "London" {
+		t.Errorf("after the file changed got %+v, %v; want it reloaded", loc, err)
+	}
+}
+
+func TestMaxMindProviderConcurrentReload(t *testing.T) {
+	path := copyFixture(t, "GeoLite2-City-Test.mmdb")
+	p, err := NewMaxMindProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				if loc, err := p.GetLocation(ctx, "81.2.69.142"); err != nil || loc.City != "London" {
+					t.Errorf("lookup during reloads: %+v, %v", loc, err)
+					return
+				}
+			}
+		}()
+	}
+	for range 20 {
+		if err := p.Reload(); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy chooses which entry a MemoryCache drops when it is full
+type EvictionPolicy int
+
+const (
+	// EvictLRU drops the least recently used entry
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU drops the least frequently used entry, the least recently
+	// used among equals
+	EvictLFU
+)
+
+// MemoryCacheConfig sets the limits of a MemoryCache. A zero limit means no
+// limit.
+type MemoryCacheConfig struct {
+	MaxEntries int
+	// MaxBytes caps the estimated memory held by entries
+	MaxBytes int64
+	Policy   EvictionPolicy
+}
+
+// entryOverhead approximates the bookkeeping memory of a cache entry beyond
+// its strings: the entry itself, its map slot and its eviction list node
+const entryOverhead = 256
+
+// cacheEntry is a cached lookup result
+type cacheEntry struct {
+	key      string
+	location Location
+	expires  time.Time // zero if the entry never expires
+	size     int64
+
+	// Eviction bookkeeping
+	elem     *list.Element // LRU
+	index    int           // LFU heap position
+	hits     int
+	lastUsed uint64
+}
+
+// MemoryCache is an in-memory Cache bounded by entry count and estimated
+// size. Expired entries are never returned.
+type MemoryCache struct {
+	mutex     sync.Mutex
+	config    MemoryCacheConfig
+	entries   map[string]*cacheEntry
+	evictor   evictor
+	bytes     int64
+	clock     uint64
+	evictions uint64
+}
+
+// NewMemoryCache creates an in-memory cache with the given limits
+func NewMemoryCache(config MemoryCacheConfig) *MemoryCache {
+	c := &MemoryCache{
+		config:  config,
+		entries: make(map[string]*cacheEntry),
+	}
+	c.evictor = c.newEvictor()
+	return c
+}
+
+// NewLRUCache creates an in-memory cache holding up to maxEntries results,
+// evicting the least recently used. Zero means no limit.
+func NewLRUCache(maxEntries int) *MemoryCache {
+	return NewMemoryCache(MemoryCacheConfig{MaxEntries: maxEntries})
+}
+
+// newEvictor builds the evictor for the configured policy
+func (c *MemoryCache) newEvictor() evictor {
+	if c.config.Policy == EvictLFU {
+		return &lfuEvictor{}
+	}
+	return &lruEvictor{order: list.New()}
+}
+
+// Get returns a copy of the result cached for ip, if it hasn't expired
+func (c *MemoryCache) Get(ctx context.Context, ip string) (*Location, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		c.remove(entry)
+		return nil, false, nil
+	}
+	c.touch(entry)
+	return copyLocation(&entry.location), true, nil
+}
+
+// Set caches a copy of loc for ip, evicting entries if the cache is full
+func (c *MemoryCache) Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	size := estimateEntrySize(ip, loc)
+
+	entry, ok := c.entries[ip]
+	if ok {
+		c.bytes += size - entry.size
+		entry.location = *loc
+		entry.expires = expires
+		entry.size = size
+		c.touch(entry)
+	} else {
+		entry = &cacheEntry{key: ip, location: *loc, expires: expires, size: size}
+		c.entries[ip] = entry
+		c.bytes += size
+		c.clock++
+		entry.lastUsed = c.clock
+		c.evictor.add(entry)
+	}
+
+	// The entry just written is never the victim, or an LFU cache whose
+	// entries had all been hit would turn away every new result
+	c.evictor.remove(entry)
+	for c.full() {
+		victim := c.evictor.victim()
+		if victim == nil {
+			break
+		}
+		c.remove(victim)
+		c.evictions++
+	}
+	if c.full() {
+		// Too big for the cache on its own
+		delete(c.entries, entry.key)
+		c.bytes -= entry.size
+		c.evictions++
+		return nil
+	}
+	c.evictor.add(entry)
+	return nil
+}
+
+// Delete removes the result cached for ip
+func (c *MemoryCache) Delete(ctx context.Context, ip string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[ip]; ok {
+		c.remove(entry)
+	}
+	return nil
+}
+
+// Flush removes every entry
+func (c *MemoryCache) Flush(ctx context.Context) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := len(c.entries)
+	clear(c.entries)
+	c.evictor = c.newEvictor()
+	c.bytes = 0
+	return removed, nil
+}
+
+// Evictions returns how many entries have been evicted to make room
+func (c *MemoryCache) Evictions() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.evictions
+}
+
+// Bytes returns the estimated memory held by the cached entries
+func (c *MemoryCache) Bytes() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bytes
+}
+
+// full reports whether the cache is over either limit. The caller must hold
+// c.mutex.
+func (c *MemoryCache) full() bool {
+	return (c.config.MaxEntries > 0 && len(c.entries) > c.config.MaxEntries) ||
+		(c.config.MaxBytes > 0 && c.bytes > c.config.MaxBytes)
+}
+
+// touch records a use of entry. The caller must hold c.mutex.
+func (c *MemoryCache) touch(entry *cacheEntry) {
+	c.clock++
+	entry.lastUsed = c.clock
+	entry.hits++
+	c.evictor.touch(entry)
+}
+
+// remove drops entry. The caller must hold c.mutex.
+func (c *MemoryCache) remove(entry *cacheEntry) {
+	c.evictor.remove(entry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// estimateEntrySize approximates the memory held by an entry: its fixed
+// overhead plus the bytes of the key and of every string in the location
+func estimateEntrySize(key string, loc *Location) int64 {
+	size := int64(entryOverhead) + int64(reflect.TypeFor[Location]().Size()) + int64(len(key))
+	v := reflect.ValueOf(loc).Elem()
+	for i := range v.NumField() {
+		if f := v.Field(i); f.Kind() == reflect.String {
+			size += int64(f.Len())
+		}
+	}
+	return size
+}
+
+// evictor tracks entries in the order a MemoryCache should evict them.
+// Its methods are called with the cache's mutex held.
+type evictor interface {
+	add(e *cacheEntry)
+	touch(e *cacheEntry)
+	remove(e *cacheEntry)
+	// victim returns the entry to evict next, or nil if there are none
+	victim() *cacheEntry
+}
+
+// lruEvictor evicts the least recently used entry
+type lruEvictor struct {
+	order *list.List // front is most recently used
+}
+
+func (l *lruEvictor) add(e *cacheEntry) {
+	e.elem = l.order.PushFront(e)
+}
+
+func (l *lruEvictor) touch(e *cacheEntry) {
+	l.order.MoveToFront(e.elem)
+}
+
+func (l *lruEvictor) remove(e *cacheEntry) {
+	l.order.Remove(e.elem)
+}
+
+func (l *lruEvictor) victim() *cacheEntry {
+	back := l.order.Back()
+	if back == nil {
+		return nil
+	}
+	return back.Value.(*cacheEntry)
+}
+
+// lfuEvictor evicts the least frequently used entry using a min-heap
+type lfuEvictor struct {
+	entries []*cacheEntry
+}
+
+func (l *lfuEvictor) add(e *cacheEntry) {
+	heap.Push(l, e)
+}
+
+func (l *lfuEvictor) touch(e *cacheEntry) {
+	heap.Fix(l, e.index)
+}
+
+func (l *lfuEvictor) remove(e *cacheEntry) {
+	heap.Remove(l, e.index)
+}
+
+func (l *lfuEvictor) victim() *cacheEntry {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	return l.entries[0]
+}
+
+// heap.Interface, ordering by hits and then by last use
+
+func (l *lfuEvictor) Len() int {
+	return len(l.entries)
+}
+
+func (l *lfuEvictor) Less(i, j int) bool {
+	a, b := l.entries[i], l.entries[j]
+	if a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.lastUsed < b.lastUsed
+}
+
+func (l *lfuEvictor) Swap(i, j int) {
+	l.entries[i], l.entries[j] = l.entries[j], l.entries[i]
+	l.entries[i].index = i
+	l.entries[j].index = j
+}
+
+func (l *lfuEvictor) Push(x any) {
+	e := x.(*cacheEntry)
+	e.index = len(l.entries)
+	l.entries = append(l.entries, e)
+}
+
+func (l *lfuEvictor) Pop() any {
+	last := len(l.entries) - 1
+	e := l.entries[last]
+	l.entries[last] = nil
+	l.entries = l.entries[:last]
+	return e
+}
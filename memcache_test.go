@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheConcurrent(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockLatency(time.Millisecond))
+	b := NewBroker([]Provider{p}, WithCache(100, time.Hour))
+	defer b.Close()
+
+	// lookupAll looks up ten addresses from many goroutines at once
+	lookupAll := func() {
+		var wg sync.WaitGroup
+		for i := range 100 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				loc, err := b.GetLocation(context.Background(), testIP(i%10))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if loc.IP != testIP(i%10) {
+					t.Errorf("lookup of %s answered for %s", testIP(i%10), loc.IP)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	lookupAll()
+	calls := p.Calls()
+	if calls < 10 {
+		t.Fatalf("%d provider calls for 10 addresses", calls)
+	}
+	before, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every address is cached now
+	lookupAll()
+	if n := p.Calls() - calls; n != 0 {
+		t.Errorf("%d provider calls for cached addresses, want 0", n)
+	}
+	after, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.TotalRequests != before.TotalRequests || after.RequestsThisMinute != before.RequestsThisMinute {
+		t.Errorf("cache hits counted against the provider: %d requests, then %d", before.TotalRequests, after.TotalRequests)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	p := NewMockProvider("mock", 0)
+	b := NewBroker([]Provider{p}, WithCache(100, 50*time.Millisecond))
+	defer b.Close()
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := b.GetLocation(ctx, testIP(0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := p.Calls(); n != 1 {
+		t.Fatalf("%d calls before the entry expired, want 1", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	loc, err := b.GetLocation(ctx, testIP(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Calls(); n != 2 || loc.FromCache {
+		t.Errorf("%d calls after the entry expired, from cache %v; want a live lookup", n, loc.FromCache)
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2)
+	ctx := context.Background()
+	for _, ip := range []string{"a", "b"} {
+		c.Set(ctx, ip, &Location{IP: ip}, time.Hour)
+	}
+	// a becomes the most recently used, so adding c evicts b
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a missing")
+	}
+	c.Set(ctx, "c", &Location{IP: "c"}, time.Hour)
+
+	for ip, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := c.Get(ctx, ip); ok != want {
+			t.Errorf("%s cached %v, want %v", ip, ok, want)
+		}
+	}
+	if n := c.Evictions(); n != 1 {
+		t.Errorf("%d evictions, want 1", n)
+	}
+}
+
+func TestLFUCacheEviction(t *testing.T) {
+	c := NewMemoryCache(MemoryCacheConfig{MaxEntries: 2, Policy: EvictLFU})
+	ctx := context.Background()
+	for _, ip := range []string{"a", "b"} {
+		c.Set(ctx, ip, &Location{IP: ip}, time.Hour)
+	}
+	// b is the more recently used but a the more frequently. The new entry,
+	// never hit yet, isn't evicted the moment it is written.
+	for range 3 {
+		c.Get(ctx, "a")
+	}
+	c.Get(ctx, "b")
+	c.Set(ctx, "c", &Location{IP: "c"}, time.Hour)
+
+	for ip, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := c.Get(ctx, ip); ok != want {
+			t.Errorf("%s cached %v, want %v", ip, ok, want)
+		}
+	}
+}
+
+// soakLocation is a lookup result with realistic field sizes
+func soakLocation(i int) *Location {
+	return &Location{
+		IP:        fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255),
+		Country:   "United States",
+		City:      fmt.Sprintf("Springfield %d", i),
+		Region:    "Illinois",
+		Latitude:  39.78,
+		Longitude: -89.65,
+		Provider:  "mock",
+	}
+}
+
+func TestMemoryCacheByteBudget(t *testing.T) {
+	ctx := context.Background()
+	entrySize := estimateEntrySize(soakLocation(0).IP, soakLocation(0))
+	c := NewMemoryCache(MemoryCacheConfig{MaxBytes: 10 * entrySize})
+
+	for i := range 100 {
+		loc := soakLocation(i)
+		c.Set(ctx, loc.IP, loc, time.Hour)
+	}
+	if c.Bytes() > 10*entrySize {
+		t.Errorf("cache holds %d bytes with a budget of %d", c.Bytes(), 10*entrySize)
+	}
+	// Entries are all about the same size, give or take the longer city
+	// names
+	if n := c.Evictions(); n < 89 || n > 91 {
+		t.Errorf("%d evictions, want about 90", n)
+	}
+
+	// An entry bigger than the whole budget isn't kept
+	tiny := NewMemoryCache(MemoryCacheConfig{MaxBytes: entrySize / 2})
+	tiny.Set(ctx, "a", soakLocation(0), time.Hour)
+	if _, ok, _ := tiny.Get(ctx, "a"); ok || tiny.Bytes() != 0 {
+		t.Errorf("oversized entry cached, %d bytes held", tiny.Bytes())
+	}
+
+	b := NewBroker([]Provider{NewMockProvider("mock", 0)}, WithCacheStore(c, time.Hour))
+	defer b.Close()
+	if stats := b.CacheStats(); stats.Evictions != c.Evictions() {
+		t.Errorf("cache stats report %d evictions, want %d", stats.Evictions, c.Evictions())
+	}
+}
+
+// TestMemoryCacheSoak fills a cache with a byte budget many times over and
+// checks the memory actually held stays within the budget
+func TestMemoryCacheSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	const budget = 16 << 20
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	c := NewMemoryCache(MemoryCacheConfig{MaxBytes: budget})
+	ctx := context.Background()
+	for i := range 300_000 {
+		loc := soakLocation(i)
+		c.Set(ctx, loc.IP, loc, time.Hour)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	held := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	if held > budget {
+		t.Errorf("cache holds %d MiB of heap with a budget of %d MiB", held>>20, budget>>20)
+	}
+	if c.Bytes() > budget || c.Evictions() == 0 {
+		t.Errorf("estimated %d bytes after %d evictions", c.Bytes(), c.Evictions())
+	}
+	runtime.KeepAlive(c)
+}
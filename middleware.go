@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+)
+
+// ProviderMiddleware wraps a Provider with extra behavior, such as logging
+// or metrics, without changing it. The broker can't tell a wrapped provider
+// from any other.
+type ProviderMiddleware func(Provider) Provider
+
+// LookupFunc has the signature of Provider.GetLocation
+type LookupFunc func(ctx context.Context, ip string) (*Location, error)
+
+// WrapProvider applies mws to p. The first middleware is the outermost, so
+// it sees each call first and its result last.
+func WrapProvider(p Provider, mws ...ProviderMiddleware) Provider {
+	for i := len(mws) - 1; i >= 0; i-- {
+		p = mws[i](p)
+	}
+	return p
+}
+
+// LookupMiddleware builds a middleware that intercepts GetLocation. fn
+// receives the wrapped provider's GetLocation as next. Name and the rate
+// limit pass through unchanged.
+func LookupMiddleware(fn func(ctx context.Context, ip string, next LookupFunc) (*Location, error)) ProviderMiddleware {
+	return func(p Provider) Provider {
+		return &wrappedProvider{
+			Provider: p,
+			lookup: func(ctx context.Context, ip string) (*Location, error) {
+				return fn(ctx, ip, p.GetLocation)
+			},
+		}
+	}
+}
+
+// wrappedProvider replaces a provider's GetLocation
+type wrappedProvider struct {
+	Provider
+	lookup LookupFunc
+}
+
+func (w *wrappedProvider) GetLocation(ctx context.Context, ip string) (*Location, error) {
+	return w.lookup(ctx, ip)
+}
+
+// Unwrap returns the wrapped provider, so optional interfaces such as
+// QuotaReporter are still found
+func (w *wrappedProvider) Unwrap() Provider {
+	return w.Provider
+}
+
+// asProvider finds a provider implementing T in p's chain of wrapped
+// providers
+func asProvider[T any](p Provider) (T, bool) {
+	for {
+		if t, ok := p.(T); ok {
+			return t, true
+		}
+		u, ok := p.(interface{ Unwrap() Provider })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		p = u.Unwrap()
+	}
+}
+
+// LoggingMiddleware logs every call with its duration and outcome
+func LoggingMiddleware() ProviderMiddleware {
+	return func(p Provider) Provider {
+		return LookupMiddleware(func(ctx context.Context, ip string, next LookupFunc) (*Location, error) {
+			start := time.Now()
+			location, err := next(ctx, ip)
+			if err != nil {
+				log.Printf("%s: lookup %s failed after %v: %v", p.Name(), ip, time.Since(start), err)
+			} else {
+				log.Printf("%s: lookup %s took %v", p.Name(), ip, time.Since(start))
+			}
+			return location, err
+		})(p)
+	}
+}
+
+// TimeoutMiddleware bounds every call by d. The caller's context still
+// applies when it is shorter.
+func TimeoutMiddleware(d time.Duration) ProviderMiddleware {
+	return LookupMiddleware(func(ctx context.Context, ip string, next LookupFunc) (*Location, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return next(ctx, ip)
+	})
+}
+
+// RetryMiddleware retries a call to the same provider, up to maxAttempts
+// calls in total, when it fails to reach the service or times out. Answers
+// from the service, such as a 4xx or an in-band error, are never retried.
+// Retries sleep with jittered exponential backoff between baseDelay and
+// maxDelay. The broker sees one call, so its latency covers every attempt,
+// and the provider timeout and the caller's context bound them all: no
+// retry starts that couldn't finish its backoff before the deadline.
+func RetryMiddleware(maxAttempts int, baseDelay, maxDelay time.Duration) ProviderMiddleware {
+	policy := retryPolicy{maxAttempts: maxAttempts, baseDelay: baseDelay, maxDelay: maxDelay}
+	return LookupMiddleware(func(ctx context.Context, ip string, next LookupFunc) (*Location, error) {
+		location, err := next(ctx, ip)
+		for attempt := 2; attempt <= policy.maxAttempts && err != nil; attempt++ {
+			if ctx.Err() != nil || !isNetworkError(err) || !sleepBackoff(ctx, policy.backoff(attempt-1)) {
+				break
+			}
+			location, err = next(ctx, ip)
+		}
+		return location, err
+	})
+}
+
+// isNetworkError reports whether err is a failure to reach a service or a
+// timeout waiting for it, as opposed to an answer from it
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// mmdbMetadataMarker precedes the metadata at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errMMDBNotFound is returned when the database has no record for an address
+var errMMDBNotFound = errors.New("address not in database")
+
+// mmdbReader reads MaxMind DB (.mmdb) files, the format of GeoLite2 and
+// GeoIP2 databases. It implements just enough of the format to look up
+// records; see https://maxmind.github.io/MaxMind-DB/.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint
+	// ipv4Start is the node reached after the 96 leading zero bits of an
+	// IPv4 address embedded in an IPv6 tree
+	ipv4Start uint
+	// databaseType is the metadata's database_type, e.g. "GeoLite2-City"
+	databaseType string
+}
+
+// newMMDBReader parses the metadata of the database held in buf
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	at := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if at < 0 {
+		return nil, errors.New("mmdb: metadata marker not found")
+	}
+	metaStart := uint(at + len(mmdbMetadataMarker))
+	meta, _, err := (&mmdbDecoder{buf: buf, base: metaStart}).decode(metaStart)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: decoding metadata: %w", err)
+	}
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+
+	r := &mmdbReader{buf: buf}
+	r.nodeCount = uint(mmdbUint(fields["node_count"]))
+	r.recordSize = uint(mmdbUint(fields["record_size"]))
+	r.ipVersion = uint(mmdbUint(fields["ip_version"]))
+	r.databaseType, _ = fields["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", r.recordSize)
+	}
+
+	// Compare node counts rather than sizes, which could overflow
+	if r.nodeCount > uint(at)*4/r.recordSize {
+		return nil, errors.New("mmdb: search tree larger than file")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	r.dataStart = treeSize + 16
+	if r.dataStart > uint(at) {
+		return nil, errors.New("mmdb: search tree larger than file")
+	}
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// lookup returns the decoded record for addr
+func (r *mmdbReader) lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	bits := addr.AsSlice()
+	switch {
+	case addr.Is4() && r.ipVersion == 6:
+		node = r.ipv4Start
+	case addr.Is6() && r.ipVersion == 4:
+		return nil, errors.New("mmdb: IPv6 lookup in an IPv4-only database")
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, errMMDBNotFound
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("mmdb: search tree deeper than the address")
+	}
+
+	offset := node - r.nodeCount - 16 + r.dataStart
+	value, _, err := (&mmdbDecoder{buf: r.buf, base: r.dataStart}).decode(offset)
+	return value, err
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a node
+func (r *mmdbReader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// mmdbDecoder decodes the data section; pointers are relative to base
+type mmdbDecoder struct {
+	buf  []byte
+	base uint
+}
+
+// MaxMind DB data types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbMaxDepth bounds how deeply maps and arrays may nest, so a file whose
+// pointers form a cycle can't exhaust the stack
+const mmdbMaxDepth = 64
+
+// decode decodes the value at offset, returning it and the offset just past
+// it. Maps decode to map[string]any, arrays to []any, integers to uint64 or
+// int64 and floats to float64.
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	return d.decodeAt(offset, 0, false)
+}
+
+// decodeAt decodes the value at offset inside depth enclosing maps and
+// arrays. viaPointer is set when offset is a pointer's target, which the
+// format doesn't allow to be another pointer.
+func (d *mmdbDecoder) decodeAt(offset uint, depth int, viaPointer bool) (any, uint, error) {
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == mmdbPointer {
+		if viaPointer {
+			return nil, 0, errors.New("pointer to a pointer")
+		}
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeAt(target, depth, true)
+		return value, next, err
+	}
+
+	switch kind {
+	case mmdbBool:
+	case mmdbMap, mmdbArray:
+		if depth >= mmdbMaxDepth {
+			return nil, 0, errors.New("maps and arrays nested too deeply")
+		}
+		// Every entry takes at least a byte
+		if size > uint(len(d.buf))-offset {
+			return nil, 0, fmt.Errorf("%d entries run past the end of the file", size)
+		}
+	default:
+		if offset+size > uint(len(d.buf)) {
+			return nil, 0, errors.New("value runs past the end of the file")
+		}
+	}
+	data := d.buf[offset:min(offset+size, uint(len(d.buf)))]
+
+	switch kind {
+	case mmdbString:
+		return string(data), offset + size, nil
+	case mmdbBytes:
+		return append([]byte(nil), data...), offset + size, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), offset + size, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), offset + size, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		var v uint64
+		for _, b := range data {
+			// A uint128 above 64 bits keeps only its low bits; no field
+			// we read uses one
+			v = v<<8 | uint64(b)
+		}
+		return v, offset + size, nil
+	case mmdbInt32:
+		var v uint32
+		for _, b := range data {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), offset + size, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for range size {
+			key, next, err := d.decodeAt(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decodeAt(next, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for range size {
+			value, next, err := d.decodeAt(offset, depth+1, false)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+// control reads a control byte and any extended type and size bytes that
+// follow it. For pointers the size is the raw control byte.
+func (d *mmdbDecoder) control(offset uint) (kind int, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errors.New("offset past the end of the file")
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind = int(ctrl >> 5)
+
+	if kind == mmdbPointer {
+		return kind, uint(ctrl), offset, nil
+	}
+	if kind == mmdbExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errors.New("truncated extended type")
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, errors.New("truncated size")
+		}
+		var extra uint
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	return kind, size, offset, nil
+}
+
+// pointer resolves a pointer with control byte ctrl whose payload starts at
+// offset, returning its target and the offset just past it
+func (d *mmdbDecoder) pointer(ctrl, offset uint) (target, next uint, err error) {
+	n := (ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errors.New("truncated pointer")
+	}
+	b := d.buf[offset : offset+n]
+	vvv := ctrl & 0x7
+
+	var p uint
+	switch n {
+	case 1:
+		p = vvv<<8 | uint(b[0])
+	case 2:
+		p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		p = uint(binary.BigEndian.Uint32(b))
+	}
+	return d.base + p, offset + n, nil
+}
+
+// mmdbUint returns v as a uint64, or zero if it isn't an unsigned integer
+func mmdbUint(v any) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
+
+// mmdbPath follows a path of map keys through a decoded record
+func mmdbPath(v any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
@@ -0,0 +1,126 @@
+//go:build maxminddb
+
+package main
+
+import (
+	"flag"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// The tests in this file check the decoder in mmdb.go against MaxMind's
+// reference reader. They need github.com/oschwald/maxminddb-golang, which
+// the broker itself doesn't depend on, so they only build with the
+// maxminddb tag:
+//
+//	go test -tags maxminddb -run TestMMDBReference -mmdb.db GeoLite2-City.mmdb
+//
+// Without -mmdb.db they check the fixtures in testdata; with it they also
+// check the named databases, such as a downloaded GeoLite2-City.mmdb.
+var referenceDBs = flag.String("mmdb.db", "", "comma-separated MaxMind databases to check against the reference reader")
+
+func TestMMDBReference(t *testing.T) {
+	paths := []string{
+		filepath.Join("testdata", "GeoLite2-City-Test.mmdb"),
+		filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb"),
+		filepath.Join("testdata", "GeoIP2-ISP-Test.mmdb"),
+	}
+	if *referenceDBs != "" {
+		paths = append(paths, strings.Split(*referenceDBs, ",")...)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			ref, err := maxminddb.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ref.Close()
+			// Verify checks the search tree, data section and metadata
+			// against the spec, so the fixtures can't drift into a
+			// format only our own decoder accepts
+			if err := ref.Verify(); err != nil {
+				t.Fatalf("reference reader rejects the file: %v", err)
+			}
+
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := newMMDBReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.ipVersion != ref.Metadata.IPVersion || r.recordSize != ref.Metadata.RecordSize ||
+				r.databaseType != ref.Metadata.DatabaseType {
+				t.Errorf("metadata: got ip_version %d, record_size %d, type %q; want %d, %d, %q",
+					r.ipVersion, r.recordSize, r.databaseType,
+					ref.Metadata.IPVersion, ref.Metadata.RecordSize, ref.Metadata.DatabaseType)
+			}
+
+			// Every network in the tree decodes to the same record
+			networks := ref.Networks(maxminddb.SkipAliasedNetworks)
+			n := 0
+			for networks.Next() {
+				var want any
+				network, err := networks.Network(&want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				addr, ok := netip.AddrFromSlice(network.IP)
+				if !ok {
+					t.Fatalf("network %v has no address", network)
+				}
+				got, err := r.lookup(addr.Unmap())
+				if err != nil {
+					t.Errorf("%v: %v", network, err)
+					continue
+				}
+				if want = referenceValue(want); !reflect.DeepEqual(got, want) {
+					t.Errorf("%v: got %#v, want %#v", network, got, want)
+				}
+				n++
+			}
+			if err := networks.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				t.Error("no networks in the database")
+			}
+		})
+	}
+}
+
+// referenceValue converts a record decoded by the reference reader to the
+// types mmdb.go decodes to
+func referenceValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = referenceValue(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, e := range v {
+			a[i] = referenceValue(e)
+		}
+		return a
+	case float32:
+		return float64(v)
+	case int:
+		return int64(v)
+	case *big.Int:
+		// mmdb.go keeps the low 64 bits of a uint128
+		return new(big.Int).And(v, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	default:
+		return v
+	}
+}
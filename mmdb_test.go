@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+)
+
+var updateFixtures = flag.Bool("update", false, "rewrite the generated files in testdata")
+
+// mmdbWriter builds MaxMind DB files for the tests. MaxMind's own test
+// databases aren't vendored, so the fixtures in testdata are generated by
+// it; see TestMMDBFixtures. TestMMDBReference, built with the maxminddb
+// tag, checks them and real databases against MaxMind's reference reader.
+// Identical values are written once and referred to by pointers, as
+// MaxMind's writer does, so lookups exercise the decoder's pointer handling.
+type mmdbWriter struct {
+	ipVersion    int
+	recordSize   int
+	databaseType string
+	networks     []mmdbNetwork
+}
+
+type mmdbNetwork struct {
+	prefix netip.Prefix
+	record any
+}
+
+// insert maps prefix, given as in an IPv4 tree for IPv4 prefixes, to record
+func (w *mmdbWriter) insert(prefix string, record any) {
+	w.networks = append(w.networks, mmdbNetwork{netip.MustParsePrefix(prefix), record})
+}
+
+// mmdbTrieNode is a node of the search tree under construction. Each side
+// is either another node, a data record or empty.
+type mmdbTrieNode struct {
+	child [2]*mmdbTrieNode
+	data  [2]int // offset+1 into the data section, 0 for none
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	var data mmdbEncoder
+	data.seen = make(map[string]int)
+
+	root := &mmdbTrieNode{}
+	for _, n := range w.networks {
+		bits := n.prefix.Addr().AsSlice()
+		length := n.prefix.Bits()
+		if n.prefix.Addr().Is4() && w.ipVersion == 6 {
+			// IPv4 lives under ::/96 in an IPv6 tree
+			bits = append(make([]byte, 12), bits...)
+			length += 96
+		}
+		offset := data.value(n.record) + 1
+
+		node := root
+		for i := range length - 1 {
+			bit := bits[i/8] >> (7 - i%8) & 1
+			if node.child[bit] == nil {
+				node.child[bit] = &mmdbTrieNode{}
+			}
+			node = node.child[bit]
+		}
+		last := length - 1
+		node.data[bits[last/8]>>(7-last%8)&1] = offset
+	}
+
+	// Number the nodes breadth first, root first
+	var nodes []*mmdbTrieNode
+	number := map[*mmdbTrieNode]int{}
+	queue := []*mmdbTrieNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		number[node] = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.child {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var tree []byte
+	count := len(nodes)
+	for _, node := range nodes {
+		var records [2]uint32
+		for bit := range 2 {
+			switch {
+			case node.child[bit] != nil:
+				records[bit] = uint32(number[node.child[bit]])
+			case node.data[bit] != 0:
+				records[bit] = uint32(count + 16 + node.data[bit] - 1)
+			default:
+				records[bit] = uint32(count)
+			}
+		}
+		tree = append(tree, w.node(records)...)
+	}
+
+	var meta mmdbEncoder
+	meta.value(map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(w.recordSize),
+		"ip_version":                  uint16(w.ipVersion),
+		"database_type":               w.databaseType,
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]any{"en": "Test database for the broker"},
+	})
+
+	out := append(tree, make([]byte, 16)...)
+	out = append(out, data.buf...)
+	out = append(out, mmdbMetadataMarker...)
+	return append(out, meta.buf...)
+}
+
+// node encodes a search tree node's two records
+func (w *mmdbWriter) node(r [2]uint32) []byte {
+	switch w.recordSize {
+	case 24:
+		return []byte{byte(r[0] >> 16), byte(r[0] >> 8), byte(r[0]), byte(r[1] >> 16), byte(r[1] >> 8), byte(r[1])}
+	case 28:
+		return []byte{byte(r[0] >> 16), byte(r[0] >> 8), byte(r[0]), byte(r[0]>>24)<<4 | byte(r[1]>>24)&0x0f, byte(r[1] >> 16), byte(r[1] >> 8), byte(r[1])}
+	default:
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, r[0]), r[1])
+	}
+}
+
+// mmdbEncoder encodes values for a data section. With seen set, maps and
+// strings already written are replaced by pointers to their first copy.
+type mmdbEncoder struct {
+	buf  []byte
+	seen map[string]int
+}
+
+// value appends v and returns its offset
+func (e *mmdbEncoder) value(v any) int {
+	var one mmdbEncoder
+	one.encode(v)
+	key := string(one.buf)
+	if at, ok := e.seen[key]; ok {
+		return at
+	}
+
+	offset := len(e.buf)
+	if e.seen != nil {
+		e.seen[key] = offset
+	}
+	e.encode(v)
+	return offset
+}
+
+func (e *mmdbEncoder) encode(v any) {
+	switch v := v.(type) {
+	case string:
+		e.control(mmdbString, len(v))
+		e.buf = append(e.buf, v...)
+	case float64:
+		e.control(mmdbDouble, 8)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+	case float32:
+		e.control(mmdbFloat, 4)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(v))
+	case []byte:
+		e.control(mmdbBytes, len(v))
+		e.buf = append(e.buf, v...)
+	case uint16:
+		e.uint(mmdbUint16, uint64(v))
+	case uint32:
+		e.uint(mmdbUint32, uint64(v))
+	case uint64:
+		e.uint(mmdbUint64, v)
+	case int32:
+		e.control(mmdbInt32, 4)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		e.control(mmdbBool, size)
+	case map[string]any:
+		e.control(mmdbMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e.child(k)
+			e.child(v[k])
+		}
+	case []any:
+		e.control(mmdbArray, len(v))
+		for _, item := range v {
+			e.child(item)
+		}
+	default:
+		panic(fmt.Sprintf("mmdbEncoder: unsupported %T", v))
+	}
+}
+
+// child encodes a value inside a map or array, as a pointer to an earlier
+// copy where there is one
+func (e *mmdbEncoder) child(v any) {
+	if e.seen == nil {
+		e.encode(v)
+		return
+	}
+	var one mmdbEncoder
+	one.encode(v)
+	if at, ok := e.seen[string(one.buf)]; ok && len(one.buf) > 3 {
+		e.pointer(at)
+		return
+	}
+	e.seen[string(one.buf)] = len(e.buf)
+	e.encode(v)
+}
+
+func (e *mmdbEncoder) uint(kind int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	e.control(kind, len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *mmdbEncoder) control(kind, size int) {
+	var first byte
+	var extra []byte
+	switch {
+	case size < 29:
+		first = byte(size)
+	case size < 285:
+		first, extra = 29, []byte{byte(size - 29)}
+	case size < 65821:
+		first, extra = 30, binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		s := size - 65821
+		first, extra = 31, []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+	if kind < 8 {
+		e.buf = append(e.buf, byte(kind)<<5|first)
+	} else {
+		e.buf = append(e.buf, first, byte(kind-7))
+	}
+	e.buf = append(e.buf, extra...)
+}
+
+func (e *mmdbEncoder) pointer(p int) {
+	switch {
+	case p < 2048:
+		e.buf = append(e.buf, 1<<5|byte(p>>8)&7, byte(p))
+	case p < 526336:
+		p -= 2048
+		e.buf = append(e.buf, 1<<5|1<<3|byte(p>>16)&7, byte(p>>8), byte(p))
+	case p < 134744064:
+		p -= 526336
+		e.buf = append(e.buf, 1<<5|2<<3|byte(p>>24)&7, byte(p>>16), byte(p>>8), byte(p))
+	default:
+		e.buf = append(e.buf, 1<<5|3<<3)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(p))
+	}
+}
+
+// mmdbCity returns a GeoLite2-City record
+func mmdbCity(continent, countryCode, country, city, region, postal, zone string, lat, lon float64) map[string]any {
+	record := map[string]any{
+		"continent": map[string]any{"code": continent, "geoname_id": uint32(6255148)},
+		"country":   map[string]any{"iso_code": countryCode, "names": map[string]any{"en": country, "de": country}},
+		"location": map[string]any{
+			"latitude":        lat,
+			"longitude":       lon,
+			"time_zone":       zone,
+			"accuracy_radius": uint16(100),
+		},
+	}
+	if city != "" {
+		record["city"] = map[string]any{"names": map[string]any{"en": city}}
+	}
+	if region != "" {
+		record["subdivisions"] = []any{map[string]any{"iso_code": "XX", "names": map[string]any{"en": region}}}
+	}
+	if postal != "" {
+		record["postal"] = map[string]any{"code": postal}
+	}
+	return record
+}
+
+// mmdbFixtures are the databases in testdata, by file name
+var mmdbFixtures = map[string]func() *mmdbWriter{
+	"GeoLite2-City-Test.mmdb": func() *mmdbWriter {
+		w := &mmdbWriter{ipVersion: 6, recordSize: 28, databaseType: "GeoLite2-City"}
+		w.insert("81.2.69.0/24", mmdbCity("EU", "GB", "United Kingdom", "London", "England", "EC1A", "Europe/London", 51.5142, -0.0931))
+		w.insert("89.160.20.112/28", mmdbCity("EU", "SE", "Sweden", "Linköping", "Östergötland County", "", "Europe/Stockholm", 58.4167, 15.6167))
+		w.insert("2.125.160.216/29", mmdbCity("EU", "GB", "United Kingdom", "Boxford", "England", "OX1", "Europe/London", 51.75, -1.25))
+		// A country-level record, with no city
+		w.insert("67.43.156.0/24", mmdbCity("AS", "BT", "Bhutan", "", "", "", "Asia/Thimphu", 27.5, 90.5))
+		w.insert("2001:218::/32", mmdbCity("AS", "JP", "Japan", "", "", "", "Asia/Tokyo", 35.68536, 139.75309))
+		w.insert("2a02:ffc0::/29", mmdbCity("EU", "GI", "Gibraltar", "", "", "", "Europe/Gibraltar", 36.1333, -5.35))
+		return w
+	},
+	"GeoLite2-ASN-Test.mmdb": func() *mmdbWriter {
+		w := &mmdbWriter{ipVersion: 4, recordSize: 24, databaseType: "GeoLite2-ASN"}
+		w.insert("1.128.0.0/11", map[string]any{"autonomous_system_number": uint32(1221), "autonomous_system_organization": "Telstra Pty Ltd"})
+		w.insert("12.81.92.0/22", map[string]any{"autonomous_system_number": uint32(7018), "autonomous_system_organization": "AT&T Services"})
+		return w
+	},
+	"GeoIP2-ISP-Test.mmdb": func() *mmdbWriter {
+		w := &mmdbWriter{ipVersion: 6, recordSize: 32, databaseType: "GeoIP2-ISP"}
+		w.insert("1.128.0.0/11", map[string]any{
+			"traits": map[string]any{
+				"autonomous_system_number":       uint32(1221),
+				"autonomous_system_organization": "Telstra Pty Ltd",
+				"isp":                            "Telstra Internet",
+				"organization":                   "Telstra Internet",
+			},
+		})
+		w.insert("2c0f:ff80::/26", map[string]any{
+			"traits": map[string]any{
+				"autonomous_system_number": uint32(237),
+				"isp":                      "Merit Network",
+			},
+		})
+		return w
+	},
+}
+
+// TestMMDBFixtures checks that the files in testdata are what the writer
+// produces; run with -update to regenerate them
+func TestMMDBFixtures(t *testing.T) {
+	for name, build := range mmdbFixtures {
+		path := filepath.Join("testdata", name)
+		want := build().bytes()
+		if *updateFixtures {
+			if err := os.WriteFile(path, want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run go test -run TestMMDBFixtures -update", name)
+		}
+	}
+}
+
+func openMMDBFixture(t testing.TB, name string) *mmdbReader {
+	t.Helper()
+	buf, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newMMDBReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestMMDBReaderMetadata(t *testing.T) {
+	tests := []struct {
+		name         string
+		ipVersion    uint
+		recordSize   uint
+		databaseType string
+	}{
+		{"GeoLite2-City-Test.mmdb", 6, 28, "GeoLite2-City"},
+		{"GeoLite2-ASN-Test.mmdb", 4, 24, "GeoLite2-ASN"},
+		{"GeoIP2-ISP-Test.mmdb", 6, 32, "GeoIP2-ISP"},
+	}
+	for _, tt := range tests {
+		r := openMMDBFixture(t, tt.name)
+		if r.ipVersion != tt.ipVersion || r.recordSize != tt.recordSize || r.databaseType != tt.databaseType {
+			t.Errorf("%s: ip_version %d, record_size %d, database_type %q", tt.name, r.ipVersion, r.recordSize, r.databaseType)
+		}
+	}
+}
+
+func TestMMDBReaderLookup(t *testing.T) {
+	tests := []struct {
+		db   string
+		ip   string
+		path []string
+		want any // nil for an address not in the database
+	}{
+		{"GeoLite2-City-Test.mmdb", "81.2.69.142", []string{"city", "names", "en"}, "London"},
+		{"GeoLite2-City-Test.mmdb", "81.2.69.0", []string{"country", "iso_code"}, "GB"},
+		{"GeoLite2-City-Test.mmdb", "81.2.69.255", []string{"location", "latitude"}, 51.5142},
+		{"GeoLite2-City-Test.mmdb", "::ffff:81.2.69.142", []string{"city", "names", "en"}, "London"},
+		{"GeoLite2-City-Test.mmdb", "89.160.20.120", []string{"city", "names", "en"}, "Linköping"},
+		{"GeoLite2-City-Test.mmdb", "89.160.20.127", []string{"location", "time_zone"}, "Europe/Stockholm"},
+		{"GeoLite2-City-Test.mmdb", "2.125.160.216", []string{"postal", "code"}, "OX1"},
+		{"GeoLite2-City-Test.mmdb", "67.43.156.1", []string{"country", "names", "en"}, "Bhutan"},
+		{"GeoLite2-City-Test.mmdb", "2001:218:1::1", []string{"country", "iso_code"}, "JP"},
+		{"GeoLite2-City-Test.mmdb", "2a02:ffc7:ffff::1", []string{"country", "iso_code"}, "GI"},
+		{"GeoLite2-City-Test.mmdb", "81.2.70.1", nil, nil},
+		{"GeoLite2-City-Test.mmdb", "89.160.20.111", nil, nil},
+		{"GeoLite2-City-Test.mmdb", "89.160.20.128", nil, nil},
+		{"GeoLite2-City-Test.mmdb", "2001:219::1", nil, nil},
+		{"GeoLite2-ASN-Test.mmdb", "1.128.0.1", []string{"autonomous_system_number"}, uint64(1221)},
+		{"GeoLite2-ASN-Test.mmdb", "1.159.255.255", []string{"autonomous_system_organization"}, "Telstra Pty Ltd"},
+		{"GeoLite2-ASN-Test.mmdb", "12.81.95.1", []string{"autonomous_system_number"}, uint64(7018)},
+		{"GeoLite2-ASN-Test.mmdb", "1.160.0.0", nil, nil},
+		{"GeoIP2-ISP-Test.mmdb", "1.130.0.1", []string{"traits", "isp"}, "Telstra Internet"},
+		{"GeoIP2-ISP-Test.mmdb", "2c0f:ff80::1", []string{"traits", "autonomous_system_number"}, uint64(237)},
+		{"GeoIP2-ISP-Test.mmdb", "2c0f:ffc0::1", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.db+"/"+tt.ip, func(t *testing.T) {
+			r := openMMDBFixture(t, tt.db)
+			record, err := r.lookup(netip.MustParseAddr(tt.ip))
+			if tt.want == nil {
+				if err != errMMDBNotFound {
+					t.Errorf("got %v, %v; want errMMDBNotFound", record, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mmdbPath(record, tt.path...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMMDBReaderIPv6InIPv4Database(t *testing.T) {
+	r := openMMDBFixture(t, "GeoLite2-ASN-Test.mmdb")
+	if _, err := r.lookup(netip.MustParseAddr("2001:db8::1")); err == nil || err == errMMDBNotFound {
+		t.Errorf("got %v, want an error for the wrong IP version", err)
+	}
+}
+
+func TestMMDBDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{"empty string", "", ""},
+		{"string", "Zürich", "Zürich"},
+		{"string of 28 bytes", string(bytes.Repeat([]byte("a"), 28)), string(bytes.Repeat([]byte("a"), 28))},
+		{"string of 29 bytes", string(bytes.Repeat([]byte("a"), 29)), string(bytes.Repeat([]byte("a"), 29))},
+		{"string of 300 bytes", string(bytes.Repeat([]byte("b"), 300)), string(bytes.Repeat([]byte("b"), 300))},
+		{"string of 70000 bytes", string(bytes.Repeat([]byte("c"), 70000)), string(bytes.Repeat([]byte("c"), 70000))},
+		{"double", -33.8688, -33.8688},
+		{"float", float32(1.5), 1.5},
+		{"bytes", []byte{0, 1, 2}, []byte{0, 1, 2}},
+		{"uint16 zero", uint16(0), uint64(0)},
+		{"uint16", uint16(443), uint64(443)},
+		{"uint32", uint32(4294967295), uint64(4294967295)},
+		{"uint64", uint64(1 << 60), uint64(1 << 60)},
+		{"int32", int32(-7), int64(-7)},
+		{"true", true, true},
+		{"false", false, false},
+		{"array", []any{"a", uint16(1), []any{}}, []any{"a", uint64(1), []any{}}},
+		{"map", map[string]any{"en": "Berlin", "n": map[string]any{}}, map[string]any{"en": "Berlin", "n": map[string]any{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e mmdbEncoder
+			e.encode(tt.value)
+			got, next, err := (&mmdbDecoder{buf: e.buf}).decode(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if next != uint(len(e.buf)) {
+				t.Errorf("decoded %d of %d bytes", next, len(e.buf))
+			}
+		})
+	}
+}
+
+func TestMMDBDecodePointers(t *testing.T) {
+	for _, target := range []int{0, 2047, 2048, 526335, 526336, 134744064} {
+		var e mmdbEncoder
+		e.buf = make([]byte, target)
+		e.encode("here")
+		at := len(e.buf)
+		e.pointer(target)
+
+		got, next, err := (&mmdbDecoder{buf: e.buf}).decode(uint(at))
+		if err != nil {
+			t.Fatalf("pointer to %d: %v", target, err)
+		}
+		if got != "here" || next != uint(len(e.buf)) {
+			t.Errorf("pointer to %d: got %v ending at %d", target, got, next)
+		}
+	}
+}
+
+func TestMMDBDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  func() []byte
+	}{
+		{"empty", func() []byte { return nil }},
+		{"truncated string", func() []byte { return []byte{mmdbString<<5 | 5, 'a', 'b'} }},
+		{"truncated size", func() []byte { return []byte{mmdbString<<5 | 30, 1} }},
+		{"truncated extended type", func() []byte { return []byte{0} }},
+		{"truncated pointer", func() []byte { return []byte{mmdbPointer<<5 | 3<<3, 0} }},
+		{"pointer past the end", func() []byte {
+			var e mmdbEncoder
+			e.pointer(1000)
+			return e.buf
+		}},
+		{"pointer to itself", func() []byte {
+			var e mmdbEncoder
+			e.pointer(0)
+			return e.buf
+		}},
+		{"pointer to a pointer", func() []byte {
+			var e mmdbEncoder
+			e.pointer(2)
+			e.pointer(0)
+			return e.buf
+		}},
+		{"map containing itself", func() []byte {
+			var e mmdbEncoder
+			e.control(mmdbMap, 1)
+			e.encode("k")
+			e.pointer(0)
+			return e.buf
+		}},
+		{"map key not a string", func() []byte {
+			var e mmdbEncoder
+			e.control(mmdbMap, 1)
+			e.encode(uint16(1))
+			e.encode("v")
+			return e.buf
+		}},
+		{"huge array", func() []byte {
+			var e mmdbEncoder
+			e.control(mmdbArray, 16_000_000)
+			return e.buf
+		}},
+		{"huge map", func() []byte {
+			var e mmdbEncoder
+			e.control(mmdbMap, 16_000_000)
+			return e.buf
+		}},
+		{"double of 4 bytes", func() []byte { return []byte{mmdbDouble<<5 | 4, 0, 0, 0, 0} }},
+		{"unknown type", func() []byte { return []byte{0, 20} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := (&mmdbDecoder{buf: tt.buf()}).decode(0); err == nil {
+				t.Errorf("decoded %#v without an error", got)
+			}
+		})
+	}
+}
+
+func TestNewMMDBReaderMalformed(t *testing.T) {
+	city, err := os.ReadFile(filepath.Join("testdata", "GeoLite2-City-Test.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := func(fields map[string]any) []byte {
+		var e mmdbEncoder
+		e.encode(fields)
+		return append(slices.Clone(mmdbMetadataMarker), e.buf...)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"no marker", bytes.Repeat([]byte{0}, 100)},
+		{"metadata not a map", append(slices.Clone(mmdbMetadataMarker), 0x44, 't', 'e', 's', 't')},
+		{"unsupported record size", metadata(map[string]any{"node_count": uint32(0), "record_size": uint16(20), "ip_version": uint16(6)})},
+		{"tree past the end", metadata(map[string]any{"node_count": uint32(1000), "record_size": uint16(24), "ip_version": uint16(6)})},
+		{"tree size overflows", metadata(map[string]any{"node_count": uint64(1 << 62), "record_size": uint16(32), "ip_version": uint16(6)})},
+		{"truncated", city[:len(city)/2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMMDBReader(tt.buf); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+// FuzzMMDBReader checks that no file makes the reader panic or hang,
+// starting from the fixtures
+func FuzzMMDBReader(f *testing.F) {
+	for name := range mmdbFixtures {
+		buf, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf, []byte{81, 2, 69, 142})
+		f.Add(buf, netip.MustParseAddr("2001:218::1").AsSlice())
+	}
+
+	f.Fuzz(func(t *testing.T, buf, ip []byte) {
+		r, err := newMMDBReader(buf)
+		if err != nil {
+			return
+		}
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return
+		}
+		r.lookup(addr)
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxNegativeEntries bounds how many failed lookups are remembered at once
+const maxNegativeEntries = 10000
+
+// negativeEntry is a remembered failure
+type negativeEntry struct {
+	err     error
+	expires time.Time
+}
+
+// negativeCache remembers lookups that failed on every provider so repeated
+// requests for the same bad input fail fast
+type negativeCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]negativeEntry
+}
+
+// newNegativeCache creates a cache remembering failures for ttl
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{
+		ttl:     ttl,
+		entries: make(map[string]negativeEntry),
+	}
+}
+
+// get returns the failure remembered for ip, if it hasn't expired
+func (c *negativeCache) get(ip string, now time.Time) (error, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, ip)
+		return nil, false
+	}
+	return entry.err, true
+}
+
+// delete forgets any failure remembered for ip
+func (c *negativeCache) delete(ip string) {
+	c.mutex.Lock()
+	delete(c.entries, ip)
+	c.mutex.Unlock()
+}
+
+// flush forgets every remembered failure
+func (c *negativeCache) flush() {
+	c.mutex.Lock()
+	clear(c.entries)
+	c.mutex.Unlock()
+}
+
+// set remembers err for ip. When the cache is full expired entries are
+// dropped first, and if it is still full the failure isn't remembered.
+func (c *negativeCache) set(ip string, err error, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.entries) >= maxNegativeEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxNegativeEntries {
+			return
+		}
+	}
+	c.entries[ip] = negativeEntry{err: err, expires: now.Add(c.ttl)}
+}
+
+// isTransient reports whether err might not happen again on a later attempt:
+// running out of capacity, timeouts, cancellation, open circuits and bad data
+// from a provider. Transient failures are never negatively cached.
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, ErrProviderRateLimited),
+		errors.Is(err, ErrAllProvidersRateLimited),
+		errors.Is(err, ErrProviderBusy),
+		errors.Is(err, ErrCircuitOpen),
+		errors.Is(err, ErrProviderDraining),
+		errors.Is(err, ErrProviderUnavailable),
+		errors.Is(err, ErrBadProviderData),
+		errors.Is(err, ErrNoProviderAvailable),
+		errors.Is(err, ErrBrokerClosed),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, context.Canceled):
+		return true
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return true
+	}
+	return false
+}
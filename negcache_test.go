@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheInvalidIP(t *testing.T) {
+	invalid := fmt.Errorf("%w: mock: not an address we know", ErrProviderInvalidIP)
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 100, invalid))
+	b := NewBroker([]Provider{p}, WithCache(100, time.Hour), WithNegativeCache(100*time.Millisecond))
+	defer b.Close()
+	ctx := context.Background()
+
+	if _, err := b.GetLocation(ctx, testIP(1)); !errors.Is(err, ErrProviderInvalidIP) || errors.Is(err, ErrCachedFailure) {
+		t.Fatalf("first lookup: got %v, want a live ErrProviderInvalidIP", err)
+	}
+
+	// Repeats fail from the negative cache without a provider call
+	_, err := b.GetLocation(ctx, testIP(1))
+	if !errors.Is(err, ErrCachedFailure) || !errors.Is(err, ErrProviderInvalidIP) {
+		t.Errorf("repeat: got %v, want a cached ErrProviderInvalidIP", err)
+	}
+	if n := p.Calls(); n != 1 {
+		t.Errorf("%d provider calls, want 1", n)
+	}
+
+	// The failure expires after the negative TTL, not the cache TTL
+	time.Sleep(150 * time.Millisecond)
+	if _, err := b.GetLocation(ctx, testIP(1)); errors.Is(err, ErrCachedFailure) {
+		t.Errorf("after the negative TTL: got %v, want a live lookup", err)
+	}
+	if n := p.Calls(); n != 2 {
+		t.Errorf("%d provider calls after the negative TTL, want 2", n)
+	}
+
+	// RefreshCache forgets the failure
+	if _, err := b.GetLocation(ctx, testIP(1), RefreshCache()); errors.Is(err, ErrCachedFailure) {
+		t.Errorf("RefreshCache: got %v, want a live lookup", err)
+	}
+	if n := p.Calls(); n != 3 {
+		t.Errorf("%d provider calls after RefreshCache, want 3", n)
+	}
+}
+
+func TestNegativeCacheSkipsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"rate limited", rateLimited("mock", "slow down", nil)},
+		{"unavailable", ErrProviderUnavailable},
+		{"bad data", fmt.Errorf("%w: mock: latitude out of range", ErrBadProviderData)},
+		{"timeout", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewMockProvider("mock", 0, MockFailCalls(1, 1, tt.err))
+			b := NewBroker([]Provider{p}, WithNegativeCache(time.Hour))
+			defer b.Close()
+
+			if _, err := b.GetLocation(context.Background(), testIP(1)); err == nil {
+				t.Fatal("first lookup succeeded")
+			}
+			_, err := b.GetLocation(context.Background(), testIP(1))
+			if errors.Is(err, ErrCachedFailure) {
+				t.Errorf("repeat: got %v, want the failure not remembered", err)
+			}
+		})
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	invalid := fmt.Errorf("%w: mock: not an address we know", ErrProviderInvalidIP)
+	for _, opts := range [][]BrokerOption{nil, {WithNegativeCache(time.Hour), WithNegativeCache(0)}} {
+		p := NewMockProvider("mock", 0, MockFailCalls(1, 100, invalid))
+		b := NewBroker([]Provider{p}, opts...)
+		defer b.Close()
+
+		for range 2 {
+			if _, err := b.GetLocation(context.Background(), testIP(1)); errors.Is(err, ErrCachedFailure) {
+				t.Errorf("got %v with negative caching off", err)
+			}
+		}
+		if n := p.Calls(); n != 2 {
+			t.Errorf("%d provider calls with negative caching off, want 2", n)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+// Attempt describes a single call to a provider
+type Attempt struct {
+	// IP is the address being looked up
+	IP string
+	// Provider is the name of the provider called
+	Provider string
+	// Latency is how long the attempt took; zero for OnProviderSelected
+	Latency time.Duration
+	// Err is why the attempt failed; nil for OnProviderSelected and OnSuccess
+	Err error
+	// Probe reports whether the attempt was a background health probe
+	Probe bool
+}
+
+// Observer receives events for every provider attempt. Callbacks run
+// synchronously on the request path, outside the broker's locks, so
+// implementations must be fast and must not block; hand slow work off to
+// another goroutine.
+type Observer interface {
+	// OnProviderSelected is called before a provider is called
+	OnProviderSelected(a Attempt)
+	// OnSuccess is called when a provider returns a location
+	OnSuccess(a Attempt)
+	// OnError is called when an attempt fails, including attempts the
+	// provider never saw because of its circuit breaker or rate limit
+	OnError(a Attempt)
+	// OnNoProvider is called when selection finds no candidate for ip
+	OnNoProvider(ip string, err error)
+}
+
+// observe passes an event to every registered observer
+func (b *Broker) observe(event func(Observer)) {
+	for _, o := range b.observers {
+		event(o)
+	}
+}
+
+// HashIP returns a short, stable digest of ip for observers that should not
+// record raw addresses
+func HashIP(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:8])
+}
+
+// LogObserver logs every attempt with the standard logger
+type LogObserver struct {
+	// HashIPs logs HashIP(ip) instead of the address itself
+	HashIPs bool
+}
+
+// ip returns the address as it should appear in the log
+func (l LogObserver) ip(ip string) string {
+	if l.HashIPs {
+		return HashIP(ip)
+	}
+	return ip
+}
+
+// OnProviderSelected logs the provider chosen for a lookup
+func (l LogObserver) OnProviderSelected(a Attempt) {
+	log.Printf("lookup %s: trying %s", l.ip(a.IP), a.Provider)
+}
+
+// OnSuccess logs a successful attempt
+func (l LogObserver) OnSuccess(a Attempt) {
+	log.Printf("lookup %s: %s answered in %v", l.ip(a.IP), a.Provider, a.Latency)
+}
+
+// OnError logs a failed attempt
+func (l LogObserver) OnError(a Attempt) {
+	log.Printf("lookup %s: %s failed after %v: %v", l.ip(a.IP), a.Provider, a.Latency, a.Err)
+}
+
+// OnNoProvider logs a lookup that found no provider
+func (l LogObserver) OnNoProvider(ip string, err error) {
+	log.Printf("lookup %s: %v", l.ip(ip), err)
+}
+
+// CountingObserver counts events per provider in memory
+type CountingObserver struct {
+	mutex      sync.Mutex
+	selected   map[string]int
+	successes  map[string]int
+	errors     map[string]int
+	noProvider int
+}
+
+// NewCountingObserver creates an empty CountingObserver
+func NewCountingObserver() *CountingObserver {
+	return &CountingObserver{
+		selected:  make(map[string]int),
+		successes: make(map[string]int),
+		errors:    make(map[string]int),
+	}
+}
+
+// OnProviderSelected counts a selection of a.Provider
+func (c *CountingObserver) OnProviderSelected(a Attempt) {
+	c.mutex.Lock()
+	c.selected[a.Provider]++
+	c.mutex.Unlock()
+}
+
+// OnSuccess counts a success from a.Provider
+func (c *CountingObserver) OnSuccess(a Attempt) {
+	c.mutex.Lock()
+	c.successes[a.Provider]++
+	c.mutex.Unlock()
+}
+
+// OnError counts an error from a.Provider
+func (c *CountingObserver) OnError(a Attempt) {
+	c.mutex.Lock()
+	c.errors[a.Provider]++
+	c.mutex.Unlock()
+}
+
+// OnNoProvider counts a lookup that found no provider
+func (c *CountingObserver) OnNoProvider(ip string, err error) {
+	c.mutex.Lock()
+	c.noProvider++
+	c.mutex.Unlock()
+}
+
+// Selected returns how many times the named provider was selected
+func (c *CountingObserver) Selected(name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.selected[name]
+}
+
+// Successes returns how many attempts on the named provider succeeded
+func (c *CountingObserver) Successes(name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.successes[name]
+}
+
+// Errors returns how many attempts on the named provider failed
+func (c *CountingObserver) Errors(name string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.errors[name]
+}
+
+// NoProvider returns how many lookups found no provider
+func (c *CountingObserver) NoProvider() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.noProvider
+}
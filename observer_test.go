@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountingObserver(t *testing.T) {
+	counter := NewCountingObserver()
+	a := NewMockProvider("a", 0, MockFailCalls(1, 1, nil))
+	b := NewBroker([]Provider{a, NewMockProvider("b", 0)}, WithProviderTier("b", 1), WithObserver(counter))
+	defer b.Close()
+
+	// a fails the first lookup over to b, then answers the second
+	for i := range 2 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name                          string
+		selected, successes, failures int
+	}{
+		{"a", 2, 1, 1},
+		{"b", 1, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := counter.Selected(tt.name); got != tt.selected {
+			t.Errorf("%s selected %d times, want %d", tt.name, got, tt.selected)
+		}
+		if got := counter.Successes(tt.name); got != tt.successes {
+			t.Errorf("%s succeeded %d times, want %d", tt.name, got, tt.successes)
+		}
+		if got := counter.Errors(tt.name); got != tt.failures {
+			t.Errorf("%s failed %d times, want %d", tt.name, got, tt.failures)
+		}
+	}
+	if n := counter.NoProvider(); n != 0 {
+		t.Errorf("%d lookups found no provider, want 0", n)
+	}
+}
+
+func TestObserverNoProvider(t *testing.T) {
+	counter := NewCountingObserver()
+	b := NewBroker([]Provider{NewMockProvider("mock", 1)}, WithObserver(counter))
+	defer b.Close()
+
+	b.GetLocation(context.Background(), testIP(0))
+	if _, err := b.GetLocation(context.Background(), testIP(1)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Fatalf("got %v, want ErrAllProvidersRateLimited", err)
+	}
+	if n := counter.NoProvider(); n != 1 {
+		t.Errorf("%d lookups found no provider, want 1", n)
+	}
+}
+
+// statsObserver reads the broker's stats from every callback, which would
+// deadlock if callbacks ran under the broker's locks
+type statsObserver struct {
+	broker *Broker
+}
+
+func (o statsObserver) OnProviderSelected(a Attempt)      { o.broker.Stats() }
+func (o statsObserver) OnSuccess(a Attempt)               { o.broker.Stats() }
+func (o statsObserver) OnError(a Attempt)                 { o.broker.Stats() }
+func (o statsObserver) OnNoProvider(ip string, err error) { o.broker.Stats() }
+
+func TestObserverOutsideLocks(t *testing.T) {
+	o := &statsObserver{}
+	b := NewBroker([]Provider{NewMockProvider("mock", 1, MockFailCalls(1, 1, nil))}, WithObserver(o))
+	defer b.Close()
+	o.broker = b
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 3 {
+			b.GetLocation(context.Background(), testIP(i))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lookups deadlocked with an observer reading the stats")
+	}
+}
+
+func TestLogObserver(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	b := NewBroker([]Provider{NewMockProvider("mock", 0)}, WithObserver(LogObserver{HashIPs: true}))
+	defer b.Close()
+	if _, err := b.GetLocation(context.Background(), "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "8.8.8.8") {
+		t.Errorf("log contains the address: %q", out)
+	}
+	if !strings.Contains(out, HashIP("8.8.8.8")) || !strings.Contains(out, "mock answered") {
+		t.Errorf("log lacks the hashed lookup: %q", out)
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import "time"
+
+// BrokerOption configures optional Broker behavior
+type BrokerOption func(*Broker)
+
+// retryPolicy controls how failed lookups are retried
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// WithRetry retries failed lookups up to maxAttempts times in total, sleeping
+// with exponential backoff and jitter between attempts. Provider selection is
+// re-run on every attempt.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) BrokerOption {
+	return func(b *Broker) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		b.retry = retryPolicy{
+			maxAttempts: maxAttempts,
+			baseDelay:   baseDelay,
+			maxDelay:    maxDelay,
+		}
+	}
+}
+
+// hedgePolicy controls when a slow lookup is duplicated to another provider
+type hedgePolicy struct {
+	delay     time.Duration
+	maxHedges int
+	// percentile, when set, takes the delay from the in-flight provider's
+	// response times instead, with delay used until it has any
+	percentile float64
+}
+
+// delayFor returns how long to wait for ps before hedging
+func (h hedgePolicy) delayFor(ps *ProviderStats) time.Duration {
+	if h.percentile > 0 {
+		if d, ok := ps.responseTimePercentile(h.percentile); ok {
+			return d
+		}
+	}
+	return h.delay
+}
+
+// WithHedging sends the same lookup to the next-best provider when the current
+// one hasn't answered within delay, up to maxHedges extra requests. The first
+// successful answer wins and the remaining requests are cancelled.
+func WithHedging(delay time.Duration, maxHedges int) BrokerOption {
+	return func(b *Broker) {
+		b.hedge = hedgePolicy{
+			delay:     delay,
+			maxHedges: maxHedges,
+		}
+	}
+}
+
+// WithHedgingPercentile is WithHedging with a delay that adapts to each
+// provider: the lookup is hedged once it has taken longer than the given
+// percentile, e.g. 95, of the provider's recent response times. delay is
+// used for a provider with no response times yet.
+func WithHedgingPercentile(percentile float64, delay time.Duration, maxHedges int) BrokerOption {
+	return func(b *Broker) {
+		b.hedge = hedgePolicy{
+			delay:      delay,
+			maxHedges:  maxHedges,
+			percentile: percentile,
+		}
+	}
+}
+
+// CallOption configures a single GetLocation call
+type CallOption func(*callOptions)
+
+// callOptions holds the per-call settings collected from CallOptions
+type callOptions struct {
+	race     bool
+	provider string
+	noCache  bool
+	refresh  bool
+}
+
+// WithRace sends the lookup to every provider with remaining capacity at once
+// and returns the first successful answer, cancelling the rest.
+func WithRace() CallOption {
+	return func(co *callOptions) {
+		co.race = true
+	}
+}
+
+// TieBreak decides which answer wins in consensus mode when no country has a
+// strict majority
+type TieBreak int
+
+const (
+	// TieBreakLowestErrorRate prefers the answer given by the provider with
+	// the fewest recent errors
+	TieBreakLowestErrorRate TieBreak = iota
+	// TieBreakBestRanked prefers the answer given by the highest-scored provider
+	TieBreakBestRanked
+)
+
+// consensusPolicy controls how many providers vote on a lookup
+type consensusPolicy struct {
+	voters   int
+	tieBreak TieBreak
+}
+
+// WithConsensus queries up to voters providers for every lookup and returns
+// the majority answer by country. Results are marked Disputed when the
+// providers disagree.
+func WithConsensus(voters int, tieBreak TieBreak) BrokerOption {
+	return func(b *Broker) {
+		b.consensus = consensusPolicy{
+			voters:   voters,
+			tieBreak: tieBreak,
+		}
+	}
+}
+
+// WithStrategy sets the strategy used to pick the provider for each lookup.
+// The default is a ScoreStrategy using the cold start settings.
+func WithStrategy(strategy SelectionStrategy) BrokerOption {
+	return func(b *Broker) {
+		b.strategy = strategy
+	}
+}
+
+// WithStatsWindow sets how far back errors are considered when scoring
+// providers in raw window mode. In the default EWMA mode the half-life is
+// half the window unless set with WithEWMAHalfLife. The default is 5 minutes.
+func WithStatsWindow(d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.statsWindow = d
+	}
+}
+
+// WithCleanupInterval starts a background sweep that prunes the stats of
+// every provider at the given interval until the broker is closed. Stats are
+// always pruned when a provider is used, so the sweep only matters for the
+// memory held by idle providers. It is off by default.
+func WithCleanupInterval(d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.cleanupInterval = d
+	}
+}
+
+// WithMaxResponseSamples sets the size of the ring buffer holding each
+// provider's most recent response times. The default is 100.
+func WithMaxResponseSamples(n int) BrokerOption {
+	return func(b *Broker) {
+		b.maxResponseSamples = n
+	}
+}
+
+// WithCircuitBreaker enables a per-provider circuit breaker that stops routing
+// to a failing provider for a cooldown period before probing it again
+func WithCircuitBreaker(config CircuitBreakerConfig) BrokerOption {
+	return func(b *Broker) {
+		b.breakerConfig = config
+	}
+}
+
+// probePolicy controls background health probes
+type probePolicy struct {
+	interval time.Duration
+	ip       string
+}
+
+// WithHealthProbes looks up ip on every enabled provider once per interval so
+// providers that haven't been selected recently still have fresh stats.
+// Probes count against each provider's rate limit.
+func WithHealthProbes(interval time.Duration, ip string) BrokerOption {
+	return func(b *Broker) {
+		b.probe = probePolicy{
+			interval: interval,
+			ip:       ip,
+		}
+	}
+}
+
+// WithProviderTimeout caps how long a single call to the named provider may
+// take, independent of the caller's deadline. A timed out call counts as an
+// error and the lookup fails over to the next provider.
+func WithProviderTimeout(name string, d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		if b.providerTimeouts == nil {
+			b.providerTimeouts = make(map[string]time.Duration)
+		}
+		b.providerTimeouts[name] = d
+	}
+}
+
+// WithProvider forces the lookup through the named provider, bypassing
+// selection and failover. The provider's rate limit still applies.
+func WithProvider(name string) CallOption {
+	return func(co *callOptions) {
+		co.provider = name
+	}
+}
+
+// WithProviderTier assigns the named provider to a priority tier. Providers
+// in lower tiers are always preferred; a higher tier is only used when no
+// provider in a lower tier is selectable. All providers default to tier 0.
+func WithProviderTier(name string, tier int) BrokerOption {
+	return func(b *Broker) {
+		if b.providerTiers == nil {
+			b.providerTiers = make(map[string]int)
+		}
+		b.providerTiers[name] = tier
+	}
+}
+
+// WithCostTier assigns the named provider to a cost tier. Within a priority
+// tier the broker prefers the cheapest cost tier whose providers clear the
+// quality bar set with WithQualityBar, escalating to dearer tiers only when
+// the cheaper providers are rate limited, quarantined or below the bar. All
+// providers default to CostTierFree.
+func WithCostTier(name string, tier CostTier) BrokerOption {
+	return func(b *Broker) {
+		if b.costTiers == nil {
+			b.costTiers = make(map[string]CostTier)
+		}
+		b.costTiers[name] = tier
+	}
+}
+
+// WithQualityBar sets the health a provider must show to be preferred over
+// providers in dearer cost tiers. Without one any selectable provider
+// qualifies.
+func WithQualityBar(bar QualityBar) BrokerOption {
+	return func(b *Broker) {
+		b.qualityBar = bar
+	}
+}
+
+// WithScoreFunc replaces the formula used to rate providers. The default is
+// DefaultScore.
+func WithScoreFunc(f ScoreFunc) BrokerOption {
+	return func(b *Broker) {
+		b.scoreFunc = f
+	}
+}
+
+// WithBlockOnRateLimit makes lookups wait for the earliest provider's rate
+// limit window to reset, instead of failing, when every provider is out of
+// capacity. The wait ends early with ErrAllProvidersRateLimited if the
+// caller's context is done.
+func WithBlockOnRateLimit(block bool) BrokerOption {
+	return func(b *Broker) {
+		b.blockOnRateLimit = block
+	}
+}
+
+// WithMaxInFlight caps the number of concurrent requests to the named
+// provider. By default excess requests spill over to the next provider; see
+// WithBulkheadWait.
+func WithMaxInFlight(name string, limit int) BrokerOption {
+	return func(b *Broker) {
+		if b.maxInFlight == nil {
+			b.maxInFlight = make(map[string]int)
+		}
+		b.maxInFlight[name] = limit
+	}
+}
+
+// WithBulkheadWait makes requests wait for a free concurrency slot on their
+// chosen provider instead of spilling over to the next one
+func WithBulkheadWait(wait bool) BrokerOption {
+	return func(b *Broker) {
+		b.bulkheadWait = wait
+	}
+}
+
+// WithProviderCost sets the price of a single lookup on the named provider.
+// Cost is used to prefer cheaper providers and to estimate daily spend.
+func WithProviderCost(name string, costPerRequest float64) BrokerOption {
+	return func(b *Broker) {
+		if b.providerCosts == nil {
+			b.providerCosts = make(map[string]float64)
+		}
+		b.providerCosts[name] = costPerRequest
+	}
+}
+
+// WithCostWeight sets how strongly cost counts against quality when ranking
+// providers. Zero ignores cost entirely; the default is 1.
+func WithCostWeight(weight float64) BrokerOption {
+	return func(b *Broker) {
+		b.costWeight = weight
+	}
+}
+
+// WithDailyQuota caps the number of requests sent to the named provider per
+// UTC day. Once the quota is used up the provider is skipped until midnight.
+func WithDailyQuota(name string, limit int) BrokerOption {
+	return func(b *Broker) {
+		if b.dailyQuotas == nil {
+			b.dailyQuotas = make(map[string]int)
+		}
+		b.dailyQuotas[name] = limit
+	}
+}
+
+// WithMonthlyQuota caps the number of requests the named provider answers
+// per billing month, for services such as ipstack whose free tier is limited
+// per month. The month starts at midnight UTC on resetDay (1-31, the last day
+// for shorter months). The provider is not selected once the quota is used
+// up. Use WithQuotaStateFile to keep the count across restarts.
+func WithMonthlyQuota(name string, limit, resetDay int) BrokerOption {
+	return func(b *Broker) {
+		if b.monthlyQuotas == nil {
+			b.monthlyQuotas = make(map[string]monthlyQuota)
+		}
+		b.monthlyQuotas[name] = monthlyQuota{limit: limit, resetDay: resetDay}
+	}
+}
+
+// WithQuotaStateFile keeps monthly quota usage in the JSON file at path so
+// it survives restarts. The file is rewritten at most once a second and on
+// Shutdown; an unreadable file is logged and usage starts from zero.
+func WithQuotaStateFile(path string) BrokerOption {
+	return func(b *Broker) {
+		b.quotaState = &quotaStateFile{path: path}
+	}
+}
+
+// WithBurst sets how many requests the named provider may receive in a
+// burst. Its rate limit refills continuously at GetMaxRequestsPerMinute per
+// minute; the default burst size equals that limit.
+func WithBurst(name string, burst int) BrokerOption {
+	return func(b *Broker) {
+		if b.bursts == nil {
+			b.bursts = make(map[string]int)
+		}
+		b.bursts[name] = burst
+	}
+}
+
+// WithRateLimiter uses l to rate limit the named provider instead of the
+// limiter built by the default factory
+func WithRateLimiter(name string, l RateLimiter) BrokerOption {
+	return func(b *Broker) {
+		if b.limiters == nil {
+			b.limiters = make(map[string]RateLimiter)
+		}
+		b.limiters[name] = l
+	}
+}
+
+// WithRateLimiterFactory sets how rate limiters are built for providers that
+// have no limiter set with WithRateLimiter. The factory receives the
+// provider's GetMaxRequestsPerMinute and its burst size from WithBurst.
+// The default builds a TokenBucketLimiter.
+func WithRateLimiterFactory(factory func(maxPerMinute, burst int) RateLimiter) BrokerOption {
+	return func(b *Broker) {
+		b.limiterFactory = factory
+	}
+}
+
+// WithBatchConcurrency sets how many lookups GetLocations runs at once.
+// The default is 8.
+func WithBatchConcurrency(n int) BrokerOption {
+	return func(b *Broker) {
+		if n < 1 {
+			n = 1
+		}
+		b.batchConcurrency = n
+	}
+}
+
+// WithBatchCountPerIP counts every IP in a request to a BatchProvider
+// against the provider's rate limit and cost, for services that bill batch
+// lookups per address. By default a batch request counts once. Daily and
+// monthly quotas always count every IP.
+func WithBatchCountPerIP() BrokerOption {
+	return func(b *Broker) {
+		b.batchCountPerIP = true
+	}
+}
+
+// WithEWMAHalfLife sets how quickly the moving averages used for scoring
+// forget old samples. The default is half the stats window.
+func WithEWMAHalfLife(d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.ewmaHalfLife = d
+	}
+}
+
+// WithRawStatsWindow scores providers from the exact errors and response
+// times recorded in the stats window instead of moving averages. Stats
+// reports both either way.
+func WithRawStatsWindow() BrokerOption {
+	return func(b *Broker) {
+		b.rawStatsWindow = true
+	}
+}
+
+// coldStartPolicy controls how providers without much history are treated
+type coldStartPolicy struct {
+	minSamples   int
+	epsilon      float64
+	priorLatency time.Duration
+}
+
+// WithColdStart tunes how the default strategy handles providers with fewer
+// than minSamples completed requests: they receive an epsilon share of
+// traffic through exploration instead of competing on score, and until they
+// have any samples they are scored as if their latency were priorLatency.
+// The defaults are 5 samples, 0.05 and 250ms. An epsilon of zero disables
+// exploration.
+func WithColdStart(minSamples int, epsilon float64, priorLatency time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.coldStart = coldStartPolicy{
+			minSamples:   minSamples,
+			epsilon:      epsilon,
+			priorLatency: priorLatency,
+		}
+	}
+}
+
+// WithQuarantine excludes providers whose error rate or score over the stats
+// window falls below the configured health floor. They are re-admitted after
+// a cooldown, or earlier when a health probe succeeds.
+func WithQuarantine(config QuarantineConfig) BrokerOption {
+	return func(b *Broker) {
+		b.quarantineConfig = config
+	}
+}
+
+// WithObserver registers o to receive an event for every provider attempt.
+// It may be given more than once; observers are called in the order they
+// were registered.
+func WithObserver(o Observer) BrokerOption {
+	return func(b *Broker) {
+		b.observers = append(b.observers, o)
+	}
+}
+
+// WithCache caches successful lookups in memory for ttl, keyed by IP, holding
+// up to maxEntries results and evicting the least recently used. Cache hits
+// don't count against provider rate limits or stats.
+func WithCache(maxEntries int, ttl time.Duration) BrokerOption {
+	return WithCacheStore(NewLRUCache(maxEntries), ttl)
+}
+
+// WithMemoryCache caches successful lookups in memory for ttl within the
+// given limits, such as a byte budget or LFU eviction
+func WithMemoryCache(config MemoryCacheConfig, ttl time.Duration) BrokerOption {
+	return WithCacheStore(NewMemoryCache(config), ttl)
+}
+
+// WithCacheStore caches successful lookups in c for ttl. Errors from c are
+// treated as misses so a failing store never fails a lookup.
+func WithCacheStore(c Cache, ttl time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.cache = c
+		b.cacheTTL = ttl
+	}
+}
+
+// WithNegativeCache remembers lookups that failed on every provider for ttl
+// and fails repeated requests for the same IP immediately with an error
+// wrapping ErrCachedFailure. Rate limits, timeouts and other transient
+// failures are never remembered. A ttl of zero or less disables it, which is
+// the default.
+func WithNegativeCache(ttl time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.negative = nil
+		if ttl > 0 {
+			b.negative = newNegativeCache(ttl)
+		}
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving cached results for grace after
+// their TTL has passed. Such results are marked Stale and trigger a single
+// background refresh per IP; an IP whose refresh fails is not refreshed again
+// for a while.
+func WithStaleWhileRevalidate(grace time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.staleGrace = grace
+	}
+}
+
+// NoCache skips reading the cache for this lookup. A successful result is
+// still written back.
+func NoCache() CallOption {
+	return func(co *callOptions) {
+		co.noCache = true
+	}
+}
+
+// RefreshCache forces a live lookup that overwrites the cached result, even
+// if it is still fresh, and forgets any remembered failure for the IP. It
+// never shares a lookup that was already in flight when it was made.
+func RefreshCache() CallOption {
+	return func(co *callOptions) {
+		co.noCache = true
+		co.refresh = true
+	}
+}
+
+// WithCacheTTLFunc decides the cache TTL of each result with f instead of
+// using the single TTL given to WithCache or WithCacheStore. Results for
+// which f returns zero are not cached.
+func WithCacheTTLFunc(f CacheTTLFunc) BrokerOption {
+	return func(b *Broker) {
+		b.cacheTTLFunc = f
+	}
+}
+
+// WithPrefixCaching caches results per network prefix instead of per
+// address: an IPv4 lookup is cached for its containing /v4Bits and an IPv6
+// lookup for its /v6Bits, so neighbouring addresses share one entry. This
+// raises the hit rate at the cost of accuracy, since addresses in the same
+// prefix can geolocate differently. Zero keeps exact-address caching for
+// that family, which is the default. Typical values are 24 and 48.
+func WithPrefixCaching(v4Bits, v6Bits int) BrokerOption {
+	return func(b *Broker) {
+		b.prefixBitsV4 = v4Bits
+		b.prefixBitsV6 = v6Bits
+	}
+}
+
+// WithConfidenceRules replaces DefaultConfidenceRules in deciding the
+// Confidence of results
+func WithConfidenceRules(rules ConfidenceRules) BrokerOption {
+	return func(b *Broker) {
+		b.confidence = rules
+	}
+}
+
+// WithValidationRules replaces the rules every provider result is checked
+// against, DefaultValidationRules unless set. A result failing any rule is
+// rejected with ErrBadProviderData and the next provider is tried. Calling it
+// without rules turns the checks off, though results are still sanitized and
+// a provider returning neither a result nor an error is still rejected.
+func WithValidationRules(rules ...ValidationRule) BrokerOption {
+	return func(b *Broker) {
+		b.validationRules = rules
+	}
+}
+
+// WithReservedIPs sets what lookups of private, loopback and other reserved
+// addresses do, ReservedIPReject unless set
+func WithReservedIPs(policy ReservedIPPolicy) BrokerOption {
+	return func(b *Broker) {
+		b.reservedIPs = policy
+	}
+}
+
+// WithEchoInputIP reports the IP exactly as the caller passed it in
+// Location.IP. By default results carry the canonical form of the address
+// that was looked up.
+func WithEchoInputIP() BrokerOption {
+	return func(b *Broker) {
+		b.echoInputIP = true
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewBrokerDefaults(t *testing.T) {
+	b := NewBroker([]Provider{NewMockProvider("mock", 0)})
+	defer b.Close()
+
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.StatsWindow != 5*time.Minute {
+		t.Errorf("stats window %v, want 5m", snap.StatsWindow)
+	}
+	if b.maxResponseSamples != 100 {
+		t.Errorf("response sample cap %d, want 100", b.maxResponseSamples)
+	}
+	if b.cleanupInterval != 0 {
+		t.Errorf("cleanup sweep every %v, want none", b.cleanupInterval)
+	}
+}
+
+// failThenSucceed makes the provider fail three lookups and then, once
+// window has passed, succeed at one, and returns its snapshot after each
+func failThenSucceed(t *testing.T, window time.Duration, opts ...BrokerOption) (failed, succeeded ProviderSnapshot) {
+	t.Helper()
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 3, nil))
+	b := NewBroker([]Provider{p}, append(opts, WithStatsWindow(window))...)
+	defer b.Close()
+	ctx := context.Background()
+
+	for i := range 3 {
+		if _, err := b.GetLocation(ctx, testIP(i)); err == nil {
+			t.Fatal("scripted failure succeeded")
+		}
+	}
+	failed, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(window + 20*time.Millisecond)
+	if _, err := b.GetLocation(ctx, testIP(3)); err != nil {
+		t.Fatal(err)
+	}
+	succeeded, err = b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return failed, succeeded
+}
+
+func TestWithStatsWindow(t *testing.T) {
+	window := 100 * time.Millisecond
+
+	t.Run("raw window", func(t *testing.T) {
+		failed, succeeded := failThenSucceed(t, window, WithRawStatsWindow())
+		if failed.ErrorsInWindow != 3 || failed.ErrorRate != 1 {
+			t.Errorf("after the failures: %d errors, rate %v; want 3, 1", failed.ErrorsInWindow, failed.ErrorRate)
+		}
+		if succeeded.ErrorsInWindow != 0 || succeeded.ErrorRate != 0 {
+			t.Errorf("after the window: %d errors, rate %v; want none", succeeded.ErrorsInWindow, succeeded.ErrorRate)
+		}
+	})
+
+	// The moving average's half-life is half the window, so by the time
+	// the success is recorded the three errors weigh less than it does
+	t.Run("moving average", func(t *testing.T) {
+		failed, succeeded := failThenSucceed(t, window)
+		if failed.ErrorRate < 0.99 {
+			t.Errorf("after the failures: rate %v, want 1", failed.ErrorRate)
+		}
+		if succeeded.ErrorRate >= 0.5 {
+			t.Errorf("after the window: rate %v, want below 0.5", succeeded.ErrorRate)
+		}
+	})
+}
+
+func TestWithStatsWindowScoring(t *testing.T) {
+	window := 100 * time.Millisecond
+	recovered := NewMockProvider("recovered", 0, MockFailCalls(1, 3, nil), MockLatency(time.Millisecond))
+	steady := NewMockProvider("steady", 0, MockLatency(5*time.Millisecond))
+	b := NewBroker([]Provider{recovered, steady},
+		WithStatsWindow(window), WithRawStatsWindow(), WithStrategy(&ScoreStrategy{}))
+	defer b.Close()
+
+	for i := range 3 {
+		if _, err := b.GetLocationFrom(context.Background(), "recovered", testIP(i)); err == nil {
+			t.Fatal("scripted failure succeeded")
+		}
+	}
+	if ps := b.selectBestProvider(testIP(3)); ps.provider.Name() != "steady" {
+		t.Errorf("%s selected right after recovered's failures, want steady", ps.provider.Name())
+	}
+
+	// Once the errors are older than the window only the faster response
+	// times count
+	time.Sleep(window + 20*time.Millisecond)
+	if ps := b.selectBestProvider(testIP(3)); ps.provider.Name() != "recovered" {
+		t.Errorf("%s selected after the window, want recovered", ps.provider.Name())
+	}
+}
+
+func TestWithMaxResponseSamples(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockLatencyFunc(func(call int) time.Duration {
+		if call <= 5 {
+			return 20 * time.Millisecond
+		}
+		return 0
+	}))
+	b := NewBroker([]Provider{p}, WithMaxResponseSamples(3))
+	defer b.Close()
+
+	for i := range 8 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the last three, fast, samples are kept
+	if snap.MaxResponseTime >= 20*time.Millisecond {
+		t.Errorf("max response time %v; slow samples beyond the cap were kept", snap.MaxResponseTime)
+	}
+}
+
+// recordedErrors returns how many error timestamps the provider still holds,
+// pruned or not
+func recordedErrors(ps *ProviderStats) int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return len(ps.errorsInLast5Min)
+}
+
+func TestLazyPruning(t *testing.T) {
+	window := 50 * time.Millisecond
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 2, nil))
+	b := NewBroker([]Provider{p}, WithStatsWindow(window), WithRawStatsWindow())
+	defer b.Close()
+	ps := b.providers[0]
+
+	for i := range 2 {
+		b.GetLocation(context.Background(), testIP(i))
+	}
+	time.Sleep(window + 20*time.Millisecond)
+
+	// Without a sweep, expired errors linger but no longer count
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.ErrorsInWindow != 0 || snap.ErrorRate != 0 {
+		t.Errorf("%d errors, rate %v after the window; want none", snap.ErrorsInWindow, snap.ErrorRate)
+	}
+	if n := recordedErrors(ps); n != 2 {
+		t.Fatalf("%d errors held before the provider was touched, want 2", n)
+	}
+
+	// The next request prunes them
+	if _, err := b.GetLocation(context.Background(), testIP(2)); err != nil {
+		t.Fatal(err)
+	}
+	if n := recordedErrors(ps); n != 0 {
+		t.Errorf("%d errors held after a request, want 0", n)
+	}
+}
+
+func TestWithCleanupInterval(t *testing.T) {
+	window := 50 * time.Millisecond
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 2, nil))
+	b := NewBroker([]Provider{p}, WithStatsWindow(window), WithCleanupInterval(10*time.Millisecond))
+	defer b.Close()
+
+	for i := range 2 {
+		b.GetLocation(context.Background(), testIP(i))
+	}
+	// The sweep prunes the idle provider
+	deadline := time.Now().Add(time.Second)
+	for recordedErrors(b.providers[0]) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := recordedErrors(b.providers[0]); n != 0 {
+		t.Errorf("%d errors held by an idle provider after the sweep, want 0", n)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// probeStats tracks health probe traffic separately from organic lookups.
+// It is guarded by the owning ProviderStats' mutex.
+type probeStats struct {
+	successes   int
+	failures    int
+	lastProbeAt time.Time
+	lastErr     error
+}
+
+// record tallies the outcome of a single probe
+func (p *probeStats) record(err error) {
+	p.lastProbeAt = time.Now()
+	p.lastErr = err
+	if err != nil {
+		p.failures++
+	} else {
+		p.successes++
+	}
+}
+
+// healthProbeRoutine probes every provider once per interval until the
+// broker is closed
+func (b *Broker) healthProbeRoutine() {
+	ticker := time.NewTicker(b.probe.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.probeProviders()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// probeProviders sends one probe to each enabled provider with capacity left
+// and refreshes the capacity of every enabled provider that can be asked
+func (b *Broker) probeProviders() {
+	// Cancel outstanding probes if the broker closes or the next round is due
+	ctx, cancel := context.WithTimeout(context.Background(), b.probe.interval)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	b.providerMutex.RLock()
+	providers := b.providers
+	b.providerMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, ps := range providers {
+		ps.mutex.RLock()
+		active := ps.enabled && !ps.draining
+		skip := !active || !ps.hasCapacity() || !ps.quotaAvailable(time.Now())
+		ps.mutex.RUnlock()
+
+		if refresher, ok := asProvider[CapacityRefresher](ps.provider); ok && active {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if err := refresher.RefreshCapacity(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("refreshing capacity of %s: %v", name, err)
+				}
+			}(ps.provider.Name())
+		}
+		if skip {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ps *ProviderStats) {
+			defer wg.Done()
+			b.doCall(ctx, ps, b.probe.ip, true)
+		}(ps)
+	}
+	wg.Wait()
+}
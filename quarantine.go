@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// QuarantineConfig sets the minimum health a provider must keep to stay in
+// rotation. Unlike the circuit breaker, which reacts to consecutive failures,
+// quarantine looks at the provider's error rate and score over the stats
+// window. A zero threshold disables that check.
+type QuarantineConfig struct {
+	// MaxErrorRate quarantines a provider once the fraction of its recent
+	// requests that failed exceeds this value
+	MaxErrorRate float64
+	// MinScore quarantines a provider whose score drops below this value
+	MinScore float64
+	// MinSamples is the number of completed requests needed before the
+	// provider can be judged
+	MinSamples int
+	// Cooldown is how long a provider stays quarantined unless a health
+	// probe succeeds first
+	Cooldown time.Duration
+}
+
+// quarantine holds a provider's quarantine state. It is guarded by the
+// owning ProviderStats' mutex.
+type quarantine struct {
+	config QuarantineConfig
+	until  time.Time
+}
+
+// quarantinedAt reports whether the provider is quarantined at now,
+// re-admitting it once the cooldown has passed. The caller must hold
+// ps.mutex for writing.
+func (ps *ProviderStats) quarantinedAt(now time.Time) bool {
+	q := &ps.quarantine
+	if q.until.IsZero() {
+		return false
+	}
+	if now.Before(q.until) {
+		return true
+	}
+	ps.readmit("cooldown elapsed")
+	return false
+}
+
+// checkErrorRate quarantines the provider if its error rate is above the
+// configured maximum. The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) checkErrorRate() {
+	cfg := ps.quarantine.config
+	if cfg.MaxErrorRate <= 0 || ps.completedRequests < cfg.MinSamples {
+		return
+	}
+	if rate := ps.errorRate(); rate > cfg.MaxErrorRate {
+		ps.quarantineFor("error rate too high")
+	}
+}
+
+// checkScore quarantines the provider if score is below the configured
+// minimum and reports whether it did
+func (ps *ProviderStats) checkScore(score float64) bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	cfg := ps.quarantine.config
+	if cfg.MinScore <= 0 || ps.completedRequests < cfg.MinSamples || score >= cfg.MinScore {
+		return false
+	}
+	ps.quarantineFor("score too low")
+	return true
+}
+
+// authQuarantine is the shortest quarantine for a provider that rejected
+// our credentials, which won't fix themselves quickly
+const authQuarantine = 10 * time.Minute
+
+// quarantineFor takes the provider out of rotation for the cooldown.
+// The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) quarantineFor(reason string) {
+	ps.quarantineUntil(reason, time.Now().Add(ps.quarantine.config.Cooldown))
+}
+
+// quarantineAuth takes the provider out of rotation after it rejected our
+// credentials, whatever the configured thresholds. The caller must hold
+// ps.mutex for writing.
+func (ps *ProviderStats) quarantineAuth() {
+	cooldown := max(ps.quarantine.config.Cooldown, authQuarantine)
+	ps.quarantineUntil("credentials rejected", time.Now().Add(cooldown))
+}
+
+// quarantineUntil quarantines the provider until the given time unless it is
+// already quarantined. The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) quarantineUntil(reason string, until time.Time) {
+	if !ps.quarantine.until.IsZero() {
+		return
+	}
+	log.Printf("quarantining %s: %s", ps.provider.Name(), reason)
+	ps.quarantine.until = until
+}
+
+// readmit puts a quarantined provider back into rotation. Its error history
+// is cleared so it is judged on fresh evidence rather than being quarantined
+// again straight away. The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) readmit(reason string) {
+	if ps.quarantine.until.IsZero() {
+		return
+	}
+	log.Printf("re-admitting %s: %s", ps.provider.Name(), reason)
+	ps.quarantine.until = time.Time{}
+	ps.errorsInLast5Min = ps.errorsInLast5Min[:0]
+	ps.requestsInWindow = ps.requestsInWindow[:0]
+	ps.errorEWMA = ewma{}
+	ps.completedRequests = 0
+}
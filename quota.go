@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// utcDay returns the start of the UTC day containing t
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// dailyQuota counts requests per UTC day against an optional cap. It is
+// guarded by the owning ProviderStats' mutex. The day rolls over lazily, so
+// the count is correct at midnight without any background work.
+type dailyQuota struct {
+	limit int
+	day   time.Time
+	used  int
+}
+
+// use records one request made at now
+func (q *dailyQuota) use(now time.Time) {
+	if day := utcDay(now); !day.Equal(q.day) {
+		q.day = day
+		q.used = 0
+	}
+	q.used++
+}
+
+// usedOn returns the number of requests made on the UTC day containing now
+func (q *dailyQuota) usedOn(now time.Time) int {
+	if !utcDay(now).Equal(q.day) {
+		return 0
+	}
+	return q.used
+}
+
+// remaining returns how many requests are left today, or 0 when the quota
+// is unlimited
+func (q *dailyQuota) remaining(now time.Time) int {
+	if q.limit <= 0 {
+		return 0
+	}
+	if left := q.limit - q.usedOn(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// available reports whether another request fits in today's quota
+func (q *dailyQuota) available(now time.Time) bool {
+	return q.fits(1, now)
+}
+
+// fits reports whether n more requests fit in today's quota
+func (q *dailyQuota) fits(n int, now time.Time) bool {
+	return q.limit <= 0 || q.usedOn(now)+n <= q.limit
+}
+
+// monthlyQuotaWarning is the share of a monthly quota whose use is reported
+// to QuotaObservers
+const monthlyQuotaWarning = 0.9
+
+// quotaSaveInterval is how often at most the quota state file is rewritten
+// while lookups are running
+const quotaSaveInterval = time.Second
+
+// monthlyQuota counts answered requests per billing month against a cap. A
+// month starts at midnight UTC on resetDay, or on the last day of months too
+// short to have it. It is guarded by the owning ProviderStats' mutex and,
+// like dailyQuota, rolls over lazily.
+type monthlyQuota struct {
+	limit    int
+	resetDay int
+	period   time.Time
+	used     int
+	warned   bool
+}
+
+// resetDate returns midnight UTC on day of the given month, clamped to the
+// month's length. month may be out of range, as with time.Date.
+func resetDate(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(max(day, 1), last)-1)
+}
+
+// periodStart returns the start of the billing month containing t
+func (q *monthlyQuota) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	start := resetDate(t.Year(), t.Month(), q.resetDay)
+	if t.Before(start) {
+		start = resetDate(t.Year(), t.Month()-1, q.resetDay)
+	}
+	return start
+}
+
+// resetsAt returns when the billing month containing now ends
+func (q *monthlyQuota) resetsAt(now time.Time) time.Time {
+	start := q.periodStart(now)
+	return resetDate(start.Year(), start.Month()+1, q.resetDay)
+}
+
+// roll starts a new billing month once the current one has ended
+func (q *monthlyQuota) roll(now time.Time) {
+	if period := q.periodStart(now); !period.Equal(q.period) {
+		q.period = period
+		q.used = 0
+		q.warned = false
+	}
+}
+
+// use records n answered requests at now. It reports whether they took the
+// month's usage past the warning threshold.
+func (q *monthlyQuota) use(now time.Time, n int) bool {
+	if q.limit <= 0 {
+		return false
+	}
+	q.roll(now)
+	q.used += n
+	if !q.warned && float64(q.used) >= monthlyQuotaWarning*float64(q.limit) {
+		q.warned = true
+		return true
+	}
+	return false
+}
+
+// usedIn returns the number of requests counted in the billing month
+// containing now
+func (q *monthlyQuota) usedIn(now time.Time) int {
+	if !q.periodStart(now).Equal(q.period) {
+		return 0
+	}
+	return q.used
+}
+
+// remaining returns how many requests are left this month, or 0 when the
+// quota is unlimited
+func (q *monthlyQuota) remaining(now time.Time) int {
+	if q.limit <= 0 {
+		return 0
+	}
+	return max(q.limit-q.usedIn(now), 0)
+}
+
+// available reports whether another request fits in this month's quota
+func (q *monthlyQuota) available(now time.Time) bool {
+	return q.fits(1, now)
+}
+
+// fits reports whether n more requests fit in this month's quota
+func (q *monthlyQuota) fits(n int, now time.Time) bool {
+	return q.limit <= 0 || q.usedIn(now)+n <= q.limit
+}
+
+// quotaAvailable reports whether the provider has daily and monthly quota
+// left. The caller must hold ps.mutex.
+func (ps *ProviderStats) quotaAvailable(now time.Time) bool {
+	return ps.quotaFits(1, now)
+}
+
+// quotaFits reports whether n more lookups fit in the provider's daily and
+// monthly quotas. The caller must hold ps.mutex.
+func (ps *ProviderStats) quotaFits(n int, now time.Time) bool {
+	return ps.daily.fits(n, now) && ps.monthly.fits(n, now)
+}
+
+// exhaustMonthlyQuota marks the provider's monthly quota used up after its
+// service said so, so it isn't selected again before the quota resets. It
+// reports false if the provider has no monthly quota configured. The caller
+// must hold ps.mutex for writing.
+func (ps *ProviderStats) exhaustMonthlyQuota(now time.Time) bool {
+	if ps.monthly.limit <= 0 {
+		return false
+	}
+	ps.monthly.roll(now)
+	if ps.monthly.used < ps.monthly.limit {
+		ps.monthly.used = ps.monthly.limit
+		log.Printf("%s reports its monthly quota used up; not selecting it until %s", ps.provider.Name(), ps.monthly.resetsAt(now).Format(time.DateOnly))
+	}
+	return true
+}
+
+// QuotaObserver can be implemented by an Observer to be warned before a
+// provider's monthly quota runs out
+type QuotaObserver interface {
+	// OnMonthlyQuotaWarning is called once per billing month when a
+	// provider has used 90% of its monthly quota
+	OnMonthlyQuotaWarning(provider string, used, limit int)
+}
+
+// useMonthlyQuota counts n requests answered by ps against its monthly
+// quota, persisting the count and warning observers as needed
+func (b *Broker) useMonthlyQuota(ps *ProviderStats, n int) {
+	ps.mutex.Lock()
+	if ps.monthly.limit <= 0 {
+		ps.mutex.Unlock()
+		return
+	}
+	crossed := ps.monthly.use(time.Now(), n)
+	used, limit := ps.monthly.used, ps.monthly.limit
+	ps.mutex.Unlock()
+
+	b.quotaState.changed(b, false)
+	if crossed {
+		name := ps.provider.Name()
+		b.observe(func(o Observer) {
+			if qo, ok := o.(QuotaObserver); ok {
+				qo.OnMonthlyQuotaWarning(name, used, limit)
+			}
+		})
+	}
+}
+
+// quotaStateFile persists monthly quota usage so it survives restarts. The
+// file holds one JSON object mapping provider names to their usage.
+type quotaStateFile struct {
+	path      string
+	mutex     sync.Mutex
+	lastSaved time.Time
+	dirty     bool
+}
+
+// quotaUsage is a provider's entry in the quota state file
+type quotaUsage struct {
+	Period time.Time `json:"period"`
+	Used   int       `json:"used"`
+}
+
+// load restores monthly usage from the file. Entries for a billing month
+// other than the one containing now are ignored. A missing file is not an
+// error.
+func (f *quotaStateFile) load(b *Broker, now time.Time) error {
+	buf, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state map[string]quotaUsage
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return err
+	}
+
+	for _, ps := range b.providers {
+		usage, ok := state[ps.provider.Name()]
+		if !ok || ps.monthly.limit <= 0 || !usage.Period.Equal(ps.monthly.periodStart(now)) {
+			continue
+		}
+		ps.mutex.Lock()
+		ps.monthly.period = usage.Period
+		ps.monthly.used = usage.Used
+		ps.monthly.warned = float64(usage.Used) >= monthlyQuotaWarning*float64(ps.monthly.limit)
+		ps.mutex.Unlock()
+	}
+	return nil
+}
+
+// changed notes that usage has changed and saves it, at most once per
+// quotaSaveInterval unless force is set. Failures are logged; counting goes
+// on in memory.
+func (f *quotaStateFile) changed(b *Broker, force bool) {
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.dirty = true
+	if !force && time.Since(f.lastSaved) < quotaSaveInterval {
+		return
+	}
+	if err := f.save(b); err != nil {
+		log.Printf("saving quota state to %s: %v", f.path, err)
+		return
+	}
+	f.lastSaved = time.Now()
+	f.dirty = false
+}
+
+// flush saves any usage not yet written. It is called on shutdown.
+func (f *quotaStateFile) flush(b *Broker) {
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	dirty := f.dirty
+	f.mutex.Unlock()
+	if dirty {
+		f.changed(b, true)
+	}
+}
+
+// save writes the usage of every provider with a monthly quota, replacing
+// the file atomically. The caller must hold f.mutex.
+func (f *quotaStateFile) save(b *Broker) error {
+	b.providerMutex.RLock()
+	state := make(map[string]quotaUsage)
+	for _, ps := range b.providers {
+		ps.mutex.RLock()
+		if ps.monthly.limit > 0 && !ps.monthly.period.IsZero() {
+			state[ps.provider.Name()] = quotaUsage{Period: ps.monthly.period, Used: ps.monthly.used}
+		}
+		ps.mutex.RUnlock()
+	}
+	b.providerMutex.RUnlock()
+
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMonthlyQuotaPeriod(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		resetDay  int
+		now       time.Time
+		wantStart time.Time
+		wantReset time.Time
+	}{
+		{1, date(2024, 3, 15), date(2024, 3, 1), date(2024, 4, 1)},
+		{15, date(2024, 3, 10), date(2024, 2, 15), date(2024, 3, 15)},
+		{15, date(2024, 3, 15), date(2024, 3, 15), date(2024, 4, 15)},
+		{15, date(2024, 1, 3), date(2023, 12, 15), date(2024, 1, 15)},
+		// Months too short for the reset day reset on their last day
+		{31, date(2024, 2, 20), date(2024, 1, 31), date(2024, 2, 29)},
+		{31, date(2024, 2, 29), date(2024, 2, 29), date(2024, 3, 31)},
+		{31, date(2023, 2, 28), date(2023, 2, 28), date(2023, 3, 31)},
+		{30, date(2024, 3, 30).Add(-time.Nanosecond), date(2024, 2, 29), date(2024, 3, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.now.Format(time.RFC3339Nano), func(t *testing.T) {
+			q := monthlyQuota{limit: 10, resetDay: tt.resetDay}
+			if got := q.periodStart(tt.now); !got.Equal(tt.wantStart) {
+				t.Errorf("reset day %d: period starts %v, want %v", tt.resetDay, got, tt.wantStart)
+			}
+			if got := q.resetsAt(tt.now); !got.Equal(tt.wantReset) {
+				t.Errorf("reset day %d: resets at %v, want %v", tt.resetDay, got, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestMonthlyQuotaRollover(t *testing.T) {
+	q := monthlyQuota{limit: 10, resetDay: 15}
+	now := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	if q.use(now, 8) {
+		t.Error("warned at 80% of the quota")
+	}
+	if !q.use(now, 1) {
+		t.Error("no warning on reaching 90% of the quota")
+	}
+	if !q.fits(1, now) || q.fits(2, now) {
+		t.Errorf("with 9 of 10 used: fits 1 %v, fits 2 %v; want true, false", q.fits(1, now), q.fits(2, now))
+	}
+	if q.use(now, 1) {
+		t.Error("warned twice in one month")
+	}
+
+	// Used up until the last moment of the billing month
+	lastMoment := time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+	if q.available(lastMoment) || q.remaining(lastMoment) != 0 {
+		t.Errorf("at %v: available %v with %d remaining, want the quota used up", lastMoment, q.available(lastMoment), q.remaining(lastMoment))
+	}
+
+	// The next month starts afresh, warning again
+	next := lastMoment.Add(time.Nanosecond)
+	if !q.available(next) || q.remaining(next) != 10 {
+		t.Errorf("at %v: available %v with %d remaining, want a fresh quota", next, q.available(next), q.remaining(next))
+	}
+	if !q.use(next, 9) {
+		t.Error("no warning on reaching 90% in the new month")
+	}
+	if got := q.usedIn(next); got != 9 {
+		t.Errorf("%d used in the new month, want 9", got)
+	}
+	if got := q.usedIn(lastMoment); got != 0 {
+		t.Errorf("%d used in the previous month after the rollover, want 0", got)
+	}
+}
+
+func TestQuotaStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	opts := []BrokerOption{WithMonthlyQuota("mock", 100, 1), WithQuotaStateFile(path)}
+	ctx := context.Background()
+
+	b := NewBroker([]Provider{NewMockProvider("mock", 0)}, opts...)
+	for i := range 3 {
+		if _, err := b.GetLocation(ctx, testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted broker carries on from the saved usage
+	restarted := NewBroker([]Provider{NewMockProvider("mock", 0)}, opts...)
+	defer restarted.Close()
+	snap, err := restarted.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.MonthlyRemaining != 97 {
+		t.Errorf("%d remaining after a restart, want 97", snap.MonthlyRemaining)
+	}
+
+	// Usage saved in an earlier billing month is not restored
+	file := &quotaStateFile{path: path}
+	tests := []struct {
+		name     string
+		now      time.Time
+		wantUsed int
+	}{
+		{"same month", time.Now(), 3},
+		{"next month", time.Now().AddDate(0, 1, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fresh := NewBroker([]Provider{NewMockProvider("mock", 0)}, WithMonthlyQuota("mock", 100, 1))
+			defer fresh.Close()
+			if err := file.load(fresh, tt.now); err != nil {
+				t.Fatal(err)
+			}
+			if got := fresh.findProvider("mock").monthly.usedIn(tt.now); got != tt.wantUsed {
+				t.Errorf("%d used, want %d", got, tt.wantUsed)
+			}
+		})
+	}
+
+	// A corrupt file is reported and leaves usage at zero
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewBroker([]Provider{NewMockProvider("mock", 0)}, WithMonthlyQuota("mock", 100, 1))
+	defer fresh.Close()
+	if err := file.load(fresh, time.Now()); err == nil {
+		t.Error("loaded a corrupt state file")
+	}
+	if got := fresh.findProvider("mock").monthly.usedIn(time.Now()); got != 0 {
+		t.Errorf("%d used after a corrupt state file, want 0", got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// raceResult is the outcome of a single racing provider call
+type raceResult struct {
+	provider string
+	location *Location
+	err      error
+}
+
+// lookupRace queries all candidates concurrently and returns the first
+// successful answer. Losing calls are cancelled with errLostRace, so they
+// don't count as errors against the provider.
+func (b *Broker) lookupRace(ctx context.Context, ip string, candidates []*ProviderStats) (*Location, error) {
+	raceCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errLostRace)
+
+	// Buffered so losing calls can finish after we've returned
+	results := make(chan raceResult, len(candidates))
+	for _, ps := range candidates {
+		go func(ps *ProviderStats) {
+			location, err := b.callProvider(raceCtx, ps, ip)
+			results <- raceResult{provider: ps.provider.Name(), location: location, err: err}
+		}(ps)
+	}
+
+	errs := make([]error, 0, len(candidates))
+	for range candidates {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.location, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.provider, r.err))
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("all %d providers failed: %w", len(candidates), errors.Join(errs...))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRaceFastestSuccessWins(t *testing.T) {
+	fast := NewMockProvider("fast", 0, MockLatency(10*time.Millisecond))
+	failing := NewMockProvider("failing", 0, MockFailCalls(1, 1, ErrProviderUnavailable))
+	slow := []*blockingProvider{newBlockingProvider("slow1"), newBlockingProvider("slow2")}
+	b := NewBroker([]Provider{slow[0], failing, fast, slow[1]})
+	defer b.Close()
+
+	start := time.Now()
+	loc, err := b.GetLocation(context.Background(), testIP(1), WithRace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "fast" {
+		t.Errorf("served by %s, want fast", loc.Provider)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("answered after %v, waited for the slow providers", elapsed)
+	}
+
+	// Every provider was called and the slow ones were cancelled without
+	// counting as errors
+	for _, p := range []*MockProvider{fast, failing, slow[0].MockProvider, slow[1].MockProvider} {
+		if n := p.Calls(); n != 1 {
+			t.Errorf("%s called %d times, want 1", p.Name(), n)
+		}
+	}
+	for _, p := range slow {
+		select {
+		case <-p.cancelled:
+		case <-time.After(time.Second):
+			t.Fatalf("%s not cancelled", p.Name())
+		}
+		snap := waitIdle(t, b, p.Name())
+		if snap.TotalRequests != 1 || snap.ErrorsInWindow != 0 {
+			t.Errorf("%s has %d requests and %d errors, want 1 and 0", p.Name(), snap.TotalRequests, snap.ErrorsInWindow)
+		}
+	}
+	if snap := waitIdle(t, b, "failing"); snap.ErrorsInWindow != 1 {
+		t.Errorf("failing has %d errors, want 1", snap.ErrorsInWindow)
+	}
+}
+
+func TestRaceAllFail(t *testing.T) {
+	down := NewMockProvider("down", 0, MockFailCalls(1, 1, ErrProviderUnavailable))
+	denied := NewMockProvider("denied", 0, MockFailCalls(1, 1, ErrProviderAuth))
+	b := NewBroker([]Provider{down, denied})
+	defer b.Close()
+
+	_, err := b.GetLocation(context.Background(), testIP(1), WithRace())
+	if !errors.Is(err, ErrProviderUnavailable) || !errors.Is(err, ErrProviderAuth) {
+		t.Errorf("got %v, want both providers' errors", err)
+	}
+	if err != nil && (!strings.Contains(err.Error(), "down:") || !strings.Contains(err.Error(), "denied:")) {
+		t.Errorf("error %q doesn't name each provider", err)
+	}
+}
+
+func TestRaceIsPerCall(t *testing.T) {
+	first := NewMockProvider("first", 0)
+	second := NewMockProvider("second", 0)
+	b := NewBroker([]Provider{first, second}, WithProviderTier("second", 1))
+	defer b.Close()
+
+	if _, err := b.GetLocation(context.Background(), testIP(1)); err != nil {
+		t.Fatal(err)
+	}
+	if first.Calls() != 1 || second.Calls() != 0 {
+		t.Errorf("without WithRace first called %d times and second %d, want 1 and 0", first.Calls(), second.Calls())
+	}
+}
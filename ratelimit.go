@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// waitForCapacity blocks until a provider's rate limiter frees up and
+// returns the ranked candidates at that point. It returns no candidates and
+// no error if waiting cannot help, e.g. because all providers are disabled.
+func (b *Broker) waitForCapacity(ctx context.Context, ip string) ([]*ProviderStats, error) {
+	for {
+		resetAt, ok := b.nextCapacityAt()
+		if !ok {
+			return nil, nil
+		}
+
+		timer := time.NewTimer(time.Until(resetAt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %w", ErrAllProvidersRateLimited, ctx.Err())
+		}
+
+		if candidates := b.rankProviders(ip); len(candidates) > 0 {
+			return candidates, nil
+		}
+	}
+}
+
+// nextCapacityAt returns when the earliest rate-limited provider can take
+// another request. It reports false if no enabled provider is rate limited.
+func (b *Broker) nextCapacityAt() (time.Time, bool) {
+	b.providerMutex.RLock()
+	defer b.providerMutex.RUnlock()
+
+	var earliest time.Time
+	found := false
+	for _, ps := range b.providers {
+		ps.mutex.RLock()
+		if ps.enabled && !ps.hasCapacity() {
+			resetAt := ps.capacityAt(time.Now())
+			if !found || resetAt.Before(earliest) {
+				earliest = resetAt
+				found = true
+			}
+		}
+		ps.mutex.RUnlock()
+	}
+	return earliest, found
+}
+
+// allRateLimited reports whether the only reason no provider is selectable
+// is that every enabled provider is out of capacity
+func (b *Broker) allRateLimited() bool {
+	b.providerMutex.RLock()
+	defer b.providerMutex.RUnlock()
+
+	limited := 0
+	for _, ps := range b.providers {
+		ps.mutex.RLock()
+		if ps.enabled {
+			if ps.hasCapacity() {
+				ps.mutex.RUnlock()
+				return false
+			}
+			limited++
+		}
+		ps.mutex.RUnlock()
+	}
+	return limited > 0
+}
+
+// capacityAt returns the earliest time at or after now when the provider can
+// take another request. The caller must hold ps.mutex.
+func (ps *ProviderStats) capacityAt(now time.Time) time.Time {
+	at := now
+	if ps.limiter.Remaining(now) <= 0 {
+		at = ps.limiter.NextAvailable(now)
+	}
+	if ps.upstreamLimitedUntil.After(at) {
+		at = ps.upstreamLimitedUntil
+	}
+	if remaining, resetAt, ok := ps.reportedQuota(); ok && remaining <= 0 && resetAt.After(at) {
+		at = resetAt
+	}
+	return at
+}
+
+// headerQuota keeps the rate limit state a service reports in its response
+// headers, for providers implementing QuotaReporter
+type headerQuota struct {
+	mutex     sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+// record stores the requests remaining and the seconds until the window
+// resets from the named headers. Responses without both are ignored.
+func (q *headerQuota) record(header http.Header, remainingHeader, resetHeader string) {
+	remaining, err := strconv.Atoi(header.Get(remainingHeader))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.Atoi(header.Get(resetHeader))
+	if err != nil {
+		return
+	}
+
+	q.mutex.Lock()
+	q.remaining = remaining
+	q.resetAt = time.Now().Add(time.Duration(reset) * time.Second)
+	q.mutex.Unlock()
+}
+
+// get returns the recorded state, with ok false until headers have been
+// seen or once the window has reset
+func (q *headerQuota) get() (remaining int, resetAt time.Time, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.resetAt.IsZero() || !time.Now().Before(q.resetAt) {
+		return 0, time.Time{}, false
+	}
+	return q.remaining, q.resetAt, true
+}
+
+// QuotaReporter can be implemented by a Provider whose service reports how
+// many requests are left, e.g. in response headers. That figure accounts for
+// other clients sharing the same API key, which the broker's own rate
+// limiter can't see, so the broker skips the provider while it is zero.
+type QuotaReporter interface {
+	// Quota returns the requests remaining in the service's current window
+	// and when that window resets. ok is false when the provider has no
+	// current figure, e.g. before its first response or after resetAt.
+	Quota() (remaining int, resetAt time.Time, ok bool)
+}
+
+// CapacityRefresher can be implemented by a QuotaReporter whose service
+// only reports its remaining capacity when asked. The broker calls it once
+// per health probe round, including for providers whose reported quota is
+// used up, since that is how it learns the quota is back.
+type CapacityRefresher interface {
+	RefreshCapacity(ctx context.Context) error
+}
+
+// reportedQuota returns the provider's own remaining-requests figure, if it
+// reports one
+func (ps *ProviderStats) reportedQuota() (remaining int, resetAt time.Time, ok bool) {
+	reporter, ok := asProvider[QuotaReporter](ps.provider)
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return reporter.Quota()
+}
+
+// upstreamAllows reports whether the provider's service is accepting
+// requests: it hasn't rate limited us recently and hasn't reported its
+// quota as used up. The caller must hold ps.mutex.
+func (ps *ProviderStats) upstreamAllows(now time.Time) bool {
+	if now.Before(ps.upstreamLimitedUntil) {
+		return false
+	}
+	remaining, _, ok := ps.reportedQuota()
+	return !ok || remaining > 0
+}
+
+// backOffUpstream stops selecting the provider after its service rate
+// limited us: for retryAfter, or until the end of the current minute when
+// the service didn't say. The caller must hold ps.mutex for writing.
+func (ps *ProviderStats) backOffUpstream(retryAfter time.Duration, now time.Time) {
+	until := limitedUntil(retryAfter, now)
+	if until.After(ps.upstreamLimitedUntil) {
+		ps.upstreamLimitedUntil = until
+		layout := time.TimeOnly
+		if retryAfter > 24*time.Hour {
+			layout = time.DateTime
+		}
+		log.Printf("%s rate limited us upstream; not selecting it until %s", ps.provider.Name(), until.Format(layout))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUpstreamBackOff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 20, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		until      time.Time
+	}{
+		{"retry after", 30 * time.Second, now.Add(30 * time.Second)},
+		// Without a Retry-After, until the end of the minute
+		{"no header", 0, time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker([]Provider{NewMockProvider("mock", 0)})
+			defer b.Close()
+			ps := b.providers[0]
+
+			ps.mutex.Lock()
+			defer ps.mutex.Unlock()
+			ps.backOffUpstream(tt.retryAfter, now)
+			for at := now; at.Before(tt.until); at = at.Add(time.Second) {
+				if ps.upstreamAllows(at) {
+					t.Fatalf("selectable %v after being rate limited, want not before %v", at.Sub(now), tt.until.Sub(now))
+				}
+			}
+			if !ps.upstreamAllows(tt.until) {
+				t.Errorf("still not selectable %v later", tt.until.Sub(now))
+			}
+			if at := ps.capacityAt(now); !at.Equal(tt.until) {
+				t.Errorf("capacity at %v, want %v", at, tt.until)
+			}
+
+			// A shorter limit reported later doesn't cut the first short
+			ps.backOffUpstream(time.Second, now)
+			if ps.upstreamAllows(now.Add(2 * time.Second)) {
+				t.Error("a shorter Retry-After shortened the back-off")
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"Mon, 01 Jan 2024 12:02:00 GMT", 2 * time.Minute},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0},
+		{"-10", 0},
+		{"soon", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBrokerHonorsRetryAfter(t *testing.T) {
+	s := newCannedServer(t, http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, `{"error": {"title": "Rate limit exceeded"}}`)
+	limited, err := NewIPInfoProvider(1000, WithBaseURL(s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := NewCountingObserver()
+	fallback := NewMockProvider("fallback", 0)
+	b := NewBroker([]Provider{limited, fallback}, WithProviderTier("fallback", 1), WithObserver(counter))
+	defer b.Close()
+
+	for i := range 10 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if n := counter.Selected(limited.Name()); n != 1 {
+		t.Errorf("rate limited provider received %d requests, want only the first", n)
+	}
+	if n := fallback.Calls(); n != 10 {
+		t.Errorf("fallback served %d of 10 lookups", n)
+	}
+
+	snap, err := b.Snapshot(limited.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(snap.UpstreamLimitedUntil); until < 25*time.Second || until > 30*time.Second {
+		t.Errorf("limited for another %v, want about 30s", until)
+	}
+	// Being told to slow down isn't a failure
+	if snap.ErrorsInWindow != 0 || snap.BreakerState != BreakerClosed {
+		t.Errorf("%d errors, breaker %v after a 429", snap.ErrorsInWindow, snap.BreakerState)
+	}
+
+	// With nowhere else to go the lookup says why
+	only := NewBroker([]Provider{limited})
+	defer only.Close()
+	only.GetLocation(context.Background(), testIP(0))
+	if _, err := only.GetLocation(context.Background(), testIP(1)); !errors.Is(err, ErrAllProvidersRateLimited) {
+		t.Errorf("got %v, want ErrAllProvidersRateLimited", err)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RedisConfig describes how to reach the Redis server backing a RedisCache
+type RedisConfig struct {
+	// Addr is the server's host:port
+	Addr string
+	// Password is sent with AUTH when set
+	Password string
+	// DB is the database selected on every connection
+	DB int
+	// KeyPrefix is prepended to every key so several applications can share
+	// one server. The default is "geo:".
+	KeyPrefix string
+	// PoolSize is the number of idle connections kept open. The default is 8.
+	PoolSize int
+	// DialTimeout bounds connecting to the server. The default is 1 second.
+	DialTimeout time.Duration
+}
+
+// RedisCache is a Cache backed by Redis, so several broker instances can
+// share their lookups. Locations are stored as JSON with a per-entry expiry.
+// It speaks the Redis protocol directly rather than depending on a client
+// library, keeping the broker free of third-party modules; it needs only
+// GET, SET, DEL, PTTL and SCAN. Every operation honours its context's deadline, and a server that
+// can't be reached is reported as an error, which the broker treats as a
+// miss.
+type RedisCache struct {
+	config RedisConfig
+	idle   chan *redisConn
+}
+
+// NewRedisCache creates a RedisCache. Connections are opened lazily.
+func NewRedisCache(config RedisConfig) *RedisCache {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "geo:"
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = 8
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = time.Second
+	}
+	return &RedisCache{
+		config: config,
+		idle:   make(chan *redisConn, config.PoolSize),
+	}
+}
+
+// Get returns the location stored for ip, if any
+func (c *RedisCache) Get(ctx context.Context, ip string) (*Location, bool, error) {
+	reply, err := c.do(ctx, "GET", c.key(ip))
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	var loc Location
+	if err := json.Unmarshal(reply.([]byte), &loc); err != nil {
+		return nil, false, fmt.Errorf("redis cache: decoding %s: %w", ip, err)
+	}
+	return &loc, true, nil
+}
+
+// Set stores loc for ip, expiring after ttl
+func (c *RedisCache) Set(ctx context.Context, ip string, loc *Location, ttl time.Duration) error {
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return fmt.Errorf("redis cache: encoding %s: %w", ip, err)
+	}
+
+	args := []string{"SET", c.key(ip), string(data)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err = c.do(ctx, args...)
+	return err
+}
+
+// Delete removes the location stored for ip
+func (c *RedisCache) Delete(ctx context.Context, ip string) error {
+	_, err := c.do(ctx, "DEL", c.key(ip))
+	return err
+}
+
+// Flush deletes every key under the cache's prefix and returns how many
+// were removed
+func (c *RedisCache) Flush(ctx context.Context) (int, error) {
+	removed := 0
+	cursor := "0"
+	for {
+		reply, err := c.do(ctx, "SCAN", cursor, "MATCH", c.match(), "COUNT", "100")
+		if err != nil {
+			return removed, err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return removed, fmt.Errorf("redis cache: unexpected SCAN reply %v", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]any)
+
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, key := range keys {
+				if k, ok := key.([]byte); ok {
+					args = append(args, string(k))
+				}
+			}
+			reply, err := c.do(ctx, args...)
+			if err != nil {
+				return removed, err
+			}
+			n, _ := reply.(int64)
+			removed += int(n)
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return removed, nil
+		}
+	}
+}
+
+// Export lists every entry under the cache's prefix, a SCAN page at a time
+func (c *RedisCache) Export(ctx context.Context, fn func(SnapshotEntry) error) error {
+	cursor := "0"
+	for {
+		reply, err := c.do(ctx, "SCAN", cursor, "MATCH", c.match(), "COUNT", "100")
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return fmt.Errorf("redis cache: unexpected SCAN reply %v", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]any)
+
+		for _, key := range keys {
+			k, ok := key.([]byte)
+			if !ok {
+				continue
+			}
+			ip := strings.TrimPrefix(string(k), c.config.KeyPrefix)
+			loc, ok, err := c.Get(ctx, ip)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			entry := SnapshotEntry{Key: ip, Location: loc}
+			reply, err := c.do(ctx, "PTTL", string(k))
+			if err != nil {
+				return err
+			}
+			if ms, _ := reply.(int64); ms > 0 {
+				entry.Expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Close closes the idle connections. Operations still in flight close their
+// own connections when they finish.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// key returns the Redis key for ip
+func (c *RedisCache) key(ip string) string {
+	return c.config.KeyPrefix + ip
+}
+
+// match returns the SCAN pattern matching every key under the prefix. Glob
+// characters in the prefix are escaped so they match only themselves.
+func (c *RedisCache) match() string {
+	var pattern strings.Builder
+	for _, r := range c.config.KeyPrefix {
+		if strings.ContainsRune(`*?[]\`, r) {
+			pattern.WriteByte('\\')
+		}
+		pattern.WriteRune(r)
+	}
+	pattern.WriteByte('*')
+	return pattern.String()
+}
+
+// do runs a single command on a pooled connection. The reply is nil, a
+// string, an int64, a []byte for a bulk string or a []any for an array.
+// An idle connection the server has since closed, e.g. after a restart or
+// an idle timeout, is replaced and the command sent again on a new one;
+// every command the cache sends is safe to repeat.
+func (c *RedisCache) do(ctx context.Context, args ...string) (any, error) {
+	for {
+		conn, pooled, err := c.conn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("redis cache: %w", err)
+		}
+
+		reply, err := conn.do(ctx, args...)
+		var serverErr redisError
+		if err != nil && !errors.As(err, &serverErr) {
+			// The connection is in an unknown state, so don't reuse it
+			conn.Close()
+			if pooled && ctx.Err() == nil && isConnReset(err) {
+				continue
+			}
+			return nil, fmt.Errorf("redis cache: %w", err)
+		}
+		c.release(conn)
+		if err != nil {
+			return nil, fmt.Errorf("redis cache: %w", err)
+		}
+		return reply, nil
+	}
+}
+
+// isConnReset reports whether err shows the server closed the connection
+func isConnReset(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// conn returns an idle connection, with pooled set, or dials a new one
+func (c *RedisCache) conn(ctx context.Context) (conn *redisConn, pooled bool, err error) {
+	select {
+	case conn := <-c.idle:
+		return conn, true, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.config.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.config.Addr)
+	if err != nil {
+		return nil, false, err
+	}
+	conn = &redisConn{Conn: nc, reader: bufio.NewReader(nc)}
+
+	if c.config.Password != "" {
+		if _, err := conn.do(ctx, "AUTH", c.config.Password); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	if c.config.DB != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(c.config.DB)); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	return conn, false, nil
+}
+
+// release returns conn to the pool, closing it if the pool is full
+func (c *RedisCache) release(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+const (
+	// maxRedisBulk caps the length of a bulk string accepted from the
+	// server; cached locations are a few hundred bytes
+	maxRedisBulk = 1 << 20
+	// maxRedisArray caps the number of elements of an array reply, and
+	// maxRedisDepth how deeply arrays may nest
+	maxRedisArray = 1 << 16
+	maxRedisDepth = 4
+)
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a single connection to the server
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// do sends a command and reads its reply, giving up when ctx is done
+func (rc *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := rc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	// Unblock the read or write as soon as the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		rc.SetDeadline(time.Now())
+	})
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(rc, cmd.String())
+	var reply any
+	if err == nil {
+		reply, err = rc.readReply(0)
+	}
+
+	// If the cancellation already fired, the deadline it set could still
+	// land after this call, so the connection must not be reused
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		var serverErr redisError
+		if errors.As(err, &serverErr) {
+			return nil, err
+		}
+		return nil, contextErr(ctx, err)
+	}
+	return reply, nil
+}
+
+// readReply reads a single reply at the given array nesting depth; arrays
+// are returned as []any. An error element in an array is returned once the
+// whole array has been read, so the connection stays in step with the
+// server. Any other error leaves the connection unusable.
+func (rc *redisConn) readReply(depth int) (any, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRedisBulk {
+			return nil, fmt.Errorf("bulk reply of %d bytes is too long", n)
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRedisArray || depth >= maxRedisDepth {
+			return nil, fmt.Errorf("array reply of %d elements at depth %d is too large", n, depth)
+		}
+		items := make([]any, n)
+		var elemErr error
+		for i := range items {
+			items[i], err = rc.readReply(depth + 1)
+			var serverErr redisError
+			if errors.As(err, &serverErr) {
+				elemErr = cmp.Or(elemErr, err)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if elemErr != nil {
+			return nil, elemErr
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+// contextErr prefers the context's error over the I/O error it caused. The
+// connection's deadline, set from the context's, can pass a moment before
+// the context notices its own.
+func contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
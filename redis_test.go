@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal Redis server speaking enough of the protocol for
+// RedisCache: AUTH and SELECT, which it accepts without checking, GET, SET
+// with PX, DEL, PTTL and SCAN, which pages through the
+// matching keys two at a time and, like Redis, still returns every key
+// present throughout the scan when keys are deleted along the way. A test
+// can script the raw reply to any command with override.
+type fakeRedis struct {
+	listener net.Listener
+	accepted atomic.Int32
+
+	mutex    sync.Mutex
+	conns    []net.Conn
+	data     map[string]string
+	expiry   map[string]time.Time
+	commands [][]string
+	override func(args []string) (reply string, ok bool)
+	// cursors maps a SCAN cursor to the last key returned before it
+	cursors map[int]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		listener: listener,
+		data:     make(map[string]string),
+		expiry:   make(map[string]time.Time),
+		cursors:  make(map[int]string),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+// setOverride scripts replies; fn returns ok false to fall back to the
+// normal handling
+func (s *fakeRedis) setOverride(fn func(args []string) (string, bool)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.override = fn
+}
+
+// set stores a key directly
+func (s *fakeRedis) set(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[key] = value
+}
+
+// has reports whether key is stored
+func (s *fakeRedis) has(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.data[key]
+	return ok
+}
+
+// lastCommand returns the most recent command named name
+func (s *fakeRedis) lastCommand(name string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, cmd := range slices.Backward(s.commands) {
+		if cmd[0] == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// dropConnections closes every open connection, as a restarting server
+// would
+func (s *fakeRedis) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// count returns how many commands named name were received
+func (s *fakeRedis) count(name string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, cmd := range s.commands {
+		if cmd[0] == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mutex.Lock()
+	s.conns = append(s.conns, conn)
+	s.mutex.Unlock()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) handle(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands = append(s.commands, args)
+	if s.override != nil {
+		if reply, ok := s.override(args); ok {
+			return reply
+		}
+	}
+
+	now := time.Now()
+	for key, at := range s.expiry {
+		if !now.Before(at) {
+			delete(s.data, key)
+			delete(s.expiry, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fakeBulk(value)
+	case "SET":
+		s.data[args[1]] = args[2]
+		delete(s.expiry, args[1])
+		if len(args) == 5 && args[3] == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expiry[args[1]] = now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		removed := 0
+		for _, key := range args[1:] {
+			if _, ok := s.data[key]; ok {
+				delete(s.data, key)
+				delete(s.expiry, key)
+				removed++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "PTTL":
+		if _, ok := s.data[args[1]]; !ok {
+			return ":-2\r\n"
+		}
+		at, ok := s.expiry[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", at.Sub(now).Milliseconds())
+	case "SCAN":
+		cursor, _ := strconv.Atoi(args[1])
+		after := s.cursors[cursor]
+		var keys []string
+		for key := range s.data {
+			if ok, _ := path.Match(args[3], key); ok && key > after {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		page := keys[:min(2, len(keys))]
+		next := 0
+		if len(keys) > len(page) {
+			next = len(s.cursors) + 1
+			s.cursors[next] = page[len(page)-1]
+		}
+		reply := fmt.Sprintf("*2\r\n%s*%d\r\n", fakeBulk(strconv.Itoa(next)), len(page))
+		for _, key := range page {
+			reply += fakeBulk(key)
+		}
+		return reply
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func fakeBulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "8.8.8.8"); ok || err != nil {
+		t.Fatalf("Get on an empty cache: ok %v, err %v", ok, err)
+	}
+
+	want := MockCities["Mountain View"]
+	want.IP = "8.8.8.8"
+	if err := c.Set(ctx, "8.8.8.8", &want, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := server.lastCommand("SET"); len(cmd) != 5 || cmd[1] != "geo:8.8.8.8" || cmd[4] != "3600000" {
+		t.Errorf("SET sent as %q", cmd)
+	}
+	got, ok, err := c.Get(ctx, "8.8.8.8")
+	if err != nil || !ok {
+		t.Fatalf("Get after Set: ok %v, err %v", ok, err)
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	if err := c.Delete(ctx, "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := c.Get(ctx, "8.8.8.8"); ok || err != nil {
+		t.Fatalf("Get after Delete: ok %v, err %v", ok, err)
+	}
+
+	// Every command went over one pooled connection
+	if n := server.accepted.Load(); n != 1 {
+		t.Errorf("%d connections opened, want 1", n)
+	}
+
+	if err := VerifyCache(ctx, c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedisCacheFlushAndExport(t *testing.T) {
+	server := newFakeRedis(t)
+	// A prefix with glob characters, which must match only itself
+	c := NewRedisCache(RedisConfig{Addr: server.addr(), KeyPrefix: "geo[1]*:"})
+	defer c.Close()
+	ctx := context.Background()
+
+	server.set("geo1x:9.9.9.9", "{}")
+	server.set("other:9.9.9.9", "{}")
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"} {
+		if err := c.Set(ctx, ip, &Location{IP: ip, Country: "ZZ"}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exported []string
+	err := c.Export(ctx, func(entry SnapshotEntry) error {
+		exported = append(exported, entry.Key)
+		if until := time.Until(entry.Expires); until <= 0 || until > time.Hour {
+			t.Errorf("%s expires in %v", entry.Key, until)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}; !slices.Equal(exported, want) {
+		t.Errorf("exported %q, want %q", exported, want)
+	}
+	if cmd := server.lastCommand("SCAN"); cmd[3] != `geo\[1\]\*:*` {
+		t.Errorf("SCAN MATCH %q", cmd[3])
+	}
+
+	removed, err := c.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("flushed %d keys, want 3", removed)
+	}
+	if !server.has("geo1x:9.9.9.9") {
+		t.Error("Flush removed a key outside the prefix that the unescaped pattern matches")
+	}
+	if !server.has("other:9.9.9.9") {
+		t.Error("Flush removed another application's key")
+	}
+}
+
+func TestRedisCacheErrorInArray(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	server.setOverride(func(args []string) (string, bool) {
+		if args[0] != "SCAN" {
+			return "", false
+		}
+		return "*2\r\n-ERR first\r\n*2\r\n-ERR second\r\n$4\r\nkey1\r\n", true
+	})
+	_, err := c.Flush(ctx)
+	var serverErr redisError
+	if !errors.As(err, &serverErr) || string(serverErr) != "ERR first" {
+		t.Fatalf("got %v, want the first error reply", err)
+	}
+
+	// The rest of the array was read, so the pooled connection is still in
+	// step with the server
+	server.setOverride(nil)
+	if err := c.Set(ctx, "8.8.8.8", &Location{IP: "8.8.8.8", Country: "ZZ"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := c.Get(ctx, "8.8.8.8"); !ok || err != nil {
+		t.Fatalf("Get after the error: ok %v, err %v", ok, err)
+	}
+	if n := server.accepted.Load(); n != 1 {
+		t.Errorf("%d connections opened, want 1", n)
+	}
+}
+
+func TestRedisCacheOversizedReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+	}{
+		{"bulk", fmt.Sprintf("$%d\r\n", maxRedisBulk+1)},
+		{"array", fmt.Sprintf("*%d\r\n", maxRedisArray+1)},
+		{"nesting", strings.Repeat("*1\r\n", maxRedisDepth+1) + ":1\r\n"},
+		{"garbage", "?\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeRedis(t)
+			c := NewRedisCache(RedisConfig{Addr: server.addr()})
+			defer c.Close()
+			ctx := context.Background()
+
+			server.setOverride(func(args []string) (string, bool) {
+				return tt.reply, args[0] == "GET"
+			})
+			if _, _, err := c.Get(ctx, "8.8.8.8"); err == nil {
+				t.Fatal("no error")
+			}
+
+			// The connection was dropped rather than reused out of step
+			if err := c.Delete(ctx, "8.8.8.8"); err != nil {
+				t.Fatal(err)
+			}
+			if n := server.accepted.Load(); n != 2 {
+				t.Errorf("%d connections opened, want 2", n)
+			}
+		})
+	}
+}
+
+func TestRedisCacheErrorReply(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	server.setOverride(func(args []string) (string, bool) {
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", args[0] == "GET"
+	})
+	if _, _, err := c.Get(ctx, "8.8.8.8"); err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Fatalf("got %v, want the error reply", err)
+	}
+	if err := c.Delete(ctx, "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.accepted.Load(); n != 1 {
+		t.Errorf("%d connections opened, want 1", n)
+	}
+}
+
+func TestRedisCacheContext(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr()})
+	defer c.Close()
+
+	server.setOverride(func(args []string) (string, bool) {
+		if args[0] != "GET" {
+			return "", false
+		}
+		time.Sleep(200 * time.Millisecond)
+		return "$-1\r\n", true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := c.Get(ctx, "8.8.8.8"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Get took %v despite its deadline", elapsed)
+	}
+}
+
+func TestRedisCacheNilReplies(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	// A nil bulk string is a miss
+	server.setOverride(func(args []string) (string, bool) {
+		return "$-1\r\n", args[0] == "GET"
+	})
+	if loc, ok, err := c.Get(ctx, "8.8.8.8"); ok || err != nil || loc != nil {
+		t.Errorf("nil bulk reply: got %v, ok %v, err %v; want a miss", loc, ok, err)
+	}
+
+	// A nil array where SCAN should page is an error, not a panic
+	server.setOverride(func(args []string) (string, bool) {
+		return "*-1\r\n", args[0] == "SCAN"
+	})
+	if _, err := c.Flush(ctx); err == nil || !strings.Contains(err.Error(), "unexpected SCAN reply") {
+		t.Errorf("nil array reply: got %v, want an unexpected reply error", err)
+	}
+
+	// Nil keys inside a SCAN page are skipped
+	server.setOverride(func(args []string) (string, bool) {
+		return "*2\r\n" + fakeBulk("0") + "*2\r\n$-1\r\n" + fakeBulk("geo:1.1.1.1"), args[0] == "SCAN"
+	})
+	server.set("geo:1.1.1.1", "{}")
+	if removed, err := c.Flush(ctx); err != nil || removed != 1 {
+		t.Errorf("nil key in SCAN page: removed %d, err %v; want 1 removed", removed, err)
+	}
+
+	// Every reply was read in full, so one connection served them all
+	if n := server.accepted.Load(); n != 1 {
+		t.Errorf("%d connections opened, want 1", n)
+	}
+}
+
+func TestRedisCacheReconnect(t *testing.T) {
+	server := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: server.addr(), Password: "secret", DB: 2})
+	defer c.Close()
+	ctx := context.Background()
+
+	want := Location{IP: "8.8.8.8", Country: "ZZ"}
+	if err := c.Set(ctx, "8.8.8.8", &want, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server closes the pooled connection; the next command goes over a
+	// new one, set up like the first
+	server.dropConnections()
+	got, ok, err := c.Get(ctx, "8.8.8.8")
+	if err != nil || !ok || *got != want {
+		t.Fatalf("Get after the connection dropped: got %v, ok %v, err %v", got, ok, err)
+	}
+	if n := server.accepted.Load(); n != 2 {
+		t.Errorf("%d connections opened, want 2", n)
+	}
+	if server.count("AUTH") != 2 || server.count("SELECT") != 2 {
+		t.Errorf("AUTH sent %d times and SELECT %d, want once per connection", server.count("AUTH"), server.count("SELECT"))
+	}
+	if cmd := server.lastCommand("SELECT"); cmd[1] != "2" {
+		t.Errorf("SELECT sent as %q", cmd)
+	}
+
+	// With the server gone the error is reported rather than retried forever
+	server.listener.Close()
+	server.dropConnections()
+	if _, _, err := c.Get(ctx, "8.8.8.8"); err == nil || !strings.HasPrefix(err.Error(), "redis cache:") {
+		t.Errorf("got %v with the server down, want a redis cache error", err)
+	}
+}
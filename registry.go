@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderConfig declares a provider to build by name, e.g. from a config
+// file. Which fields matter depends on the provider type.
+type ProviderConfig struct {
+	// Type is the registered factory name, such as "ipinfo" or "maxmind"
+	Type string `json:"type"`
+	// MaxRequestsPerMinute overrides the provider's default rate limit
+	MaxRequestsPerMinute int `json:"max_requests_per_minute,omitempty"`
+	// Token is the API key; most providers fall back to their environment
+	// variable without one
+	Token string `json:"token,omitempty"`
+	// KeyEnv names an environment variable to read the API key from
+	// instead, keeping it out of the config file
+	KeyEnv string `json:"key_env,omitempty"`
+	// Tokens are the API keys of several accounts of the same service.
+	// Lookups rotate over them, adding up the accounts' quotas, and the rate
+	// limit applies to each key.
+	Tokens []string `json:"tokens,omitempty"`
+	// Timeout bounds every lookup sent to the provider; zero means no bound
+	// beyond the caller's context
+	Timeout Duration `json:"timeout,omitempty"`
+	// RetryAttempts retries lookups that fail to reach the provider, up to
+	// this many attempts in total, waiting RetryBackoff and then twice as
+	// long each time. The Timeout covers all attempts.
+	RetryAttempts int      `json:"retry_attempts,omitempty"`
+	RetryBackoff  Duration `json:"retry_backoff,omitempty"`
+	// Enabled set to false leaves the provider out without deleting its entry
+	Enabled *bool `json:"enabled,omitempty"`
+	// BaseURL replaces the public endpoint of an HTTP provider
+	BaseURL string `json:"base_url,omitempty"`
+	// Headers and UserAgent are sent with every request of an HTTP provider
+	Headers   map[string]string `json:"headers,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	// Path is the database file of a local provider
+	Path string `json:"path,omitempty"`
+	// JSON describes a "generic" provider
+	JSON *GenericJSONConfig `json:"json,omitempty"`
+}
+
+// ProviderFactory builds a provider from its config
+type ProviderFactory func(cfg ProviderConfig) (Provider, error)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]ProviderFactory)
+)
+
+// RegisterProviderFactory makes a provider type available to BuildProviders
+// under name, replacing any factory already registered under it
+func RegisterProviderFactory(name string, f ProviderFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[name] = f
+}
+
+// ProviderTypes returns the registered provider type names in order
+func ProviderTypes() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuildProviders builds a provider for each enabled config. Errors name the
+// entry at fault. Two entries may not produce providers with the same name.
+func BuildProviders(configs []ProviderConfig) ([]Provider, error) {
+	providers := make([]Provider, 0, len(configs))
+	seen := make(map[string]int)
+	for i, cfg := range configs {
+		if !cfg.enabled() {
+			continue
+		}
+		if cfg.KeyEnv != "" && cfg.Token == "" {
+			cfg.Token = os.Getenv(cfg.KeyEnv)
+		}
+
+		registryMutex.RLock()
+		factory, ok := registry[cfg.Type]
+		registryMutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("provider %d: unknown type %q (known: %v)", i, cfg.Type, ProviderTypes())
+		}
+
+		p, err := buildProvider(factory, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d (%s): %w", i, cfg.Type, err)
+		}
+		if j, dup := seen[p.Name()]; dup {
+			return nil, fmt.Errorf("provider %d (%s): name %q already used by provider %d", i, cfg.Type, p.Name(), j)
+		}
+		seen[p.Name()] = i
+		if cfg.RetryAttempts > 1 {
+			p = WrapProvider(p, RetryMiddleware(cfg.RetryAttempts, time.Duration(cfg.RetryBackoff), 0))
+		}
+		if cfg.Timeout > 0 {
+			p = WrapProvider(p, TimeoutMiddleware(time.Duration(cfg.Timeout)))
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// buildProvider calls factory, or with several tokens pools a provider
+// built for each of them
+func buildProvider(factory ProviderFactory, cfg ProviderConfig) (Provider, error) {
+	if len(cfg.Tokens) == 0 {
+		return factory(cfg)
+	}
+	return NewKeyPoolProvider(cfg.Tokens, func(token string) (Provider, error) {
+		keyCfg := cfg
+		keyCfg.Token, keyCfg.Tokens = token, nil
+		return factory(keyCfg)
+	})
+}
+
+// enabled reports whether the entry should be built
+func (cfg ProviderConfig) enabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
+// httpOptions turns the HTTP settings of cfg into provider options
+func (cfg ProviderConfig) httpOptions() ([]ProviderOption, error) {
+	var opts []ProviderOption
+	if cfg.Token != "" {
+		opts = append(opts, WithToken(cfg.Token))
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, WithBaseURL(cfg.BaseURL))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, WithHeaders(cfg.Headers))
+	}
+	if cfg.UserAgent != "" {
+		opts = append(opts, WithUserAgent(cfg.UserAgent))
+	}
+	return opts, nil
+}
+
+// rateLimit returns the configured rate limit, or def if none was set
+func (cfg ProviderConfig) rateLimit(def int) int {
+	if cfg.MaxRequestsPerMinute != 0 {
+		return cfg.MaxRequestsPerMinute
+	}
+	return def
+}
+
+// httpFactory adapts an HTTP provider constructor with a default rate limit
+func httpFactory[P Provider](newProvider func(int, ...ProviderOption) (P, error), defaultLimit int) ProviderFactory {
+	return func(cfg ProviderConfig) (Provider, error) {
+		opts, err := cfg.httpOptions()
+		if err != nil {
+			return nil, err
+		}
+		return newProvider(cfg.rateLimit(defaultLimit), opts...)
+	}
+}
+
+// fileFactory adapts a local database provider constructor
+func fileFactory[P Provider](newProvider func(string) (P, error)) ProviderFactory {
+	return func(cfg ProviderConfig) (Provider, error) {
+		if cfg.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return newProvider(cfg.Path)
+	}
+}
+
+// Built-in providers, with default rate limits matching their free tiers
+func init() {
+	RegisterProviderFactory("ipinfo", httpFactory(NewIPInfoProvider, 100))
+	RegisterProviderFactory("ip-api", httpFactory(NewIPAPIProvider, 45))
+	RegisterProviderFactory("ipwhois", httpFactory(NewIPWhoisProvider, 10))
+	RegisterProviderFactory("dbip", httpFactory(NewDBIPProvider, 1))
+	RegisterProviderFactory("ipapi.co", httpFactory(NewIPAPICoProvider, 30))
+	RegisterProviderFactory("ipstack", httpFactory(NewIPStackProvider, 150))
+	RegisterProviderFactory("ipgeolocation", httpFactory(NewIPGeolocationProvider, 30))
+	RegisterProviderFactory("ipdata", httpFactory(NewIPDataProvider, 60))
+	RegisterProviderFactory("ip2location", httpFactory(NewIP2LocationProvider, 30))
+	RegisterProviderFactory("ipbase", httpFactory(NewIPBaseProvider, 10))
+	RegisterProviderFactory("maxmind", fileFactory(NewMaxMindProvider))
+	RegisterProviderFactory("file", fileFactory(NewFileProvider))
+	RegisterProviderFactory("generic", func(cfg ProviderConfig) (Provider, error) {
+		if cfg.JSON == nil {
+			return nil, errors.New("json is required")
+		}
+		spec := *cfg.JSON
+		if cfg.MaxRequestsPerMinute != 0 {
+			spec.MaxRequestsPerMinute = cfg.MaxRequestsPerMinute
+		}
+		opts, err := cfg.httpOptions()
+		if err != nil {
+			return nil, err
+		}
+		return NewGenericJSONProvider(spec, opts...)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureFactory registers a provider type under name whose factory records
+// the config it was given. The type is unregistered when the test ends.
+func captureFactory(t *testing.T, name string) *ProviderConfig {
+	t.Helper()
+	var got ProviderConfig
+	RegisterProviderFactory(name, func(cfg ProviderConfig) (Provider, error) {
+		got = cfg
+		if cfg.Token == "reject" {
+			return nil, errors.New("token rejected")
+		}
+		return NewMockProvider(name+"-"+cfg.Token, cfg.rateLimit(7)), nil
+	})
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		delete(registry, name)
+		registryMutex.Unlock()
+	})
+	return &got
+}
+
+func TestBuildProviders(t *testing.T) {
+	captureFactory(t, "capture")
+	disabled := false
+	tests := []struct {
+		name      string
+		configs   []ProviderConfig
+		wantNames []string
+		wantErr   string // empty for success
+	}{
+		{"built-in types", []ProviderConfig{{Type: "ipinfo"}, {Type: "ip-api"}}, []string{"ipinfo.io", "ip-api.com"}, ""},
+		{"registered type", []ProviderConfig{{Type: "capture", Token: "a"}}, []string{"capture-a"}, ""},
+		{"disabled entry", []ProviderConfig{{Type: "capture", Token: "a"}, {Type: "capture", Token: "b", Enabled: &disabled}}, []string{"capture-a"}, ""},
+		{"unknown type", []ProviderConfig{{Type: "capture", Token: "a"}, {Type: "nosuch"}}, nil, `provider 1: unknown type "nosuch"`},
+		{"factory error", []ProviderConfig{{Type: "capture", Token: "reject"}}, nil, "provider 0 (capture): token rejected"},
+		{"missing path", []ProviderConfig{{Type: "maxmind"}}, nil, "provider 0 (maxmind): path is required"},
+		{"missing json", []ProviderConfig{{Type: "generic"}}, nil, "provider 0 (generic): json is required"},
+		{"duplicate name", []ProviderConfig{{Type: "capture", Token: "a"}, {Type: "capture", Token: "a"}}, nil, `provider 1 (capture): name "capture-a" already used by provider 0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers, err := BuildProviders(tt.configs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range providers {
+				names = append(names, p.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("built %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestBuildProvidersOptions(t *testing.T) {
+	got := captureFactory(t, "capture")
+
+	// The factory sees the config as written, with the key read from key_env
+	t.Setenv("CAPTURE_KEY", "from-env")
+	providers, err := BuildProviders([]ProviderConfig{{Type: "capture", KeyEnv: "CAPTURE_KEY", MaxRequestsPerMinute: 3, Path: "db.mmdb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Token != "from-env" || got.Path != "db.mmdb" {
+		t.Errorf("factory got token %q and path %q, want from-env and db.mmdb", got.Token, got.Path)
+	}
+	if n := providers[0].GetMaxRequestsPerMinute(); n != 3 {
+		t.Errorf("rate limit %d, want the configured 3", n)
+	}
+
+	// Default rate limits apply without one configured
+	providers, err = BuildProviders([]ProviderConfig{{Type: "capture"}, {Type: "ipwhois"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := providers[0].GetMaxRequestsPerMinute(), providers[1].GetMaxRequestsPerMinute(); a != 7 || b != 10 {
+		t.Errorf("rate limits %d and %d, want the defaults 7 and 10", a, b)
+	}
+
+	// Several tokens build a key pool
+	providers, err = BuildProviders([]ProviderConfig{{Type: "ipinfo", Tokens: []string{"one", "two"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := providers[0].(*KeyPoolProvider); !ok {
+		t.Errorf("got %T for two tokens, want a *KeyPoolProvider", providers[0])
+	}
+
+	// HTTP settings reach the requests an HTTP provider sends
+	s := newCannedServer(t, http.StatusOK, nil, `{"ip": "8.8.8.8", "country": "US"}`)
+	providers, err = BuildProviders([]ProviderConfig{{
+		Type: "ipinfo", Token: "secret", BaseURL: s.URL, UserAgent: "broker-test/1.0",
+		Headers: map[string]string{"X-Team": "geo"}, Timeout: Duration(time.Second), RetryAttempts: 2,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := providers[0].GetLocation(context.Background(), "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	r := s.request()
+	if r.Header.Get("User-Agent") != "broker-test/1.0" || r.Header.Get("X-Team") != "geo" {
+		t.Errorf("request headers %v, want the configured User-Agent and X-Team", r.Header)
+	}
+	if !strings.Contains(r.URL.RawQuery+r.Header.Get("Authorization"), "secret") {
+		t.Errorf("request %s carried no token", r.URL)
+	}
+	if _, ok := asProvider[*IPInfoProvider](providers[0]); !ok {
+		t.Errorf("got %T, want the timeout and retry wrappers around an *IPInfoProvider", providers[0])
+	}
+}
+
+func TestProviderTypes(t *testing.T) {
+	captureFactory(t, "capture")
+	types := ProviderTypes()
+	for _, name := range []string{"capture", "ipinfo", "maxmind", "file", "generic"} {
+		if !slices.Contains(types, name) {
+			t.Errorf("%q missing from %v", name, types)
+		}
+	}
+	if !slices.IsSorted(types) {
+		t.Errorf("types not sorted: %v", types)
+	}
+}
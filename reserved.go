@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// ReservedIPPolicy decides what the broker does with addresses in reserved
+// ranges, such as private networks and loopback, which no online provider
+// can locate
+type ReservedIPPolicy int
+
+const (
+	// ReservedIPReject fails lookups of reserved addresses with
+	// ErrReservedIP without calling a provider. It is the default.
+	ReservedIPReject ReservedIPPolicy = iota
+	// ReservedIPLocation answers them with a Location that has Reserved
+	// set and no geographic data, without calling a provider
+	ReservedIPLocation
+	// ReservedIPLookup sends them to the providers like any other address,
+	// for setups with a provider that knows the local network, such as a
+	// FileProvider
+	ReservedIPLookup
+)
+
+// reservedRange is a block of addresses that isn't routed on the public
+// internet
+type reservedRange struct {
+	prefix netip.Prefix
+	name   string
+}
+
+// reservedRanges are the bogon blocks not already covered by the netip.Addr
+// predicates reservedRangeOf checks first
+var reservedRanges = []reservedRange{
+	{netip.MustParsePrefix("0.0.0.0/8"), "this-network"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "carrier-grade NAT"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF protocol"},
+	{netip.MustParsePrefix("192.0.2.0/24"), "documentation"},
+	{netip.MustParsePrefix("192.88.99.0/24"), "6to4 relay"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking"},
+	{netip.MustParsePrefix("198.51.100.0/24"), "documentation"},
+	{netip.MustParsePrefix("203.0.113.0/24"), "documentation"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "local-use NAT64"},
+	{netip.MustParsePrefix("100::/64"), "discard-only"},
+	// Before 2001::/23, which contains them
+	{netip.MustParsePrefix("2001:2::/48"), "benchmarking"},
+	{netip.MustParsePrefix("2001:10::/28"), "ORCHID"},
+	{netip.MustParsePrefix("2001::/23"), "IETF protocol"},
+	{netip.MustParsePrefix("2001:db8::/32"), "documentation"},
+	{netip.MustParsePrefix("3fff::/20"), "documentation"},
+	{netip.MustParsePrefix("fec0::/10"), "site-local"},
+}
+
+// reservedRangeOf returns the name of the reserved range addr is in, such
+// as "private" or "loopback", or "" if it is a public address. addr must be
+// unmapped, as parseIP returns it.
+func reservedRangeOf(addr netip.Addr) string {
+	switch {
+	case addr.IsUnspecified():
+		return "unspecified"
+	case addr.IsLoopback():
+		return "loopback"
+	case addr.IsPrivate():
+		return "private"
+	case addr.IsLinkLocalUnicast():
+		return "link-local"
+	case addr.IsMulticast():
+		return "multicast"
+	}
+	for _, r := range reservedRanges {
+		if r.prefix.Contains(addr) {
+			return r.name
+		}
+	}
+	return ""
+}
+
+// reserved answers a lookup of a reserved address according to the
+// broker's ReservedIPPolicy. ok is false when addr is public or the policy
+// sends it to the providers.
+func (b *Broker) reserved(addr netip.Addr) (location *Location, ok bool, err error) {
+	if b.reservedIPs == ReservedIPLookup {
+		return nil, false, nil
+	}
+	name := reservedRangeOf(addr)
+	if name == "" {
+		return nil, false, nil
+	}
+	if b.reservedIPs == ReservedIPLocation {
+		return &Location{IP: addr.String(), Reserved: name, RetrievedAt: time.Now()}, true, nil
+	}
+	return nil, true, fmt.Errorf("%w: %s is a %s address", ErrReservedIP, addr, name)
+}
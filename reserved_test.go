@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReservedRangeOf(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		// IPv4
+		{"0.0.0.0", "unspecified"},
+		{"0.1.2.3", "this-network"},
+		{"10.0.0.1", "private"},
+		{"172.16.0.1", "private"},
+		{"172.31.255.255", "private"},
+		{"192.168.1.1", "private"},
+		{"127.0.0.1", "loopback"},
+		{"127.255.255.254", "loopback"},
+		{"169.254.169.254", "link-local"},
+		{"100.64.0.1", "carrier-grade NAT"},
+		{"100.127.255.255", "carrier-grade NAT"},
+		{"192.0.0.8", "IETF protocol"},
+		{"192.0.2.1", "documentation"},
+		{"198.51.100.1", "documentation"},
+		{"203.0.113.1", "documentation"},
+		{"198.18.0.1", "benchmarking"},
+		{"192.88.99.1", "6to4 relay"},
+		{"224.0.0.1", "multicast"},
+		{"240.0.0.1", "reserved"},
+		{"255.255.255.255", "reserved"},
+
+		// IPv4 neighbours of reserved ranges
+		{"8.8.8.8", ""},
+		{"9.255.255.255", ""},
+		{"11.0.0.1", ""},
+		{"172.15.255.255", ""},
+		{"172.32.0.1", ""},
+		{"100.63.255.255", ""},
+		{"100.128.0.1", ""},
+		{"169.253.255.255", ""},
+		{"192.0.3.1", ""},
+		{"203.0.114.1", ""},
+
+		// IPv6
+		{"::", "unspecified"},
+		{"::1", "loopback"},
+		{"fc00::1", "private"},
+		{"fd12:3456:789a::1", "private"},
+		{"fe80::1", "link-local"},
+		{"febf:ffff::1", "link-local"},
+		{"fec0::1", "site-local"},
+		{"ff02::1", "multicast"},
+		{"2001:db8::1", "documentation"},
+		{"2001:db8:ffff:ffff::1", "documentation"},
+		{"3fff::1", "documentation"},
+		{"3fff:fff:ffff::1", "documentation"},
+		{"64:ff9b:1::1", "local-use NAT64"},
+		{"100::1", "discard-only"},
+		{"2001::1", "IETF protocol"},
+		{"2001:1ff:ffff::1", "IETF protocol"},
+		{"2001:2::1", "benchmarking"},
+		{"2001:10::1", "ORCHID"},
+		{"2001:1f:ffff::1", "ORCHID"},
+
+		// IPv6 neighbours of reserved ranges
+		{"2606:4700:4700::1111", ""},
+		{"2001:200::1", ""},
+		{"2001:db9::1", ""},
+		{"2001:db7:ffff::1", ""},
+		{"3fff:1000::1", ""},
+		{"fbff:ffff::1", ""},
+		{"64:ff9b::808:808", ""},
+
+		// IPv4-mapped IPv6 is judged as IPv4
+		{"::ffff:10.0.0.1", "private"},
+		{"::ffff:100.64.0.1", "carrier-grade NAT"},
+		{"::ffff:8.8.8.8", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := reservedRangeOf(mustParseIP(t, tt.ip)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReservedIPPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reject", func(t *testing.T) {
+		p := NewMockProvider("mock", 100)
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+
+		for _, ip := range []string{"10.1.2.3", "::1", "100.64.1.1", "2001:db8::1"} {
+			if _, err := b.GetLocation(ctx, ip); !errors.Is(err, ErrReservedIP) {
+				t.Errorf("%s: got %v, want ErrReservedIP", ip, err)
+			}
+		}
+		if got := p.Calls(); got != 0 {
+			t.Errorf("provider called %d times for reserved addresses", got)
+		}
+	})
+
+	t.Run("location", func(t *testing.T) {
+		p := NewMockProvider("mock", 100)
+		b := NewBroker([]Provider{p}, WithReservedIPs(ReservedIPLocation))
+		defer b.Close()
+
+		loc, err := b.GetLocation(ctx, "::ffff:192.168.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.IP != "192.168.0.1" || loc.Reserved != "private" || loc.Country != "" {
+			t.Errorf("got IP %q, Reserved %q, Country %q; want a bare private result", loc.IP, loc.Reserved, loc.Country)
+		}
+		if got := p.Calls(); got != 0 {
+			t.Errorf("provider called %d times for a reserved address", got)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		p := NewMockProvider("mock", 100, MockResponse("10.0.0.1", MockCities["Berlin"]))
+		b := NewBroker([]Provider{p}, WithReservedIPs(ReservedIPLookup))
+		defer b.Close()
+
+		loc, err := b.GetLocation(ctx, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.City != "Berlin" || loc.Reserved != "" {
+			t.Errorf("got City %q, Reserved %q; want the provider's answer", loc.City, loc.Reserved)
+		}
+	})
+
+	t.Run("public", func(t *testing.T) {
+		p := NewMockProvider("mock", 100)
+		b := NewBroker([]Provider{p})
+		defer b.Close()
+
+		if _, err := b.GetLocation(ctx, "8.8.8.8"); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Calls(); got != 1 {
+			t.Errorf("provider called %d times, want 1", got)
+		}
+	})
+}
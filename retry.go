@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// backoff returns the delay to sleep before the given retry (1-based).
+// The delay doubles with every attempt, is capped at maxDelay and has jitter
+// applied so concurrent callers don't retry in lockstep.
+func (r retryPolicy) backoff(retry int) time.Duration {
+	if r.baseDelay <= 0 {
+		return 0
+	}
+
+	delay := r.baseDelay
+	for i := 1; i < retry && (r.maxDelay <= 0 || delay < r.maxDelay); i++ {
+		delay *= 2
+	}
+	if r.maxDelay > 0 && delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+
+	// Equal jitter: keep half the delay and randomize the other half
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// sleepBackoff waits for delay unless ctx is done first. It returns false
+// without sleeping if the context deadline would pass during the sleep.
+func sleepBackoff(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBrokerRetry(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 2, nil), MockResponse("8.8.8.8", MockCities["Mountain View"]))
+	b := NewBroker([]Provider{p}, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("failing twice then succeeding: %v", err)
+	}
+	if loc.City != "Mountain View" {
+		t.Errorf("got %+v", loc)
+	}
+	if n := p.Calls(); n != 3 {
+		t.Errorf("provider called %d times, want 3", n)
+	}
+}
+
+func TestBrokerRetryGivesUp(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockFailCalls(1, 10, nil))
+	b := NewBroker([]Provider{p}, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+	defer b.Close()
+
+	if _, err := b.GetLocation(context.Background(), "8.8.8.8"); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("got %v, want the last attempt's error", err)
+	}
+	if n := p.Calls(); n != 3 {
+		t.Errorf("provider called %d times, want 3", n)
+	}
+}
+
+func TestBrokerRetryStops(t *testing.T) {
+	t.Run("invalid ip", func(t *testing.T) {
+		p := NewMockProvider("mock", 0, MockFailCalls(1, 10, ErrProviderInvalidIP))
+		b := NewBroker([]Provider{p}, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+		defer b.Close()
+
+		if _, err := b.GetLocation(context.Background(), "8.8.8.8"); !errors.Is(err, ErrProviderInvalidIP) {
+			t.Errorf("got %v, want ErrProviderInvalidIP", err)
+		}
+		if n := p.Calls(); n != 1 {
+			t.Errorf("provider called %d times for an address it can't locate", n)
+		}
+	})
+
+	// A backoff that would outlast the deadline isn't slept
+	t.Run("deadline", func(t *testing.T) {
+		p := NewMockProvider("mock", 0, MockFailCalls(1, 10, nil))
+		b := NewBroker([]Provider{p}, WithRetry(3, time.Hour, time.Hour))
+		defer b.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		if _, err := b.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, ErrProviderUnavailable) {
+			t.Errorf("got %v, want the first attempt's error", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("gave up after %v", elapsed)
+		}
+		if n := p.Calls(); n != 1 {
+			t.Errorf("provider called %d times, want 1", n)
+		}
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := retryPolicy{maxAttempts: 10, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		retry int
+		want  time.Duration // before jitter
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			// Equal jitter keeps between half and all of the delay
+			if got := r.backoff(tt.retry); got < tt.want/2 || got > tt.want {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", tt.retry, got, tt.want/2, tt.want)
+			}
+		}
+	}
+
+	if got := (retryPolicy{maxAttempts: 3}).backoff(2); got != 0 {
+		t.Errorf("backoff without a base delay = %v, want 0", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "time"
+
+// durationRing is a fixed-capacity ring buffer of durations. Once full, each
+// new sample overwrites the oldest one, so memory use stays constant.
+type durationRing struct {
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newDurationRing(capacity int) *durationRing {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &durationRing{samples: make([]time.Duration, capacity)}
+}
+
+// add stores a sample, overwriting the oldest one when the ring is full
+func (r *durationRing) add(d time.Duration) {
+	r.samples[r.next] = d
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// len returns the number of samples held
+func (r *durationRing) len() int {
+	if r.full {
+		return len(r.samples)
+	}
+	return r.next
+}
+
+// values returns a copy of the samples in no particular order
+func (r *durationRing) values() []time.Duration {
+	out := make([]time.Duration, r.len())
+	copy(out, r.samples[:r.len()])
+	return out
+}
+
+// reset drops all samples
+func (r *durationRing) reset() {
+	r.next = 0
+	r.full = false
+}
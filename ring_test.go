@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDurationRing(t *testing.T) {
+	r := newDurationRing(3)
+	if r.len() != 0 || len(r.values()) != 0 {
+		t.Fatalf("new ring holds %d samples", r.len())
+	}
+
+	for i := 1; i <= 5; i++ {
+		r.add(time.Duration(i))
+	}
+	got := r.values()
+	slices.Sort(got)
+	if want := []time.Duration{3, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want the last three samples %v", got, want)
+	}
+
+	// values is a copy
+	got[0] = 100
+	if slices.Contains(r.values(), 100) {
+		t.Error("modifying values changed the ring")
+	}
+
+	r.reset()
+	if r.len() != 0 {
+		t.Errorf("%d samples after reset", r.len())
+	}
+	r.add(7)
+	if got := r.values(); !slices.Equal(got, []time.Duration{7}) {
+		t.Errorf("after reset and add: got %v", got)
+	}
+
+	if r := newDurationRing(0); len(r.samples) != 1 {
+		t.Errorf("capacity %d for a requested capacity of 0, want 1", len(r.samples))
+	}
+}
+
+// BenchmarkRecordResponseTime records samples from many goroutines at once
+// into a provider's ring, which shouldn't allocate at all
+func BenchmarkRecordResponseTime(b *testing.B) {
+	broker := NewBroker([]Provider{NewMockProvider("mock", 0)})
+	defer broker.Close()
+	ps := broker.providers[0]
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ps.recordResponseTime(time.Millisecond)
+		}
+	})
+}
+
+// BenchmarkUnboundedResponseTimes is the slice the ring replaced, appended
+// to under a mutex and cut back to the last 100 samples every 10,000
+// appends as the cleanup routine used to, for comparison
+func BenchmarkUnboundedResponseTimes(b *testing.B) {
+	var mutex sync.Mutex
+	var samples []time.Duration
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mutex.Lock()
+			samples = append(samples, time.Millisecond)
+			if len(samples) >= 10000 {
+				samples = append([]time.Duration(nil), samples[len(samples)-100:]...)
+			}
+			mutex.Unlock()
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+// ScoreFunc rates a provider from a snapshot of its metrics. Higher scores
+// are preferred by ScoreStrategy and when ordering providers for failover.
+type ScoreFunc func(snapshot ProviderSnapshot) float64
+
+// DefaultScore prioritizes providers with a lower fraction of failed
+// requests and faster response times while also considering available
+// capacity. By default it uses the moving averages. In raw window mode
+// response time is taken at the 95th percentile so occasional long stalls
+// count against a provider instead of being averaged away.
+func DefaultScore(s ProviderSnapshot) float64 {
+	responseTime := float64(s.LatencyEWMA)
+	if s.RawWindow {
+		// Use tail latency rather than the mean
+		responseTime = float64(s.P95ResponseTime)
+	}
+
+	// Calculate score (higher is better)
+	return (1.0 - s.ErrorRate) * (1000.0 / (responseTime + 1.0)) * s.CapacityRemaining
+}
+
+// MeanLatencyScore is DefaultScore using the mean of the recent response
+// time samples in every mode, instead of the moving average or the 95th
+// percentile
+func MeanLatencyScore(s ProviderSnapshot) float64 {
+	return (1.0 - s.ErrorRate) * (1000.0 / (float64(s.AvgResponseTime) + 1.0)) * s.CapacityRemaining
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// errorAverse weights the error rate far above latency
+func errorAverse(s ProviderSnapshot) float64 {
+	return math.Pow(1-s.ErrorRate, 20) * DefaultScore(s)
+}
+
+// scriptedBroker gives a fast provider failing 20% of its lookups and a
+// slower one that never fails identical histories, scored by score
+func scriptedBroker(t *testing.T, score ScoreFunc) *Broker {
+	t.Helper()
+	fast := NewMockProvider("fast", 0, MockLatency(time.Millisecond), MockFailCalls(1, 2, nil))
+	slow := NewMockProvider("slow", 0, MockLatency(10*time.Millisecond))
+	b := NewBroker([]Provider{fast, slow}, WithScoreFunc(score), WithStrategy(&ScoreStrategy{}))
+	t.Cleanup(func() { b.Close() })
+
+	for _, name := range []string{"fast", "slow"} {
+		for i := range 10 {
+			b.GetLocationFrom(context.Background(), name, testIP(i))
+		}
+	}
+	return b
+}
+
+func TestWithScoreFunc(t *testing.T) {
+	tests := []struct {
+		name  string
+		score ScoreFunc
+		want  string
+	}{
+		{"default", DefaultScore, "fast"},
+		{"error averse", errorAverse, "slow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := scriptedBroker(t, tt.score)
+			if got := b.selectBestProvider(testIP(100)).provider.Name(); got != tt.want {
+				t.Errorf("selected %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultScore(t *testing.T) {
+	base := ProviderSnapshot{LatencyEWMA: 50 * time.Millisecond, P95ResponseTime: 50 * time.Millisecond, CapacityRemaining: 1}
+	with := func(modify func(*ProviderSnapshot)) ProviderSnapshot {
+		s := base
+		modify(&s)
+		return s
+	}
+
+	better := []struct {
+		name        string
+		good, worse ProviderSnapshot
+	}{
+		{"fewer errors", base, with(func(s *ProviderSnapshot) { s.ErrorRate = 0.1 })},
+		{"faster", base, with(func(s *ProviderSnapshot) { s.LatencyEWMA *= 2 })},
+		{"more capacity", base, with(func(s *ProviderSnapshot) { s.CapacityRemaining = 0.5 })},
+		{"faster tail in raw mode",
+			with(func(s *ProviderSnapshot) { s.RawWindow = true }),
+			with(func(s *ProviderSnapshot) { s.RawWindow = true; s.P95ResponseTime *= 4 })},
+	}
+	for _, tt := range better {
+		if DefaultScore(tt.good) <= DefaultScore(tt.worse) {
+			t.Errorf("%s: %v doesn't beat %v", tt.name, DefaultScore(tt.good), DefaultScore(tt.worse))
+		}
+	}
+
+	if s := DefaultScore(with(func(s *ProviderSnapshot) { s.ErrorRate = 1 })); s != 0 {
+		t.Errorf("always failing scores %v, want 0", s)
+	}
+	if s := DefaultScore(with(func(s *ProviderSnapshot) { s.CapacityRemaining = 0 })); s != 0 {
+		t.Errorf("out of capacity scores %v, want 0", s)
+	}
+	// The moving average is ignored in raw mode and vice versa
+	raw := with(func(s *ProviderSnapshot) { s.RawWindow = true; s.LatencyEWMA = time.Hour })
+	if DefaultScore(raw) != DefaultScore(with(func(s *ProviderSnapshot) { s.RawWindow = true })) {
+		t.Error("raw mode score depends on the moving average")
+	}
+}
+
+func TestMeanLatencyScore(t *testing.T) {
+	fast := ProviderSnapshot{AvgResponseTime: 10 * time.Millisecond, LatencyEWMA: time.Second, CapacityRemaining: 1}
+	slow := ProviderSnapshot{AvgResponseTime: 100 * time.Millisecond, LatencyEWMA: time.Millisecond, CapacityRemaining: 1}
+	if MeanLatencyScore(fast) <= MeanLatencyScore(slow) {
+		t.Error("MeanLatencyScore doesn't rank by the mean response time")
+	}
+}
+
+func TestErrorRateDecidesSelection(t *testing.T) {
+	modes := []struct {
+		name string
+		opts []BrokerOption
+	}{
+		{"moving average", nil},
+		{"raw window", []BrokerOption{WithRawStatsWindow()}},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			half := NewMockProvider("half", 0, MockLatency(5*time.Millisecond), MockFailRate(0.5, 1, nil))
+			rare := NewMockProvider("rare", 0, MockLatency(5*time.Millisecond), MockFailRate(0.01, 2, nil))
+			b := NewBroker([]Provider{half, rare}, append(mode.opts, WithStrategy(&ScoreStrategy{}))...)
+			defer b.Close()
+
+			for _, name := range []string{"half", "rare"} {
+				for i := range 100 {
+					b.GetLocationFrom(context.Background(), name, testIP(i))
+				}
+			}
+			snap, err := b.Snapshot("half")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The rate is a fraction of requests, not errors per second
+			if snap.ErrorRate < 0.3 || snap.ErrorRate > 0.7 {
+				t.Errorf("half's error rate %v, want about 0.5", snap.ErrorRate)
+			}
+
+			for i := range 100 {
+				if got := b.selectBestProvider(testIP(i)).provider.Name(); got != "rare" {
+					t.Fatalf("%s selected, want rare", got)
+				}
+			}
+		})
+	}
+}
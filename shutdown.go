@@ -0,0 +1,53 @@
+package main
+
+import "context"
+
+// Shutdown stops the broker's background work and rejects new lookups with
+// ErrBrokerClosed. It then waits for in-flight lookups to finish, returning
+// ctx.Err() if ctx is done first, and saves the monthly quota usage. Calling
+// Shutdown more than once is safe.
+func (b *Broker) Shutdown(ctx context.Context) error {
+	b.closeMutex.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	b.closeMutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(drained)
+	}()
+
+	defer b.quotaState.flush(b)
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close shuts the broker down, waiting for all in-flight lookups to finish
+func (b *Broker) Close() error {
+	return b.Shutdown(context.Background())
+}
+
+// acquire registers an in-flight lookup. It returns false if the broker has
+// been closed, in which case the lookup must not proceed.
+func (b *Broker) acquire() bool {
+	b.closeMutex.RLock()
+	defer b.closeMutex.RUnlock()
+
+	if b.closed {
+		return false
+	}
+	b.inFlight.Add(1)
+	return true
+}
+
+// release marks an in-flight lookup registered with acquire as finished
+func (b *Broker) release() {
+	b.inFlight.Done()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestBrokerCloseStopsGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for range 1000 {
+		b := NewBroker([]Provider{NewMockProvider("mock", 0)},
+			WithCleanupInterval(time.Millisecond), WithHealthProbes(time.Millisecond, "8.8.8.8"))
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stopped goroutines take a moment to exit
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("%d goroutines before creating and closing 1000 brokers, %d after", before, after)
+	}
+}
+
+func TestBrokerClosed(t *testing.T) {
+	p := NewMockProvider("mock", 0)
+	b := NewBroker([]Provider{p})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := b.GetLocation(ctx, "8.8.8.8"); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("GetLocation: got %v, want ErrBrokerClosed", err)
+	}
+	_, errs := b.GetLocations(ctx, []string{"8.8.8.8", "1.1.1.1"})
+	for i, err := range errs {
+		if !errors.Is(err, ErrBrokerClosed) {
+			t.Errorf("GetLocations[%d]: got %v, want ErrBrokerClosed", i, err)
+		}
+	}
+	if n := p.Calls(); n != 0 {
+		t.Errorf("provider called %d times after Close", n)
+	}
+}
+
+func TestBrokerShutdownWaits(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("mock", 0, MockGate(gate))
+	b := NewBroker([]Provider{p})
+
+	result := make(chan error)
+	go func() {
+		_, err := b.GetLocation(context.Background(), "8.8.8.8")
+		result <- err
+	}()
+	for p.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The lookup outlasts the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	// New lookups are already turned away
+	if _, err := b.GetLocation(context.Background(), "1.1.1.1"); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("got %v, want ErrBrokerClosed", err)
+	}
+
+	// The lookup in flight completes and Shutdown sees it finish
+	close(gate)
+	if err := <-result; err != nil {
+		t.Errorf("lookup in flight during Shutdown: %v", err)
+	}
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Errorf("got %v once drained", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flight is a lookup in progress that callers can wait on. location and
+// err are set before done is closed.
+type flight struct {
+	done     chan struct{}
+	cancel   context.CancelFunc
+	waiters  int
+	location *Location
+	err      error
+
+	// deadline is the latest of the waiters' deadlines; unbounded is set
+	// once a waiter without one joined. Both are guarded by the group's
+	// mutex.
+	deadline  time.Time
+	unbounded bool
+}
+
+// flightGroup coalesces concurrent lookups for the same key into a single
+// upstream call
+type flightGroup struct {
+	// inFlight, if set, counts the running lookups, so the broker's
+	// Shutdown waits for those every caller has stopped waiting on
+	inFlight *sync.WaitGroup
+
+	mutex   sync.Mutex
+	flights map[string]*flight
+}
+
+// do runs fn once for all concurrent callers with the same key. fn runs on
+// its own goroutine, on a context that keeps the first caller's values but
+// not its cancellation, so a caller giving up doesn't fail the others. Its
+// deadline is the latest of the callers' deadlines. Each caller waits only
+// until its own ctx is done, and fn's context is cancelled once every
+// caller has given up. A panic in fn is returned to every caller as an
+// error. Every caller receives its own copy of the location so nobody can
+// mutate another caller's result.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*Location, error)) (*Location, error) {
+	g.mutex.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		base, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		if g.inFlight != nil {
+			g.inFlight.Add(1)
+		}
+		go g.run(flightContext{Context: base, group: g, flight: f}, key, f, fn)
+	}
+	f.waiters++
+	if deadline, ok := ctx.Deadline(); !ok {
+		f.unbounded = true
+	} else if deadline.After(f.deadline) {
+		f.deadline = deadline
+	}
+	g.mutex.Unlock()
+
+	select {
+	case <-f.done:
+		return copyLocation(f.location), f.err
+	case <-ctx.Done():
+		g.leave(key, f)
+		return nil, ctx.Err()
+	}
+}
+
+// run calls fn for the flight f and hands its result to the waiters
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(ctx context.Context) (*Location, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.location, f.err = nil, fmt.Errorf("lookup of %s panicked: %v", key, r)
+		}
+		f.cancel()
+		g.forget(key, f)
+		close(f.done)
+		if g.inFlight != nil {
+			g.inFlight.Done()
+		}
+	}()
+	f.location, f.err = fn(ctx)
+}
+
+// leave drops a caller that stopped waiting on f. When it was the last one
+// the lookup is cancelled, and later callers start a new flight.
+func (g *flightGroup) leave(key string, f *flight) {
+	g.mutex.Lock()
+	f.waiters--
+	last := f.waiters == 0
+	g.mutex.Unlock()
+
+	if last {
+		f.cancel()
+		g.forget(key, f)
+	}
+}
+
+// flightContext is the context a shared lookup runs on. It reports the
+// flight's deadline, so the lookup can tell how long somebody is still
+// waiting, e.g. before sleeping between retries. The deadline isn't
+// enforced; the context is cancelled once every waiter has given up.
+type flightContext struct {
+	context.Context
+	group  *flightGroup
+	flight *flight
+}
+
+func (c flightContext) Deadline() (time.Time, bool) {
+	c.group.mutex.Lock()
+	defer c.group.mutex.Unlock()
+	if c.flight.unbounded {
+		return time.Time{}, false
+	}
+	return c.flight.deadline, true
+}
+
+// forget removes f from the group unless a newer flight took its place
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// copyLocation returns a copy of loc, or nil if loc is nil
+func copyLocation(loc *Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	cp := *loc
+	return &cp
+}
+
+// flightKey identifies calls that can share an upstream lookup. Calls using
+// a different routing mode must not be merged with default lookups.
+func (co callOptions) flightKey(ip string) string {
+	parts := []string{ip}
+	if co.race {
+		parts = append(parts, "race")
+	}
+	if co.provider != "" {
+		parts = append(parts, "provider="+co.provider)
+	}
+	if co.refresh {
+		parts = append(parts, "refresh")
+	}
+	return strings.Join(parts, "|")
+}
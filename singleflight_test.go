@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBrokerCoalescesLookups(t *testing.T) {
+	gate := make(chan struct{})
+	p := NewMockProvider("mock", 0, MockGate(gate), MockResponse("8.8.8.8", MockCities["Mountain View"]))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	const callers = 100
+	var wg sync.WaitGroup
+	results := make([]*Location, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = b.GetLocation(context.Background(), "8.8.8.8")
+		}()
+	}
+	// Hold the lookup until every caller has joined it
+	for b.flights.waiters("8.8.8.8") < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+
+	if n := p.Calls(); n != 1 {
+		t.Errorf("%d concurrent lookups made %d provider calls, want 1", callers, n)
+	}
+	for i := range callers {
+		if errs[i] != nil || results[i].City != "Mountain View" {
+			t.Fatalf("caller %d: got %+v, %v", i, results[i], errs[i])
+		}
+	}
+	// Every caller has its own copy
+	results[0].City = "changed"
+	if results[1].City != "Mountain View" {
+		t.Error("callers share one Location")
+	}
+}
+
+func TestFlightGroupCallerLeaves(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (*Location, error) {
+		close(started)
+		select {
+		case <-release:
+			return &Location{IP: "8.8.8.8"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// The first caller giving up doesn't fail the second
+	first, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := g.do(first, "k", fn)
+		firstErr <- err
+	}()
+	<-started
+	second := make(chan error)
+	go func() {
+		_, err := g.do(context.Background(), "k", fn)
+		second <- err
+	}()
+	for g.waiters("k") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller: got %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("second caller failed with %v after the first left", err)
+	}
+}
+
+func TestFlightGroupLastCallerCancels(t *testing.T) {
+	var g flightGroup
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for g.waiters("k") < 1 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	_, err := g.do(ctx, "k", func(ctx context.Context) (*Location, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("lookup not cancelled after its only caller left")
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	var g flightGroup
+	_, err := g.do(context.Background(), "k", func(context.Context) (*Location, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("panic not reported")
+	}
+	// The group is usable afterwards
+	loc, err := g.do(context.Background(), "k", func(context.Context) (*Location, error) {
+		return &Location{IP: "8.8.8.8"}, nil
+	})
+	if err != nil || loc.IP != "8.8.8.8" {
+		t.Errorf("after a panic got %+v, %v", loc, err)
+	}
+}
+
+func TestFlightGroupDeadline(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	deadlines := make(chan time.Time, 1)
+	fn := func(ctx context.Context) (*Location, error) {
+		<-release
+		if d, ok := ctx.Deadline(); ok {
+			deadlines <- d
+		} else {
+			deadlines <- time.Time{}
+		}
+		return &Location{}, nil
+	}
+
+	join := func(ctx context.Context) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := g.do(ctx, "k", fn)
+			done <- err
+		}()
+		return done
+	}
+
+	// The latest deadline among the callers wins
+	soon := time.Now().Add(time.Hour)
+	later := soon.Add(time.Hour)
+	ctx1, cancel1 := context.WithDeadline(context.Background(), soon)
+	defer cancel1()
+	ctx2, cancel2 := context.WithDeadline(context.Background(), later)
+	defer cancel2()
+	done1, done2 := join(ctx1), join(ctx2)
+	for g.waiters("k") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done1
+	<-done2
+	if d := <-deadlines; !d.Equal(later) {
+		t.Errorf("deadline %v, want the later caller's %v", d, later)
+	}
+
+	// A caller without a deadline leaves the lookup without one
+	release = make(chan struct{})
+	done1, done2 = join(ctx1), join(context.Background())
+	for g.waiters("k") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done1
+	<-done2
+	if d := <-deadlines; !d.IsZero() {
+		t.Errorf("deadline %v, want none", d)
+	}
+}
+
+// waiters returns the number of callers waiting on the flight for key
+func (g *flightGroup) waiters(key string) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f.waiters
+	}
+	return 0
+}
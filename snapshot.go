@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// SnapshotEntry is a single cache entry in an exported snapshot
+type SnapshotEntry struct {
+	Key      string    `json:"key"`
+	Location *Location `json:"location"`
+	// Expires is when the entry expires; zero means never
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// CacheExporter can be implemented by a Cache whose entries can be listed.
+// Export calls fn for every unexpired entry and stops at the first error.
+// It should not block other cache operations for its whole duration.
+type CacheExporter interface {
+	Export(ctx context.Context, fn func(SnapshotEntry) error) error
+}
+
+// exportChunk is how many entries are copied out of a cache per lock
+const exportChunk = 512
+
+// ExportSnapshot writes every cached result to w as JSON lines so another
+// instance can load them with ImportSnapshot. It returns the number of
+// entries written, or ErrSnapshotUnsupported if the cache can't list its
+// entries.
+func (b *Broker) ExportSnapshot(ctx context.Context, w io.Writer) (int, error) {
+	if b.cache == nil {
+		return 0, ErrCacheDisabled
+	}
+	exporter, ok := b.cache.(CacheExporter)
+	if !ok {
+		return 0, ErrSnapshotUnsupported
+	}
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	written := 0
+	err := exporter.Export(ctx, func(entry SnapshotEntry) error {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, buf.Flush()
+}
+
+// ImportSnapshot loads entries written by ExportSnapshot into the cache,
+// keeping their remaining lifetime. Entries that have already expired are
+// skipped, as are malformed lines.
+func (b *Broker) ImportSnapshot(ctx context.Context, r io.Reader) (imported, skipped int, err error) {
+	if b.cache == nil {
+		return 0, 0, ErrCacheDisabled
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	now := time.Now()
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return imported, skipped, err
+		}
+
+		var entry SnapshotEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Key == "" || entry.Location == nil {
+			skipped++
+			continue
+		}
+		var ttl time.Duration
+		if !entry.Expires.IsZero() {
+			if ttl = entry.Expires.Sub(now); ttl <= 0 {
+				skipped++
+				continue
+			}
+		}
+		if err := b.cache.Set(ctx, entry.Key, entry.Location, ttl); err != nil {
+			b.cacheFailed("set", entry.Key, err)
+			return imported, skipped, err
+		}
+		imported++
+	}
+	return imported, skipped, scanner.Err()
+}
+
+// Export lists the cache's unexpired entries, copying them out a chunk at a
+// time so other callers aren't blocked for long
+func (c *MemoryCache) Export(ctx context.Context, fn func(SnapshotEntry) error) error {
+	c.mutex.Lock()
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	c.mutex.Unlock()
+
+	for start := 0; start < len(keys); start += exportChunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		chunk := make([]SnapshotEntry, 0, exportChunk)
+		c.mutex.Lock()
+		for _, key := range keys[start:min(start+exportChunk, len(keys))] {
+			entry, ok := c.entries[key]
+			if !ok || (!entry.expires.IsZero() && !now.Before(entry.expires)) {
+				continue
+			}
+			chunk = append(chunk, SnapshotEntry{
+				Key:      key,
+				Location: copyLocation(&entry.location),
+				Expires:  entry.expires,
+			})
+		}
+		c.mutex.Unlock()
+
+		for _, entry := range chunk {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Export lists the cache's unexpired entries, reading them from disk a chunk
+// at a time
+func (c *DiskCache) Export(ctx context.Context, fn func(SnapshotEntry) error) error {
+	c.mutex.Lock()
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	c.mutex.Unlock()
+
+	for start := 0; start < len(keys); start += exportChunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk := make([]SnapshotEntry, 0, exportChunk)
+		for _, key := range keys[start:min(start+exportChunk, len(keys))] {
+			c.mutex.Lock()
+			entry, ok := c.index[key]
+			c.mutex.Unlock()
+			if !ok {
+				continue
+			}
+			loc, ok, err := c.Get(ctx, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				chunk = append(chunk, SnapshotEntry{Key: key, Location: loc, Expires: entry.expires})
+			}
+		}
+
+		for _, entry := range chunk {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
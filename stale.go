@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// staleRefreshTimeout bounds a single background refresh
+	staleRefreshTimeout = 10 * time.Second
+	// staleRefreshBackoff is how long to wait before refreshing an IP again
+	// after a background refresh of it failed
+	staleRefreshBackoff = 30 * time.Second
+	// maxStaleRefreshes caps the background refreshes running at once
+	maxStaleRefreshes = 4
+)
+
+// staleRefresher tracks background refreshes of stale cache entries so each
+// IP has at most one in progress and failing IPs are not retried constantly
+type staleRefresher struct {
+	mutex sync.Mutex
+	// next maps an IP to the earliest time it may be refreshed again. IPs
+	// with a refresh in progress map to the zero time.
+	next    map[string]time.Time
+	running int
+}
+
+// start reports whether a refresh of ip may begin now, claiming it if so
+func (r *staleRefresher) start(ip string, now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.next == nil {
+		r.next = make(map[string]time.Time)
+	}
+	if next, ok := r.next[ip]; ok && (next.IsZero() || now.Before(next)) {
+		return false
+	}
+	if r.running >= maxStaleRefreshes {
+		return false
+	}
+	r.next[ip] = time.Time{}
+	r.running++
+	return true
+}
+
+// finish releases ip, holding off further refreshes for a while if this
+// one failed
+func (r *staleRefresher) finish(ip string, failed bool, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.running--
+	if failed {
+		r.next[ip] = now.Add(staleRefreshBackoff)
+	} else {
+		delete(r.next, ip)
+	}
+
+	// Forget IPs whose backoff has passed
+	for key, next := range r.next {
+		if !next.IsZero() && !now.Before(next) {
+			delete(r.next, key)
+		}
+	}
+}
+
+// freshness classifies a cached location: fresh entries are served as they are,
+// stale ones are served marked Stale while they are refreshed, and expired
+// ones are treated as a miss
+func (b *Broker) freshness(loc *Location, now time.Time) (fresh, stale bool) {
+	ttl := b.entryTTL(loc)
+	if ttl <= 0 || loc.CachedAt.IsZero() {
+		return true, false
+	}
+	age := now.Sub(loc.CachedAt)
+	if age < ttl {
+		return true, false
+	}
+	return false, age < ttl+b.staleGrace
+}
+
+// refreshStale looks up ip again in the background and replaces the cache
+// entry under key. Refreshes go through normal provider selection, so they
+// respect rate limits and are shared with any concurrent live lookup of ip.
+func (b *Broker) refreshStale(key, ip string) {
+	if !b.refresher.start(key, time.Now()) {
+		return
+	}
+	if !b.acquire() {
+		b.refresher.finish(key, false, time.Now())
+		return
+	}
+
+	go func() {
+		defer b.release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), staleRefreshTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-b.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		var co callOptions
+		_, err := b.flights.do(ctx, co.flightKey(ip), func(ctx context.Context) (*Location, error) {
+			location, err := b.lookupWithRetry(ctx, ip, co)
+			if err == nil {
+				b.cacheSet(ctx, key, location)
+			}
+			return location, err
+		})
+		b.refresher.finish(key, err != nil, time.Now())
+	}()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	const refreshLatency = 300 * time.Millisecond
+	p := NewMockProvider("mock", 0, MockLatencyFunc(func(call int) time.Duration {
+		if call == 1 {
+			return 0
+		}
+		return refreshLatency
+	}))
+	b := NewBroker([]Provider{p}, WithCache(100, 100*time.Millisecond), WithStaleWhileRevalidate(time.Hour))
+	defer b.Close()
+	ctx := context.Background()
+	ip := testIP(1)
+
+	first, err := b.GetLocation(ctx, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	// Concurrent lookups of the expired entry are all served from the cache
+	// straight away while a single refresh runs
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			loc, err := b.GetLocation(ctx, ip)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !loc.Stale || !loc.FromCache {
+				t.Errorf("got stale %v, from cache %v; want the stale entry", loc.Stale, loc.FromCache)
+			}
+			if elapsed := time.Since(start); elapsed >= refreshLatency {
+				t.Errorf("stale entry served after %v, waited for the refresh", elapsed)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The refresh replaces the entry
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entry, ok, _ := b.cache.Get(ctx, ip)
+		if ok && entry.RetrievedAt.After(first.RetrievedAt) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale entry not replaced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.Calls(); n != 2 {
+		t.Errorf("%d provider calls, want the first lookup and one refresh", n)
+	}
+	loc, err := b.GetLocation(ctx, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Stale || !loc.RetrievedAt.After(first.RetrievedAt) {
+		t.Errorf("got stale %v retrieved at %v, want the refreshed entry", loc.Stale, loc.RetrievedAt)
+	}
+}
+
+func TestStaleRefreshBackoff(t *testing.T) {
+	p := NewMockProvider("mock", 0, MockFailCalls(2, 100, ErrProviderUnavailable))
+	b := NewBroker([]Provider{p}, WithCache(100, 50*time.Millisecond), WithStaleWhileRevalidate(time.Hour))
+	defer b.Close()
+	ctx := context.Background()
+
+	if _, err := b.GetLocation(ctx, testIP(1)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A failed refresh isn't retried by the lookups that follow it
+	for range 5 {
+		loc, err := b.GetLocation(ctx, testIP(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loc.Stale {
+			t.Error("got a fresh entry from a failing provider")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := p.Calls(); n != 2 {
+		t.Errorf("%d provider calls, want the first lookup and one failed refresh", n)
+	}
+}
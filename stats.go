@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// ProviderSnapshot is a point-in-time copy of a provider's quality metrics
+type ProviderSnapshot struct {
+	Name                 string
+	RequestsThisMinute   int
+	MaxRequestsPerMinute int
+	ErrorsInWindow       int
+	// ErrorRate is the fraction of recent requests that failed, taken from
+	// the raw window or the moving average depending on the stats mode
+	ErrorRate       float64
+	AvgResponseTime time.Duration
+	P50ResponseTime time.Duration
+	P95ResponseTime time.Duration
+	P99ResponseTime time.Duration
+	// CapacityRemaining is the unused fraction of the per-minute rate limit
+	CapacityRemaining float64
+	StatsWindow       time.Duration
+	// CostPerRequest is the configured price of one lookup and CostTier the
+	// provider's cost tier
+	CostPerRequest float64
+	CostTier       CostTier
+	// SpendToday is the estimated spend on this provider for the current
+	// UTC day
+	SpendToday float64
+	// DailyQuota is the configured requests per UTC day (0 means unlimited)
+	// and DailyRemaining what is left of it today
+	DailyQuota     int
+	DailyRemaining int
+	// MonthlyQuota is the configured requests per billing month (0 means
+	// unlimited), MonthlyRemaining what is left of it and MonthlyResetsAt
+	// when the next month starts
+	MonthlyQuota     int
+	MonthlyRemaining int
+	MonthlyResetsAt  time.Time
+
+	// TotalRequests counts every request sent since the provider was added
+	TotalRequests int
+	// CompletedRequests counts requests that finished with a result or an
+	// error, i.e. the samples behind the quality metrics
+	CompletedRequests int
+	MaxResponseTime   time.Duration
+	// Disagreements counts consensus votes where this provider was outvoted
+	Disagreements int
+	Enabled       bool
+	// Draining is set while DrainProvider keeps new lookups away from the
+	// provider, and InFlight counts its calls not yet finished
+	Draining     bool
+	InFlight     int
+	BreakerState BreakerState
+	// Selectable reports whether the provider could serve a lookup right now
+	Selectable bool
+	// QuarantinedUntil is when a quarantined provider is re-admitted; it is
+	// zero when the provider is not quarantined
+	Quarantined      bool
+	QuarantinedUntil time.Time
+	// ReportedRemaining is the requests left in the current window as last
+	// reported by a provider implementing QuotaReporter, valid when
+	// QuotaReported is set
+	QuotaReported     bool
+	ReportedRemaining int
+	// UpstreamLimitedUntil is when a provider whose service rate limited us
+	// may be selected again; it is zero when no such limit is in force
+	UpstreamLimitedUntil time.Time
+	// Keys is the usage of each API key of a provider implementing
+	// KeyUsageReporter, such as a KeyPoolProvider
+	Keys []KeyUsage
+
+	// RawWindow reports whether the provider is scored from the raw stats
+	// window rather than the moving averages below
+	RawWindow bool
+	// LatencyEWMA and ErrorRateEWMA are time-decayed averages of response
+	// time and of the fraction of failed requests
+	LatencyEWMA   time.Duration
+	ErrorRateEWMA float64
+
+	// Health probe traffic, tracked separately from organic lookups
+	ProbeSuccesses int
+	ProbeFailures  int
+	LastProbeAt    time.Time
+}
+
+// Stats returns a snapshot of every provider's metrics. The snapshots are
+// copies and safe to keep or modify.
+func (b *Broker) Stats() []ProviderSnapshot {
+	b.providerMutex.RLock()
+	providers := b.providers
+	b.providerMutex.RUnlock()
+
+	snaps := make([]ProviderSnapshot, len(providers))
+	for i, ps := range providers {
+		snaps[i] = ps.fullSnapshot()
+	}
+	return snaps
+}
+
+// fullSnapshot extends snapshot with the provider's live selection status
+func (ps *ProviderStats) fullSnapshot() ProviderSnapshot {
+	snap := ps.snapshot()
+
+	// Reading the breaker state may move it to half-open, so this part
+	// needs the write lock
+	ps.mutex.Lock()
+	snap.BreakerState = ps.currentState()
+	snap.Selectable = ps.selectableLocked()
+	snap.Quarantined = ps.quarantinedAt(time.Now())
+	snap.QuarantinedUntil = ps.quarantine.until
+	ps.mutex.Unlock()
+
+	return snap
+}
+
+// snapshot copies the provider's current metrics
+func (ps *ProviderStats) snapshot() ProviderSnapshot {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	snap := ProviderSnapshot{
+		Name:                 ps.provider.Name(),
+		RequestsThisMinute:   ps.requestsThisMinuteAt(time.Now()),
+		MaxRequestsPerMinute: ps.provider.GetMaxRequestsPerMinute(),
+		ErrorsInWindow:       ps.errorsInWindow(),
+		ErrorRate:            ps.errorRate(),
+		StatsWindow:          ps.statsWindow,
+		CostPerRequest:       ps.cost.perRequest,
+		CostTier:             ps.costTier,
+		SpendToday:           ps.cost.spentOn(time.Now()),
+		DailyQuota:           ps.daily.limit,
+		DailyRemaining:       ps.daily.remaining(time.Now()),
+		MonthlyQuota:         ps.monthly.limit,
+		MonthlyRemaining:     ps.monthly.remaining(time.Now()),
+		TotalRequests:        ps.totalRequests,
+		CompletedRequests:    ps.completedRequests,
+		Disagreements:        ps.disagreements,
+		Enabled:              ps.enabled,
+		Draining:             ps.draining,
+		InFlight:             ps.inFlight,
+		BreakerState:         ps.breaker.state,
+		ProbeSuccesses:       ps.probes.successes,
+		ProbeFailures:        ps.probes.failures,
+		LastProbeAt:          ps.probes.lastProbeAt,
+		RawWindow:            ps.rawWindow,
+		LatencyEWMA:          time.Duration(ps.latencyEWMA.value()),
+		ErrorRateEWMA:        ps.errorEWMA.value(),
+	}
+	snap.CapacityRemaining = fractionLeft(ps.limiter, time.Now())
+	if ps.monthly.limit > 0 {
+		snap.MonthlyResetsAt = ps.monthly.resetsAt(time.Now())
+	}
+	if remaining, _, ok := ps.reportedQuota(); ok {
+		snap.QuotaReported = true
+		snap.ReportedRemaining = remaining
+		// The service's figure wins when it knows of less capacity than we do
+		if limit := ps.limiter.Limit(); limit > 0 {
+			snap.CapacityRemaining = min(snap.CapacityRemaining, max(float64(remaining), 0)/float64(limit))
+		}
+	}
+	if !ps.upstreamAllows(time.Now()) {
+		snap.UpstreamLimitedUntil = ps.upstreamLimitedUntil
+	}
+	if reporter, ok := asProvider[KeyUsageReporter](ps.provider); ok {
+		snap.Keys = reporter.KeyUsage()
+	}
+
+	ps.responseTimesMutex.RLock()
+	samples := ps.responseTimes.values()
+	ps.responseTimesMutex.RUnlock()
+
+	if len(samples) > 0 {
+		var total time.Duration
+		for _, rt := range samples {
+			total += rt
+		}
+		snap.AvgResponseTime = total / time.Duration(len(samples))
+
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		snap.P50ResponseTime = percentile(samples, 50)
+		snap.P95ResponseTime = percentile(samples, 95)
+		snap.P99ResponseTime = percentile(samples, 99)
+		snap.MaxResponseTime = samples[len(samples)-1]
+	}
+
+	return snap
+}
+
+// responseTimePercentile returns the p-th percentile of the provider's recent
+// response times, with ok false before it has any
+func (ps *ProviderStats) responseTimePercentile(p float64) (d time.Duration, ok bool) {
+	ps.responseTimesMutex.RLock()
+	samples := ps.responseTimes.values()
+	ps.responseTimesMutex.RUnlock()
+
+	if len(samples) == 0 {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return percentile(samples, p), true
+}
+
+// percentile returns the p-th percentile of sorted samples using the
+// nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestCounts(t *testing.T) {
+	providers := []*MockProvider{NewMockProvider("a", 0), NewMockProvider("b", 0), NewMockProvider("c", 0)}
+	b := NewBroker([]Provider{providers[0], providers[1], providers[2]},
+		WithStrategy(&RoundRobinStrategy{}), WithCache(100, time.Hour))
+	defer b.Close()
+	ctx := context.Background()
+
+	for i := range 9 {
+		if _, err := b.GetLocation(ctx, testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Cache hits don't reach a provider
+	for i := range 9 {
+		if _, err := b.GetLocation(ctx, testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, snap := range b.Stats() {
+		if snap.TotalRequests != 3 || snap.CompletedRequests != 3 || snap.RequestsThisMinute != 3 {
+			t.Errorf("%s: %d requests, %d completed, %d this minute; want 3 each", snap.Name, snap.TotalRequests, snap.CompletedRequests, snap.RequestsThisMinute)
+		}
+	}
+	for _, p := range providers {
+		if n := p.Calls(); n != 3 {
+			t.Errorf("%s received %d calls, want 3", p.Name(), n)
+		}
+	}
+}
+
+// TestRequestCountsAgree checks that the broker counts exactly the calls
+// providers receive, including failures, failovers and calls turned away
+// for lack of capacity
+func TestRequestCountsAgree(t *testing.T) {
+	providers := []*MockProvider{
+		NewMockProvider("a", 0, MockFailRate(0.3, 1, nil)),
+		NewMockProvider("b", 5, MockFailCalls(2, 3, nil)),
+		NewMockProvider("c", 0),
+	}
+	b := NewBroker([]Provider{providers[0], providers[1], providers[2]}, WithStrategy(&RoundRobinStrategy{}))
+	defer b.Close()
+
+	const lookups = 30
+	for i := range lookups {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	total := 0
+	for i, snap := range b.Stats() {
+		calls := providers[i].Calls()
+		if snap.TotalRequests != calls || snap.RequestsThisMinute != calls || snap.CompletedRequests != calls {
+			t.Errorf("%s received %d calls; broker counted %d requests, %d this minute, %d completed",
+				snap.Name, calls, snap.TotalRequests, snap.RequestsThisMinute, snap.CompletedRequests)
+		}
+		total += calls
+	}
+	if total <= lookups {
+		t.Errorf("%d calls for %d lookups with failures to fail over from", total, lookups)
+	}
+	if n := providers[1].Calls(); n > 5 {
+		t.Errorf("b received %d calls with a limit of 5 a minute", n)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	// One call in ten stalls
+	p := NewMockProvider("mock", 0, MockLatencyFunc(func(call int) time.Duration {
+		if call%10 == 0 {
+			return 50 * time.Millisecond
+		}
+		return time.Millisecond
+	}))
+	b := NewBroker([]Provider{p})
+	defer b.Close()
+
+	for i := range 100 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := b.Snapshot("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.P50ResponseTime >= 10*time.Millisecond {
+		t.Errorf("p50 %v, want the fast mode", snap.P50ResponseTime)
+	}
+	if snap.P95ResponseTime < 50*time.Millisecond || snap.P99ResponseTime < 50*time.Millisecond {
+		t.Errorf("p95 %v, p99 %v; want the slow mode", snap.P95ResponseTime, snap.P99ResponseTime)
+	}
+	// The mean hides the stalls
+	if snap.AvgResponseTime >= 10*time.Millisecond {
+		t.Errorf("mean %v, want well below the stalls", snap.AvgResponseTime)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		samples []time.Duration
+		p       float64
+		want    time.Duration
+	}{
+		{sorted, 50, 50 * time.Millisecond},
+		{sorted, 95, 95 * time.Millisecond},
+		{sorted, 99, 99 * time.Millisecond},
+		{sorted, 100, 100 * time.Millisecond},
+		{sorted[:1], 50, time.Millisecond},
+		{sorted[:1], 0, time.Millisecond},
+		{nil, 95, 0},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.samples, tt.p); got != tt.want {
+			t.Errorf("p%v of %d samples: got %v, want %v", tt.p, len(tt.samples), got, tt.want)
+		}
+	}
+}
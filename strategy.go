@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// SelectionStrategy picks the provider that should serve the next lookup.
+// Candidates are never empty and contain only providers with capacity left,
+// in registration order. Implementations must be safe for concurrent use.
+type SelectionStrategy interface {
+	Select(candidates []*ProviderStats) *ProviderStats
+}
+
+// KeyedSelectionStrategy is implemented by strategies that take the looked
+// up IP into account. The broker calls SelectFor instead of Select for them.
+type KeyedSelectionStrategy interface {
+	SelectionStrategy
+	SelectFor(ip string, candidates []*ProviderStats) *ProviderStats
+}
+
+// selectFor asks the strategy for a provider, passing the IP along if the
+// strategy can use it
+func selectFor(s SelectionStrategy, ip string, candidates []*ProviderStats) *ProviderStats {
+	if keyed, ok := s.(KeyedSelectionStrategy); ok {
+		return keyed.SelectFor(ip, candidates)
+	}
+	return s.Select(candidates)
+}
+
+// ScoreStrategy picks the provider with the best combination of error rate,
+// response time and remaining capacity.
+//
+// With Epsilon set it also explores: that share of requests goes to a random
+// candidate, preferring providers with fewer than MinSamples completed
+// requests. Such cold providers are otherwise left out of the greedy choice
+// while warm ones exist, so a new provider neither floods with traffic nor
+// starves, and a provider with bad stats still gets the occasional request
+// that lets it recover.
+type ScoreStrategy struct {
+	MinSamples int
+	Epsilon    float64
+}
+
+func (s *ScoreStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	if s.Epsilon <= 0 {
+		return bestScored(candidates)
+	}
+
+	var warm, cold []*ProviderStats
+	for _, ps := range candidates {
+		if ps.completedCount() < s.MinSamples {
+			cold = append(cold, ps)
+		} else {
+			warm = append(warm, ps)
+		}
+	}
+
+	if rand.Float64() < s.Epsilon {
+		if len(cold) > 0 {
+			return cold[rand.Intn(len(cold))]
+		}
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	if len(warm) > 0 {
+		return bestScored(warm)
+	}
+	return bestScored(candidates)
+}
+
+// bestScored returns the candidate with the highest score
+func bestScored(candidates []*ProviderStats) *ProviderStats {
+	var bestProvider *ProviderStats
+	var bestScore float64 = -1
+
+	for _, ps := range candidates {
+		score := ps.score()
+		if bestScore < 0 || score > bestScore {
+			bestScore = score
+			bestProvider = ps
+		}
+	}
+
+	return bestProvider
+}
+
+// RoundRobinStrategy rotates through the candidates in order, spreading
+// requests evenly across providers
+type RoundRobinStrategy struct {
+	next atomic.Uint64
+}
+
+func (s *RoundRobinStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	n := s.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+// RandomStrategy picks a candidate uniformly at random
+type RandomStrategy struct{}
+
+func (s *RandomStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// LeastLoadedStrategy picks the provider that has used the smallest share of
+// its rate limit
+type LeastLoadedStrategy struct{}
+
+func (s *LeastLoadedStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	var bestProvider *ProviderStats
+	var bestLoad float64
+
+	for _, ps := range candidates {
+		ps.mutex.RLock()
+		load := 1.0 - fractionLeft(ps.limiter, time.Now())
+		ps.mutex.RUnlock()
+
+		if bestProvider == nil || load < bestLoad {
+			bestLoad = load
+			bestProvider = ps
+		}
+	}
+
+	return bestProvider
+}
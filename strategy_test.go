@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// servedBy looks up n distinct addresses and returns the provider that
+// answered each
+func servedBy(t *testing.T, b *Broker, n int) []string {
+	t.Helper()
+	names := make([]string, n)
+	for i := range names {
+		loc, err := b.GetLocation(context.Background(), testIP(i))
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		names[i] = loc.Provider
+	}
+	return names
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	providers := []Provider{NewMockProvider("a", 0), NewMockProvider("b", 0), NewMockProvider("c", 0)}
+	b := NewBroker(providers, WithStrategy(&RoundRobinStrategy{}))
+	defer b.Close()
+
+	got := servedBy(t, b, 9)
+	want := []string{"a", "b", "c", "a", "b", "c", "a", "b", "c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLeastLoadedStrategy(t *testing.T) {
+	// b has the most headroom until it has used as large a share as a
+	b := NewBroker([]Provider{NewMockProvider("a", 10), NewMockProvider("b", 20)}, WithStrategy(&LeastLoadedStrategy{}))
+	defer b.Close()
+
+	counts := map[string]int{}
+	for _, name := range servedBy(t, b, 15) {
+		counts[name]++
+	}
+	if counts["a"] != 5 || counts["b"] != 10 {
+		t.Errorf("served %v, want a:5 b:10 in proportion to their limits", counts)
+	}
+}
+
+func TestRandomStrategy(t *testing.T) {
+	b := NewBroker([]Provider{NewMockProvider("a", 0), NewMockProvider("b", 0)}, WithStrategy(&RandomStrategy{}))
+	defer b.Close()
+
+	counts := map[string]int{}
+	for _, name := range servedBy(t, b, 200) {
+		counts[name]++
+	}
+	if counts["a"] < 50 || counts["b"] < 50 {
+		t.Errorf("served %v, want both used", counts)
+	}
+}
+
+// lastStrategy always picks the last candidate
+type lastStrategy struct{}
+
+func (lastStrategy) Select(candidates []*ProviderStats) *ProviderStats {
+	return candidates[len(candidates)-1]
+}
+
+func TestCustomStrategy(t *testing.T) {
+	a, c := NewMockProvider("a", 0), NewMockProvider("c", 1)
+	b := NewBroker([]Provider{a, NewMockProvider("b", 0), c}, WithStrategy(lastStrategy{}))
+	defer b.Close()
+
+	// Candidates are the providers with capacity, in registration order
+	got := servedBy(t, b, 3)
+	want := []string{"c", "b", "b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// selections counts which provider the broker would select for n lookups,
+// without making them
+func selections(b *Broker, n int) map[string]int {
+	counts := map[string]int{}
+	for i := range n {
+		counts[b.selectBestProvider(testIP(i)).provider.Name()]++
+	}
+	return counts
+}
+
+func TestColdStartNewProvider(t *testing.T) {
+	old := NewMockProvider("old", 0, MockLatency(5*time.Millisecond))
+	b := NewBroker([]Provider{old})
+	defer b.Close()
+	for i := range 10 {
+		if _, err := b.GetLocation(context.Background(), testIP(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unsampled, the new provider would look infinitely fast. Instead it
+	// gets the exploration share and no more.
+	fresh := NewMockProvider("new", 0)
+	b.AddProvider(fresh)
+	counts := selections(b, 2000)
+	if counts["new"] < 40 || counts["new"] > 200 {
+		t.Errorf("new provider selected %d of 2000 times, want about 5%%", counts["new"])
+	}
+
+	// Nor does it starve: explored until it has enough samples, the faster
+	// provider then wins on its merits
+	servedBy(t, b, 500)
+	if n := fresh.Calls(); n < 250 {
+		t.Errorf("new, faster provider served %d of 500 lookups", n)
+	}
+}
+
+func TestColdStartPriorLatency(t *testing.T) {
+	// With no history anywhere providers compete on the prior
+	b := NewBroker([]Provider{NewMockProvider("a", 0), NewMockProvider("b", 0)}, WithColdStart(5, 0, time.Second))
+	defer b.Close()
+	ps := b.providers[0]
+	if got, want := ps.score(), 1000.0/(float64(time.Second)+1); got != want {
+		t.Errorf("unsampled provider scores %v, want %v from the prior", got, want)
+	}
+}
+
+func TestColdStartBadProviderRecovers(t *testing.T) {
+	bad := NewMockProvider("bad", 0, MockFailCalls(1, 10, nil))
+	good := NewMockProvider("good", 0)
+	for _, tt := range []struct {
+		name    string
+		epsilon float64
+		min     int
+	}{
+		{"exploring", 0.1, 1},
+		{"greedy", 0, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bad.Reset()
+			b := NewBroker([]Provider{bad, good}, WithColdStart(5, tt.epsilon, 250*time.Millisecond))
+			defer b.Close()
+			for i := range 10 {
+				b.GetLocationFrom(context.Background(), "bad", testIP(i))
+				b.GetLocationFrom(context.Background(), "good", testIP(i))
+			}
+
+			counts := selections(b, 1000)
+			if counts["bad"] < tt.min || (tt.epsilon == 0 && counts["bad"] > 0) {
+				t.Errorf("bad provider selected %d of 1000 times with epsilon %v", counts["bad"], tt.epsilon)
+			}
+		})
+	}
+}
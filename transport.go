@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP client and connection pool providers use.
+// Zero fields take their value from DefaultTransportConfig.
+type TransportConfig struct {
+	// MaxIdleConns caps idle connections across all hosts and
+	// MaxIdleConnsPerHost those kept open to each provider. Busy providers
+	// need enough idle connections per host to avoid a TLS handshake on
+	// every lookup.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps all connections to one host, idle or not; zero
+	// means no cap
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an unused connection is kept open
+	IdleConnTimeout time.Duration
+	// DialTimeout and TLSHandshakeTimeout bound setting up a connection and
+	// KeepAlive is the TCP keep-alive period
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	KeepAlive           time.Duration
+	// ResponseHeaderTimeout bounds the wait for a response once the request
+	// is sent; zero means no bound beyond RequestTimeout
+	ResponseHeaderTimeout time.Duration
+	// RequestTimeout bounds a whole request, including reading the body
+	RequestTimeout time.Duration
+	// DisableHTTP2 keeps connections on HTTP/1.1
+	DisableHTTP2 bool
+}
+
+// DefaultTransportConfig is the tuning of the client HTTP-backed providers
+// share unless given their own
+var DefaultTransportConfig = TransportConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+	DialTimeout:         5 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+	KeepAlive:           30 * time.Second,
+	RequestTimeout:      10 * time.Second,
+}
+
+// defaultHTTPClient is shared by HTTP-backed providers unless they are given
+// their own with WithHTTPClient or WithTransportConfig. It keeps connections
+// to each provider open between lookups.
+var defaultHTTPClient = NewHTTPClient(DefaultTransportConfig)
+
+// SetDefaultTransport replaces the client shared by HTTP-backed providers
+// with one tuned by tc. Providers created earlier keep the old client, so
+// call it before creating any.
+func SetDefaultTransport(tc TransportConfig) {
+	defaultHTTPClient = NewHTTPClient(tc)
+}
+
+// withDefaults fills the zero fields of tc from DefaultTransportConfig
+func (tc TransportConfig) withDefaults() TransportConfig {
+	def := DefaultTransportConfig
+	if tc.MaxIdleConns == 0 {
+		tc.MaxIdleConns = def.MaxIdleConns
+	}
+	if tc.MaxIdleConnsPerHost == 0 {
+		tc.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	if tc.MaxConnsPerHost == 0 {
+		tc.MaxConnsPerHost = def.MaxConnsPerHost
+	}
+	if tc.IdleConnTimeout == 0 {
+		tc.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if tc.DialTimeout == 0 {
+		tc.DialTimeout = def.DialTimeout
+	}
+	if tc.TLSHandshakeTimeout == 0 {
+		tc.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+	if tc.KeepAlive == 0 {
+		tc.KeepAlive = def.KeepAlive
+	}
+	if tc.ResponseHeaderTimeout == 0 {
+		tc.ResponseHeaderTimeout = def.ResponseHeaderTimeout
+	}
+	if tc.RequestTimeout == 0 {
+		tc.RequestTimeout = def.RequestTimeout
+	}
+	return tc
+}
+
+// NewTransport builds an http.Transport tuned by tc
+func NewTransport(tc TransportConfig) *http.Transport {
+	tc = tc.withDefaults()
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: tc.DialTimeout, KeepAlive: tc.KeepAlive}).DialContext,
+		ForceAttemptHTTP2:     !tc.DisableHTTP2,
+		MaxIdleConns:          tc.MaxIdleConns,
+		MaxIdleConnsPerHost:   tc.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       tc.MaxConnsPerHost,
+		IdleConnTimeout:       tc.IdleConnTimeout,
+		TLSHandshakeTimeout:   tc.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tc.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if tc.DisableHTTP2 {
+		// A non-nil empty map is what turns HTTP/2 off
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
+
+// NewHTTPClient builds a client for providers using a transport tuned by tc
+func NewHTTPClient(tc TransportConfig) *http.Client {
+	return &http.Client{
+		Timeout:   tc.withDefaults().RequestTimeout,
+		Transport: NewTransport(tc),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	transport := NewTransport(TransportConfig{MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Second})
+	if transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Second {
+		t.Errorf("set fields: got %d idle per host for %v, want 4 for 1s", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+	// Zero fields take the defaults
+	def := DefaultTransportConfig
+	if transport.MaxIdleConns != def.MaxIdleConns || transport.TLSHandshakeTimeout != def.TLSHandshakeTimeout {
+		t.Errorf("zero fields: got %d idle, %v handshake timeout, want %d, %v",
+			transport.MaxIdleConns, transport.TLSHandshakeTimeout, def.MaxIdleConns, def.TLSHandshakeTimeout)
+	}
+	if !transport.ForceAttemptHTTP2 || transport.TLSNextProto != nil {
+		t.Error("HTTP/2 not attempted by default")
+	}
+
+	transport = NewTransport(TransportConfig{DisableHTTP2: true})
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil {
+		t.Error("HTTP/2 still enabled with DisableHTTP2")
+	}
+	if client := NewHTTPClient(TransportConfig{}); client.Timeout != def.RequestTimeout {
+		t.Errorf("client timeout %v, want %v", client.Timeout, def.RequestTimeout)
+	}
+}
+
+// handshakeCounter counts the connections a transport dials, each of which
+// costs a TLS handshake
+type handshakeCounter struct {
+	dials atomic.Int32
+}
+
+// wrap makes transport dial through c and trust server's certificate
+func (c *handshakeCounter) wrap(transport *http.Transport, server *httptest.Server) {
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c.dials.Add(1)
+		return dial(ctx, network, addr)
+	}
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+}
+
+func TestTransportConnectionReuse(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slow enough that a round's lookups overlap
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(`{"ip": "8.8.8.8", "country": "US"}`))
+	}))
+	defer s.Close()
+
+	const rounds, concurrency = 5, 16
+	handshakes := func(tc TransportConfig) int {
+		var counter handshakeCounter
+		client := NewHTTPClient(tc)
+		counter.wrap(client.Transport.(*http.Transport), s)
+		defer client.CloseIdleConnections()
+		p, err := NewIPInfoProvider(0, WithBaseURL(s.URL), WithHTTPClient(client))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range rounds {
+			var wg sync.WaitGroup
+			for i := range concurrency {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := p.GetLocation(context.Background(), testIP(i)); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+		}
+		return int(counter.dials.Load())
+	}
+
+	// Go's own default of two idle connections per host
+	before := handshakes(TransportConfig{MaxIdleConnsPerHost: 2})
+	after := handshakes(TransportConfig{MaxIdleConnsPerHost: concurrency})
+	t.Logf("%d lookups: %d handshakes with 2 idle connections per host, %d with %d", rounds*concurrency, before, after, concurrency)
+	if after > concurrency {
+		t.Errorf("%d handshakes with room for %d idle connections, want no more than one per concurrent lookup", after, concurrency)
+	}
+	if before < 2*after {
+		t.Errorf("%d handshakes with a small pool against %d with a tuned one, want the tuned pool to save most of them", before, after)
+	}
+}
+
+func TestWithTransportConfig(t *testing.T) {
+	p, err := NewIPInfoProvider(100, WithTransportConfig(TransportConfig{MaxIdleConnsPerHost: 64, RequestTimeout: time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := p.config.client
+	if client == defaultHTTPClient {
+		t.Fatal("provider still shares the default client")
+	}
+	if transport := client.Transport.(*http.Transport); transport.MaxIdleConnsPerHost != 64 || client.Timeout != time.Second {
+		t.Errorf("got %d idle per host and a %v timeout, want 64 and 1s", transport.MaxIdleConnsPerHost, client.Timeout)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Embed the zone database so time zones validate on hosts without one
+	_ "time/tzdata"
+)
+
+// ValidationRule checks a result a provider returned for ip. A non-nil error
+// rejects the result, which the broker then treats as a failure of that
+// provider and fails over, so junk never reaches callers or the cache.
+type ValidationRule func(ip string, loc *Location) error
+
+// DefaultValidationRules returns the rules the broker applies unless
+// configured otherwise with WithValidationRules: the result must have a
+// country, an IP the provider echoes back must be the one looked up, and
+// coordinates, if any, must be on the globe. Region and postal code are
+// never required, as many providers leave them out.
+func DefaultValidationRules() []ValidationRule {
+	return []ValidationRule{RequireCountry, RequireMatchingIP, ValidCoordinates}
+}
+
+// RequireCountry rejects results without a country
+func RequireCountry(ip string, loc *Location) error {
+	if loc.Country == "" {
+		return fmt.Errorf("no country for %s", ip)
+	}
+	return nil
+}
+
+// RequireMatchingIP rejects results whose IP differs from the looked up
+// address. Providers that don't echo the IP leave it empty, which passes.
+func RequireMatchingIP(ip string, loc *Location) error {
+	if loc.IP == "" {
+		return nil
+	}
+	echoed, err := parseIP(loc.IP)
+	if err != nil {
+		return fmt.Errorf("answered for %q instead of %s", loc.IP, ip)
+	}
+	if want, err := parseIP(ip); err == nil && echoed != want {
+		return fmt.Errorf("answered for %s instead of %s", echoed, ip)
+	}
+	return nil
+}
+
+// RequireCountryCode rejects results whose country couldn't be identified
+// by an ISO 3166-1 alpha-2 code, for providers that may answer with free
+// text
+func RequireCountryCode(ip string, loc *Location) error {
+	if loc.CountryCode == "" {
+		return fmt.Errorf("country %q for %s has no ISO 3166-1 alpha-2 code", loc.Country, ip)
+	}
+	return nil
+}
+
+// RequireCity rejects results without a city
+func RequireCity(ip string, loc *Location) error {
+	if loc.City == "" {
+		return fmt.Errorf("no city for %s", ip)
+	}
+	return nil
+}
+
+// ValidCoordinates rejects results with a latitude outside -90..90 or a
+// longitude outside -180..180. Results without coordinates pass.
+func ValidCoordinates(ip string, loc *Location) error {
+	if !loc.HasCoordinates {
+		return nil
+	}
+	if err := checkCoordinates(loc.Latitude, loc.Longitude); err != nil {
+		return fmt.Errorf("%w for %s", err, ip)
+	}
+	return nil
+}
+
+// checkCoordinates reports whether lat and lon are within range
+func checkCoordinates(lat, lon float64) error {
+	// Written so NaN fails too
+	if !(lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180) {
+		return fmt.Errorf("coordinates %g,%g out of range", lat, lon)
+	}
+	return nil
+}
+
+// sanitizeLocation tidies up the fields of a provider's result in place:
+// surrounding whitespace is trimmed, the country identified by its code and
+// given its English name, the continent derived from it when the provider
+// gave none and coordinates not flagged as present zeroed. A country that
+// can't be identified keeps the name the provider gave. A time zone that
+// isn't a known IANA name, such as "GMT+2", is dropped rather than
+// rejecting the result, and so is an ASN that isn't one.
+func sanitizeLocation(loc *Location) {
+	loc.IP = strings.TrimSpace(loc.IP)
+	loc.Country = strings.TrimSpace(loc.Country)
+	code, ok := NormalizeCountryCode(loc.CountryCode)
+	if !ok {
+		code, ok = NormalizeCountryCode(loc.Country)
+	}
+	if ok {
+		// User-assigned codes have no name of their own
+		loc.Country = cmp.Or(CountryName(code), loc.Country, code)
+		loc.CountryCode = code
+	} else {
+		loc.CountryCode = ""
+	}
+	loc.ContinentCode = strings.ToUpper(strings.TrimSpace(loc.ContinentCode))
+	if _, ok := continents[loc.ContinentCode]; !ok {
+		loc.ContinentCode, _ = ContinentOf(loc.CountryCode)
+	}
+	loc.Continent = continents[loc.ContinentCode]
+	loc.City = strings.TrimSpace(loc.City)
+	loc.Region = strings.TrimSpace(loc.Region)
+	loc.PostalCode = strings.TrimSpace(loc.PostalCode)
+	loc.Timezone = strings.TrimSpace(loc.Timezone)
+	if loc.Timezone != "" && !validTimezone(loc.Timezone) {
+		loc.Timezone = ""
+	}
+	loc.ASN = normalizeASN(loc.ASN)
+	loc.ISP = strings.TrimSpace(loc.ISP)
+	loc.Org = strings.TrimSpace(loc.Org)
+	if !loc.HasCoordinates {
+		loc.Latitude, loc.Longitude = 0, 0
+	}
+}
+
+// validate sanitizes loc and checks it against the broker's rules. The
+// caller names the provider, as with any upstream error. It
+// returns an error matching ErrBadProviderData for a result that fails any
+// rule, including a nil result without an error.
+func (b *Broker) validate(ip string, loc *Location) error {
+	if loc == nil {
+		return fmt.Errorf("%w: no result for %s", ErrBadProviderData, ip)
+	}
+	sanitizeLocation(loc)
+	for _, rule := range b.validationRules {
+		if err := rule(ip, loc); err != nil {
+			return fmt.Errorf("%w: %w", ErrBadProviderData, err)
+		}
+	}
+	return nil
+}
+
+// knownTimezones remembers the names time.LoadLocation accepted, as it
+// reads the zone database on every call. Only valid names are kept, so
+// garbage from providers can't grow it.
+var knownTimezones sync.Map
+
+// validTimezone reports whether name is an IANA time zone name
+func validTimezone(name string) bool {
+	if _, ok := knownTimezones.Load(name); ok {
+		return true
+	}
+	// "Local" would be the server's zone, not the address's
+	if name == "Local" {
+		return false
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return false
+	}
+	knownTimezones.Store(name, struct{}{})
+	return true
+}
+
+// splitASN splits a combined "AS15169 Google LLC" into the ASN and the
+// name. Without a leading ASN, all of s is the name.
+func splitASN(s string) (asn, name string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	if asn = normalizeASN(first); asn == "" {
+		return "", s
+	}
+	return asn, rest
+}
+
+// normalizeASN turns the forms providers report an autonomous system number
+// in, such as "15169", "as15169" or "AS15169 Google LLC", into "AS15169". It
+// returns "" for anything else.
+func normalizeASN(asn string) string {
+	asn, _, _ = strings.Cut(strings.TrimSpace(asn), " ")
+	if len(asn) >= 2 && strings.EqualFold(asn[:2], "AS") {
+		asn = asn[2:]
+	}
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil || n == 0 {
+		return ""
+	}
+	return "AS" + strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		has      bool
+		valid    bool
+	}{
+		{"mountain view", 37.3861, -122.0839, true, true},
+		{"poles and date line", -90, 180, true, true},
+		{"null island", 0, 0, true, true},
+		{"latitude too far north", 90.5, 0, true, false},
+		{"latitude too far south", -91, 0, true, false},
+		{"longitude too far east", 0, 180.1, true, false},
+		{"longitude too far west", 0, -200, true, false},
+		{"NaN", math.NaN(), 0, true, false},
+		// Not reported, so not checked
+		{"absent", 999, 999, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := &Location{Country: "US", Latitude: tt.lat, Longitude: tt.lon, HasCoordinates: tt.has}
+			if err := ValidCoordinates("8.8.8.8", loc); (err == nil) != tt.valid {
+				t.Errorf("got %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBrokerRejectsBadCoordinates(t *testing.T) {
+	offGlobe := NewMockProvider("off-globe", 0, MockResponse("8.8.8.8", Location{Country: "US", Latitude: 122.08, Longitude: 37.39, HasCoordinates: true}))
+	good := NewMockProvider("good", 0, MockResponse("8.8.8.8", MockCities["Mountain View"]))
+	b := NewBroker([]Provider{offGlobe, good}, WithProviderTier("good", 1))
+	defer b.Close()
+
+	loc, err := b.GetLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "good" || loc.Latitude != 37.3861 || loc.Longitude != -122.0839 {
+		t.Errorf("got %s at %v,%v, want the good provider's coordinates", loc.Provider, loc.Latitude, loc.Longitude)
+	}
+
+	only := NewBroker([]Provider{offGlobe})
+	defer only.Close()
+	if _, err := only.GetLocation(context.Background(), "8.8.8.8"); !errors.Is(err, ErrBadProviderData) {
+		t.Errorf("got %v, want ErrBadProviderData", err)
+	}
+}
+
+func TestSanitizeLocationCoordinates(t *testing.T) {
+	// Stray values without the flag don't reach callers
+	loc := &Location{Country: "US", Latitude: 37.4, Longitude: -122.1}
+	sanitizeLocation(loc)
+	if loc.Latitude != 0 || loc.Longitude != 0 {
+		t.Errorf("got %v,%v without HasCoordinates, want 0,0", loc.Latitude, loc.Longitude)
+	}
+}
+
+func TestMockCities(t *testing.T) {
+	for city, loc := range MockCities {
+		if !loc.HasCoordinates || loc.City != city {
+			t.Errorf("%s: %+v, want the city with coordinates", city, loc)
+		}
+		if err := ValidCoordinates(city, &loc); err != nil {
+			t.Errorf("%s: %v", city, err)
+		}
+	}
+}
+
+func TestSanitizeLocationCountry(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Location
+		want Location
+	}{
+		{
+			"name only",
+			Location{Country: "United States of America"},
+			Location{Country: "United States", CountryCode: "US", ContinentCode: "NA", Continent: "North America"},
+		},
+		{
+			"lower-case code",
+			Location{Country: "Germany", CountryCode: "de"},
+			Location{Country: "Germany", CountryCode: "DE", ContinentCode: "EU", Continent: "Europe"},
+		},
+		{
+			"code in the name field",
+			Location{Country: " JP "},
+			Location{Country: "Japan", CountryCode: "JP", ContinentCode: "AS", Continent: "Asia"},
+		},
+		{
+			"provider's continent kept",
+			Location{Country: "Russia", ContinentCode: "as"},
+			Location{Country: "Russian Federation", CountryCode: "RU", ContinentCode: "AS", Continent: "Asia"},
+		},
+		{
+			"bogus continent replaced",
+			Location{Country: "France", ContinentCode: "XX"},
+			Location{Country: "France", CountryCode: "FR", ContinentCode: "EU", Continent: "Europe"},
+		},
+		{
+			"unidentified country",
+			Location{Country: "Atlantis", CountryCode: "ATL"},
+			Location{Country: "Atlantis"},
+		},
+		{
+			"user-assigned code",
+			Location{CountryCode: "zz"},
+			Location{Country: "ZZ", CountryCode: "ZZ"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in
+			sanitizeLocation(&got)
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
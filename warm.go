@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// WarmOption configures a WarmCache load
+type WarmOption func(*warmOptions)
+
+type warmOptions struct {
+	ttl time.Duration
+}
+
+// WarmTTL keeps the loaded entries fresh for ttl instead of the cache's
+// TTL, even when a CacheTTLFunc would not cache them. Zero or less keeps
+// the cache's TTL.
+func WarmTTL(ttl time.Duration) WarmOption {
+	return func(o *warmOptions) {
+		o.ttl = max(ttl, 0)
+	}
+}
+
+// WarmCache bulk-loads known results into the broker's cache so they are
+// served without a provider round-trip. Each line of r is either a JSON
+// Location or a CSV record of ip,country,city; blank lines and lines
+// starting with # are ignored. Entries use the cache's configured TTL
+// unless WarmTTL gives another. Malformed lines are skipped and counted
+// rather than aborting the load. It returns ErrCacheDisabled if the broker
+// has no cache.
+func (b *Broker) WarmCache(ctx context.Context, r io.Reader, opts ...WarmOption) (loaded, skipped int, err error) {
+	if b.cache == nil {
+		return 0, 0, ErrCacheDisabled
+	}
+	var wo warmOptions
+	for _, opt := range opts {
+		opt(&wo)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return loaded, skipped, err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		loc, ok := parseSeedLine(line)
+		if !ok {
+			skipped++
+			continue
+		}
+		if loc.Confidence == 0 {
+			loc.Confidence = b.confidence.Static
+		}
+		loc.ttl = wo.ttl
+		b.cacheSet(ctx, b.cacheKey(netip.MustParseAddr(loc.IP)), loc)
+		loaded++
+	}
+	return loaded, skipped, scanner.Err()
+}
+
+// WarmCacheFile loads the seed file at path with WarmCache
+func (b *Broker) WarmCacheFile(ctx context.Context, path string, opts ...WarmOption) (loaded, skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return b.WarmCache(ctx, f, opts...)
+}
+
+// parseSeedLine parses a single seed record, normalizing its IP
+func parseSeedLine(line string) (*Location, bool) {
+	var loc Location
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), &loc); err != nil {
+			return nil, false
+		}
+	} else {
+		fields, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil || len(fields) != 3 {
+			return nil, false
+		}
+		loc = Location{
+			IP:      strings.TrimSpace(fields[0]),
+			Country: strings.TrimSpace(fields[1]),
+			City:    strings.TrimSpace(fields[2]),
+		}
+	}
+
+	addr, err := parseIP(loc.IP)
+	if err != nil || loc.Country == "" {
+		return nil, false
+	}
+	loc.IP = addr.String()
+	if loc.Provider == "" {
+		loc.Provider = "seed"
+	}
+	return &loc, true
+}
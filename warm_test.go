@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSeed = `# known addresses
+8.8.8.8,US,Mountain View
+{"ip":"1.1.1.1","country":"AU","city":"Sydney","confidence":80}
+
+::ffff:9.9.9.9,"CH","Zurich"
+not an ip,US,Nowhere
+8.8.4.4,US
+{"ip":"1.0.0.1",
+`
+
+func TestWarmCache(t *testing.T) {
+	p := NewMockProvider("mock", 100)
+	b := NewBroker([]Provider{p}, WithCache(100, time.Hour))
+	defer b.Close()
+
+	ctx := context.Background()
+	loaded, skipped, err := b.WarmCache(ctx, strings.NewReader(testSeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 3 || skipped != 3 {
+		t.Errorf("loaded %d, skipped %d; want 3, 3", loaded, skipped)
+	}
+
+	tests := []struct {
+		ip, country, city string
+		confidence        int
+	}{
+		{"8.8.8.8", "US", "Mountain View", DefaultConfidenceRules.Static},
+		{"1.1.1.1", "AU", "Sydney", 80},
+		{"9.9.9.9", "CH", "Zurich", DefaultConfidenceRules.Static},
+	}
+	for _, tt := range tests {
+		loc, err := b.GetLocation(ctx, tt.ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loc.FromCache || loc.Provider != "seed" {
+			t.Errorf("%s: FromCache %v, Provider %q; want a seeded cache hit", tt.ip, loc.FromCache, loc.Provider)
+		}
+		if loc.Country != tt.country || loc.City != tt.city || loc.Confidence != tt.confidence {
+			t.Errorf("%s: got %s/%s confidence %d, want %s/%s confidence %d", tt.ip, loc.Country, loc.City, loc.Confidence, tt.country, tt.city, tt.confidence)
+		}
+	}
+	if got := p.Calls(); got != 0 {
+		t.Errorf("provider called %d times for seeded addresses", got)
+	}
+}
+
+func TestWarmCacheTTL(t *testing.T) {
+	b := NewBroker([]Provider{NewMockProvider("mock", 100)},
+		WithCache(100, time.Hour),
+		WithCacheTTLFunc(func(*Location) time.Duration { return 0 }),
+	)
+	defer b.Close()
+
+	ctx := context.Background()
+	if _, _, err := b.WarmCache(ctx, strings.NewReader("8.8.8.8,US,Mountain View\n"), WarmTTL(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok, err := b.cache.Get(ctx, b.cacheKey(mustParseIP(t, "8.8.8.8")))
+	if err != nil || !ok {
+		t.Fatalf("seeded entry missing: %v", err)
+	}
+
+	for _, tt := range []struct {
+		age          time.Duration
+		fresh, stale bool
+	}{
+		{time.Hour, true, false},
+		{47 * time.Hour, true, false},
+		{49 * time.Hour, false, false},
+	} {
+		fresh, stale := b.freshness(entry, entry.CachedAt.Add(tt.age))
+		if fresh != tt.fresh || stale != tt.stale {
+			t.Errorf("after %v: fresh %v, stale %v; want %v, %v", tt.age, fresh, stale, tt.fresh, tt.stale)
+		}
+	}
+
+	// The TTL survives the caches that store entries as JSON
+	data, err := entry.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Location
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ttl != 48*time.Hour {
+		t.Errorf("decoded TTL %v, want 48h", decoded.ttl)
+	}
+
+	loc, err := b.GetLocation(ctx, "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loc.FromCache {
+		t.Error("seeded entry wasn't served from the cache")
+	}
+	if loc.ttl != 0 {
+		t.Error("served result still carries the entry's TTL")
+	}
+}
+
+func TestWarmCacheWithoutCache(t *testing.T) {
+	b := NewBroker([]Provider{NewMockProvider("mock", 100)})
+	defer b.Close()
+
+	_, _, err := b.WarmCache(context.Background(), strings.NewReader(testSeed))
+	if !errors.Is(err, ErrCacheDisabled) {
+		t.Errorf("got %v, want ErrCacheDisabled", err)
+	}
+}
+
+func mustParseIP(t *testing.T, ip string) netip.Addr {
+	t.Helper()
+	addr, err := parseIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}